@@ -1,16 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"mime"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
 	"time"
 )
 
@@ -116,12 +122,13 @@ func corsMiddleware(next http.Handler) http.Handler {
 
 		// Set CORS headers
 		crw.Header().Set("Access-Control-Allow-Origin", "*")
-		crw.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		crw.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-ID, X-Username")
+		crw.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		crw.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-ID, X-Username, X-Invoke-Timeout")
 		crw.Header().Set("Access-Control-Expose-Headers", "X-User-ID, X-Username")
 
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
+			setAllowHeader(crw, r)
 			crw.WriteHeader(http.StatusOK)
 			return
 		}
@@ -131,6 +138,52 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// invocationMethods are the HTTP methods functions can be invoked with. They match the
+// function controller's invoke routes, which invocations are forwarded to.
+var invocationMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// allowedMethods returns the HTTP methods supported by a gateway route
+func allowedMethods(path string) []string {
+	switch {
+	case path == "/health", path == "/list":
+		return []string{http.MethodGet}
+	case path == "/register":
+		return []string{http.MethodPost}
+	case strings.HasPrefix(path, "/function/"):
+		// Management operations are forwarded to the controller, everything else is an invocation
+		subPath := strings.TrimPrefix(path, "/function/")
+		switch {
+		case strings.HasPrefix(subPath, "register"), strings.HasPrefix(subPath, "start/"), strings.HasPrefix(subPath, "stop/"):
+			return []string{http.MethodPost}
+		case strings.HasPrefix(subPath, "delete/"):
+			return []string{http.MethodDelete}
+		case strings.HasPrefix(subPath, "list"):
+			return []string{http.MethodGet}
+		}
+		return invocationMethods
+	}
+	return nil
+}
+
+// withOptions returns methods along with OPTIONS, which every route accepts for CORS
+// preflight requests
+func withOptions(methods []string) []string {
+	return append(append([]string(nil), methods...), http.MethodOptions)
+}
+
+// setAllowHeader advertises the methods supported by the requested route
+func setAllowHeader(w http.ResponseWriter, r *http.Request) {
+	if methods := allowedMethods(r.URL.Path); len(methods) > 0 {
+		w.Header().Set("Allow", strings.Join(withOptions(methods), ", "))
+	}
+}
+
+// methodNotAllowed writes a 405 response including the route's Allow header
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	setAllowHeader(w, r)
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
+
 // Custom response writer that ensures we don't have duplicate CORS headers
 type corsResponseWriter struct {
 	http.ResponseWriter
@@ -169,12 +222,316 @@ func (crw *corsResponseWriter) cleanupHeaders(header string) {
 
 // Function metadata for routing
 type Function struct {
-	Name     string `json:"name"`
-	Endpoint string `json:"endpoint"`
+	Name      string         `json:"name"`
+	Endpoint  string         `json:"endpoint"`
+	Transform *BodyTransform `json:"transform,omitempty"` // Optional rewrite of invocation request bodies
+	Timeout   *int           `json:"timeout,omitempty"`   // Seconds the route's invocations may take, the function's own timeout when unset
 }
 
 // In-memory function registry for MVP
-var functions = map[string]Function{}
+var (
+	functions      = map[string]Function{}
+	functionsMutex sync.RWMutex
+)
+
+// Header clients use to override the invocation timeout of a single request, in seconds
+const invokeTimeoutHeader = "X-Invoke-Timeout"
+
+// Time the gateway waits beyond an invocation's timeout, so the function proxy, which
+// applies the same timeout, reports a timed out function rather than the gateway
+const gatewayTimeoutMargin = 5 * time.Second
+
+// coldStartWaitTimeout is how long the function controller may wait for a stopped function to
+// start before its invocation timeout begins, configured with COLD_START_WAIT_TIMEOUT like
+// the controller. The gateway waits for it on top of the invocation's timeout.
+var coldStartWaitTimeout = 60 * time.Second
+
+// maxInvokeTimeout is the largest timeout a route or request may set, configured with
+// MAX_INVOKE_TIMEOUT like the rest of the platform. Invocations without a timeout of their
+// own wait up to it, leaving the function proxy to apply the function's configured timeout.
+var maxInvokeTimeout = 300 * time.Second
+
+func init() {
+	if value := os.Getenv("MAX_INVOKE_TIMEOUT"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			maxInvokeTimeout = time.Duration(seconds) * time.Second
+		} else {
+			log.Printf("Invalid MAX_INVOKE_TIMEOUT %q, using default %s", value, maxInvokeTimeout)
+		}
+	}
+	if value := os.Getenv("COLD_START_WAIT_TIMEOUT"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			coldStartWaitTimeout = parsed
+		} else {
+			log.Printf("Invalid COLD_START_WAIT_TIMEOUT %q, using default %s", value, coldStartWaitTimeout)
+		}
+	}
+}
+
+// gatewayWaitTimeout returns how long the gateway waits for the response to an invocation
+// with a timeout, 0 meaning the function's own. A stopped function is started by the
+// controller before the timeout begins, so a longer timeout is allowed for cold starts.
+func gatewayWaitTimeout(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		timeout = maxInvokeTimeout
+	}
+	return coldStartWaitTimeout + timeout + gatewayTimeoutMargin
+}
+
+// validateRouteTimeout checks the timeout a function's route is registered with
+func validateRouteTimeout(function Function) error {
+	if function.Timeout == nil {
+		return nil
+	}
+	if *function.Timeout <= 0 {
+		return fmt.Errorf("timeout must be a positive number of seconds")
+	}
+	if time.Duration(*function.Timeout)*time.Second > maxInvokeTimeout {
+		return fmt.Errorf("timeout of %ds exceeds the platform maximum of %ds", *function.Timeout, int(maxInvokeTimeout.Seconds()))
+	}
+	return nil
+}
+
+// invokeTimeout returns the timeout of an invocation: the X-Invoke-Timeout header if set,
+// else the route's timeout, which is passed on in the header so the function proxy
+// applies it too. Zero means the function's own timeout applies.
+func invokeTimeout(r *http.Request, function Function, registered bool) (time.Duration, error) {
+	if value := r.Header.Get(invokeTimeoutHeader); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds <= 0 {
+			return 0, fmt.Errorf("invalid %s '%s', expected a positive number of seconds", invokeTimeoutHeader, value)
+		}
+		timeout := time.Duration(seconds) * time.Second
+		if timeout > maxInvokeTimeout {
+			return 0, fmt.Errorf("%s of %ds exceeds the platform maximum of %ds",
+				invokeTimeoutHeader, seconds, int(maxInvokeTimeout.Seconds()))
+		}
+		return timeout, nil
+	}
+
+	if registered && function.Timeout != nil {
+		r.Header.Set(invokeTimeoutHeader, strconv.Itoa(*function.Timeout))
+		return time.Duration(*function.Timeout) * time.Second, nil
+	}
+	return 0, nil
+}
+
+// Largest request body the gateway will transform
+const maxTransformBodySize = 10 << 20
+
+// BodyTransform rewrites a request body before it is forwarded to a function, e.g. to
+// adapt a webhook payload to the function's input. Either Template or Fields is set.
+type BodyTransform struct {
+	// Template is a text/template rendered with a TransformInput
+	Template string `json:"template,omitempty"`
+	// Fields builds a JSON object by mapping output fields (dotted for nesting) to sources:
+	// body.<path>, header.<name>, query.<name>, request.<method|path|user_id|received_at>,
+	// or a literal value prefixed with "="
+	Fields map[string]string `json:"fields,omitempty"`
+	// ContentType of the transformed body (default application/json)
+	ContentType string `json:"content_type,omitempty"`
+
+	tmpl *template.Template
+}
+
+// TransformInput is the data available to body transformations
+type TransformInput struct {
+	Body       interface{}       // Decoded JSON body, or nil when the body isn't JSON
+	RawBody    string            // Original body
+	Method     string
+	Path       string
+	Query      map[string]string
+	Headers    map[string]string
+	UserID     string
+	ReceivedAt string // RFC 3339 time the gateway received the request
+}
+
+// Functions available in transformation templates
+var transformFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// compile validates the transformation and prepares its template
+func (t *BodyTransform) compile() error {
+	if (t.Template == "") == (len(t.Fields) == 0) {
+		return fmt.Errorf("transform must set exactly one of template or fields")
+	}
+
+	if t.Template != "" {
+		tmpl, err := template.New("transform").Funcs(transformFuncs).Option("missingkey=zero").Parse(t.Template)
+		if err != nil {
+			return fmt.Errorf("invalid transform template: %v", err)
+		}
+		t.tmpl = tmpl
+		return nil
+	}
+
+	for field, source := range t.Fields {
+		if field == "" {
+			return fmt.Errorf("transform field names must not be empty")
+		}
+		if strings.HasPrefix(source, "=") {
+			continue
+		}
+		kind := strings.SplitN(source, ".", 2)[0]
+		if kind != "body" && kind != "header" && kind != "query" && kind != "request" {
+			return fmt.Errorf("invalid source '%s' for field '%s'", source, field)
+		}
+	}
+	return nil
+}
+
+// newTransformInput collects the request data available to transformations
+func newTransformInput(r *http.Request, body []byte) TransformInput {
+	input := TransformInput{
+		RawBody:    string(body),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Query:      make(map[string]string),
+		Headers:    make(map[string]string),
+		UserID:     r.Header.Get("X-User-ID"),
+		ReceivedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	for key := range r.URL.Query() {
+		input.Query[key] = r.URL.Query().Get(key)
+	}
+	for key := range r.Header {
+		input.Headers[key] = r.Header.Get(key)
+	}
+	if len(body) > 0 {
+		var decoded interface{}
+		if err := json.Unmarshal(body, &decoded); err == nil {
+			input.Body = decoded
+		}
+	}
+	return input
+}
+
+// lookupPath resolves a dotted path in a decoded JSON value
+func lookupPath(value interface{}, path string) interface{} {
+	if path == "" {
+		return value
+	}
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
+
+// resolveSource returns the value of a field mapping source
+func resolveSource(input TransformInput, source string) interface{} {
+	if strings.HasPrefix(source, "=") {
+		return strings.TrimPrefix(source, "=")
+	}
+
+	parts := strings.SplitN(source, ".", 2)
+	name := ""
+	if len(parts) == 2 {
+		name = parts[1]
+	}
+	switch parts[0] {
+	case "body":
+		return lookupPath(input.Body, name)
+	case "header":
+		return input.Headers[http.CanonicalHeaderKey(name)]
+	case "query":
+		return input.Query[name]
+	case "request":
+		switch name {
+		case "method":
+			return input.Method
+		case "path":
+			return input.Path
+		case "user_id":
+			return input.UserID
+		case "received_at":
+			return input.ReceivedAt
+		}
+	}
+	return nil
+}
+
+// Apply transforms a request body. It doesn't touch the request, so it can be used in isolation.
+func (t *BodyTransform) Apply(input TransformInput) ([]byte, error) {
+	if t.tmpl != nil {
+		var output bytes.Buffer
+		if err := t.tmpl.Execute(&output, input); err != nil {
+			return nil, err
+		}
+		return output.Bytes(), nil
+	}
+
+	result := make(map[string]interface{})
+	for field, source := range t.Fields {
+		// Dotted field names create nested objects
+		keys := strings.Split(field, ".")
+		object := result
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := object[key].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				object[key] = child
+			}
+			object = child
+		}
+		object[keys[len(keys)-1]] = resolveSource(input, source)
+	}
+	return json.Marshal(result)
+}
+
+// isTransformableBody reports whether a request body is text a transformation can read.
+// Binary bodies such as images, protobuf or compressed payloads are forwarded untouched.
+func isTransformableBody(r *http.Request) bool {
+	if encoding := r.Header.Get("Content-Encoding"); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return false
+	}
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+json") ||
+		mediaType == "application/x-www-form-urlencoded"
+}
+
+// transformRequestBody replaces the request body with its transformed version
+func transformRequestBody(r *http.Request, transform *BodyTransform) error {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, maxTransformBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %v", err)
+	}
+	if len(body) > maxTransformBodySize {
+		return fmt.Errorf("request body exceeds %d bytes", maxTransformBodySize)
+	}
+
+	transformed, err := transform.Apply(newTransformInput(r, body))
+	if err != nil {
+		return err
+	}
+
+	contentType := transform.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(transformed))
+	r.ContentLength = int64(len(transformed))
+	r.Header.Set("Content-Length", fmt.Sprintf("%d", len(transformed)))
+	r.Header.Set("Content-Type", contentType)
+	return nil
+}
 
 // Controller endpoint for function invocation
 var controllerEndpoint = "http://function-controller:8081"
@@ -182,28 +539,77 @@ var controllerEndpoint = "http://function-controller:8081"
 // Proxy endpoint for direct function access (used for health checks)
 var proxyEndpoint = "http://function-proxy:8090"
 
-// checkServiceHealth checks if a service is healthy
-func checkServiceHealth(healthEndpoint string) string {
+// HealthCheck is a platform component probed by the /health endpoint
+type HealthCheck struct {
+	Name string
+	URL  string
+}
+
+// ComponentHealth is the result of probing a platform component
+type ComponentHealth struct {
+	Status    string `json:"status"` // healthy, degraded or unhealthy
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Platform components probed by /health, configurable with HEALTH_CHECKS="name=url,name=url"
+var healthChecks = []HealthCheck{
+	{Name: "function_controller", URL: controllerEndpoint + "/health"},
+	{Name: "function_proxy", URL: proxyEndpoint + "/health"},
+	{Name: "project_orchestrator", URL: "http://project-orchestrator:8085/health"},
+	{Name: "auth_service", URL: "http://auth-service:8084/health"},
+	{Name: "metadata_service", URL: "http://metadata-service:8083/health"},
+	{Name: "builder", URL: "http://builder:8082/health"},
+	{Name: "registry", URL: "http://registry:5000/v2/"},
+	{Name: "nginx", URL: "http://nginx:80/"},
+}
+
+func init() {
+	value := os.Getenv("HEALTH_CHECKS")
+	if value == "" {
+		return
+	}
+
+	var checks []HealthCheck
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			log.Printf("Ignoring invalid HEALTH_CHECKS entry %q, expected name=url", entry)
+			continue
+		}
+		checks = append(checks, HealthCheck{Name: parts[0], URL: parts[1]})
+	}
+	healthChecks = checks
+}
+
+// checkServiceHealth checks if a service is healthy and measures how long it took to answer
+func checkServiceHealth(healthEndpoint string) ComponentHealth {
 	// Create a client with a short timeout
 	client := &http.Client{
 		Timeout: 2 * time.Second,
 	}
 	
 	// Make request to health endpoint
+	start := time.Now()
 	resp, err := client.Get(healthEndpoint)
+	latency := time.Since(start).Milliseconds()
 	if err != nil {
 		log.Printf("Health check failed for %s: %v", healthEndpoint, err)
-		return "unhealthy"
+		return ComponentHealth{Status: "unhealthy", LatencyMs: latency, Error: err.Error()}
 	}
 	defer resp.Body.Close()
 	
 	// Check response status
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("Health check returned non-200 status for %s: %d", healthEndpoint, resp.StatusCode)
-		return "degraded"
+		return ComponentHealth{
+			Status:    "degraded",
+			LatencyMs: latency,
+			Error:     fmt.Sprintf("status %d", resp.StatusCode),
+		}
 	}
 	
-	return "healthy"
+	return ComponentHealth{Status: "healthy", LatencyMs: latency}
 }
 
 func main() {
@@ -221,6 +627,28 @@ func main() {
 		// Log the request
 		log.Printf("Forwarding request to function: %s via proxy", functionName)
 
+		// Apply the function's body transformation, if it has one
+		functionsMutex.RLock()
+		function, registered := functions[functionName]
+		functionsMutex.RUnlock()
+		if registered && function.Transform != nil {
+			if !isTransformableBody(r) {
+				log.Printf("Forwarding binary %s body to function %s untransformed", r.Header.Get("Content-Type"), functionName)
+			} else if err := transformRequestBody(r, function.Transform); err != nil {
+				log.Printf("Error transforming request body for function %s: %v", functionName, err)
+				http.Error(w, fmt.Sprintf("Failed to transform request body: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Apply the request's or route's timeout, otherwise the function's own
+		timeout, err := invokeTimeout(r, function, registered)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		waitTimeout := gatewayWaitTimeout(timeout)
+
 		// Forward request to function proxy
 		targetURL, _ := url.Parse(endpoint)
 		proxy := httputil.NewSingleHostReverseProxy(targetURL)
@@ -240,14 +668,28 @@ func main() {
 			log.Printf("Forwarding user ID: %s for function: %s", userID, functionName)
 		}
 
-		// Set a longer timeout for the proxy to handle cold starts
+		// Wait for the function's response for as long as its invocation may take
 		proxy.Transport = &http.Transport{
-			ResponseHeaderTimeout: 30 * time.Second,
+			ResponseHeaderTimeout: waitTimeout,
 			ExpectContinueTimeout: 1 * time.Second,
 			DialContext: (&net.Dialer{
 				Timeout:   30 * time.Second,
 				KeepAlive: 30 * time.Second,
 			}).DialContext,
+			DisableCompression: true,
+		}
+		// Flush every write so streamed function responses reach the client in real time
+		proxy.FlushInterval = -1
+
+		// Report a function that didn't respond in time as a gateway timeout
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			if os.IsTimeout(err) {
+				log.Printf("Function %s did not respond within %s", functionName, waitTimeout)
+				http.Error(w, fmt.Sprintf("Function '%s' did not respond within the gateway timeout of %s", functionName, waitTimeout), http.StatusGatewayTimeout)
+				return
+			}
+			log.Printf("Error forwarding request to function %s: %v", functionName, err)
+			http.Error(w, fmt.Sprintf("Error reaching function '%s': %v", functionName, err), http.StatusBadGateway)
 		}
 
 		proxy.ServeHTTP(w, r)
@@ -256,7 +698,7 @@ func main() {
 	// Register function endpoint
 	registerHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			methodNotAllowed(w, r)
 			return
 		}
 
@@ -266,9 +708,23 @@ func main() {
 			return
 		}
 
+		// Validate the route's timeout and body transformation
+		if err := validateRouteTimeout(function); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if function.Transform != nil {
+			if err := function.Transform.compile(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
 		// Store function in registry with controller endpoint
 		function.Endpoint = controllerEndpoint
+		functionsMutex.Lock()
 		functions[function.Name] = function
+		functionsMutex.Unlock()
 		
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
@@ -279,6 +735,9 @@ func main() {
 
 	// List registered functions
 	listHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		functionsMutex.RLock()
+		defer functionsMutex.RUnlock()
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(functions)
 	})
@@ -331,28 +790,37 @@ func main() {
 
 	// Enhanced health check endpoint (no auth required)
 	mux.Handle("/health", corsMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Check controller health
-		controllerHealth := checkServiceHealth(controllerEndpoint + "/health")
+		// Probe all platform components concurrently
+		results := make([]ComponentHealth, len(healthChecks))
+		var wg sync.WaitGroup
+		for i, check := range healthChecks {
+			wg.Add(1)
+			go func(i int, check HealthCheck) {
+				defer wg.Done()
+				results[i] = checkServiceHealth(check.URL)
+			}(i, check)
+		}
+		wg.Wait()
 		
-		// Check proxy health
-		proxyHealth := checkServiceHealth(proxyEndpoint + "/health")
+		services := map[string]ComponentHealth{
+			"api_gateway": {Status: "healthy"},
+		}
+		overall := "healthy"
+		for i, check := range healthChecks {
+			services[check.Name] = results[i]
+			// If any service is unhealthy, mark overall status as degraded
+			if results[i].Status != "healthy" {
+				overall = "degraded"
+			}
+		}
 		
 		// Prepare response
 		response := map[string]interface{}{
-			"status": "healthy",
-			"services": map[string]interface{}{
-				"api_gateway": "healthy",
-				"function_controller": controllerHealth,
-				"function_proxy": proxyHealth,
-			},
+			"status":    overall,
+			"services":  services,
 			"timestamp": fmt.Sprintf("%d", time.Now().Unix()),
 		}
 		
-		// If any service is unhealthy, mark overall status as degraded
-		if controllerHealth != "healthy" || proxyHealth != "healthy" {
-			response["status"] = "degraded"
-		}
-		
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 	})))
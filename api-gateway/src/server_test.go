@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsTransformableBody(t *testing.T) {
+	tests := []struct {
+		contentType string
+		encoding    string
+		want        bool
+	}{
+		{"", "", true},
+		{"application/json", "", true},
+		{"application/json; charset=utf-8", "", true},
+		{"application/vnd.api+json", "", true},
+		{"text/plain", "", true},
+		{"application/x-www-form-urlencoded", "", true},
+		{"application/json", "identity", true},
+		{"application/json", "gzip", false},
+		{"text/plain", "br", false},
+		{"application/octet-stream", "", false},
+		{"application/x-protobuf", "", false},
+		{"application/grpc", "", false},
+		{"image/png", "", false},
+		{"multipart/form-data; boundary=x", "", false},
+		{"not a media type;;", "", false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/function/hook", nil)
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		if test.encoding != "" {
+			r.Header.Set("Content-Encoding", test.encoding)
+		}
+		if got := isTransformableBody(r); got != test.want {
+			t.Errorf("isTransformableBody(%q, encoding %q) = %v, want %v", test.contentType, test.encoding, got, test.want)
+		}
+	}
+}
+
+// Binary bodies sent to a function with a body transformation are forwarded byte for byte
+// with their length, text bodies are transformed with the length of the transformed body
+func TestTransformRoundTrip(t *testing.T) {
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	if _, err := writer.Write([]byte(`{"event":"push","repository":{"name":"platform"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	transform := &BodyTransform{Fields: map[string]string{"repo": "body.repository.name"}}
+	if err := transform.compile(); err != nil {
+		t.Fatal(err)
+	}
+
+	type forwarded struct {
+		body          []byte
+		contentLength int64
+		contentType   string
+	}
+	received := make(chan forwarded, 1)
+	function := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading the forwarded body: %v", err)
+		}
+		received <- forwarded{body: body, contentLength: r.ContentLength, contentType: r.Header.Get("Content-Type")}
+	}))
+	defer function.Close()
+	target, err := url.Parse(function.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The transformation step of the gateway's function handler
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isTransformableBody(r) {
+			if err := transformRequestBody(r, transform); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.Transport = &http.Transport{DisableCompression: true}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer gateway.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        []byte
+		want        []byte
+	}{
+		{"non-UTF-8", "application/octet-stream", "", []byte{0xff, 0xfe, 0x00, 0xc3, 0x28, 0x80}, nil},
+		{"gzip", "application/json", "gzip", gzipped.Bytes(), nil},
+		{"protobuf", "application/x-protobuf", "", []byte{0x08, 0x96, 0x01, 0x12, 0x02, 0xff, 0x00}, nil},
+		{"json", "application/json", "", []byte(`{"event":"push","repository":{"name":"platform"}}`), []byte(`{"repo":"platform"}`)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodPost, gateway.URL+"/function/hook", bytes.NewReader(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			request.Header.Set("Content-Type", test.contentType)
+			if test.encoding != "" {
+				request.Header.Set("Content-Encoding", test.encoding)
+			}
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			response.Body.Close()
+			if response.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want 200", response.StatusCode)
+			}
+
+			want, wantType := test.want, test.contentType
+			if want == nil {
+				want = test.body
+			} else {
+				wantType = "application/json"
+			}
+			got := <-received
+			if !bytes.Equal(got.body, want) {
+				t.Errorf("function received %q, want %q", got.body, want)
+			}
+			if got.contentLength != int64(len(want)) {
+				t.Errorf("function received Content-Length %d, want %d", got.contentLength, len(want))
+			}
+			if !strings.HasPrefix(got.contentType, wantType) {
+				t.Errorf("function received Content-Type %q, want %q", got.contentType, wantType)
+			}
+		})
+	}
+}
+
+// applyTransform compiles a transformation and applies it to a request
+func applyTransform(t *testing.T, transform *BodyTransform, r *http.Request, body string) string {
+	t.Helper()
+	if err := transform.compile(); err != nil {
+		t.Fatalf("compile() = %v", err)
+	}
+	output, err := transform.Apply(newTransformInput(r, []byte(body)))
+	if err != nil {
+		t.Fatalf("Apply() = %v", err)
+	}
+	return string(output)
+}
+
+func TestBodyTransformFields(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/function/hook?source=github", nil)
+	r.Header.Set("X-User-ID", "user1")
+	r.Header.Set("X-Github-Event", "push")
+	transform := &BodyTransform{Fields: map[string]string{
+		"repo":         "body.repository.name",
+		"commits":      "body.commits",
+		"meta.event":   "header.x-github-event",
+		"meta.source":  "query.source",
+		"meta.method":  "request.method",
+		"meta.user":    "request.user_id",
+		"meta.version": "=v2",
+		"meta.missing": "body.repository.owner.login",
+		"request.path": "request.path",
+	}}
+
+	output := applyTransform(t, transform, r, `{"repository":{"name":"platform"},"commits":[{"id":"abc"}]}`)
+	want := `{"commits":[{"id":"abc"}],"meta":{"event":"push","method":"POST","missing":null,"source":"github","user":"user1","version":"v2"},"repo":"platform","request":{"path":"/function/hook"}}`
+	if output != want {
+		t.Errorf("Apply() = %s, want %s", output, want)
+	}
+}
+
+func TestBodyTransformTemplate(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/function/hook", nil)
+	transform := &BodyTransform{Template: `{"text":{{ json .Body.message }},"length":{{ len .RawBody }},"method":"{{ .Method }}"}`}
+
+	output := applyTransform(t, transform, r, `{"message":"say \"hi\""}`)
+	want := `{"text":"say \"hi\"","length":24,"method":"POST"}`
+	if output != want {
+		t.Errorf("Apply() = %s, want %s", output, want)
+	}
+
+	// Templates failing at execution time report the error
+	failing := &BodyTransform{Template: `{{ .Body.message.text }}`}
+	if err := failing.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := failing.Apply(newTransformInput(r, []byte(`{"message":"flat"}`))); err == nil {
+		t.Error("Apply() of a template indexing a string = nil, want an error")
+	}
+}
+
+// Bodies that aren't valid JSON are only available raw
+func TestBodyTransformInvalidJSON(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/function/hook", nil)
+
+	fields := &BodyTransform{Fields: map[string]string{"name": "body.name", "kind": "=invalid"}}
+	if output := applyTransform(t, fields, r, `{"name":`); output != `{"kind":"invalid","name":null}` {
+		t.Errorf("Apply() of fields = %s, want the body fields to be null", output)
+	}
+
+	template := &BodyTransform{Template: `{{ if .Body }}json{{ else }}raw: {{ .RawBody }}{{ end }}`}
+	if output := applyTransform(t, template, r, `{"name":`); output != `raw: {"name":` {
+		t.Errorf("Apply() of template = %q, want the raw body", output)
+	}
+}
+
+// Text bodies of other content types are transformed from their raw form, and the
+// transformed body is sent with the transformation's content type
+func TestBodyTransformNonJSONContentTypes(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+	}{
+		{"application/x-www-form-urlencoded", "name=platform&event=push"},
+		{"text/plain; charset=utf-8", "deploy platform"},
+		{"text/csv", "name,event\nplatform,push\n"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/function/hook", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", test.contentType)
+		if !isTransformableBody(r) {
+			t.Fatalf("isTransformableBody(%q) = false, want true", test.contentType)
+		}
+
+		transform := &BodyTransform{Template: `payload={{ .RawBody }}`, ContentType: "text/plain"}
+		if err := transform.compile(); err != nil {
+			t.Fatal(err)
+		}
+		if err := transformRequestBody(r, transform); err != nil {
+			t.Fatalf("transformRequestBody(%q) = %v", test.contentType, err)
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "payload="+test.body {
+			t.Errorf("transformed %q body = %q, want %q", test.contentType, body, "payload="+test.body)
+		}
+		if r.ContentLength != int64(len(body)) {
+			t.Errorf("Content-Length = %d, want %d", r.ContentLength, len(body))
+		}
+		if contentType := r.Header.Get("Content-Type"); contentType != "text/plain" {
+			t.Errorf("Content-Type = %q, want the transformation's text/plain", contentType)
+		}
+	}
+}
+
+func TestBodyTransformCompile(t *testing.T) {
+	tests := []struct {
+		name      string
+		transform BodyTransform
+		valid     bool
+	}{
+		{"fields", BodyTransform{Fields: map[string]string{"a": "body.a"}}, true},
+		{"template", BodyTransform{Template: "{{ .RawBody }}"}, true},
+		{"neither", BodyTransform{}, false},
+		{"both", BodyTransform{Template: "x", Fields: map[string]string{"a": "body.a"}}, false},
+		{"invalid source", BodyTransform{Fields: map[string]string{"a": "cookie.session"}}, false},
+		{"empty field", BodyTransform{Fields: map[string]string{"": "body.a"}}, false},
+		{"invalid template", BodyTransform{Template: "{{ .RawBody "}, false},
+	}
+
+	for _, test := range tests {
+		err := test.transform.compile()
+		if test.valid && err != nil {
+			t.Errorf("%s: compile() = %v, want nil", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%s: compile() = nil, want an error", test.name)
+		}
+	}
+}
+
+// Stopped functions are started before the invocation timeout begins, so the gateway waits
+// for a cold start on top of it
+func TestGatewayWaitTimeout(t *testing.T) {
+	tests := []struct {
+		timeout time.Duration
+		want    time.Duration
+	}{
+		{2 * time.Second, coldStartWaitTimeout + 2*time.Second + gatewayTimeoutMargin},
+		{0, coldStartWaitTimeout + maxInvokeTimeout + gatewayTimeoutMargin},
+	}
+
+	for _, test := range tests {
+		if got := gatewayWaitTimeout(test.timeout); got != test.want {
+			t.Errorf("gatewayWaitTimeout(%s) = %s, want %s", test.timeout, got, test.want)
+		}
+	}
+}
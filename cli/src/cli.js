@@ -239,7 +239,7 @@ async function deployFunction(options) {
     
     // Register function with Function Controller
     log.info('Registering function with controller...');
-    const controllerResponse = await axios.post(`http://localhost:8081/register`, {
+    const controllerResponse = await axios.post(`http://localhost:8081/register?overwrite=true`, {
       name: functionName,
       image: buildResponse.data.image,
       port: 0  // Let the controller assign a port
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Alias is a stable public name invoking an underlying function, e.g. "prod"
+type Alias struct {
+	Alias     string    `json:"alias"`
+	Function  string    `json:"function"`
+	Version   string    `json:"version,omitempty"` // Version the function must be at, any when empty
+	UserID    string    `json:"user_id"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AliasRequest points an alias at a function
+type AliasRequest struct {
+	Alias    string `json:"alias"`
+	Function string `json:"function"`
+	Version  string `json:"version,omitempty"`
+}
+
+// Alias registry, keyed by userID + "-" + alias like the function registry
+var (
+	aliases     = make(map[string]*Alias)
+	aliasMutex  = &sync.RWMutex{}
+	aliasesFile = "/app/data/aliases.json" // Path to store aliases
+)
+
+// Valid alias names, usable in invocation URLs
+var aliasNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]{0,62}$`)
+
+// resolveAlias returns the alias a name refers to, if any. Without a user ID the alias
+// must be unambiguous across users, like the legacy function lookup.
+func resolveAlias(userID, name string) (*Alias, bool) {
+	aliasMutex.RLock()
+	defer aliasMutex.RUnlock()
+
+	if userID != "" {
+		alias, exists := aliases[userID+"-"+name]
+		return alias, exists
+	}
+
+	var match *Alias
+	for _, alias := range aliases {
+		if alias.Alias == name {
+			if match != nil {
+				return nil, false
+			}
+			match = alias
+		}
+	}
+	return match, match != nil
+}
+
+// aliasesHandler manages the requesting user's aliases: GET /aliases lists them,
+// POST /aliases creates or repoints one and DELETE /aliases/{alias} removes one
+func aliasesHandler(w http.ResponseWriter, r *http.Request, name string) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		listAliases(w, userID)
+	case http.MethodPost:
+		setAlias(w, r, userID)
+	case http.MethodDelete:
+		aliasMutex.Lock()
+		_, exists := aliases[userID+"-"+name]
+		delete(aliases, userID+"-"+name)
+		aliasMutex.Unlock()
+		if !exists {
+			http.Error(w, fmt.Sprintf("Alias '%s' not found", name), http.StatusNotFound)
+			return
+		}
+		if err := saveAliases(); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to save aliases: %v", err), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Deleted alias %s of user %s", name, userID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r)
+	}
+}
+
+// listAliases writes the user's aliases sorted by name
+func listAliases(w http.ResponseWriter, userID string) {
+	aliasMutex.RLock()
+	userAliases := make([]Alias, 0)
+	for _, alias := range aliases {
+		if alias.UserID == userID {
+			userAliases = append(userAliases, *alias)
+		}
+	}
+	aliasMutex.RUnlock()
+
+	sort.Slice(userAliases, func(i, j int) bool { return userAliases[i].Alias < userAliases[j].Alias })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userAliases)
+}
+
+// setAlias creates an alias or points an existing one at another function
+func setAlias(w http.ResponseWriter, r *http.Request, userID string) {
+	var request AliasRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !aliasNamePattern.MatchString(request.Alias) {
+		http.Error(w, fmt.Sprintf("Invalid alias '%s', use up to 63 letters, digits, '.', '-' and '_'", request.Alias), http.StatusBadRequest)
+		return
+	}
+	if request.Function == "" {
+		http.Error(w, "Function is required", http.StatusBadRequest)
+		return
+	}
+
+	// An alias can't hide one of the user's functions
+	if _, _, exists := findFunction(userID, request.Alias); exists {
+		http.Error(w, fmt.Sprintf("Alias '%s' is already the name of a function", request.Alias), http.StatusConflict)
+		return
+	}
+
+	function, _, exists := findFunction(userID, request.Function)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Function '%s' not found", request.Function), http.StatusNotFound)
+		return
+	}
+	mutex.RLock()
+	version := function.Version
+	mutex.RUnlock()
+	if request.Version != "" && request.Version != version {
+		http.Error(w, fmt.Sprintf("Function '%s' is at version '%s', not '%s'", request.Function, version, request.Version), http.StatusConflict)
+		return
+	}
+
+	alias := &Alias{
+		Alias:     request.Alias,
+		Function:  request.Function,
+		Version:   request.Version,
+		UserID:    userID,
+		UpdatedAt: time.Now(),
+	}
+	aliasMutex.Lock()
+	aliases[userID+"-"+request.Alias] = alias
+	aliasMutex.Unlock()
+	if err := saveAliases(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save aliases: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Pointed alias %s of user %s at function %s", request.Alias, userID, request.Function)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(alias)
+}
+
+// saveAliases writes the alias registry to disk
+func saveAliases() error {
+	aliasMutex.RLock()
+	data, err := json.MarshalIndent(aliases, "", "  ")
+	aliasMutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(aliasesFile), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(aliasesFile, data, 0644); err != nil {
+		log.Printf("Error writing aliases file: %v", err)
+		return err
+	}
+	return nil
+}
+
+// loadAliases reads the alias registry from disk
+func loadAliases() error {
+	if _, err := os.Stat(aliasesFile); os.IsNotExist(err) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(aliasesFile)
+	if err != nil {
+		return err
+	}
+
+	aliasMutex.Lock()
+	defer aliasMutex.Unlock()
+	if err := json.Unmarshal(data, &aliases); err != nil {
+		return err
+	}
+
+	log.Printf("Loaded %d aliases", len(aliases))
+	return nil
+}
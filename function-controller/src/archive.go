@@ -0,0 +1,349 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// How often functions idle for longer than functionArchiveAfter are archived
+const archiveCheckPeriod = 10 * time.Minute
+
+// Registry limits, configured with FUNCTION_REGISTRY_LIMIT, the most functions registered
+// at once (0 means unlimited), and FUNCTION_ARCHIVE_AFTER, how long a function may go
+// without invocations before it is archived. Archiving removes images, so it is disabled
+// (0) unless configured.
+var (
+	functionRegistryLimit = 0
+	functionArchiveAfter  = time.Duration(0)
+)
+
+// When the controller started, the idle time of functions registered before registration
+// times were recorded counts from it
+var controllerStartTime = time.Now()
+
+// ArchivedFunction is a function taken out of the registry with its container and image
+// removed. Restoring it registers the definition again; its image is pulled on the next start.
+type ArchivedFunction struct {
+	Function
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// Archived functions, keyed by userID + "-" + functionName like the function registry
+var (
+	archivedFunctions     = make(map[string]*ArchivedFunction)
+	archiveMutex          = &sync.Mutex{}
+	archivedFunctionsFile = "/app/data/archived-functions.json" // Path to store archived functions
+)
+
+func init() {
+	if value := os.Getenv("FUNCTION_REGISTRY_LIMIT"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+			functionRegistryLimit = parsed
+		} else {
+			log.Printf("Invalid FUNCTION_REGISTRY_LIMIT %q, using default %d", value, functionRegistryLimit)
+		}
+	}
+	if value := os.Getenv("FUNCTION_ARCHIVE_AFTER"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed >= 0 {
+			functionArchiveAfter = parsed
+		} else {
+			log.Printf("Invalid FUNCTION_ARCHIVE_AFTER %q, using default %s", value, functionArchiveAfter)
+		}
+	}
+}
+
+// ensureRegistryCapacity checks that a function can be added to the registry, archiving
+// idle functions to make room when it is full. Replacing a registered function always fits.
+func ensureRegistryCapacity(functionKey string) error {
+	if functionRegistryLimit == 0 {
+		return nil
+	}
+	full := func() bool {
+		mutex.RLock()
+		defer mutex.RUnlock()
+		_, exists := functions[functionKey]
+		return !exists && len(functions) >= functionRegistryLimit
+	}
+	if !full() {
+		return nil
+	}
+	archiveIdleFunctions()
+	if full() {
+		return fmt.Errorf("function registry is full (%d functions), delete or archive unused functions first", functionRegistryLimit)
+	}
+	return nil
+}
+
+// lastActivity returns when a function was last invoked, or registered if it never was
+func lastActivity(function *Function) time.Time {
+	last := controllerStartTime
+	if function.RegisteredAt != nil {
+		last = *function.RegisteredAt
+	}
+	// Invocations are recorded by user and function name, whatever the registry key
+	if invoked := lastInvocationTime(function.UserID + "-" + function.Name); invoked.After(last) {
+		last = invoked
+	}
+	return last
+}
+
+// archiveIdleFunctions archives the functions that weren't invoked for longer than
+// functionArchiveAfter
+func archiveIdleFunctions() {
+	if functionArchiveAfter == 0 {
+		return
+	}
+
+	var idle []string
+	mutex.RLock()
+	for key, function := range functions {
+		if time.Since(lastActivity(function)) > functionArchiveAfter {
+			idle = append(idle, key)
+		}
+	}
+	mutex.RUnlock()
+
+	for _, key := range idle {
+		if _, err := archiveFunction(key); err != nil {
+			log.Printf("Warning: failed to archive idle function %s: %v", key, err)
+		}
+	}
+}
+
+// startArchiver periodically archives idle functions
+func startArchiver() {
+	if functionArchiveAfter == 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(archiveCheckPeriod)
+		defer ticker.Stop()
+		for range ticker.C {
+			archiveIdleFunctions()
+		}
+	}()
+}
+
+// archiveFunction moves a function from the registry to the archive, removing its
+// containers and, unless it may never be pulled again, its image
+func archiveFunction(functionKey string) (*ArchivedFunction, error) {
+	mutex.Lock()
+	function, exists := functions[functionKey]
+	if !exists {
+		mutex.Unlock()
+		return nil, fmt.Errorf("function not found")
+	}
+	if err := stopContainer(function); err != nil {
+		mutex.Unlock()
+		return nil, fmt.Errorf("failed to stop container: %v", err)
+	}
+	removeStrayContainers(function)
+	delete(functions, functionKey)
+	archived := &ArchivedFunction{Function: *function, ArchivedAt: time.Now().UTC()}
+	mutex.Unlock()
+
+	deleteInvocationMetrics(functionKey)
+	markRegistryDirty()
+
+	archiveMutex.Lock()
+	archivedFunctions[functionKey] = archived
+	archiveMutex.Unlock()
+	if err := saveArchivedFunctions(); err != nil {
+		log.Printf("Warning: failed to save archived functions: %v", err)
+	}
+
+	if archived.ImagePullPolicy != pullNever {
+		removeFunctionImage(archived.Image)
+	}
+	log.Printf("Archived function %s of user %s", archived.Name, archived.UserID)
+	return archived, nil
+}
+
+// restoreFunction moves an archived function back into the registry
+func restoreFunction(functionKey string) (*Function, error) {
+	archiveMutex.Lock()
+	archived, exists := archivedFunctions[functionKey]
+	archiveMutex.Unlock()
+	if !exists {
+		return nil, fmt.Errorf("function is not archived")
+	}
+	if err := ensureRegistryCapacity(functionKey); err != nil {
+		return nil, err
+	}
+
+	function := archived.Function
+	if _, stored := storeFunction(&function, false); !stored {
+		return nil, fmt.Errorf("a function of the same name was registered since it was archived")
+	}
+	discardArchivedFunction(functionKey)
+
+	log.Printf("Restored function %s of user %s", function.Name, function.UserID)
+	return &function, nil
+}
+
+// discardArchivedFunction drops the archived copy of a function, e.g. when a function of
+// the same name is registered
+func discardArchivedFunction(functionKey string) {
+	archiveMutex.Lock()
+	_, exists := archivedFunctions[functionKey]
+	delete(archivedFunctions, functionKey)
+	archiveMutex.Unlock()
+	if !exists {
+		return
+	}
+	if err := saveArchivedFunctions(); err != nil {
+		log.Printf("Warning: failed to save archived functions: %v", err)
+	}
+}
+
+// isArchived reports whether a function of the user is archived
+func isArchived(userID, functionName string) bool {
+	archiveMutex.Lock()
+	defer archiveMutex.Unlock()
+
+	_, exists := archivedFunctions[userID+"-"+functionName]
+	return exists
+}
+
+// archivedFunctionsHandler lists the requesting user's archived functions
+func archivedFunctionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	archiveMutex.Lock()
+	userArchived := make([]ArchivedFunction, 0)
+	for _, archived := range archivedFunctions {
+		if archived.UserID == userID {
+			userArchived = append(userArchived, *archived)
+		}
+	}
+	archiveMutex.Unlock()
+
+	sort.Slice(userArchived, func(i, j int) bool { return userArchived[i].Name < userArchived[j].Name })
+	for i := range userArchived {
+		userArchived[i].Secrets = nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userArchived)
+}
+
+// archiveFunctionHandler archives one of the requesting user's functions
+func archiveFunctionHandler(w http.ResponseWriter, r *http.Request, functionName string) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	_, functionKey, exists := findFunction(userID, functionName)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Function '%s' not found", functionName), http.StatusNotFound)
+		return
+	}
+	archived, err := archiveFunction(functionKey)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to archive function '%s': %v", functionName, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":     fmt.Sprintf("Function '%s' archived successfully", functionName),
+		"archived_at": archived.ArchivedAt,
+	})
+}
+
+// restoreFunctionHandler restores one of the requesting user's archived functions
+func restoreFunctionHandler(w http.ResponseWriter, r *http.Request, functionName string) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	functionKey := userID + "-" + functionName
+	if !isArchived(userID, functionName) {
+		http.Error(w, fmt.Sprintf("Function '%s' is not archived", functionName), http.StatusNotFound)
+		return
+	}
+	if _, err := restoreFunction(functionKey); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to restore function '%s': %v", functionName, err), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Function '%s' restored successfully", functionName),
+		"running": false,
+	})
+}
+
+// saveArchivedFunctions writes the archived functions to disk
+func saveArchivedFunctions() error {
+	archiveMutex.Lock()
+	data, err := json.MarshalIndent(archivedFunctions, "", "  ")
+	archiveMutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(archivedFunctionsFile), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(archivedFunctionsFile, data, 0644); err != nil {
+		log.Printf("Error writing archived functions file: %v", err)
+		return err
+	}
+	return nil
+}
+
+// loadArchivedFunctions reads the archived functions from disk
+func loadArchivedFunctions() error {
+	if _, err := os.Stat(archivedFunctionsFile); os.IsNotExist(err) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(archivedFunctionsFile)
+	if err != nil {
+		return err
+	}
+
+	archiveMutex.Lock()
+	if err := json.Unmarshal(data, &archivedFunctions); err != nil {
+		archiveMutex.Unlock()
+		return err
+	}
+
+	// Older archives kept secrets in plaintext
+	migrated := false
+	for _, archived := range archivedFunctions {
+		encrypted, err := encryptLegacySecrets(&archived.Function)
+		if err != nil {
+			log.Printf("Warning: failed to encrypt secrets of archived function %s: %v", archived.Name, err)
+		}
+		migrated = migrated || encrypted
+	}
+	log.Printf("Loaded %d archived functions", len(archivedFunctions))
+	archiveMutex.Unlock()
+
+	if migrated {
+		return saveArchivedFunctions()
+	}
+	return nil
+}
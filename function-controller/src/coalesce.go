@@ -0,0 +1,123 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Header a client sets to true to let its invocation share the execution of identical
+// concurrent ones, for functions that allow it
+const coalesceHeader = "X-Coalesce"
+
+// Header set on responses shared with another invocation
+const coalescedHeader = "X-Coalesced"
+
+// coalesceWindow is how long after an execution started identical invocations may still
+// share it; later ones start a new execution so they don't get a stale response.
+// It can be configured with COALESCE_WINDOW.
+var coalesceWindow = 5 * time.Second
+
+// coalescedInvocations shares executions between identical invocations
+var coalescedInvocations singleflight.Group
+
+// Start times of the executions in flight, keyed by request signature
+var (
+	coalesceStarts = make(map[string]time.Time)
+	coalesceMutex  sync.Mutex
+)
+
+func init() {
+	if value := os.Getenv("COALESCE_WINDOW"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			coalesceWindow = parsed
+		} else {
+			log.Printf("Invalid COALESCE_WINDOW %q, using default %s", value, coalesceWindow)
+		}
+	}
+}
+
+// coalescingEnabled reports whether an invocation may share the execution of identical
+// ones: the function must allow it and the client must opt in
+func coalescingEnabled(function *Function, r *http.Request) bool {
+	return function.Coalesce && strings.EqualFold(r.Header.Get(coalesceHeader), "true")
+}
+
+// invocationSignature identifies the invocations that get the same response: the same
+// caller sending the same method, path, query and body to the same function
+func invocationSignature(r *http.Request, function *Function, body []byte) string {
+	hash := sha256.New()
+	for _, part := range []string{
+		function.UserID, function.Name, r.Header.Get("X-User-ID"), r.Method, rawSubPath(r), r.URL.RawQuery,
+		r.Header.Get("Content-Type"), r.Header.Get("Accept"), r.Header.Get("Authorization"),
+	} {
+		fmt.Fprintf(hash, "%s\x00", part)
+	}
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// coalescedInvoke invokes a function, sharing the execution and its buffered response
+// with identical invocations that arrive while it is in flight
+func coalescedInvoke(w http.ResponseWriter, r *http.Request, function *Function, functionName string, timeout time.Duration, startTime time.Time) {
+	body, err := readInvocationBody(r)
+	if err != nil {
+		writeInvocationError(w, err)
+		return
+	}
+
+	key := invocationSignature(r, function, body)
+	response, shared, err := coalesce(key, func() (*bufferedResponse, error) {
+		return bufferedInvocation(function, functionName, r, body, timeout, startTime)
+	})
+	if err != nil {
+		writeInvocationError(w, err)
+		return
+	}
+
+	if shared {
+		log.Printf("Invocation of function %s shared a coalesced execution", functionName)
+		w.Header().Set(coalescedHeader, "true")
+	}
+	writeBufferedResponse(w, response)
+}
+
+// coalesce runs execute once for the invocations with the same signature in flight at
+// once, unless the execution in flight started more than coalesceWindow ago
+func coalesce(key string, execute func() (*bufferedResponse, error)) (*bufferedResponse, bool, error) {
+	coalesceMutex.Lock()
+	if started, exists := coalesceStarts[key]; exists && time.Since(started) > coalesceWindow {
+		coalescedInvocations.Forget(key)
+		delete(coalesceStarts, key)
+	}
+	coalesceMutex.Unlock()
+
+	result, err, shared := coalescedInvocations.Do(key, func() (interface{}, error) {
+		started := time.Now()
+		coalesceMutex.Lock()
+		coalesceStarts[key] = started
+		coalesceMutex.Unlock()
+
+		defer func() {
+			coalesceMutex.Lock()
+			// A newer execution replaces a forgotten one
+			if coalesceStarts[key] == started {
+				delete(coalesceStarts, key)
+			}
+			coalesceMutex.Unlock()
+		}()
+		return execute()
+	})
+	if err != nil {
+		return nil, shared, err
+	}
+	return result.(*bufferedResponse), shared, nil
+}
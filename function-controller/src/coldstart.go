@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// coldStarts makes sure only one request starts a stopped function; the others wait for it
+var coldStarts singleflight.Group
+
+// coldStartWaitTimeout is how long a request waits for a cold start before giving up
+var coldStartWaitTimeout = 60 * time.Second
+
+func init() {
+	if value := os.Getenv("COLD_START_WAIT_TIMEOUT"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			coldStartWaitTimeout = parsed
+		} else {
+			log.Printf("Invalid COLD_START_WAIT_TIMEOUT %q, using default %s", value, coldStartWaitTimeout)
+		}
+	}
+}
+
+// needsColdStart reports whether a function's container has to be (re)started before invoking it
+func needsColdStart(function *Function) bool {
+	coldStartNeeded, _ := inspectFunctionContainer(function)
+	return coldStartNeeded
+}
+
+// inspectFunctionContainer inspects a function's container once, reporting whether it has
+// to be (re)started before invoking it and otherwise its health status, which is empty
+// when its image has no HEALTHCHECK
+func inspectFunctionContainer(function *Function) (bool, string) {
+	if !function.Running {
+		return true, ""
+	}
+	if function.Container == "" {
+		return false, ""
+	}
+	running, health := containerStatus(function.Container)
+	return !running, health
+}
+
+// coldStart starts a function's container and waits until it accepts connections.
+// Concurrent callers for the same function share a single start.
+func coldStart(functionKey string, function *Function) error {
+	results := coldStarts.DoChan(functionKey, func() (interface{}, error) {
+		// Pull the image before taking the registry lock, a slow pull would hold up every request
+		if err := pullImageForStart(function); err != nil {
+			log.Printf("Failed to start container for function %s: %v", function.Name, err)
+			return nil, err
+		}
+
+		mutex.Lock()
+		// A cold start that finished after the caller's check already did the work
+		if !needsColdStart(function) {
+			mutex.Unlock()
+			return nil, nil
+		}
+
+		log.Printf("Starting container for function %s before invocation", function.Name)
+		function.Container = ""
+		function.Running = false
+		err := startContainer(function)
+		containerID := function.Container
+		mutex.Unlock()
+		if err != nil {
+			return nil, err
+		}
+
+		// Surface permission problems instead of leaving a silent crash loop
+		if err := checkContainerStartup(function, containerID); err != nil {
+			return nil, err
+		}
+
+		log.Printf("Waiting for function %s container to accept connections", function.Name)
+		return nil, waitForFunctionReady(function)
+	})
+
+	// Functions allowed to boot longer than the wait are waited for
+	waitTimeout := coldStartWaitTimeout
+	if startupTimeout := resolveStartupTimeout(function); startupTimeout > waitTimeout {
+		waitTimeout = startupTimeout
+	}
+
+	select {
+	case result := <-results:
+		if result.Shared {
+			log.Printf("Request for function %s shared a cold start", function.Name)
+		}
+		return result.Err
+	case <-time.After(waitTimeout):
+		return &ReadinessError{
+			Function: function.Name,
+			Err:      fmt.Errorf("cold start still in progress after %s", waitTimeout),
+		}
+	}
+}
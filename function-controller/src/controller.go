@@ -15,16 +15,86 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/gorilla/mux"
 )
 
 // Function represents a serverless function
 type Function struct {
-	Name      string            `json:"name"`
-	Image     string            `json:"image"`
-	Container string            `json:"container,omitempty"`
-	Running   bool              `json:"running"`
-	Env       map[string]string `json:"env,omitempty"`
-	UserID    string            `json:"user_id,omitempty"`
+	Name        string            `json:"name"`
+	Image       string            `json:"image"`
+	Container   string            `json:"container,omitempty"`
+	Running     bool              `json:"running"`
+	Env         map[string]string `json:"env,omitempty"`
+	UserID      string            `json:"user_id,omitempty"`
+	Secrets     map[string]string `json:"secrets,omitempty"`      // Rendered into a file mounted into the container
+	SecretsPath string            `json:"secrets_path,omitempty"` // Mount path of the secrets file (default /run/secrets/config.json)
+	RunAsUser   string            `json:"run_as_user,omitempty"`  // uid:gid passed to docker run --user
+	AutoStart   *bool             `json:"auto_start,omitempty"`   // Start the container on invoke if stopped (default true)
+
+	// Whether the image is pulled before the container starts: Always, IfNotPresent (default) or Never
+	ImagePullPolicy string `json:"image_pull_policy,omitempty"`
+
+	// Named volume mounted into the container for data that persists across restarts,
+	// e.g. local caches or SQLite databases. Kept on deletion unless removal is requested.
+	DataVolume bool   `json:"data_volume,omitempty"`
+	DataPath   string `json:"data_path,omitempty"` // Mount path of the volume (default /data)
+
+	// Metadata shown in function listings, set as meta.* labels on the container
+	Description string `json:"description,omitempty"`
+	Owner       string `json:"owner,omitempty"`   // Team or person responsible for the function
+	Version     string `json:"version,omitempty"`
+
+	// Env vars the function expects, checked on registration and before starting
+	EnvSchema map[string]EnvVarSpec `json:"env_schema,omitempty"`
+
+	// Restart behaviour; a container restarted more than MaxRestarts times is stopped and marked crashed
+	RestartPolicy string       `json:"restart_policy,omitempty"` // Docker restart policy (default unless-stopped)
+	MaxRestarts   *int         `json:"max_restarts,omitempty"`   // Default FUNCTION_MAX_RESTARTS
+	Crash         *CrashReport `json:"crash,omitempty"`          // Set when the function crashed, cleared on start
+	StopSignal    string       `json:"stop_signal,omitempty"`    // Signal docker stop sends (default SIGTERM)
+
+	// Invocations that may be in flight at once, default FUNCTION_MAX_CONCURRENCY (0 means unlimited)
+	MaxConcurrency *int `json:"max_concurrency,omitempty"`
+
+	// Seconds an invocation may take unless a request overrides it, default 25s.
+	// Set as the platform.timeout label so the function proxy applies it too.
+	Timeout *int `json:"timeout,omitempty"`
+
+	// Let identical concurrent invocations sending X-Coalesce: true share one execution,
+	// for idempotent functions. Their responses are buffered instead of streamed.
+	Coalesce bool `json:"coalesce,omitempty"`
+
+	// Retry invocations failing transiently before returning the error, for idempotent
+	// methods or clients sending X-Retry: true
+	Retry *RetryPolicy `json:"retry,omitempty"`
+
+	// Trace every invocation, breaking its latency down into phases reported in the
+	// Server-Timing header and the log. Clients can trace single ones with X-Trace: true.
+	Trace bool `json:"trace,omitempty"`
+
+	// Request sent to a started container before it serves invocations, within the
+	// startup timeout
+	Warmup *WarmupRequest `json:"warmup,omitempty"`
+
+	// Seconds a started container may take to accept connections, for functions booting
+	// faster or slower than READINESS_PROBE_TIMEOUT, the default
+	StartupTimeout *int `json:"startup_timeout,omitempty"`
+
+	// When the function was registered, its idle time counts from it until it is invoked
+	RegisteredAt *time.Time `json:"registered_at,omitempty"`
+
+	// Header rules applied when forwarding invocations
+	AddRequestHeaders     map[string]string `json:"add_request_headers,omitempty"`     // Set on every request to the function
+	RemoveResponseHeaders []string          `json:"remove_response_headers,omitempty"` // Stripped from every response
+}
+
+// autoStartEnabled reports whether invoking a stopped function should start its container
+func (f *Function) autoStartEnabled(r *http.Request) bool {
+	if strings.EqualFold(r.Header.Get("X-No-Autostart"), "true") {
+		return false
+	}
+	return f.AutoStart == nil || *f.AutoStart
 }
 
 // Function registry with persistence
@@ -41,43 +111,113 @@ func enableCors(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 	}
 	if w.Header().Get("Access-Control-Allow-Methods") == "" {
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 	}
 	if w.Header().Get("Access-Control-Allow-Headers") == "" {
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-ID, X-Username")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-User-ID, X-Username, X-Invoke-Timeout, X-No-Autostart, X-Coalesce, Idempotency-Key, X-Retry, X-Request-ID, X-Trace")
 	}
 	if w.Header().Get("Access-Control-Expose-Headers") == "" {
-		w.Header().Set("Access-Control-Expose-Headers", "X-User-ID, X-Username")
+		w.Header().Set("Access-Control-Expose-Headers", "X-User-ID, X-Username, X-Coalesced, Idempotent-Replayed, X-Request-ID, X-Error-Origin, Server-Timing")
 	}
 
 	// Handle preflight requests
 	if r.Method == "OPTIONS" {
+		setAllowHeader(w, r)
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
+// invocationMethods are the HTTP methods functions can be invoked with, used by the invoke
+// routes and their Allow header. The function proxy and the gateway accept the same list.
+var invocationMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// allowedMethods returns the HTTP methods supported by a controller route
+func allowedMethods(path string) []string {
+	switch {
+	case path == "/register":
+		return []string{http.MethodPost}
+	case strings.HasPrefix(path, "/invoke/"):
+		return invocationMethods
+	case strings.HasPrefix(path, "/start/"), strings.HasPrefix(path, "/stop/"), strings.HasPrefix(path, "/test/"):
+		return []string{http.MethodPost}
+	case strings.HasPrefix(path, "/delete/"), strings.HasPrefix(path, "/aliases/"):
+		return []string{http.MethodDelete}
+	case path == "/aliases", path == "/queues":
+		return []string{http.MethodGet, http.MethodPost}
+	case strings.HasPrefix(path, "/queues/") && strings.HasSuffix(path, "/messages"):
+		return []string{http.MethodPost}
+	case strings.HasPrefix(path, "/queues/"):
+		return []string{http.MethodDelete}
+	case path == "/functions/import", strings.HasPrefix(path, "/functions/") &&
+		(strings.HasSuffix(path, "/archive") || strings.HasSuffix(path, "/restore") || strings.HasSuffix(path, "/refresh")):
+		return []string{http.MethodPost}
+	case strings.HasPrefix(path, "/functions/") && strings.HasSuffix(path, "/debug"):
+		return []string{http.MethodGet, http.MethodPut, http.MethodDelete}
+	case path == "/list", strings.HasPrefix(path, "/list/"), strings.HasPrefix(path, "/functions/"),
+		path == "/health", path == "/usage", strings.HasPrefix(path, "/logs/"), strings.HasPrefix(path, "/logs-json/"):
+		return []string{http.MethodGet}
+	}
+	return nil
+}
+
+// rawSubPath returns the path of an invocation after the function name, still escaped as
+// the client sent it and including its leading and trailing slashes. Using the decoded
+// path would turn encoded slashes into separators and decode escapes a second time.
+func rawSubPath(r *http.Request) string {
+	rest := strings.TrimPrefix(r.URL.EscapedPath(), "/invoke/")
+	if index := strings.IndexByte(rest, '/'); index >= 0 {
+		return rest[index:]
+	}
+	return ""
+}
+
+// withOptions returns methods along with OPTIONS, which every route accepts for CORS
+// preflight requests
+func withOptions(methods []string) []string {
+	return append(append([]string(nil), methods...), http.MethodOptions)
+}
+
+// setAllowHeader advertises the methods supported by the requested route
+func setAllowHeader(w http.ResponseWriter, r *http.Request) {
+	if methods := allowedMethods(r.URL.Path); len(methods) > 0 {
+		w.Header().Set("Allow", strings.Join(withOptions(methods), ", "))
+	}
+}
+
+// methodNotAllowed writes a 405 response including the route's Allow header
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	setAllowHeader(w, r)
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
+
 // Note: Port allocation functions have been removed as we now use internal Docker networking
 
 // Note: Port allocation functions have been removed as we now use internal Docker networking
 
+// removeFunctionImage removes a function image from the local Docker host
+func removeFunctionImage(image string) {
+	if image == "" {
+		return
+	}
+	// Containers are started from the localhost registry address
+	image = localImage(image)
+	if output, err := exec.Command("docker", "rmi", image).CombinedOutput(); err != nil {
+		log.Printf("Warning: Failed to remove image %s: %v\nOutput: %s", image, err, string(output))
+		return
+	}
+	log.Printf("Removed image %s", image)
+}
+
 // Start a function container
 func startContainer(function *Function) error {
-	// Generate a unique container name
-	containerName := fmt.Sprintf("%s-%d", function.Name, time.Now().Unix())
+	// Generate a unique container name, traceable to the function and its owner
+	name := containerName(function)
 
 	// For MVP, we'll use the host's localhost:5001 which is mapped to the registry container
-	image := function.Image
-	// Ensure we're using localhost:5001 for the registry
-	if strings.Contains(image, "registry:") {
-		image = strings.Replace(image, "registry:", "localhost:", 1)
-	}
+	image := localImage(function.Image)
 
-	// Get the network name from environment or use default with project prefix
-	networkName := os.Getenv("FUNCTION_NETWORK")
-	if networkName == "" {
-		// Use the Docker Compose prefixed network name
-		networkName = "platform-repository_function-network"
-	}
+	// Get the network the function containers are attached to
+	networkName := functionNetworkName()
 
 	// Log the network we're connecting to
 	log.Printf("Starting container for function %s on network %s", function.Name, networkName)
@@ -86,17 +226,63 @@ func startContainer(function *Function) error {
 	args := []string{
 		"run",
 		"-d",
-		"--name", containerName,
+		"--name", name,
 		"--network", networkName, // Connect to the function network
 		"--label", fmt.Sprintf("function=%s", function.Name), // Add label for function identification
-		"--restart", "unless-stopped", // Restart policy
+		"--label", fmt.Sprintf("platform.user=%s", function.UserID), // Scope the function to its owner
+		"--restart", resolveRestartPolicy(function), // Restart policy
+	}
+
+	// Stop the container with the signal the function shuts down gracefully on
+	if function.StopSignal != "" {
+		args = append(args, "--stop-signal", function.StopSignal)
+	}
+
+	// Let the owner's other functions reach the container by the function's name
+	args = append(args, networkAliasArgs(function)...)
+
+	// Label the container with the function's metadata
+	args = append(args, metadataLabels(function)...)
+
+	// Let the function proxy apply the function's own timeout
+	if function.Timeout != nil {
+		args = append(args, "--label", fmt.Sprintf("platform.timeout=%d", *function.Timeout))
+	}
+
+	// Run as a non-root user if configured
+	runAsUser := resolveRunAsUser(function)
+	if runAsUser != "" {
+		args = append(args, "--user", runAsUser)
 	}
 
-	// Add environment variables
-	for key, value := range function.Env {
+	// Add environment variables, the platform's defaults overridden by the function's own
+	for key, value := range functionEnv(function) {
 		args = append(args, "-e", fmt.Sprintf("%s=%s", key, value))
 	}
 
+	// Add the platform's environment variables, which the function's env can't override
+	for key, value := range platformEnv(function) {
+		args = append(args, "-e", fmt.Sprintf("%s=%s", key, value))
+	}
+
+	// Mount the rendered secrets file read-only
+	secretsVolume, err := renderSecretsFile(function)
+	if err != nil {
+		log.Printf("Failed to prepare secrets for function %s: %v", function.Name, err)
+		return err
+	}
+	if secretsVolume != "" {
+		args = append(args, "-v", secretsVolume)
+	}
+
+	// Mount the data volume
+	dataArgs, err := dataVolumeArgs(function)
+	if err != nil {
+		log.Printf("Failed to prepare data volume for function %s: %v", function.Name, err)
+		return err
+	}
+	args = append(args, dataArgs...)
+
 	// Add image name
 	args = append(args, image)
 
@@ -163,13 +349,123 @@ func stopContainer(function *Function) error {
 	function.Container = ""
 	function.Running = false
 
+	// Secrets are only kept on disk while the container is running
+	removeSecretsFile(function)
+
 	log.Printf("Stopped container for function %s", function.Name)
 
 	return nil
 }
 
+// findFunction looks up a function owned by a user, returning it with its registry key
+func findFunction(userID, functionName string) (*Function, string, bool) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	// Use composite key to find the function
+	functionKey := userID + "-" + functionName
+	if function, exists := functions[functionKey]; exists {
+		return function, functionKey, true
+	}
+
+	// If not found with composite key, try to find by name for backward compatibility
+	for key, fn := range functions {
+		if fn.Name == functionName && fn.UserID == userID {
+			return fn, key, true
+		}
+	}
+
+	return nil, "", false
+}
+
+// validateFunction checks the settings of a function being registered
+func validateFunction(function *Function) error {
+	validators := []func(*Function) error{
+		func(f *Function) error { return validateRunAsUser(f.RunAsUser) },
+		validateHeaderRules,
+		validateMetadata,
+		validateRestartPolicy,
+		validateStopSignal,
+		validateImagePullPolicy,
+		validateRetryPolicy,
+		validateWarmup,
+		validateStartupTimeout,
+		validateMaxConcurrency,
+		validateTimeout,
+		validateDataVolume,
+		validateEnvSchema,
+		validatePlatformEnv,
+		validateEnv,
+	}
+	for _, validate := range validators {
+		if err := validate(function); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// qualifyFunctionImage prefixes the image name of a function with its user ID, the name
+// the image is pushed to the registry under
+func qualifyFunctionImage(function *Function) {
+	// Check if the image name already has the user ID prefix
+	if strings.HasPrefix(function.Image, "localhost:5001/"+function.UserID+"-") {
+		return
+	}
+	imageParts := strings.Split(function.Image, "/")
+	if len(imageParts) > 1 {
+		// Extract the function name and tag
+		nameAndTag := strings.Split(imageParts[1], ":")
+		if len(nameAndTag) > 0 {
+			// Create a new image name with user ID
+			function.Image = fmt.Sprintf("localhost:5001/%s-%s:%s",
+				function.UserID,
+				nameAndTag[0],
+				nameAndTag[len(nameAndTag)-1])
+			log.Printf("Updated image name to include user ID: %s", function.Image)
+		}
+	}
+}
+
+// storeFunction adds a function to the registry, replacing an existing function of the
+// same name only when overwrite is set. It reports whether a function was replaced and
+// whether the function was stored.
+func storeFunction(function *Function, overwrite bool) (bool, bool) {
+	mutex.Lock()
+	// Use composite key of userID + "-" + functionName to prevent collisions
+	functionKey := function.UserID + "-" + function.Name
+	existing, exists := functions[functionKey]
+	if exists && !overwrite {
+		mutex.Unlock()
+		return true, false
+	}
+	if exists {
+		// Stop the old version so it doesn't keep running unmanaged
+		log.Printf("Replacing function '%s', stopping its container", function.Name)
+		if err := stopContainer(existing); err != nil {
+			log.Printf("Warning: Failed to stop container for function '%s' during replacement: %v", function.Name, err)
+		}
+	}
+	registeredAt := time.Now().UTC()
+	function.RegisteredAt = &registeredAt
+	functions[functionKey] = function
+	mutex.Unlock()
+
+	// Save registry to file on the next flush
+	markRegistryDirty()
+
+	// Don't leak the old image, a reused tag is pulled again on the next start
+	if exists {
+		removeFunctionImage(existing.Image)
+	}
+	return exists, true
+}
+
 // saveRegistry saves the function registry to a file
 func saveRegistry() error {
+	registrySaveMutex.Lock()
+	defer registrySaveMutex.Unlock()
+
 	mutex.RLock()
 	defer mutex.RUnlock()
 
@@ -197,8 +493,8 @@ func saveRegistry() error {
 		return err
 	}
 
-	// Write to file
-	if err := ioutil.WriteFile(registryFile, data, 0644); err != nil {
+	// Write to file atomically so a crash can't leave it truncated
+	if err := writeFileAtomic(registryFile, data, 0644); err != nil {
 		log.Printf("Error writing registry file: %v", err)
 		return err
 	}
@@ -235,6 +531,12 @@ func loadRegistry() error {
 
 	for name, fn := range persistentFunctions {
 		fnCopy := fn // Create a copy to avoid reference issues
+		// Older registries kept secrets in plaintext
+		if encrypted, err := encryptLegacySecrets(&fnCopy); err != nil {
+			log.Printf("Warning: failed to encrypt secrets of function %s: %v", fnCopy.Name, err)
+		} else if encrypted {
+			markRegistryDirty()
+		}
 		functions[name] = &fnCopy
 	}
 
@@ -247,8 +549,51 @@ func main() {
 	if err := loadRegistry(); err != nil {
 		log.Printf("Warning: Failed to load function registry: %v", err)
 	}
+
+	// Adopt the containers still running from before a restart and remove orphaned ones
+	if err := reconcileContainers(); err != nil {
+		log.Printf("Warning: Failed to reconcile function containers: %v", err)
+	}
+
+	// Load the aliases pointing at functions
+	if err := loadAliases(); err != nil {
+		log.Printf("Warning: Failed to load aliases: %v", err)
+	}
+
+	// Load the archived functions and archive idle ones periodically
+	if err := loadArchivedFunctions(); err != nil {
+		log.Printf("Warning: Failed to load archived functions: %v", err)
+	}
+	startArchiver()
+
+	// Start consuming the queues bound to functions
+	if err := loadQueueBindings(); err != nil {
+		log.Printf("Warning: Failed to load queue bindings: %v", err)
+	}
+
+	// Load invocation metrics and persist them periodically
+	if err := loadMetrics(); err != nil {
+		log.Printf("Warning: Failed to load invocation metrics: %v", err)
+	}
+	startMetricsFlusher()
+
+	// Batch registry saves and flush pending state on shutdown
+	startRegistryFlusher()
+	handleShutdown()
+
+	// Stop functions that are crash looping
+	startRestartWatcher()
+
+	router := mux.NewRouter()
+
+	// Invocation paths are forwarded to functions as sent, so they must not be cleaned
+	router.SkipClean(true)
+
+	// Advertise the supported methods when a route rejects a method
+	router.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowed)
+
 	// Register function handler
-	http.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {
 		// Enable CORS
 		enableCors(w, r)
 
@@ -257,11 +602,6 @@ func main() {
 			return
 		}
 
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
 		// Extract user ID from request headers
 		userID := r.Header.Get("X-User-ID")
 		if userID == "" {
@@ -278,46 +618,58 @@ func main() {
 		// Set the user ID for the function
 		function.UserID = userID
 
-		// No need to assign ports with internal networking
+		// Validate the function's settings
+		if err := validateFunction(&function); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
 		// Ensure the image name includes the user ID
-		// Check if the image name already has the user ID prefix
-		if !strings.HasPrefix(function.Image, "localhost:5001/"+userID+"-") {
-			// If not, update the image name to include the user ID
-			imageParts := strings.Split(function.Image, "/")
-			if len(imageParts) > 1 {
-				// Extract the function name and tag
-				nameAndTag := strings.Split(imageParts[1], ":")
-				if len(nameAndTag) > 0 {
-					// Create a new image name with user ID
-					function.Image = fmt.Sprintf("localhost:5001/%s-%s:%s", 
-						userID, 
-						nameAndTag[0], 
-						nameAndTag[len(nameAndTag)-1])
-					log.Printf("Updated image name to include user ID: %s", function.Image)
-				}
-			}
+		qualifyFunctionImage(&function)
+
+		// Secrets are only kept encrypted
+		if err := encryptSecrets(&function); err != nil {
+			log.Printf("Failed to encrypt secrets of function %s: %v", function.Name, err)
+			http.Error(w, "Failed to encrypt function secrets", http.StatusInternalServerError)
+			return
 		}
 
-		// Store function in registry
-		mutex.Lock()
-		// Use composite key of userID + "-" + functionName to prevent collisions
+		// A full registry only takes new functions once idle ones are archived
 		functionKey := function.UserID + "-" + function.Name
-		functions[functionKey] = &function
-		mutex.Unlock()
-		
-		// Save registry to file
-		go saveRegistry()
+		if err := ensureRegistryCapacity(functionKey); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		// Replacing an existing function has to be requested explicitly
+		overwrite := r.URL.Query().Get("overwrite") == "true"
+		exists, stored := storeFunction(&function, overwrite)
+		if !stored {
+			http.Error(w, fmt.Sprintf("Function '%s' already exists, register it with ?overwrite=true to replace it", function.Name), http.StatusConflict)
+			return
+		}
+
+		// The new definition replaces an archived one of the same name
+		discardArchivedFunction(functionKey)
+
+		// Report whether the function was created or updated
+		result, statusCode := "created", http.StatusCreated
+		message := fmt.Sprintf("Function '%s' registered successfully", function.Name)
+		if exists {
+			result, statusCode = "updated", http.StatusOK
+			message = fmt.Sprintf("Function '%s' updated successfully", function.Name)
+		}
 
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
+		w.WriteHeader(statusCode)
 		json.NewEncoder(w).Encode(map[string]string{
-			"message": fmt.Sprintf("Function '%s' registered successfully", function.Name),
+			"message": message,
+			"result":  result,
 		})
-	})
+	}).Methods("POST", "OPTIONS")
 
 	// Invoke function handler
-	http.HandleFunc("/invoke/", func(w http.ResponseWriter, r *http.Request) {
+	invokeHandler := func(w http.ResponseWriter, r *http.Request) {
 		// Enable CORS
 		enableCors(w, r)
 
@@ -326,13 +678,37 @@ func main() {
 			return
 		}
 
+		// Track invocation latency for metrics
+		startTime := time.Now()
+
 		// Extract function name from path
-		path := strings.TrimPrefix(r.URL.Path, "/invoke/")
-		functionName := strings.Split(path, "/")[0]
+		functionName := mux.Vars(r)["name"]
+
+		// Log the invocation once it is answered, at the configured verbosity
+		invocationLog := startInvocationLog(w, r, functionName, startTime)
+		defer invocationLog.finish()
+		w = invocationLog
+
+		// Validate a per-request timeout override before doing any work
+		timeout, err := invokeTimeout(r)
+		if err != nil {
+			writeInvocationError(w, &invocationError{Status: http.StatusBadRequest, Message: err.Error()})
+			return
+		}
 
 		// Extract user ID from request headers
 		userID := r.Header.Get("X-User-ID")
 
+		// Resolve a public alias to the function it points at
+		alias, isAlias := resolveAlias(userID, functionName)
+		if isAlias {
+			if userID == "" {
+				userID = alias.UserID
+			}
+			log.Printf("Resolved alias %s to function %s", functionName, alias.Function)
+			functionName = alias.Function
+		}
+
 		// Try to find the function using the composite key first
 		mutex.RLock()
 		var function *Function
@@ -356,107 +732,345 @@ func main() {
 		mutex.RUnlock()
 
 		if !exists {
-			http.Error(w, fmt.Sprintf("Function '%s' not found", functionName), http.StatusNotFound)
+			if isArchived(userID, functionName) {
+				writeInvocationError(w, &invocationError{
+					Status:  http.StatusConflict,
+					Message: fmt.Sprintf("Function '%s' is archived, restore it to invoke it", functionName),
+				})
+				return
+			}
+			writeInvocationError(w, &invocationError{
+				Status:  http.StatusNotFound,
+				Message: fmt.Sprintf("Function '%s' not found", functionName),
+			})
 			return
 		}
 
+		invocationLog.setFunction(function)
+
 		// Only check ownership if user ID is provided (for backward compatibility)
 		if userID != "" && function.UserID != "" && function.UserID != userID {
-			http.Error(w, "You do not have permission to invoke this function", http.StatusForbidden)
+			writeInvocationError(w, &invocationError{
+				Status:  http.StatusForbidden,
+				Message: "You do not have permission to invoke this function",
+			})
 			return
 		}
 
-		// Start container if not running
-		if !function.Running {
-			mutex.Lock()
-			if !function.Running {
-				log.Printf("Starting container for function %s before invocation", functionName)
-				if err := startContainer(function); err != nil {
-					mutex.Unlock()
-					http.Error(w, fmt.Sprintf("Failed to start function: %v", err), http.StatusInternalServerError)
-					return
-				}
-
-				// Wait for container to start and initialize
-				log.Printf("Waiting for function %s container to initialize", functionName)
-				time.Sleep(3 * time.Second)
-			}
-			mutex.Unlock()
-		}
-		
-		// Verify container is actually running
-		if function.Container != "" && !isContainerRunning(function.Container) {
-			log.Printf("Container for function %s is not running, attempting to restart", functionName)
-			mutex.Lock()
-			function.Container = ""
-			function.Running = false
-			if err := startContainer(function); err != nil {
-				mutex.Unlock()
-				http.Error(w, fmt.Sprintf("Failed to restart function: %v", err), http.StatusInternalServerError)
+		// An alias pinned to a version doesn't invoke other versions of its function
+		if isAlias && alias.Version != "" {
+			mutex.RLock()
+			version := function.Version
+			mutex.RUnlock()
+			if version != alias.Version {
+				writeInvocationError(w, &invocationError{
+					Status: http.StatusConflict,
+					Message: fmt.Sprintf("Alias '%s' points at version '%s' of function '%s', which is at version '%s'",
+						alias.Alias, alias.Version, functionName, version),
+				})
 				return
 			}
-			time.Sleep(3 * time.Second)
-			mutex.Unlock()
 		}
 
-		// Forward request to function container via the reverse proxy
-		// Extract the path after the function name
-		subPath := ""
-		if len(strings.Split(path, "/")) > 1 {
-			subPath = strings.Join(strings.Split(path, "/")[1:], "/")
+		// Without a per-request override, the function's own timeout applies
+		if r.Header.Get(invokeTimeoutHeader) == "" {
+			timeout = resolveInvokeTimeout(function)
 		}
 
-		// Build the URL to the function-proxy service
-		functionURL := fmt.Sprintf("http://function-proxy:8090/function/%s", functionName)
-		if subPath != "" {
-			functionURL = fmt.Sprintf("%s/%s", functionURL, subPath)
-		}
-		if r.URL.RawQuery != "" {
-			functionURL = fmt.Sprintf("%s?%s", functionURL, r.URL.RawQuery)
+		// Log the payloads of functions whose owner turned on debug logging
+		w, logDebugInvocation := debugInvocation(w, r, function)
+		defer logDebugInvocation()
+
+		// Break the invocation's latency down into phases when it is traced
+		if traceEnabled(function, r) {
+			var trace *invocationTrace
+			r, trace = startInvocationTrace(r, startTime)
+			defer trace.finish(function, r)
 		}
 
-		log.Printf("Forwarding request to function %s via proxy: %s", functionName, functionURL)
+		// Apply the user's invocation rate limit, charging the owner for anonymous invocations
+		rateLimitKey := userID
+		if rateLimitKey == "" {
+			rateLimitKey = function.UserID
+		}
+		if allowed, wait := allowInvocation(rateLimitKey); !allowed {
+			writeInvocationError(w, &invocationError{
+				Status:     http.StatusTooManyRequests,
+				RetryAfter: retryAfterSeconds(wait),
+				Message:    "Invocation rate limit exceeded",
+			})
+			return
+		}
 
-		// Create a new request to the function proxy
-		proxyReq, err := http.NewRequest(r.Method, functionURL, r.Body)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Error creating proxy request: %v", err), http.StatusInternalServerError)
+		// Invocations with an idempotency key run at most once, repeats get the first result
+		if idempotencyKey := r.Header.Get(idempotencyKeyHeader); idempotencyKey != "" {
+			idempotentInvoke(w, r, function, functionName, idempotencyKey, timeout, startTime)
 			return
 		}
 
-		// Copy headers
-		for key, values := range r.Header {
-			for _, value := range values {
-				proxyReq.Header.Add(key, value)
-			}
+		// Identical concurrent invocations of a function opting in share one execution
+		if coalescingEnabled(function, r) {
+			coalescedInvoke(w, r, function, functionName, timeout, startTime)
+			return
 		}
 
-		// Send request to function via proxy with increased timeout
-		client := &http.Client{Timeout: 25 * time.Second} // Increased timeout but less than client-side 30s
-		resp, err := client.Do(proxyReq)
+		// Retry transient failures of functions configured to, otherwise stream the request
+		var resp *http.Response
+		var release func()
+		if retryEnabled(function, r) {
+			resp, release, err = retryingInvocation(w, function, functionName, r, timeout, startTime)
+		} else {
+			resp, release, err = sendInvocation(function, functionName, r, r.Body, timeout, startTime)
+		}
 		if err != nil {
-			log.Printf("Error invoking function %s via proxy: %v", functionName, err)
-			http.Error(w, fmt.Sprintf("Error invoking function: %v", err), http.StatusInternalServerError)
+			writeInvocationError(w, err)
 			return
 		}
+		defer release()
 		defer resp.Body.Close()
 
-		// Copy response headers
+		// Copy response headers, without the ones the function is configured to strip
+		applyResponseHeaderRules(function, resp.Header)
 		for key, values := range resp.Header {
 			for _, value := range values {
 				w.Header().Add(key, value)
 			}
 		}
+		disableProxyBuffering(w)
+
+		// Wrap a structured error of the function in the error envelope
+		if isFunctionError(resp.StatusCode, resp.Header) {
+			data, _ := io.ReadAll(io.LimitReader(resp.Body, maxFunctionErrorSize))
+			writeFunctionError(w, resp.StatusCode, data)
+			recordInvocation(function.UserID+"-"+function.Name, time.Since(startTime), resp.StatusCode)
+			return
+		}
+
+		// Report the phases up to the response, copying it is only traced in the log
+		if trace := requestTrace(r); trace != nil {
+			w.Header().Add("Server-Timing", trace.serverTiming())
+		}
 
 		// Copy status code
 		w.WriteHeader(resp.StatusCode)
 
-		// Copy response body
-		io.Copy(w, resp.Body)
-	})
+		// Stream the response body as the function writes it
+		responseTime := time.Now()
+		if err := streamResponse(w, resp.Body); err != nil {
+			log.Printf("Error streaming response of function %s: %v", functionName, err)
+		}
+		requestTrace(r).record("response", time.Since(responseTime))
+
+		// Record the invocation once the response has been delivered
+		recordInvocation(function.UserID+"-"+function.Name, time.Since(startTime), resp.StatusCode)
+	}
+	router.HandleFunc("/invoke/{name}", invokeHandler).Methods(withOptions(invocationMethods)...)
+	router.HandleFunc("/invoke/{name}/{path:.*}", invokeHandler).Methods(withOptions(invocationMethods)...)
+
+	// Smoke test a function with a sample request
+	router.HandleFunc("/test/{name}", func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		smokeTestHandler(w, r, mux.Vars(r)["name"])
+	}).Methods("POST", "OPTIONS")
+
+	// Aliases invoking an underlying function
+	aliasRoute := func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		aliasesHandler(w, r, mux.Vars(r)["alias"])
+	}
+	router.HandleFunc("/aliases", aliasRoute).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/aliases/{alias}", aliasRoute).Methods("DELETE", "OPTIONS")
+
+	// Queues whose messages invoke functions
+	queueRoute := func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		queueBindingsHandler(w, r, mux.Vars(r)["queue"])
+	}
+	router.HandleFunc("/queues", queueRoute).Methods("GET", "POST", "OPTIONS")
+	router.HandleFunc("/queues/{queue}", queueRoute).Methods("DELETE", "OPTIONS")
+	router.HandleFunc("/queues/{queue}/messages", func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		publishQueueMessageHandler(w, r, mux.Vars(r)["queue"])
+	}).Methods("POST", "OPTIONS")
+
+	// Invocation limits and usage of the requesting user
+	router.HandleFunc("/usage", func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		usageHandler(w, r)
+	}).Methods("GET", "OPTIONS")
+
+	// Back up and recreate the requesting user's functions
+	router.HandleFunc("/functions/export", func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		exportFunctionsHandler(w, r)
+	}).Methods("GET", "OPTIONS")
+
+	// Functions archived for being idle, restored on demand
+	router.HandleFunc("/functions/archived", func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		archivedFunctionsHandler(w, r)
+	}).Methods("GET", "OPTIONS")
+
+	router.HandleFunc("/functions/{name}/archive", func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		archiveFunctionHandler(w, r, mux.Vars(r)["name"])
+	}).Methods("POST", "OPTIONS")
+
+	router.HandleFunc("/functions/{name}/restore", func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		restoreFunctionHandler(w, r, mux.Vars(r)["name"])
+	}).Methods("POST", "OPTIONS")
+
+	router.HandleFunc("/functions/import", func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		importFunctionsHandler(w, r)
+	}).Methods("POST", "OPTIONS")
+
+	// Function sub-resources
+	router.HandleFunc("/functions/{name}/metrics", func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		functionMetricsHandler(w, r, mux.Vars(r)["name"])
+	}).Methods("GET", "OPTIONS")
+
+	router.HandleFunc("/functions/{name}/describe", func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		describeFunctionHandler(w, r, mux.Vars(r)["name"])
+	}).Methods("GET", "OPTIONS")
+
+	router.HandleFunc("/functions/{name}/debug", func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		debugModeHandler(w, r, mux.Vars(r)["name"])
+	}).Methods("GET", "PUT", "DELETE", "OPTIONS")
+
+	router.HandleFunc("/functions/{name}/refresh", func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		refreshFunctionHandler(w, r, mux.Vars(r)["name"])
+	}).Methods("POST", "OPTIONS")
+
+	router.HandleFunc("/functions/{name}/network", func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		functionNetworkHandler(w, r, mux.Vars(r)["name"])
+	}).Methods("GET", "OPTIONS")
+
+	router.HandleFunc("/functions/{name}/instances", func(w http.ResponseWriter, r *http.Request) {
+		// Enable CORS
+		enableCors(w, r)
+
+		// Handle preflight requests
+		if r.Method == "OPTIONS" {
+			return
+		}
+
+		functionInstancesHandler(w, r, mux.Vars(r)["name"])
+	}).Methods("GET", "OPTIONS")
 
 	// List functions handler - supports both /list and /list/{userId}
-	http.HandleFunc("/list/", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("/list/{userID}", func(w http.ResponseWriter, r *http.Request) {
 		// Enable CORS
 		enableCors(w, r)
 
@@ -466,8 +1080,7 @@ func main() {
 		}
 
 		// Extract user ID from path
-		path := strings.TrimPrefix(r.URL.Path, "/list/")
-		userIDFromPath := path
+		userIDFromPath := mux.Vars(r)["userID"]
 
 		// Create a copy of the functions map to avoid long lock times
 		mutex.RLock()
@@ -483,9 +1096,11 @@ func main() {
 		mutex.RUnlock()
 
 		// Verify the status of each function's container
+		health := make(map[string]string)
 		for _, fn := range functionsCopy {
 			if fn.Container != "" {
-				actuallyRunning := isContainerRunning(fn.Container)
+				actuallyRunning, status := containerStatus(fn.Container)
+				health[fn.Name] = status
 
 				// If the status has changed, update the original function in the map
 				if fn.Running != actuallyRunning {
@@ -519,6 +1134,7 @@ func main() {
 			Env       map[string]string `json:"env,omitempty"`
 			Endpoint  string            `json:"endpoint"`
 			UserID    string            `json:"user_id,omitempty"`
+			Health    string            `json:"health,omitempty"` // starting, healthy or unhealthy for images with a HEALTHCHECK
 		}
 
 		// Create a map with function names as keys
@@ -534,16 +1150,17 @@ func main() {
 				Env:       fn.Env,
 				Endpoint:  endpoint,
 				UserID:    fn.UserID,
+				Health:    health[fn.Name],
 			}
 		}
 
 		// Write the response
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(responseMap)
-	})
+	}).Methods("GET", "OPTIONS")
 
 	// List functions handler
-	http.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
 		// Enable CORS
 		enableCors(w, r)
 
@@ -585,9 +1202,11 @@ func main() {
 		mutex.RUnlock()
 
 		// Verify the status of each function's container
+		health := make(map[string]string)
 		for _, fn := range functionsCopy {
 			if fn.Container != "" {
-				actuallyRunning := isContainerRunning(fn.Container)
+				actuallyRunning, status := containerStatus(fn.Container)
+				health[fn.Name] = status
 
 				// If the status has changed, update the original function in the map
 				if fn.Running != actuallyRunning {
@@ -621,6 +1240,7 @@ func main() {
 			Env       map[string]string `json:"env,omitempty"`
 			Endpoint  string            `json:"endpoint"`
 			UserID    string            `json:"user_id,omitempty"`
+			Health    string            `json:"health,omitempty"` // starting, healthy or unhealthy for images with a HEALTHCHECK
 		}
 
 		// Create a map with function names as keys
@@ -636,16 +1256,17 @@ func main() {
 				Env:       fn.Env,
 				Endpoint:  endpoint,
 				UserID:    fn.UserID,
+				Health:    health[fn.Name],
 			}
 		}
 
 		// Write the response
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(responseMap)
-	})
+	}).Methods("GET", "OPTIONS")
 
 	// Start function handler
-	http.HandleFunc("/start/", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("/start/{name}", func(w http.ResponseWriter, r *http.Request) {
 		// Enable CORS
 		enableCors(w, r)
 
@@ -654,11 +1275,6 @@ func main() {
 			return
 		}
 
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
 		// Extract user ID from request headers
 		userID := r.Header.Get("X-User-ID")
 		if userID == "" {
@@ -666,7 +1282,7 @@ func main() {
 			return
 		}
 
-		functionName := strings.TrimPrefix(r.URL.Path, "/start/")
+		functionName := mux.Vars(r)["name"]
 
 		mutex.Lock()
 		defer mutex.Unlock()
@@ -716,12 +1332,46 @@ func main() {
 			}
 		}
 
+		// Refuse to start a container that would crash on missing configuration
+		if err := validateEnv(function); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Pull the image without holding the registry lock, so a slow pull doesn't hold up
+		// other requests. The function may be deleted or started meanwhile.
+		mutex.Unlock()
+		err := pullImageForStart(function)
+		mutex.Lock()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to start function: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if functions[functionKey] != function || function.Running {
+			http.Error(w, fmt.Sprintf("Function '%s' changed while its image was pulled, try again", functionName), http.StatusConflict)
+			return
+		}
+
+		// Starting the function again clears the crash
+		function.Crash = nil
+
 		// Start the container
 		if err := startContainer(function); err != nil {
 			http.Error(w, fmt.Sprintf("Failed to start function: %v", err), http.StatusInternalServerError)
 			return
 		}
 
+		// Surface permission problems instead of leaving a silent crash loop, without
+		// holding the registry lock while the container is watched
+		containerID := function.Container
+		mutex.Unlock()
+		err = checkContainerStartup(function, containerID)
+		mutex.Lock()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to start function: %v", err), http.StatusInternalServerError)
+			return
+		}
+
 		// Verify the container is actually running
 		if !isContainerRunning(function.Container) {
 			function.Running = false
@@ -735,10 +1385,10 @@ func main() {
 			"running":   true,
 			"container": function.Container,
 		})
-	})
+	}).Methods("POST", "OPTIONS")
 
 	// Stop function handler
-	http.HandleFunc("/stop/", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("/stop/{name}", func(w http.ResponseWriter, r *http.Request) {
 		// Enable CORS
 		enableCors(w, r)
 
@@ -747,11 +1397,6 @@ func main() {
 			return
 		}
 
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
 		// Extract user ID from request headers
 		userID := r.Header.Get("X-User-ID")
 		if userID == "" {
@@ -759,7 +1404,7 @@ func main() {
 			return
 		}
 
-		functionName := strings.TrimPrefix(r.URL.Path, "/stop/")
+		functionName := mux.Vars(r)["name"]
 
 		mutex.Lock()
 		defer mutex.Unlock()
@@ -797,6 +1442,7 @@ func main() {
 		if function.Container == "" || !isContainerRunning(function.Container) {
 			function.Running = false
 			function.Container = ""
+			removeStrayContainers(function)
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(map[string]string{
 				"message": fmt.Sprintf("Function '%s' is not running", functionName),
@@ -819,15 +1465,18 @@ func main() {
 		function.Running = false
 		function.Container = ""
 
+		// Containers the registry lost track of would keep serving the function
+		removeStrayContainers(function)
+
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(map[string]interface{}{
 			"message": fmt.Sprintf("Function '%s' stopped successfully", functionName),
 			"running": false,
 		})
-	})
+	}).Methods("POST", "OPTIONS")
 
 	// Delete function handler
-	http.HandleFunc("/delete/", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("/delete/{name}", func(w http.ResponseWriter, r *http.Request) {
 		// Enable CORS with explicit headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
@@ -835,15 +1484,11 @@ func main() {
 
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
+			setAllowHeader(w, r)
 			w.WriteHeader(http.StatusOK)
 			return
 		}
 
-		if r.Method != http.MethodDelete {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
 		// Extract user ID from request headers
 		userID := r.Header.Get("X-User-ID")
 		if userID == "" {
@@ -851,7 +1496,7 @@ func main() {
 			return
 		}
 
-		functionName := strings.TrimPrefix(r.URL.Path, "/delete/")
+		functionName := mux.Vars(r)["name"]
 
 		mutex.Lock()
 		defer mutex.Unlock()
@@ -874,6 +1519,18 @@ func main() {
 			}
 		}
 		
+		// Deleting an archived function drops its archived definition
+		if !exists && isArchived(userID, functionName) {
+			discardArchivedFunction(functionKey)
+			log.Printf("Archived function '%s' deleted", functionName)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{
+				"message": fmt.Sprintf("Function '%s' deleted successfully", functionName),
+				"status":  "success",
+			})
+			return
+		}
+
 		if !exists {
 			log.Printf("Function '%s' not found for deletion", functionName)
 			http.Error(w, fmt.Sprintf("Function '%s' not found", functionName), http.StatusNotFound)
@@ -901,12 +1558,23 @@ func main() {
 			}
 		}
 
+		// Remove containers of the function the registry doesn't track, found by their labels
+		removeStrayContainers(function)
+
+		// Data volumes are kept unless the caller asks to remove them with ?remove_data=true
+		if function.DataVolume && r.URL.Query().Get("remove_data") == "true" {
+			if err := removeDataVolume(function); err != nil {
+				log.Printf("Warning: %v", err)
+			}
+		}
+
 		// Delete the function from the registry
 		delete(functions, functionKey)
+		deleteInvocationMetrics(functionKey)
 		log.Printf("Function '%s' removed from registry", functionName)
 		
-		// Save registry to file
-		go saveRegistry()
+		// Save registry to file on the next flush
+		markRegistryDirty()
 
 		// Set response headers
 		w.Header().Set("Content-Type", "application/json")
@@ -918,10 +1586,10 @@ func main() {
 			"status": "success",
 		})
 		log.Printf("Delete response sent for function '%s'", functionName)
-	})
+	}).Methods("DELETE", "OPTIONS")
 
 	// Health check endpoint
-	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		// Enable CORS
 		enableCors(w, r)
 
@@ -932,10 +1600,10 @@ func main() {
 
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
-	})
+	}).Methods("GET", "OPTIONS")
 
 	// Get function logs endpoint (plain text version)
-	http.HandleFunc("/logs/", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("/logs/{name}", func(w http.ResponseWriter, r *http.Request) {
 		// Enable CORS
 		enableCors(w, r)
 
@@ -945,8 +1613,14 @@ func main() {
 		}
 
 		// Extract function name from path
-		functionName := strings.TrimPrefix(r.URL.Path, "/logs/")
-		
+		functionName := mux.Vars(r)["name"]
+
+		// Download the full logs as a file
+		if r.URL.Query().Get("download") == "true" {
+			downloadLogsHandler(w, r, functionName)
+			return
+		}
+
 		// Get lines parameter (default to 100)
 		lines := 100
 		if linesParam := r.URL.Query().Get("lines"); linesParam != "" {
@@ -976,10 +1650,10 @@ func main() {
 		// Return logs as plain text
 		w.Header().Set("Content-Type", "text/plain")
 		w.Write([]byte(logs))
-	})
+	}).Methods("GET", "OPTIONS")
 
 	// Get function logs endpoint (JSON version)
-	http.HandleFunc("/logs-json/", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("/logs-json/{name}", func(w http.ResponseWriter, r *http.Request) {
 		// Enable CORS
 		enableCors(w, r)
 
@@ -989,7 +1663,7 @@ func main() {
 		}
 
 		// Extract function name from path
-		functionName := strings.TrimPrefix(r.URL.Path, "/logs-json/")
+		functionName := mux.Vars(r)["name"]
 		
 		// Get lines parameter (default to 100)
 		lines := 100
@@ -1031,10 +1705,10 @@ func main() {
 			"container": function.Container,
 			"timestamp": time.Now().Unix(),
 		})
-	})
+	}).Methods("GET", "OPTIONS")
 
 	// Start server
 	port := 8081
 	log.Printf("Function Controller starting on port %d", port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
+	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), router))
 }
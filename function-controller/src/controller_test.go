@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRawSubPath(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/invoke/hello", ""},
+		{"/invoke/hello/", "/"},
+		{"/invoke/hello/items", "/items"},
+		{"/invoke/hello/items/", "/items/"},
+		{"/invoke/hello/files/a%2Fb", "/files/a%2Fb"},
+		{"/invoke/hello/hello%20world", "/hello%20world"},
+		{"/invoke/hello/files/a%252Fb", "/files/a%252Fb"},
+		{"/invoke/hello/a%2Fb/c%20d/", "/a%2Fb/c%20d/"},
+		{"/invoke/hello?name=world", ""},
+		{"/invoke/hello/search?q=a%2Fb", "/search"},
+		{"/invoke/hello/?q=1", "/"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.target, nil)
+		if got := rawSubPath(r); got != test.want {
+			t.Errorf("rawSubPath(%q) = %q, want %q", test.target, got, test.want)
+		}
+	}
+}
+
+func TestAllowHeader(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/invoke/hello", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"},
+		{"/invoke/hello/items", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"},
+		{"/register", "POST, OPTIONS"},
+		{"/functions/hello", "GET, OPTIONS"},
+		{"/functions/hello/refresh", "POST, OPTIONS"},
+		{"/functions/hello/debug", "GET, PUT, DELETE, OPTIONS"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		setAllowHeader(w, httptest.NewRequest(http.MethodOptions, test.path, nil))
+		if got := w.Header().Get("Allow"); got != test.want {
+			t.Errorf("Allow for %s = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+// Same-named functions of different users answer on different names
+func TestFunctionNetworkAlias(t *testing.T) {
+	tests := []struct {
+		function Function
+		want     string
+	}{
+		{Function{Name: "resize", UserID: "user_3f9a1c2b4d5e"}, "user_3f9a1c2b4d5e-resize"},
+		{Function{Name: "resize", UserID: "user_9e8d7c6b5a4f"}, "user_9e8d7c6b5a4f-resize"},
+		{Function{Name: "resize"}, "resize"},
+	}
+
+	for _, test := range tests {
+		if got := functionNetworkAlias(&test.function); got != test.want {
+			t.Errorf("functionNetworkAlias(%s of %q) = %q, want %q", test.function.Name, test.function.UserID, got, test.want)
+		}
+	}
+}
+
+// The debug and invocation logs redact the same credentials
+func TestRedactedCredentials(t *testing.T) {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer token")
+	header.Set("Cookie", "session=secret")
+	header.Set("Set-Cookie", "session=secret; HttpOnly")
+	header.Set("Content-Type", "application/json")
+
+	debug := debugHeaders(header)
+	want := "{Authorization: [REDACTED]; Content-Type: application/json; Cookie: [REDACTED]; Set-Cookie: [REDACTED]}"
+	if debug != want {
+		t.Errorf("debugHeaders() = %s, want %s", debug, want)
+	}
+
+	logged := redactedHeaders(header)
+	for _, key := range []string{"Authorization", "Cookie", "Set-Cookie"} {
+		if logged[key] != "[REDACTED]" {
+			t.Errorf("invocation log header %s = %q, want it redacted", key, logged[key])
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Debug logging of invocation payloads, off by default. The owner enables it per function
+// for a limited window: debugLogWindow unless the request asks for a shorter or longer one,
+// at most debugLogMaxWindow. Bodies are logged up to debugLogMaxBytes. Configured with
+// DEBUG_LOG_WINDOW, DEBUG_LOG_MAX_WINDOW and DEBUG_LOG_MAX_BYTES.
+var (
+	debugLogWindow    = 15 * time.Minute
+	debugLogMaxWindow = 24 * time.Hour
+	debugLogMaxBytes  = 4096
+)
+
+// DebugModeRequest enables debug logging of a function
+type DebugModeRequest struct {
+	Duration string `json:"duration,omitempty"` // How long debug logging stays on, e.g. 30m
+}
+
+// DebugModeResponse reports whether debug logging of a function is on
+type DebugModeResponse struct {
+	Function string     `json:"function"`
+	Enabled  bool       `json:"enabled"`
+	Until    *time.Time `json:"until,omitempty"`
+	MaxBytes int        `json:"max_bytes"` // Bodies are truncated to this many bytes
+}
+
+// End of the debug logging window of each function, keyed like the function registry.
+// Kept in memory only, so a restart turns debug logging off.
+var (
+	debugModes = make(map[string]time.Time)
+	debugMutex sync.Mutex
+)
+
+func init() {
+	if value := os.Getenv("DEBUG_LOG_WINDOW"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			debugLogWindow = parsed
+		} else {
+			log.Printf("Invalid DEBUG_LOG_WINDOW %q, using default %s", value, debugLogWindow)
+		}
+	}
+	if value := os.Getenv("DEBUG_LOG_MAX_WINDOW"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			debugLogMaxWindow = parsed
+		} else {
+			log.Printf("Invalid DEBUG_LOG_MAX_WINDOW %q, using default %s", value, debugLogMaxWindow)
+		}
+	}
+	if value := os.Getenv("DEBUG_LOG_MAX_BYTES"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			debugLogMaxBytes = parsed
+		} else {
+			log.Printf("Invalid DEBUG_LOG_MAX_BYTES %q, using default %d", value, debugLogMaxBytes)
+		}
+	}
+}
+
+// debugModeUntil returns when debug logging of a function ends, dropping expired windows
+func debugModeUntil(functionKey string) (time.Time, bool) {
+	debugMutex.Lock()
+	defer debugMutex.Unlock()
+
+	until, exists := debugModes[functionKey]
+	if exists && time.Now().After(until) {
+		delete(debugModes, functionKey)
+		log.Printf("Debug logging of function %s expired", functionKey)
+		return time.Time{}, false
+	}
+	return until, exists
+}
+
+// debugModeHandler manages debug logging of one of the requesting user's functions:
+// GET reports it, PUT turns it on for a window and DELETE turns it off
+func debugModeHandler(w http.ResponseWriter, r *http.Request, functionName string) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	function, functionKey, exists := findFunction(userID, functionName)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Function '%s' not found", functionName), http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var request DebugModeRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil && err != io.EOF {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		window := debugLogWindow
+		if request.Duration != "" {
+			parsed, err := time.ParseDuration(request.Duration)
+			if err != nil || parsed <= 0 {
+				http.Error(w, fmt.Sprintf("Invalid duration '%s'", request.Duration), http.StatusBadRequest)
+				return
+			}
+			window = parsed
+		}
+		if window > debugLogMaxWindow {
+			http.Error(w, fmt.Sprintf("Duration must not exceed %s", debugLogMaxWindow), http.StatusBadRequest)
+			return
+		}
+
+		debugMutex.Lock()
+		debugModes[functionKey] = time.Now().Add(window)
+		debugMutex.Unlock()
+		log.Printf("Enabled debug logging of function %s for %s", functionKey, window)
+	case http.MethodDelete:
+		debugMutex.Lock()
+		delete(debugModes, functionKey)
+		debugMutex.Unlock()
+		log.Printf("Disabled debug logging of function %s", functionKey)
+	default:
+		methodNotAllowed(w, r)
+		return
+	}
+
+	response := DebugModeResponse{Function: function.Name, MaxBytes: debugLogMaxBytes}
+	if until, enabled := debugModeUntil(functionKey); enabled {
+		response.Enabled = true
+		response.Until = &until
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// debugCapture keeps the first debugLogMaxBytes bytes written to it
+type debugCapture struct {
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (c *debugCapture) Write(p []byte) (int, error) {
+	if room := debugLogMaxBytes - c.buf.Len(); room < len(p) {
+		c.truncated = true
+		if room > 0 {
+			c.buf.Write(p[:room])
+		}
+	} else {
+		c.buf.Write(p)
+	}
+	return len(p), nil
+}
+
+// String returns the captured bytes, quoted so binary payloads don't garble the log
+func (c *debugCapture) String() string {
+	if c.truncated {
+		return fmt.Sprintf("%q (truncated to %d bytes)", c.buf.String(), debugLogMaxBytes)
+	}
+	return strconv.Quote(c.buf.String())
+}
+
+// debugResponseWriter captures the status and the start of the body written to a client
+type debugResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   debugCapture
+}
+
+func (w *debugResponseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *debugResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(p)
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush keeps streamed responses streaming while they are captured
+func (w *debugResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// debugInvocation captures the request and response of an invocation when debug logging of
+// the function is on, returning the writer to respond with and a function logging both once
+// the response is complete
+func debugInvocation(w http.ResponseWriter, r *http.Request, function *Function) (http.ResponseWriter, func()) {
+	functionKey := function.UserID + "-" + function.Name
+	if _, enabled := debugModeUntil(functionKey); !enabled {
+		return w, func() {}
+	}
+
+	request := &debugCapture{}
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(r.Body, request), r.Body}
+	response := &debugResponseWriter{ResponseWriter: w}
+
+	return response, func() {
+		log.Printf("[debug] Invocation of function %s: %s %s, headers: %s, body: %s",
+			functionKey, r.Method, r.URL.RequestURI(), debugHeaders(r.Header), request)
+		log.Printf("[debug] Response of function %s: status %d, headers: %s, body: %s",
+			functionKey, response.status, debugHeaders(response.Header()), &response.body)
+	}
+}
+
+// debugHeaders formats headers for the debug log, with credentials redacted
+func debugHeaders(header http.Header) string {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := strings.Join(header[key], ", ")
+		if credentialHeaders[http.CanonicalHeaderKey(key)] {
+			value = "[REDACTED]"
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s", key, value))
+	}
+	return "{" + strings.Join(parts, "; ") + "}"
+}
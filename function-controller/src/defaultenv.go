@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix of controller environment variables passed to every function without it, e.g.
+// FUNCTION_DEFAULT_ENV_LOG_ENDPOINT=http://logs:9000 sets LOG_ENDPOINT
+const defaultEnvPrefix = "FUNCTION_DEFAULT_ENV_"
+
+// Default environment variables of every function, from the controller's environment and
+// from the JSON object in DEFAULT_ENV_FILE, which wins over the environment. The file is
+// read again whenever it changes, so defaults are updated without a restart; functions
+// pick them up on their next container start. A function's own env wins over defaults.
+var (
+	defaultEnvFile    = os.Getenv("DEFAULT_ENV_FILE")
+	prefixDefaultEnv  = make(map[string]string)
+	fileDefaultEnv    map[string]string
+	defaultEnvModTime time.Time
+	defaultEnvMutex   sync.Mutex
+)
+
+func init() {
+	for _, entry := range os.Environ() {
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, value := parts[0], parts[1]
+		if name := strings.TrimPrefix(key, defaultEnvPrefix); name != key && name != "" {
+			prefixDefaultEnv[name] = value
+		}
+	}
+	if len(prefixDefaultEnv) > 0 {
+		log.Printf("Loaded %d default function env vars from %s* variables", len(prefixDefaultEnv), defaultEnvPrefix)
+	}
+}
+
+// defaultFunctionEnv returns a copy of the default environment variables, reloading the
+// defaults file if it changed since it was last read
+func defaultFunctionEnv() map[string]string {
+	defaultEnvMutex.Lock()
+	defer defaultEnvMutex.Unlock()
+
+	if defaultEnvFile != "" {
+		reloadDefaultEnvFile()
+	}
+
+	env := make(map[string]string, len(prefixDefaultEnv)+len(fileDefaultEnv))
+	for key, value := range prefixDefaultEnv {
+		env[key] = value
+	}
+	for key, value := range fileDefaultEnv {
+		env[key] = value
+	}
+	return env
+}
+
+// reloadDefaultEnvFile reads the defaults file when its modification time changed. A file
+// that can't be read or parsed keeps the defaults loaded last.
+func reloadDefaultEnvFile() {
+	info, err := os.Stat(defaultEnvFile)
+	if err != nil {
+		if !os.IsNotExist(err) || fileDefaultEnv != nil {
+			log.Printf("Warning: failed to read default env file %s: %v", defaultEnvFile, err)
+		}
+		return
+	}
+	if info.ModTime().Equal(defaultEnvModTime) {
+		return
+	}
+
+	data, err := os.ReadFile(defaultEnvFile)
+	if err != nil {
+		log.Printf("Warning: failed to read default env file %s: %v", defaultEnvFile, err)
+		return
+	}
+	var env map[string]string
+	if err := json.Unmarshal(data, &env); err != nil {
+		log.Printf("Warning: invalid default env file %s, expected a JSON object of strings: %v", defaultEnvFile, err)
+		return
+	}
+	fileDefaultEnv = env
+	defaultEnvModTime = info.ModTime()
+	log.Printf("Loaded %d default function env vars from %s", len(env), defaultEnvFile)
+}
+
+// functionEnv returns the environment of a function's container before the platform's
+// variables are added: the defaults overridden by the function's own env
+func functionEnv(function *Function) map[string]string {
+	env := defaultFunctionEnv()
+	for key, value := range function.Env {
+		env[key] = value
+	}
+	return env
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvVarSpec declares an environment variable a function expects
+type EnvVarSpec struct {
+	Required bool   `json:"required,omitempty"`
+	Type     string `json:"type,omitempty"` // string (default), int, number, bool or url
+}
+
+// Checks for the values of each supported environment variable type
+var envTypeCheckers = map[string]func(string) bool{
+	"string": func(string) bool { return true },
+	"int": func(value string) bool {
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	},
+	"number": func(value string) bool {
+		_, err := strconv.ParseFloat(value, 64)
+		return err == nil
+	},
+	"bool": func(value string) bool {
+		_, err := strconv.ParseBool(value)
+		return err == nil
+	},
+	"url": func(value string) bool {
+		parsed, err := url.Parse(value)
+		return err == nil && parsed.Scheme != "" && parsed.Host != ""
+	},
+}
+
+// validateEnvSchema checks that the schema only uses supported types
+func validateEnvSchema(function *Function) error {
+	for key, spec := range function.EnvSchema {
+		if key == "" {
+			return fmt.Errorf("env schema contains an empty key")
+		}
+		if spec.Type != "" && envTypeCheckers[spec.Type] == nil {
+			return fmt.Errorf("unsupported type '%s' for env var '%s'", spec.Type, key)
+		}
+	}
+	return nil
+}
+
+// validateEnv checks a function's env against its declared schema and reports
+// every missing required key and every value of the wrong type
+func validateEnv(function *Function) error {
+	var missing, invalid []string
+	env := functionEnv(function)
+	injected := platformEnv(function)
+	for key, spec := range function.EnvSchema {
+		value, exists := env[key]
+		if !exists {
+			// Variables the platform injects satisfy the schema too
+			value, exists = injected[key]
+		}
+		if !exists || value == "" {
+			if spec.Required {
+				missing = append(missing, key)
+			}
+			continue
+		}
+		if spec.Type != "" && !envTypeCheckers[spec.Type](value) {
+			invalid = append(invalid, fmt.Sprintf("%s (expected %s)", key, spec.Type))
+		}
+	}
+	if len(missing) == 0 && len(invalid) == 0 {
+		return nil
+	}
+
+	sort.Strings(missing)
+	sort.Strings(invalid)
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing required env vars: "+strings.Join(missing, ", "))
+	}
+	if len(invalid) > 0 {
+		problems = append(problems, "invalid env vars: "+strings.Join(invalid, ", "))
+	}
+	return fmt.Errorf("%s", strings.Join(problems, "; "))
+}
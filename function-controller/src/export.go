@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Version of the function export format
+const functionExportVersion = 1
+
+// FunctionExport is a backup of a user's function definitions that import recreates
+type FunctionExport struct {
+	Version    int                `json:"version"`
+	ExportedAt time.Time          `json:"exported_at"`
+	Functions  []ExportedFunction `json:"functions"`
+}
+
+// ExportedFunction is a function definition without its runtime state. Secret values are
+// never exported, only their names; an import may set the values again in secrets.
+type ExportedFunction struct {
+	Function
+	SecretNames []string `json:"secret_names,omitempty"`
+}
+
+// ImportResult reports what importing one function did
+type ImportResult struct {
+	Function string `json:"function"`
+	Result   string `json:"result"` // created, updated or skipped
+	Message  string `json:"message"`
+}
+
+// exportFunctionsHandler returns the definitions of all functions of the requesting user
+func exportFunctionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	export := FunctionExport{
+		Version:    functionExportVersion,
+		ExportedAt: time.Now().UTC(),
+		Functions:  []ExportedFunction{},
+	}
+	mutex.RLock()
+	for _, function := range functions {
+		if function.UserID != userID {
+			continue
+		}
+		exported := ExportedFunction{Function: *function}
+		for name := range function.Secrets {
+			exported.SecretNames = append(exported.SecretNames, name)
+		}
+		sort.Strings(exported.SecretNames)
+		clearRuntimeState(&exported.Function)
+		export.Functions = append(export.Functions, exported)
+	}
+	mutex.RUnlock()
+	sort.Slice(export.Functions, func(i, j int) bool { return export.Functions[i].Name < export.Functions[j].Name })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"functions-%s.json\"", export.ExportedAt.Format("20060102-150405")))
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(export)
+}
+
+// importFunctionsHandler registers the functions of an export for the requesting user.
+// Existing functions are skipped unless ?overwrite=true replaces them. Every function is
+// validated before any is registered; imported functions are registered stopped.
+func importFunctionsHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var export FunctionExport
+	if err := json.NewDecoder(r.Body).Decode(&export); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if export.Version != functionExportVersion {
+		http.Error(w, fmt.Sprintf("Unsupported export version %d, expected %d", export.Version, functionExportVersion), http.StatusBadRequest)
+		return
+	}
+
+	// Validate the whole export first so a bad definition doesn't leave it half imported
+	seen := make(map[string]bool)
+	imported := make([]*Function, 0, len(export.Functions))
+	for i := range export.Functions {
+		function := export.Functions[i].Function
+		if function.Name == "" || function.Image == "" {
+			http.Error(w, fmt.Sprintf("Function %d has no name or image", i+1), http.StatusBadRequest)
+			return
+		}
+		if seen[function.Name] {
+			http.Error(w, fmt.Sprintf("Function '%s' appears more than once", function.Name), http.StatusBadRequest)
+			return
+		}
+		seen[function.Name] = true
+
+		secrets := function.Secrets
+		clearRuntimeState(&function)
+		function.UserID = userID
+		function.Secrets = secrets
+		if err := validateFunction(&function); err != nil {
+			http.Error(w, fmt.Sprintf("Function '%s': %v", function.Name, err), http.StatusBadRequest)
+			return
+		}
+		qualifyFunctionImage(&function)
+		if err := encryptSecrets(&function); err != nil {
+			log.Printf("Failed to encrypt secrets of function %s: %v", function.Name, err)
+			http.Error(w, "Failed to encrypt function secrets", http.StatusInternalServerError)
+			return
+		}
+		imported = append(imported, &function)
+	}
+
+	overwrite := r.URL.Query().Get("overwrite") == "true"
+	results := make([]ImportResult, 0, len(imported))
+	for i, function := range imported {
+		result := ImportResult{Function: function.Name}
+		functionKey := function.UserID + "-" + function.Name
+		if err := ensureRegistryCapacity(functionKey); err != nil {
+			result.Result = "skipped"
+			result.Message = err.Error()
+			results = append(results, result)
+			continue
+		}
+		replaced, stored := storeFunction(function, overwrite)
+		if stored {
+			discardArchivedFunction(functionKey)
+		}
+		switch {
+		case !stored:
+			result.Result = "skipped"
+			result.Message = fmt.Sprintf("Function '%s' already exists, import with ?overwrite=true to replace it", function.Name)
+		case replaced:
+			result.Result = "updated"
+			result.Message = fmt.Sprintf("Function '%s' updated", function.Name)
+		default:
+			result.Result = "created"
+			result.Message = fmt.Sprintf("Function '%s' created", function.Name)
+		}
+
+		// Point out secrets the export left out that the import didn't set again
+		if stored {
+			var missing []string
+			for _, name := range export.Functions[i].SecretNames {
+				if _, ok := function.Secrets[name]; !ok {
+					missing = append(missing, name)
+				}
+			}
+			if len(missing) > 0 {
+				result.Message += fmt.Sprintf(", secrets %s must be set again", strings.Join(missing, ", "))
+			}
+		}
+		results = append(results, result)
+	}
+	log.Printf("Imported %d functions for user %s", len(imported), userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"functions": results,
+	})
+}
+
+// clearRuntimeState drops the fields of a function describing its container rather than
+// its definition
+func clearRuntimeState(function *Function) {
+	function.Container = ""
+	function.Running = false
+	function.UserID = ""
+	function.Crash = nil
+	function.Secrets = nil
+	function.RegisteredAt = nil
+}
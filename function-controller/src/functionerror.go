@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Header a function sets on an error response whose body is a structured error, a JSON
+// object with a code, a message and optional details
+const functionErrorHeader = "X-Function-Error"
+
+// Header telling clients whether a failed invocation failed in the function or the platform
+const errorOriginHeader = "X-Error-Origin"
+
+// Origins of invocation errors
+const (
+	errorOriginFunction = "function"
+	errorOriginPlatform = "platform"
+)
+
+// Largest structured error body read from a function
+const maxFunctionErrorSize = 64 * 1024
+
+// ErrorEnvelope is the body of every failed invocation, whether the function reported the
+// error or the platform failed to invoke it
+type ErrorEnvelope struct {
+	Error InvocationErrorBody `json:"error"`
+}
+
+// InvocationErrorBody describes a failed invocation
+type InvocationErrorBody struct {
+	Origin  string          `json:"origin"` // function or platform
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Status  int             `json:"status"`
+	Details json.RawMessage `json:"details,omitempty"` // Passed through from the function
+}
+
+// Codes of the platform's invocation errors by status
+var platformErrorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "conflict",
+	http.StatusRequestEntityTooLarge: "payload_too_large",
+	http.StatusUnprocessableEntity:   "unprocessable_entity",
+	http.StatusTooManyRequests:       "too_many_requests",
+	http.StatusBadGateway:            "bad_gateway",
+	http.StatusServiceUnavailable:    "unavailable",
+	http.StatusGatewayTimeout:        "timeout",
+}
+
+// platformErrorCode returns the code of a platform invocation error with a status
+func platformErrorCode(status int) string {
+	if code, ok := platformErrorCodes[status]; ok {
+		return code
+	}
+	return "internal_error"
+}
+
+// writeErrorEnvelope writes a failed invocation's error envelope
+func writeErrorEnvelope(w http.ResponseWriter, body InvocationErrorBody) {
+	w.Header().Del("Content-Length")
+	w.Header().Del(functionErrorHeader)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set(errorOriginHeader, body.Origin)
+	w.WriteHeader(body.Status)
+	json.NewEncoder(w).Encode(ErrorEnvelope{Error: body})
+}
+
+// isFunctionError reports whether a function response is a structured error
+func isFunctionError(status int, header http.Header) bool {
+	if status < 400 {
+		return false
+	}
+	value := header.Get(functionErrorHeader)
+	return value != "" && !strings.EqualFold(value, "false")
+}
+
+// writeFunctionError wraps a function's structured error in the error envelope, keeping
+// the function's status. A body that isn't the expected JSON becomes the message.
+func writeFunctionError(w http.ResponseWriter, status int, data []byte) {
+	var reported struct {
+		Code    string          `json:"code"`
+		Message string          `json:"message"`
+		Details json.RawMessage `json:"details"`
+	}
+	body := InvocationErrorBody{Origin: errorOriginFunction, Status: status}
+	if err := json.Unmarshal(data, &reported); err == nil {
+		body.Code = reported.Code
+		body.Message = reported.Message
+		body.Details = reported.Details
+	} else {
+		body.Message = string(bytes.TrimSpace(data))
+	}
+	if body.Code == "" {
+		body.Code = "function_error"
+	}
+	if body.Message == "" {
+		body.Message = "Function failed with status " + strconv.Itoa(status)
+	}
+	writeErrorEnvelope(w, body)
+}
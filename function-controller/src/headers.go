@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Headers that header rules may not touch, since the platform relies on them
+var protectedHeaders = map[string]bool{
+	"Host":              true,
+	"Content-Length":    true,
+	"Transfer-Encoding": true,
+	"Connection":        true,
+	"X-User-Id":         true,
+	"X-Username":        true,
+	"X-Function-Owner":  true,
+	"X-Invoke-Timeout":  true,
+}
+
+// Headers carrying credentials, never written to the invocation or debug logs
+var credentialHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+// validateHeaderName checks that a header rule names a valid, non-protected header
+func validateHeaderName(name string) error {
+	if name == "" || strings.ContainsAny(name, " \t\r\n:") {
+		return fmt.Errorf("invalid header name '%s'", name)
+	}
+	if protectedHeaders[http.CanonicalHeaderKey(name)] {
+		return fmt.Errorf("header '%s' is managed by the platform and can't be changed", name)
+	}
+	return nil
+}
+
+// validateHeaderRules checks the request/response header rules of a function
+func validateHeaderRules(function *Function) error {
+	for name, value := range function.AddRequestHeaders {
+		if err := validateHeaderName(name); err != nil {
+			return err
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid value for header '%s'", name)
+		}
+	}
+	for _, name := range function.RemoveResponseHeaders {
+		if err := validateHeaderName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyRequestHeaderRules injects the function's configured headers into a forwarded request
+func applyRequestHeaderRules(function *Function, header http.Header) {
+	for name, value := range function.AddRequestHeaders {
+		header.Set(name, value)
+	}
+}
+
+// applyResponseHeaderRules strips the function's configured headers from a response
+func applyResponseHeaderRules(function *Function, header http.Header) {
+	for _, name := range function.RemoveResponseHeaders {
+		header.Del(name)
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Header identifying an invocation that must run at most once; repeats get the first result
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// Header set on responses replayed from an earlier invocation with the same key
+const idempotentReplayedHeader = "Idempotent-Replayed"
+
+// Longest idempotency key accepted
+const maxIdempotencyKeyLength = 255
+
+// How long the result of an idempotent invocation is replayed, configured with
+// IDEMPOTENCY_TTL, how many results are kept at most, configured with
+// IDEMPOTENCY_MAX_ENTRIES, and how many bytes of responses they may take up, configured
+// with IDEMPOTENCY_MAX_BYTES. The oldest results are evicted first when the store is full.
+var (
+	idempotencyTTL        = 24 * time.Hour
+	idempotencyMaxEntries = 10000
+	idempotencyMaxBytes   = 64 * 1024 * 1024
+)
+
+// idempotentResult is the result of an idempotent invocation, without a response while
+// the invocation is in flight
+type idempotentResult struct {
+	key       string
+	signature string // Signature of the request, repeats must send the same one
+	response  *bufferedResponse
+	size      int // Bytes the response takes up
+	createdAt time.Time
+	element   *list.Element // Position in idempotentOrder
+}
+
+// Results of idempotent invocations keyed by function, caller and idempotency key, and
+// the same results from oldest to newest so expired and evicted ones are found first
+var (
+	idempotentResults = make(map[string]*idempotentResult)
+	idempotentOrder   = list.New()
+	idempotentBytes   int // Bytes taken up by the stored responses
+	idempotencyMutex  sync.Mutex
+)
+
+func init() {
+	if value := os.Getenv("IDEMPOTENCY_TTL"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			idempotencyTTL = parsed
+		} else {
+			log.Printf("Invalid IDEMPOTENCY_TTL %q, using default %s", value, idempotencyTTL)
+		}
+	}
+	if value := os.Getenv("IDEMPOTENCY_MAX_ENTRIES"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			idempotencyMaxEntries = parsed
+		} else {
+			log.Printf("Invalid IDEMPOTENCY_MAX_ENTRIES %q, using default %d", value, idempotencyMaxEntries)
+		}
+	}
+	if value := os.Getenv("IDEMPOTENCY_MAX_BYTES"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			idempotencyMaxBytes = parsed
+		} else {
+			log.Printf("Invalid IDEMPOTENCY_MAX_BYTES %q, using default %d", value, idempotencyMaxBytes)
+		}
+	}
+}
+
+// idempotentInvoke invokes a function at most once per idempotency key within
+// idempotencyTTL, replaying the first response to repeated invocations. A repeat while
+// the first invocation is in flight is rejected, as is one with a different request.
+func idempotentInvoke(w http.ResponseWriter, r *http.Request, function *Function, functionName string, idempotencyKey string, timeout time.Duration, startTime time.Time) {
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		writeInvocationError(w, &invocationError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("%s must not exceed %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength),
+		})
+		return
+	}
+
+	body, err := readInvocationBody(r)
+	if err != nil {
+		writeInvocationError(w, err)
+		return
+	}
+	signature := invocationSignature(r, function, body)
+	key := fmt.Sprintf("%s-%s\x00%s\x00%s", function.UserID, function.Name, r.Header.Get("X-User-ID"), idempotencyKey)
+
+	idempotencyMutex.Lock()
+	result, exists := idempotentResults[key]
+	if exists && time.Since(result.createdAt) > idempotencyTTL {
+		removeIdempotentResult(result)
+		exists = false
+	}
+	if exists {
+		idempotencyMutex.Unlock()
+		switch {
+		case result.signature != signature:
+			writeInvocationError(w, &invocationError{
+				Status:  http.StatusUnprocessableEntity,
+				Message: fmt.Sprintf("%s was already used for a different request", idempotencyKeyHeader),
+			})
+		case result.response == nil:
+			writeInvocationError(w, &invocationError{
+				Status:     http.StatusConflict,
+				RetryAfter: "1",
+				Message:    fmt.Sprintf("An invocation with this %s is still in progress", idempotencyKeyHeader),
+			})
+		default:
+			log.Printf("Replaying result of function %s for idempotency key %q", functionName, idempotencyKey)
+			w.Header().Set(idempotentReplayedHeader, "true")
+			writeBufferedResponse(w, result.response)
+		}
+		return
+	}
+
+	// Reserve the key so repeats don't run the function while it is in flight
+	result = &idempotentResult{key: key, signature: signature, createdAt: time.Now()}
+	result.element = idempotentOrder.PushBack(result)
+	idempotentResults[key] = result
+	evictIdempotentResults(result)
+	idempotencyMutex.Unlock()
+
+	response, err := bufferedInvocation(function, functionName, r, body, timeout, startTime)
+	idempotencyMutex.Lock()
+	if idempotentResults[key] == result {
+		if err != nil {
+			// The function didn't respond, so a retry may run it
+			removeIdempotentResult(result)
+		} else {
+			result.response = response
+			result.size = bufferedResponseSize(response)
+			idempotentBytes += result.size
+			evictIdempotentResults(result)
+		}
+	}
+	idempotencyMutex.Unlock()
+
+	if err != nil {
+		writeInvocationError(w, err)
+		return
+	}
+	writeBufferedResponse(w, response)
+}
+
+// removeIdempotentResult drops a result from the store. Callers hold idempotencyMutex.
+func removeIdempotentResult(result *idempotentResult) {
+	delete(idempotentResults, result.key)
+	idempotentOrder.Remove(result.element)
+	idempotentBytes -= result.size
+}
+
+// evictIdempotentResults drops expired results and, while the store holds too many results
+// or bytes, the oldest ones other than keep. Results in flight are passed over while
+// completed ones are left. Callers hold idempotencyMutex.
+func evictIdempotentResults(keep *idempotentResult) {
+	// Results are ordered by creation, so the expired ones are at the front
+	for element := idempotentOrder.Front(); element != nil; element = idempotentOrder.Front() {
+		result := element.Value.(*idempotentResult)
+		if result == keep || time.Since(result.createdAt) <= idempotencyTTL {
+			break
+		}
+		removeIdempotentResult(result)
+	}
+
+	for len(idempotentResults) > idempotencyMaxEntries || idempotentBytes > idempotencyMaxBytes {
+		var oldest *idempotentResult
+		for element := idempotentOrder.Front(); element != nil; element = element.Next() {
+			result := element.Value.(*idempotentResult)
+			if result == keep {
+				continue
+			}
+			// Results in flight take up no bytes, so they only make room for entries
+			if oldest == nil && len(idempotentResults) > idempotencyMaxEntries {
+				oldest = result
+			}
+			if result.response != nil {
+				oldest = result
+				break
+			}
+		}
+		if oldest == nil {
+			return
+		}
+		removeIdempotentResult(oldest)
+	}
+}
+
+// bufferedResponseSize returns the bytes a buffered response takes up
+func bufferedResponseSize(response *bufferedResponse) int {
+	size := len(response.Body)
+	for key, values := range response.Header {
+		for _, value := range values {
+			size += len(key) + len(value)
+		}
+	}
+	return size
+}
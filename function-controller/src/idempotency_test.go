@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// storeTestResult adds a completed result with a body of size bytes to the idempotency store
+func storeTestResult(key string, size int, createdAt time.Time) *idempotentResult {
+	result := &idempotentResult{key: key, createdAt: createdAt}
+	result.element = idempotentOrder.PushBack(result)
+	idempotentResults[key] = result
+	if size >= 0 {
+		result.response = &bufferedResponse{StatusCode: 200, Body: bytes.Repeat([]byte("x"), size)}
+		result.size = bufferedResponseSize(result.response)
+		idempotentBytes += result.size
+	}
+	return result
+}
+
+// resetIdempotencyStore empties the idempotency store and restores its limits after a test
+func resetIdempotencyStore(t *testing.T) {
+	previousEntries, previousBytes := idempotencyMaxEntries, idempotencyMaxBytes
+	empty := func() {
+		for _, result := range idempotentResults {
+			removeIdempotentResult(result)
+		}
+	}
+	empty()
+	t.Cleanup(func() {
+		empty()
+		idempotencyMaxEntries, idempotencyMaxBytes = previousEntries, previousBytes
+	})
+}
+
+func TestEvictIdempotentResultsByBytes(t *testing.T) {
+	resetIdempotencyStore(t)
+	idempotencyMaxBytes = 250
+
+	now := time.Now()
+	storeTestResult("oldest", 100, now.Add(-3*time.Second))
+	storeTestResult("in-flight", -1, now.Add(-2*time.Second))
+	storeTestResult("older", 100, now.Add(-time.Second))
+	newest := storeTestResult("newest", 100, now)
+
+	evictIdempotentResults(newest)
+	if _, exists := idempotentResults["oldest"]; exists {
+		t.Error("the oldest result was kept past the byte budget")
+	}
+	for _, key := range []string{"in-flight", "older", "newest"} {
+		if _, exists := idempotentResults[key]; !exists {
+			t.Errorf("result %q was evicted, want it kept", key)
+		}
+	}
+	if idempotentBytes != 200 {
+		t.Errorf("store takes up %d bytes, want 200", idempotentBytes)
+	}
+
+	// A result larger than the budget is kept on its own rather than evicted as it completes
+	large := storeTestResult("large", 1000, now)
+	evictIdempotentResults(large)
+	if len(idempotentResults) != 2 || idempotentResults["large"] == nil || idempotentResults["in-flight"] == nil {
+		t.Errorf("store holds %d results, want only the large one and the one in flight", len(idempotentResults))
+	}
+}
+
+func TestEvictIdempotentResultsExpired(t *testing.T) {
+	resetIdempotencyStore(t)
+
+	storeTestResult("expired", 10, time.Now().Add(-idempotencyTTL-time.Minute))
+	current := storeTestResult("current", 10, time.Now())
+	evictIdempotentResults(current)
+	if _, exists := idempotentResults["expired"]; exists {
+		t.Error("expired result was kept")
+	}
+	if idempotentOrder.Len() != 1 || idempotentBytes != 10 {
+		t.Errorf("store holds %d results of %d bytes, want 1 of 10", idempotentOrder.Len(), idempotentBytes)
+	}
+}
+
+func TestEvictIdempotentResultsByEntries(t *testing.T) {
+	resetIdempotencyStore(t)
+	idempotencyMaxEntries = 2
+
+	now := time.Now()
+	storeTestResult("in-flight", -1, now.Add(-2*time.Second))
+	storeTestResult("completed", 10, now.Add(-time.Second))
+	newest := storeTestResult("newest", -1, now)
+
+	// Completed results are evicted before older ones in flight
+	evictIdempotentResults(newest)
+	if _, exists := idempotentResults["completed"]; exists {
+		t.Error("completed result was kept while the store was full")
+	}
+
+	// Results in flight are evicted when nothing else is left
+	third := storeTestResult("third", -1, now)
+	evictIdempotentResults(third)
+	if _, exists := idempotentResults["in-flight"]; exists || len(idempotentResults) != 2 {
+		t.Errorf("store holds %d results, want the 2 newest", len(idempotentResults))
+	}
+}
+
+// Rejected idempotent invocations are reported in the error envelope like other failures
+func TestIdempotentInvokeErrorEnvelope(t *testing.T) {
+	function := &Function{Name: "api", UserID: "user1", Running: true}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/invoke/api", nil)
+	idempotentInvoke(w, r, function, function.Name, strings.Repeat("k", maxIdempotencyKeyLength+1), time.Second, time.Now())
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	var envelope ErrorEnvelope
+	if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("response isn't an error envelope: %v: %s", err, w.Body.String())
+	}
+	if envelope.Error.Origin != errorOriginPlatform || envelope.Error.Code != "bad_request" {
+		t.Errorf("error = %+v, want a platform bad_request", envelope.Error)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// FunctionInstance is one container backing a function
+type FunctionInstance struct {
+	Container     string `json:"container"`
+	Name          string `json:"name"`
+	State         string `json:"state"`                // running, exited, restarting, ...
+	Health        string `json:"health,omitempty"`     // For images with a HEALTHCHECK
+	IPAddress     string `json:"ip_address,omitempty"` // Address on the function network
+	StartedAt     string `json:"started_at,omitempty"`
+	UptimeSeconds int64  `json:"uptime_seconds,omitempty"` // Only for running containers
+	RestartCount  int    `json:"restart_count"`
+	Current       bool   `json:"current"` // Whether the registry tracks it as the function's container
+}
+
+// FunctionInstancesResponse lists the containers backing a function
+type FunctionInstancesResponse struct {
+	Function  string             `json:"function"`
+	Instances []FunctionInstance `json:"instances"`
+}
+
+// functionInstancesHandler lists every container of a function with its state, address
+// and uptime, to find which container of a function misbehaves
+func functionInstancesHandler(w http.ResponseWriter, r *http.Request, functionName string) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	function, _, exists := findFunction(userID, functionName)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Function '%s' not found", functionName), http.StatusNotFound)
+		return
+	}
+
+	containerIDs, err := functionContainers(function)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	mutex.RLock()
+	current := function.Container
+	mutex.RUnlock()
+
+	response := FunctionInstancesResponse{Function: function.Name, Instances: []FunctionInstance{}}
+	for _, containerID := range containerIDs {
+		info, err := inspectContainer(containerID)
+		if err != nil {
+			// The container was removed since it was listed
+			continue
+		}
+
+		instance := FunctionInstance{
+			Container:    info.ID,
+			Name:         strings.TrimPrefix(info.Name, "/"),
+			State:        info.State.Status,
+			Health:       info.State.healthStatus(),
+			RestartCount: info.RestartCount,
+			Current:      current != "" && strings.HasPrefix(info.ID, current),
+		}
+		if network, ok := info.NetworkSettings.Networks[functionNetworkName()]; ok {
+			instance.IPAddress = network.IPAddress
+		}
+		if startedAt, err := time.Parse(time.RFC3339Nano, info.State.StartedAt); err == nil && !startedAt.IsZero() {
+			instance.StartedAt = info.State.StartedAt
+			if info.State.Running {
+				instance.UptimeSeconds = int64(time.Since(startedAt).Seconds())
+			}
+		}
+		response.Instances = append(response.Instances, instance)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
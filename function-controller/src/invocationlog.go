@@ -0,0 +1,155 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Header carrying the ID of an invocation, taken from the client or generated, forwarded to
+// the function and returned with the response
+const requestIDHeader = "X-Request-ID"
+
+// Verbosity of the invocation log
+const (
+	invocationLogOff      = "off"      // Nothing is logged per invocation
+	invocationLogSummary  = "summary"  // One line per invocation
+	invocationLogDetailed = "detailed" // The summary plus request and response headers
+)
+
+// invocationLogLevel is configured with INVOCATION_LOG_LEVEL
+var invocationLogLevel = invocationLogSummary
+
+func init() {
+	if value := os.Getenv("INVOCATION_LOG_LEVEL"); value != "" {
+		switch strings.ToLower(value) {
+		case invocationLogOff, invocationLogSummary, invocationLogDetailed:
+			invocationLogLevel = strings.ToLower(value)
+		default:
+			log.Printf("Invalid INVOCATION_LOG_LEVEL %q, using default %s", value, invocationLogLevel)
+		}
+	}
+}
+
+// InvocationLogEntry is the structured log line written for an invocation
+type InvocationLogEntry struct {
+	RequestID       string            `json:"request_id"`
+	Function        string            `json:"function"`
+	Owner           string            `json:"owner,omitempty"`
+	User            string            `json:"user,omitempty"` // Empty for anonymous invocations
+	Method          string            `json:"method"`
+	Path            string            `json:"path"`
+	Status          int               `json:"status"`
+	DurationMs      float64           `json:"duration_ms"`
+	ResponseBytes   int64             `json:"response_bytes"`
+	RequestHeaders  map[string]string `json:"request_headers,omitempty"`
+	ResponseHeaders map[string]string `json:"response_headers,omitempty"`
+}
+
+// invocationLogWriter records the status and size of the response to an invocation
+type invocationLogWriter struct {
+	http.ResponseWriter
+	request   *http.Request
+	startTime time.Time
+	entry     InvocationLogEntry
+}
+
+// startInvocationLog assigns the invocation its request ID and returns the writer to respond
+// with, which logs the invocation on finish
+func startInvocationLog(w http.ResponseWriter, r *http.Request, functionName string, startTime time.Time) *invocationLogWriter {
+	requestID := r.Header.Get(requestIDHeader)
+	if requestID == "" {
+		requestID = newRequestID()
+		r.Header.Set(requestIDHeader, requestID)
+	}
+	w.Header().Set(requestIDHeader, requestID)
+
+	return &invocationLogWriter{
+		ResponseWriter: w,
+		request:        r,
+		startTime:      startTime,
+		entry: InvocationLogEntry{
+			RequestID: requestID,
+			Function:  functionName,
+			User:      r.Header.Get("X-User-ID"),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+		},
+	}
+}
+
+// setFunction records the function an invocation resolved to, e.g. through an alias
+func (w *invocationLogWriter) setFunction(function *Function) {
+	w.entry.Function = function.Name
+	w.entry.Owner = function.UserID
+}
+
+func (w *invocationLogWriter) WriteHeader(status int) {
+	if w.entry.Status == 0 {
+		w.entry.Status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *invocationLogWriter) Write(p []byte) (int, error) {
+	if w.entry.Status == 0 {
+		w.entry.Status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.entry.ResponseBytes += int64(n)
+	return n, err
+}
+
+// Flush keeps streamed responses streaming while they are measured
+func (w *invocationLogWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish writes the invocation's log line at the configured verbosity
+func (w *invocationLogWriter) finish() {
+	if invocationLogLevel == invocationLogOff {
+		return
+	}
+	entry := w.entry
+	entry.DurationMs = float64(time.Since(w.startTime).Microseconds()) / 1000
+	if invocationLogLevel == invocationLogDetailed {
+		entry.RequestHeaders = redactedHeaders(w.request.Header)
+		entry.ResponseHeaders = redactedHeaders(w.Header())
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error encoding invocation log entry: %v", err)
+		return
+	}
+	log.Printf("[invocation] %s", line)
+}
+
+// redactedHeaders returns headers for the invocation log with credentials redacted
+func redactedHeaders(header http.Header) map[string]string {
+	fields := make(map[string]string, len(header))
+	for key, values := range header {
+		value := strings.Join(values, ", ")
+		if credentialHeaders[http.CanonicalHeaderKey(key)] {
+			value = "[REDACTED]"
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+// newRequestID returns a random ID for an invocation the client didn't give one
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return time.Now().Format("20060102150405.000000000")
+	}
+	return hex.EncodeToString(id)
+}
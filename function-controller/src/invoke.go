@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Largest request and response bodies of invocations that are buffered, e.g. coalesced ones
+const maxBufferedBodySize = 10 * 1024 * 1024
+
+// bufferedResponse is a function response read in full so it can be shared or replayed
+type bufferedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// invocationError is an invocation that failed before the function responded, with the
+// status it is reported with
+type invocationError struct {
+	Status     int
+	RetryAfter string // Seconds the client should wait before retrying, if any
+	Message    string
+}
+
+func (e *invocationError) Error() string {
+	return e.Message
+}
+
+// writeInvocationError reports a failed invocation to the client in the error envelope
+func writeInvocationError(w http.ResponseWriter, err error) {
+	var invokeErr *invocationError
+	if !errors.As(err, &invokeErr) {
+		writeErrorEnvelope(w, InvocationErrorBody{
+			Origin:  errorOriginPlatform,
+			Code:    platformErrorCode(http.StatusInternalServerError),
+			Message: fmt.Sprintf("Error invoking function: %v", err),
+			Status:  http.StatusInternalServerError,
+		})
+		return
+	}
+	if invokeErr.RetryAfter != "" {
+		w.Header().Set("Retry-After", invokeErr.RetryAfter)
+	}
+	writeErrorEnvelope(w, InvocationErrorBody{
+		Origin:  errorOriginPlatform,
+		Code:    platformErrorCode(invokeErr.Status),
+		Message: invokeErr.Message,
+		Status:  invokeErr.Status,
+	})
+}
+
+// sendInvocation takes one of the function's concurrency slots, starts its container if
+// needed and forwards the request with the given body to it via the function proxy. The
+// returned release function frees the slot and must be called once the response is read.
+func sendInvocation(function *Function, functionName string, r *http.Request, body io.Reader, timeout time.Duration, startTime time.Time) (*http.Response, func(), error) {
+	// Bound the invocations of this function in flight at once
+	functionKey := function.UserID + "-" + function.Name
+	mutex.RLock()
+	maxConcurrency := resolveMaxConcurrency(function)
+	mutex.RUnlock()
+	if !acquireInvocationSlot(functionKey, maxConcurrency) {
+		return nil, nil, &invocationError{
+			Status:     http.StatusTooManyRequests,
+			RetryAfter: "1",
+			Message:    fmt.Sprintf("Function '%s' is at its concurrency limit of %d", functionName, maxConcurrency),
+		}
+	}
+	release := func() { releaseInvocationSlot(functionKey) }
+	requestTrace(r).recordOnce("queue", time.Since(startTime))
+
+	resp, err := forwardInvocation(function, functionName, r, body, timeout, startTime)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return resp, release, nil
+}
+
+// forwardInvocation starts the function's container if needed and forwards the request to it
+func forwardInvocation(function *Function, functionName string, r *http.Request, body io.Reader, timeout time.Duration, startTime time.Time) (*http.Response, error) {
+	// Inspect the container once for whether it has to be started and for its health
+	coldStartNeeded, health := inspectFunctionContainer(function)
+
+	// Callers can opt out of paying the cold start cost
+	if !function.autoStartEnabled(r) && coldStartNeeded {
+		return nil, &invocationError{
+			Status:  http.StatusConflict,
+			Message: fmt.Sprintf("Function '%s' is not running and auto-start is disabled", functionName),
+		}
+	}
+
+	// Don't restart a crash loop on every invocation, it has to be started explicitly
+	if isCrashed(function) {
+		return nil, &invocationError{
+			Status:  http.StatusConflict,
+			Message: fmt.Sprintf("Function '%s' crashed and must be started again", functionName),
+		}
+	}
+
+	// Start the container if it isn't running, sharing the start with concurrent requests.
+	// The readiness probe of the start doesn't pass while the container is unhealthy.
+	if coldStartNeeded {
+		coldStartTime := time.Now()
+		err := coldStart(function.UserID+"-"+function.Name, function)
+		requestTrace(r).record("cold-start", time.Since(coldStartTime))
+		if err != nil {
+			var readinessErr *ReadinessError
+			if errors.As(err, &readinessErr) {
+				log.Printf("Readiness probe failed for function %s: %v", functionName, err)
+				return nil, &invocationError{
+					Status:     http.StatusServiceUnavailable,
+					RetryAfter: "5",
+					Message:    fmt.Sprintf("Function not ready: %v", err),
+				}
+			}
+			return nil, &invocationError{
+				Status:  http.StatusInternalServerError,
+				Message: fmt.Sprintf("Failed to start function: %v", err),
+			}
+		}
+	}
+
+	// Don't forward to a container failing its image's HEALTHCHECK
+	if !coldStartNeeded && health == healthUnhealthy {
+		return nil, &invocationError{
+			Status:     http.StatusServiceUnavailable,
+			RetryAfter: "5",
+			Message:    fmt.Sprintf("Function '%s' is unhealthy", functionName),
+		}
+	}
+
+	// Forward request to function container via the reverse proxy, with the path after
+	// the function name and the query exactly as received
+	functionURL := fmt.Sprintf("%s/function/%s%s", functionProxyURL, url.PathEscape(functionName), rawSubPath(r))
+	if r.URL.RawQuery != "" {
+		functionURL = fmt.Sprintf("%s?%s", functionURL, r.URL.RawQuery)
+	}
+
+	if invocationLogLevel == invocationLogDetailed {
+		log.Printf("Forwarding request to function %s via proxy: %s", functionName, functionURL)
+	}
+
+	// Create a new request to the function proxy
+	proxyReq, err := http.NewRequest(r.Method, functionURL, body)
+	if err != nil {
+		return nil, &invocationError{
+			Status:  http.StatusInternalServerError,
+			Message: fmt.Sprintf("Error creating proxy request: %v", err),
+		}
+	}
+
+	// Keep the length of a streamed body, which would otherwise be sent chunked, e.g. to
+	// functions reading binary uploads that can't decode chunked bodies
+	if _, buffered := body.(*bytes.Reader); !buffered {
+		proxyReq.ContentLength = r.ContentLength
+		if r.ContentLength == 0 {
+			proxyReq.Body = http.NoBody
+		}
+	}
+
+	// Copy headers
+	for key, values := range r.Header {
+		for _, value := range values {
+			proxyReq.Header.Add(key, value)
+		}
+	}
+
+	// Inject the function's configured request headers
+	applyRequestHeaderRules(function, proxyReq.Header)
+
+	// Tell the function about the invocation with the platform's headers
+	applyPlatformHeaders(function, proxyReq.Header)
+
+	// Let the proxy pick the container owned by this function's user
+	proxyReq.Header.Set("X-Function-Owner", function.UserID)
+
+	// Let the proxy apply the same timeout to its request to the container
+	proxyReq.Header.Set(invokeTimeoutHeader, strconv.Itoa(int(timeout.Seconds())))
+
+	// Let the proxy report its timings of traced invocations
+	trace := requestTrace(r)
+	if trace != nil {
+		proxyReq.Header.Set(traceHeader, "true")
+	}
+
+	// Send request to function via proxy. The timeout only bounds the wait for the response
+	// headers, a streamed body may take longer; the request is done once its body is closed.
+	ctx, cancel := context.WithCancel(context.Background())
+	timer := time.AfterFunc(timeout, cancel)
+	client := &http.Client{Transport: invokeTransport}
+	sentTime := time.Now()
+	resp, err := client.Do(proxyReq.WithContext(ctx))
+	timedOut := !timer.Stop()
+	if err != nil {
+		cancel()
+		log.Printf("Error invoking function %s via proxy: %v", functionName, err)
+
+		// Report timeouts citing the timeout that applied
+		if timedOut || os.IsTimeout(err) {
+			recordInvocation(function.UserID+"-"+function.Name, time.Since(startTime), http.StatusGatewayTimeout)
+			return nil, &invocationError{
+				Status:  http.StatusGatewayTimeout,
+				Message: fmt.Sprintf("Function timed out after %s", timeout),
+			}
+		}
+
+		recordInvocation(function.UserID+"-"+function.Name, time.Since(startTime), http.StatusInternalServerError)
+		return nil, &invocationError{
+			Status:  http.StatusInternalServerError,
+			Message: fmt.Sprintf("Error invoking function: %v", err),
+		}
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	trace.recordUpstream(resp.Header, time.Since(sentTime))
+	return resp, nil
+}
+
+// readInvocationBody reads the body of an invocation that is buffered
+func readInvocationBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBufferedBodySize+1))
+	if err != nil {
+		return nil, &invocationError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Error reading request body: %v", err)}
+	}
+	if len(body) > maxBufferedBodySize {
+		return nil, &invocationError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Message: fmt.Sprintf("Request body must not exceed %d bytes", maxBufferedBodySize),
+		}
+	}
+	return body, nil
+}
+
+// bufferedInvocation invokes a function and reads its whole response, which is recorded
+// once for the metrics however many clients it is written to
+func bufferedInvocation(function *Function, functionName string, r *http.Request, body []byte, timeout time.Duration, startTime time.Time) (*bufferedResponse, error) {
+	resp, release, err := sendInvocation(function, functionName, r, bytes.NewReader(body), timeout, startTime)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	defer resp.Body.Close()
+
+	// Unlike a streamed response, a buffered one has to be read within the timeout
+	readTimer := time.AfterFunc(timeout, func() { resp.Body.Close() })
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBufferedBodySize+1))
+	if !readTimer.Stop() {
+		recordInvocation(function.UserID+"-"+function.Name, time.Since(startTime), http.StatusGatewayTimeout)
+		return nil, &invocationError{
+			Status:  http.StatusGatewayTimeout,
+			Message: fmt.Sprintf("Function timed out after %s sending its response", timeout),
+		}
+	}
+	if err != nil {
+		return nil, &invocationError{Status: http.StatusBadGateway, Message: fmt.Sprintf("Error reading response of function: %v", err)}
+	}
+	if len(data) > maxBufferedBodySize {
+		return nil, &invocationError{
+			Status:  http.StatusBadGateway,
+			Message: fmt.Sprintf("Response of function '%s' exceeds %d bytes and can't be buffered", functionName, maxBufferedBodySize),
+		}
+	}
+
+	// Strip the headers the function is configured to strip
+	applyResponseHeaderRules(function, resp.Header)
+	recordInvocation(function.UserID+"-"+function.Name, time.Since(startTime), resp.StatusCode)
+	return &bufferedResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: data}, nil
+}
+
+// writeBufferedResponse writes a buffered function response to a client
+func writeBufferedResponse(w http.ResponseWriter, response *bufferedResponse) {
+	for key, values := range response.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	if isFunctionError(response.StatusCode, response.Header) {
+		writeFunctionError(w, response.StatusCode, response.Body)
+		return
+	}
+	w.WriteHeader(response.StatusCode)
+	w.Write(response.Body)
+}
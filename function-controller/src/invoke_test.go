@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// binaryBody is a request body a text-only path would corrupt
+type binaryBody struct {
+	name        string
+	contentType string
+	encoding    string
+	body        []byte
+}
+
+func binaryBodies(t *testing.T) []binaryBody {
+	var gzipped bytes.Buffer
+	writer := gzip.NewWriter(&gzipped)
+	if _, err := writer.Write([]byte(strings.Repeat(`{"event":"compressible"}`, 50))); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return []binaryBody{
+		{"non-UTF-8", "application/octet-stream", "", []byte{0xff, 0xfe, 0x00, 0xc3, 0x28, 0x80, 0x0d, 0x0a}},
+		{"gzip", "application/json", "gzip", gzipped.Bytes()},
+		{"protobuf", "application/x-protobuf", "", []byte{0x08, 0x96, 0x01, 0x12, 0x04, 't', 'e', 's', 't', 0x1a, 0x03, 0xff, 0x00, 0x80}},
+	}
+}
+
+// forwardedBody is what the function proxy received
+type forwardedBody struct {
+	body          []byte
+	contentLength int64
+	chunked       bool
+}
+
+// withEchoFunctionProxy stands in for the function proxy, echoing request bodies with
+// their content headers and an explicit length
+func withEchoFunctionProxy(t *testing.T) <-chan forwardedBody {
+	received := make(chan forwardedBody, 1)
+	withFunctionProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading the forwarded body: %v", err)
+		}
+		received <- forwardedBody{body: body, contentLength: r.ContentLength, chunked: len(r.TransferEncoding) > 0}
+
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		if encoding := r.Header.Get("Content-Encoding"); encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+	})
+	return received
+}
+
+// Binary bodies reach the function and come back byte for byte with their length, both
+// when the request is streamed and when it is buffered, e.g. for retries
+func TestBinaryInvocationRoundTrip(t *testing.T) {
+	function := &Function{Name: "binary", UserID: "user1", Image: "binary:latest", Running: true}
+	controller := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("buffered") != "" {
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				t.Errorf("reading the request body: %v", err)
+				return
+			}
+			response, err := bufferedInvocation(function, function.Name, r, body, time.Second, time.Now())
+			if err != nil {
+				writeInvocationError(w, err)
+				return
+			}
+			writeBufferedResponse(w, response)
+			return
+		}
+
+		resp, release, err := sendInvocation(function, function.Name, r, r.Body, time.Second, time.Now())
+		if err != nil {
+			writeInvocationError(w, err)
+			return
+		}
+		defer release()
+		defer resp.Body.Close()
+		for key, values := range resp.Header {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+		w.WriteHeader(resp.StatusCode)
+		streamResponse(w, resp.Body)
+	}))
+	defer controller.Close()
+
+	for _, mode := range []string{"streamed", "buffered"} {
+		for _, test := range binaryBodies(t) {
+			t.Run(mode+" "+test.name, func(t *testing.T) {
+				received := withEchoFunctionProxy(t)
+
+				target := controller.URL + "/invoke/binary/upload"
+				if mode == "buffered" {
+					target += "?buffered=1"
+				}
+				request, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(test.body))
+				if err != nil {
+					t.Fatal(err)
+				}
+				request.Header.Set("Content-Type", test.contentType)
+				if test.encoding != "" {
+					request.Header.Set("Content-Encoding", test.encoding)
+				}
+				// Asking for gzip keeps the client from decompressing the response
+				request.Header.Set("Accept-Encoding", "gzip")
+
+				response, err := http.DefaultClient.Do(request)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer response.Body.Close()
+				body, err := io.ReadAll(response.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				forwarded := <-received
+				if !bytes.Equal(forwarded.body, test.body) {
+					t.Errorf("function received %x, want %x", forwarded.body, test.body)
+				}
+				if forwarded.contentLength != int64(len(test.body)) || forwarded.chunked {
+					t.Errorf("function received Content-Length %d (chunked %v), want %d", forwarded.contentLength, forwarded.chunked, len(test.body))
+				}
+
+				if response.StatusCode != http.StatusOK {
+					t.Fatalf("status = %d, want 200: %s", response.StatusCode, body)
+				}
+				if !bytes.Equal(body, test.body) {
+					t.Errorf("client received %x, want %x", body, test.body)
+				}
+				if response.ContentLength != int64(len(test.body)) {
+					t.Errorf("client received Content-Length %d, want %d", response.ContentLength, len(test.body))
+				}
+				if encoding := response.Header.Get("Content-Encoding"); encoding != test.encoding {
+					t.Errorf("client received Content-Encoding %q, want %q", encoding, test.encoding)
+				}
+			})
+		}
+	}
+}
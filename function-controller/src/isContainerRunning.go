@@ -9,12 +9,70 @@ import (
 
 // ContainerState represents the state of a Docker container
 type ContainerState struct {
-	Running bool `json:"Running"`
+	Running    bool             `json:"Running"`
+	Restarting bool             `json:"Restarting"`
+	Status     string           `json:"Status"`
+	ExitCode   int              `json:"ExitCode"`
+	StartedAt  string           `json:"StartedAt"`        // RFC 3339, the zero time when never started
+	Health     *ContainerHealth `json:"Health,omitempty"` // Only set when the image defines a HEALTHCHECK
+}
+
+// Health status docker reports for containers failing their HEALTHCHECK
+const healthUnhealthy = "unhealthy"
+
+// ContainerHealth represents the result of a container's HEALTHCHECK
+type ContainerHealth struct {
+	Status        string `json:"Status"` // starting, healthy or unhealthy
+	FailingStreak int    `json:"FailingStreak"`
+}
+
+// healthStatus returns the container's health status, empty when its image has no HEALTHCHECK
+func (s ContainerState) healthStatus() string {
+	if s.Health == nil {
+		return ""
+	}
+	return s.Health.Status
+}
+
+// ContainerNetwork represents a container's attachment to a Docker network
+type ContainerNetwork struct {
+	NetworkID  string   `json:"NetworkID"`
+	IPAddress  string   `json:"IPAddress"`
+	Gateway    string   `json:"Gateway"`
+	MacAddress string   `json:"MacAddress"`
+	Aliases    []string `json:"Aliases"`
+}
+
+// ContainerNetworkSettings represents the network settings of a Docker container
+type ContainerNetworkSettings struct {
+	Networks map[string]ContainerNetwork `json:"Networks"`
 }
 
 // ContainerInspect represents the Docker inspect output
 type ContainerInspect struct {
-	State ContainerState `json:"State"`
+	ID              string                   `json:"Id"`
+	Name            string                   `json:"Name"` // Container name with a leading /
+	State           ContainerState           `json:"State"`
+	RestartCount    int                      `json:"RestartCount"`
+	NetworkSettings ContainerNetworkSettings `json:"NetworkSettings"`
+}
+
+// inspectContainer returns the Docker inspect output of a container
+func inspectContainer(containerID string) (*ContainerInspect, error) {
+	output, err := exec.Command("docker", "inspect", containerID).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %v", containerID, err)
+	}
+
+	var containers []ContainerInspect
+	if err := json.Unmarshal(output, &containers); err != nil {
+		return nil, fmt.Errorf("failed to parse container inspect output: %v", err)
+	}
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("container %s not found", containerID)
+	}
+
+	return &containers[0], nil
 }
 
 // isContainerRunning checks if a container is actually running
@@ -53,6 +111,30 @@ func isContainerRunning(containerID string) bool {
 	return true
 }
 
+// containerStatus reports whether a container is running and its health status, which is
+// empty when its image has no HEALTHCHECK
+func containerStatus(containerID string) (bool, string) {
+	if containerID == "" {
+		return false, ""
+	}
+
+	info, err := inspectContainer(containerID)
+	if err != nil {
+		log.Printf("Error inspecting container %s: %v", containerID, err)
+		return false, ""
+	}
+	if !info.State.Running {
+		return false, ""
+	}
+	return true, info.State.healthStatus()
+}
+
+// containerHealth returns the health status of a running container, empty when it has none
+func containerHealth(containerID string) string {
+	_, health := containerStatus(containerID)
+	return health
+}
+
 // verifyFunctionStatus checks if a function's container is actually running
 // and updates the function status accordingly
 func verifyFunctionStatus(function *Function) bool {
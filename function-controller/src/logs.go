@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// parseLogsSince checks a since parameter is a duration (e.g. 1h) or an RFC3339 or Unix timestamp,
+// the formats accepted by docker logs --since
+func parseLogsSince(since string) error {
+	if parsed, err := time.ParseDuration(since); err == nil {
+		if parsed <= 0 {
+			return fmt.Errorf("duration must be positive")
+		}
+		return nil
+	}
+	if _, err := time.Parse(time.RFC3339, since); err == nil {
+		return nil
+	}
+	if _, err := strconv.ParseInt(since, 10, 64); err == nil {
+		return nil
+	}
+	return fmt.Errorf("expected a duration like 1h or an RFC3339 timestamp")
+}
+
+// downloadLogsHandler streams the full logs of a function's container as a file attachment
+func downloadLogsHandler(w http.ResponseWriter, r *http.Request, functionName string) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	since := r.URL.Query().Get("since")
+	if since != "" {
+		if err := parseLogsSince(since); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid since '%s': %v", since, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	function, _, exists := findFunction(userID, functionName)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Function '%s' not found", functionName), http.StatusNotFound)
+		return
+	}
+
+	mutex.RLock()
+	containerID := function.Container
+	mutex.RUnlock()
+
+	// Stopped containers keep their logs, so only a missing container is an error
+	if containerID == "" || exec.Command("docker", "container", "inspect", containerID).Run() != nil {
+		http.Error(w, "Function has no container", http.StatusBadRequest)
+		return
+	}
+
+	args := []string{"logs", "--timestamps"}
+	if since != "" {
+		args = append(args, "--since", since)
+	}
+	args = append(args, containerID)
+
+	// Stream the logs instead of buffering them, they can be large
+	cmd := exec.CommandContext(r.Context(), "docker", args...)
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	filename := fmt.Sprintf("%s-%s.log", function.Name, time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.Header().Set("Cache-Control", "no-store")
+
+	if err := cmd.Run(); err != nil {
+		log.Printf("Error streaming logs for function %s: %v", function.Name, err)
+	}
+}
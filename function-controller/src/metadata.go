@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Prefix of the container labels carrying user metadata. The platform's own labels
+// (function, platform.*) never use it, so metadata can't be mistaken for them.
+const metadataLabelPrefix = "meta."
+
+// Longest metadata value accepted
+const maxMetadataLength = 256
+
+// metadataFields returns the function's metadata keyed by label name, without the prefix
+func metadataFields(function *Function) map[string]string {
+	return map[string]string{
+		"description": function.Description,
+		"owner":       function.Owner,
+		"version":     function.Version,
+	}
+}
+
+// validateMetadata checks the function's metadata can be stored in container labels
+func validateMetadata(function *Function) error {
+	for name, value := range metadataFields(function) {
+		if len(value) > maxMetadataLength {
+			return fmt.Errorf("%s must not exceed %d characters", name, maxMetadataLength)
+		}
+		if strings.ContainsAny(value, "\r\n\x00") {
+			return fmt.Errorf("%s must be a single line", name)
+		}
+	}
+	return nil
+}
+
+// metadataLabels returns the docker run arguments labelling a container with the
+// function's metadata, skipping empty fields
+func metadataLabels(function *Function) []string {
+	var args []string
+	for name, value := range metadataFields(function) {
+		if value != "" {
+			args = append(args, "--label", fmt.Sprintf("%s%s=%s", metadataLabelPrefix, name, value))
+		}
+	}
+	return args
+}
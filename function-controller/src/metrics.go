@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Invocation metrics configuration
+const (
+	metricsBucketSize  = 5 * time.Minute // Granularity of the rolling counters
+	metricsBucketCount = 288             // 24h worth of 5 minute buckets
+	metricsMaxWindow   = 24 * time.Hour  // Largest window that can be queried
+	metricsFlushPeriod = 1 * time.Minute // How often metrics are persisted
+)
+
+var (
+	metricsFile        = "/app/data/metrics.json" // Path to store invocation metrics
+	metricsRecordLimit = 1000                     // Max invocation records kept per function
+	metricsMutex       = &sync.Mutex{}
+	functionMetrics    = make(map[string]*InvocationMetrics)
+)
+
+// MetricsBucket holds invocation counters for a fixed slice of time
+type MetricsBucket struct {
+	Start  int64 `json:"start"`
+	Count  int   `json:"count"`
+	Errors int   `json:"errors"`
+}
+
+// InvocationRecord describes a single function invocation
+type InvocationRecord struct {
+	Timestamp int64 `json:"timestamp"`
+	LatencyMs int64 `json:"latency_ms"`
+	Status    int   `json:"status"`
+}
+
+// InvocationMetrics keeps rolling counters and recent invocation records for a function
+type InvocationMetrics struct {
+	Buckets []MetricsBucket    `json:"buckets"`
+	Records []InvocationRecord `json:"records"`
+	Next    int                `json:"next"` // Next write position in the records ring buffer
+}
+
+// MetricsResponse is returned by the metrics endpoint
+type MetricsResponse struct {
+	Function     string  `json:"function"`
+	Window       string  `json:"window"`
+	Invocations  int     `json:"invocations"`
+	Errors       int     `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+	P50LatencyMs int64   `json:"p50_latency_ms"`
+	P95LatencyMs int64   `json:"p95_latency_ms"`
+	Samples      int     `json:"samples"`
+}
+
+func init() {
+	// Allow the per-function invocation record limit to be configured
+	if limit := os.Getenv("METRICS_RECORD_LIMIT"); limit != "" {
+		if parsed, err := strconv.Atoi(limit); err == nil && parsed > 0 {
+			metricsRecordLimit = parsed
+		} else {
+			log.Printf("Invalid METRICS_RECORD_LIMIT %q, using default %d", limit, metricsRecordLimit)
+		}
+	}
+}
+
+// recordInvocation records the outcome of a function invocation
+func recordInvocation(functionKey string, latency time.Duration, status int) {
+	now := time.Now()
+
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+
+	m, exists := functionMetrics[functionKey]
+	if !exists {
+		m = &InvocationMetrics{Buckets: make([]MetricsBucket, metricsBucketCount)}
+		functionMetrics[functionKey] = m
+	}
+
+	// Update the rolling counter for the current bucket, resetting it if it is stale
+	bucketStart := now.Truncate(metricsBucketSize).Unix()
+	idx := int((bucketStart / int64(metricsBucketSize.Seconds())) % metricsBucketCount)
+	if m.Buckets[idx].Start != bucketStart {
+		m.Buckets[idx] = MetricsBucket{Start: bucketStart}
+	}
+	m.Buckets[idx].Count++
+	if status >= 500 {
+		m.Buckets[idx].Errors++
+	}
+
+	// Append to the records ring buffer
+	record := InvocationRecord{
+		Timestamp: now.Unix(),
+		LatencyMs: latency.Milliseconds(),
+		Status:    status,
+	}
+	if len(m.Records) < metricsRecordLimit {
+		m.Records = append(m.Records, record)
+		m.Next = len(m.Records) % metricsRecordLimit
+	} else {
+		m.Records[m.Next%len(m.Records)] = record
+		m.Next = (m.Next + 1) % len(m.Records)
+	}
+}
+
+// getInvocationMetrics aggregates the metrics of a function over the given window
+func getInvocationMetrics(functionKey string, window time.Duration) MetricsResponse {
+	response := MetricsResponse{Window: window.String()}
+	since := time.Now().Add(-window).Unix()
+
+	metricsMutex.Lock()
+	m, exists := functionMetrics[functionKey]
+	if !exists {
+		metricsMutex.Unlock()
+		return response
+	}
+
+	for _, bucket := range m.Buckets {
+		if bucket.Start != 0 && bucket.Start+int64(metricsBucketSize.Seconds()) > since {
+			response.Invocations += bucket.Count
+			response.Errors += bucket.Errors
+		}
+	}
+
+	latencies := make([]int64, 0, len(m.Records))
+	for _, record := range m.Records {
+		if record.Timestamp >= since {
+			latencies = append(latencies, record.LatencyMs)
+		}
+	}
+	metricsMutex.Unlock()
+
+	if response.Invocations > 0 {
+		response.ErrorRate = float64(response.Errors) / float64(response.Invocations)
+	}
+
+	// Percentiles are computed from the retained invocation records
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	response.Samples = len(latencies)
+	response.P50LatencyMs = percentile(latencies, 50)
+	response.P95LatencyMs = percentile(latencies, 95)
+
+	return response
+}
+
+// percentile returns the p-th percentile of a sorted slice using nearest-rank
+func percentile(sorted []int64, p int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// lastInvocationTime returns when a function was last invoked, zero if it has no recorded
+// invocations
+func lastInvocationTime(functionKey string) time.Time {
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+
+	var last int64
+	if m, exists := functionMetrics[functionKey]; exists {
+		for _, record := range m.Records {
+			if record.Timestamp > last {
+				last = record.Timestamp
+			}
+		}
+	}
+	if last == 0 {
+		return time.Time{}
+	}
+	return time.Unix(last, 0)
+}
+
+// deleteInvocationMetrics removes all metrics for a function
+func deleteInvocationMetrics(functionKey string) {
+	metricsMutex.Lock()
+	delete(functionMetrics, functionKey)
+	metricsMutex.Unlock()
+}
+
+// saveMetrics persists invocation metrics to a file
+func saveMetrics() error {
+	metricsMutex.Lock()
+	data, err := json.Marshal(functionMetrics)
+	metricsMutex.Unlock()
+	if err != nil {
+		log.Printf("Error marshaling metrics: %v", err)
+		return err
+	}
+
+	// Create directory if it doesn't exist
+	if err := os.MkdirAll(filepath.Dir(metricsFile), 0755); err != nil {
+		log.Printf("Error creating directory for metrics file: %v", err)
+		return err
+	}
+
+	if err := writeFileAtomic(metricsFile, data, 0644); err != nil {
+		log.Printf("Error writing metrics file: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// loadMetrics loads invocation metrics from a file
+func loadMetrics() error {
+	if _, err := os.Stat(metricsFile); os.IsNotExist(err) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(metricsFile)
+	if err != nil {
+		log.Printf("Error reading metrics file: %v", err)
+		return err
+	}
+
+	loaded := make(map[string]*InvocationMetrics)
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		log.Printf("Error unmarshaling metrics: %v", err)
+		return err
+	}
+
+	metricsMutex.Lock()
+	defer metricsMutex.Unlock()
+
+	for key, m := range loaded {
+		// Discard persisted data that doesn't match the current layout
+		if len(m.Buckets) != metricsBucketCount {
+			m.Buckets = make([]MetricsBucket, metricsBucketCount)
+		}
+		if len(m.Records) > metricsRecordLimit {
+			m.Records = m.Records[len(m.Records)-metricsRecordLimit:]
+			m.Next = 0
+		}
+		functionMetrics[key] = m
+	}
+
+	log.Printf("Loaded invocation metrics for %d functions", len(loaded))
+	return nil
+}
+
+// startMetricsFlusher periodically persists invocation metrics
+func startMetricsFlusher() {
+	go func() {
+		ticker := time.NewTicker(metricsFlushPeriod)
+		defer ticker.Stop()
+		for range ticker.C {
+			saveMetrics()
+		}
+	}()
+}
+
+// functionMetricsHandler returns invocation metrics for a function over a window
+func functionMetricsHandler(w http.ResponseWriter, r *http.Request, functionName string) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	// Parse the window parameter (default to 24h)
+	window := metricsMaxWindow
+	if windowParam := r.URL.Query().Get("window"); windowParam != "" {
+		parsed, err := time.ParseDuration(windowParam)
+		if err != nil || parsed <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid window '%s'", windowParam), http.StatusBadRequest)
+			return
+		}
+		if parsed > metricsMaxWindow {
+			http.Error(w, fmt.Sprintf("Window must not exceed %s", metricsMaxWindow), http.StatusBadRequest)
+			return
+		}
+		window = parsed
+	}
+
+	function, functionKey, exists := findFunction(userID, functionName)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Function '%s' not found", functionName), http.StatusNotFound)
+		return
+	}
+
+	response := getInvocationMetrics(functionKey, window)
+	response.Function = function.Name
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default name of function containers, e.g. fn-42-resize-3f9a1c, so docker ps shows the
+// owner and function of every container and same-named functions of different users
+// don't collide
+const defaultContainerNameTemplate = "fn-{user}-{name}-{rand}"
+
+// containerNameTemplate names function containers, configured with CONTAINER_NAME_TEMPLATE.
+// Placeholders: {user} the owner's ID, {name} the function name, {rand} a random suffix and
+// {time} the start time in Unix seconds. It must contain {rand} or {time} so names are unique.
+var containerNameTemplate = defaultContainerNameTemplate
+
+// Characters Docker doesn't allow in container names
+var invalidContainerNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+func init() {
+	if value := os.Getenv("CONTAINER_NAME_TEMPLATE"); value != "" {
+		if err := validateContainerNameTemplate(value); err == nil {
+			containerNameTemplate = value
+		} else {
+			log.Printf("Invalid CONTAINER_NAME_TEMPLATE %q (%v), using default %s", value, err, containerNameTemplate)
+		}
+	}
+}
+
+// validateContainerNameTemplate checks that a template yields unique, valid container names
+func validateContainerNameTemplate(template string) error {
+	if !strings.Contains(template, "{rand}") && !strings.Contains(template, "{time}") {
+		return fmt.Errorf("it must contain {rand} or {time}")
+	}
+	sample := strings.NewReplacer("{user}", "u", "{name}", "n", "{rand}", "r", "{time}", "0").Replace(template)
+	if invalidContainerNameChars.MatchString(sample) || !isAlphanumeric(sample[0]) {
+		return fmt.Errorf("it must start with a letter or digit and only contain letters, digits, _, . and -")
+	}
+	return nil
+}
+
+// containerName generates the name of a new container of a function
+func containerName(function *Function) string {
+	random := make([]byte, 3)
+	var suffix string
+	if _, err := rand.Read(random); err == nil {
+		suffix = hex.EncodeToString(random)
+	} else {
+		suffix = strconv.FormatInt(time.Now().UnixNano()&0xffffff, 16)
+	}
+
+	return strings.NewReplacer(
+		"{user}", sanitizeContainerNamePart(function.UserID),
+		"{name}", sanitizeContainerNamePart(function.Name),
+		"{rand}", suffix,
+		"{time}", strconv.FormatInt(time.Now().Unix(), 10),
+	).Replace(containerNameTemplate)
+}
+
+// sanitizeContainerNamePart replaces the characters of a user ID or function name Docker
+// doesn't allow in container names
+func sanitizeContainerNamePart(value string) string {
+	value = strings.Trim(invalidContainerNameChars.ReplaceAllString(value, "-"), "-")
+	if value == "" {
+		return "x"
+	}
+	return value
+}
+
+func isAlphanumeric(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// functionContainers lists the IDs of all containers of a function, running or not, by
+// their labels, so containers are found whatever they were named when started
+func functionContainers(function *Function) ([]string, error) {
+	output, err := exec.Command("docker", "ps", "-a", "--quiet",
+		"--filter", fmt.Sprintf("label=function=%s", function.Name),
+		"--filter", fmt.Sprintf("label=platform.user=%s", function.UserID)).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers of function %s: %v", function.Name, err)
+	}
+	return strings.Fields(string(output)), nil
+}
+
+// removeStrayContainers removes containers of a function the registry doesn't track, e.g.
+// ones left behind when the controller restarted, keeping the function's current container
+func removeStrayContainers(function *Function) {
+	containerIDs, err := functionContainers(function)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+		return
+	}
+	for _, containerID := range containerIDs {
+		if function.Container != "" && strings.HasPrefix(function.Container, containerID) {
+			continue
+		}
+		if output, err := exec.Command("docker", "rm", "-f", containerID).CombinedOutput(); err != nil {
+			log.Printf("Warning: failed to remove stray container %s of function %s: %v\nOutput: %s", containerID, function.Name, err, string(output))
+			continue
+		}
+		log.Printf("Removed stray container %s of function %s", containerID, function.Name)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Label recording the index of a function container's indexed network alias
+const replicaLabel = "platform.replica"
+
+// functionProxyURL is the base URL of the function proxy invocations are forwarded through,
+// configured with FUNCTION_PROXY_URL
+var functionProxyURL = "http://function-proxy:8090"
+
+func init() {
+	if value := os.Getenv("FUNCTION_PROXY_URL"); value != "" {
+		functionProxyURL = strings.TrimSuffix(value, "/")
+	}
+}
+
+// functionNetworkName returns the Docker network function containers are attached to
+func functionNetworkName() string {
+	if networkName := os.Getenv("FUNCTION_NETWORK"); networkName != "" {
+		return networkName
+	}
+	// Use the Docker Compose prefixed network name
+	return "platform-repository_function-network"
+}
+
+// networkAliasArgs returns the docker run arguments giving a new container of a function
+// stable names on the function network, so the owner's other functions can call it without
+// going through the proxy: the owner's ID and the function name, e.g. user_3f9a1c-resize,
+// shared by all of the function's containers, and that name with the lowest replica index
+// not taken, e.g. user_3f9a1c-resize-0, naming this container. Same-named functions of
+// different users get different names, so calls can't reach another user's function.
+func networkAliasArgs(function *Function) []string {
+	output, err := exec.Command("docker", "ps", "-a",
+		"--filter", fmt.Sprintf("label=function=%s", function.Name),
+		"--filter", fmt.Sprintf("label=platform.user=%s", function.UserID),
+		"--format", fmt.Sprintf("{{.Label %q}}", replicaLabel)).Output()
+	if err != nil {
+		log.Printf("Warning: failed to list containers of function %s: %v", function.Name, err)
+	}
+	taken := make(map[int]bool)
+	for _, value := range strings.Fields(string(output)) {
+		if index, err := strconv.Atoi(value); err == nil {
+			taken[index] = true
+		}
+	}
+	index := 0
+	for taken[index] {
+		index++
+	}
+
+	alias := functionNetworkAlias(function)
+	return []string{
+		"--network-alias", alias,
+		"--network-alias", fmt.Sprintf("%s-%d", alias, index),
+		"--label", fmt.Sprintf("%s=%d", replicaLabel, index),
+	}
+}
+
+// functionNetworkAlias returns the name a function's containers share on the function
+// network, scoped to the owner. Legacy functions without an owner keep their plain name.
+func functionNetworkAlias(function *Function) string {
+	if function.UserID == "" {
+		return sanitizeContainerNamePart(function.Name)
+	}
+	return sanitizeContainerNamePart(function.UserID) + "-" + sanitizeContainerNamePart(function.Name)
+}
+
+// NetworkAttachment describes a container's address in a network
+type NetworkAttachment struct {
+	IPAddress  string   `json:"ip_address"`
+	Gateway    string   `json:"gateway,omitempty"`
+	MacAddress string   `json:"mac_address,omitempty"`
+	Aliases    []string `json:"aliases,omitempty"`
+}
+
+// FunctionNetworkResponse reports the networks a function's container is attached to
+type FunctionNetworkResponse struct {
+	Function        string                       `json:"function"`
+	Container       string                       `json:"container"`
+	ExpectedNetwork string                       `json:"expected_network"` // Network the function proxy reaches functions on
+	Attached        bool                         `json:"attached"`         // Whether the container has an address in the expected network
+	Networks        map[string]NetworkAttachment `json:"networks"`
+}
+
+// functionNetworkHandler reports the networks and addresses of a function's container,
+// to diagnose functions the proxy can't reach
+func functionNetworkHandler(w http.ResponseWriter, r *http.Request, functionName string) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	function, _, exists := findFunction(userID, functionName)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Function '%s' not found", functionName), http.StatusNotFound)
+		return
+	}
+
+	mutex.RLock()
+	containerID := function.Container
+	mutex.RUnlock()
+
+	if containerID == "" {
+		http.Error(w, "Function is not running", http.StatusConflict)
+		return
+	}
+
+	info, err := inspectContainer(containerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	response := FunctionNetworkResponse{
+		Function:        function.Name,
+		Container:       containerID,
+		ExpectedNetwork: functionNetworkName(),
+		Networks:        make(map[string]NetworkAttachment),
+	}
+	for name, network := range info.NetworkSettings.Networks {
+		response.Networks[name] = NetworkAttachment{
+			IPAddress:  network.IPAddress,
+			Gateway:    network.Gateway,
+			MacAddress: network.MacAddress,
+			Aliases:    network.Aliases,
+		}
+		if name == response.ExpectedNetwork && network.IPAddress != "" {
+			response.Attached = true
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
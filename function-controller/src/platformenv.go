@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Environment variables the platform can inject into every function's container:
+//
+//	PLATFORM_BASE_URL  URL of the platform, set with PLATFORM_BASE_URL on the controller
+//	FUNCTION_NAME      name of the function
+//	OWNER_ID           ID of the user owning the function
+//
+// They are set after the function's own env, which may not define them.
+var platformEnvVars = map[string]func(*Function) string{
+	"PLATFORM_BASE_URL": func(*Function) string { return platformBaseURL },
+	"FUNCTION_NAME":     func(function *Function) string { return function.Name },
+	"OWNER_ID":          func(function *Function) string { return function.UserID },
+}
+
+// Headers the platform can add to every invocation forwarded to a function, replacing any
+// the client sent:
+//
+//	X-Function-Name      name of the invoked function
+//	X-Platform-Base-URL  URL of the platform
+//
+// X-Request-ID, correlating an invocation across the platform's logs, is always forwarded.
+var platformHeaders = map[string]func(*Function) string{
+	"X-Function-Name":     func(function *Function) string { return function.Name },
+	"X-Platform-Base-URL": func(*Function) string { return platformBaseURL },
+}
+
+// URL of the platform passed to functions, configured with PLATFORM_BASE_URL
+var platformBaseURL = os.Getenv("PLATFORM_BASE_URL")
+
+// Injected environment variables and headers, configured as comma separated lists with
+// PLATFORM_ENV and PLATFORM_HEADERS; none injects nothing
+var (
+	injectedEnvVars = []string{"PLATFORM_BASE_URL", "FUNCTION_NAME", "OWNER_ID"}
+	injectedHeaders = []string{"X-Function-Name"}
+)
+
+func init() {
+	if value := os.Getenv("PLATFORM_ENV"); value != "" {
+		if names, err := parseInjectedNames(value, platformEnvVars, strings.ToUpper); err == nil {
+			injectedEnvVars = names
+		} else {
+			log.Printf("Invalid PLATFORM_ENV %q (%v), using default %s", value, err, strings.Join(injectedEnvVars, ","))
+		}
+	}
+	if value := os.Getenv("PLATFORM_HEADERS"); value != "" {
+		if names, err := parseInjectedNames(value, platformHeaders, http.CanonicalHeaderKey); err == nil {
+			injectedHeaders = names
+		} else {
+			log.Printf("Invalid PLATFORM_HEADERS %q (%v), using default %s", value, err, strings.Join(injectedHeaders, ","))
+		}
+	}
+
+	// Header rules may not override the headers the platform injects
+	for _, name := range injectedHeaders {
+		protectedHeaders[name] = true
+	}
+}
+
+// parseInjectedNames parses a list of injected variables or headers, checking each is known
+func parseInjectedNames(value string, known map[string]func(*Function) string, normalize func(string) string) ([]string, error) {
+	if strings.EqualFold(strings.TrimSpace(value), "none") {
+		return []string{}, nil
+	}
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		name = normalize(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if known[name] == nil {
+			available := make([]string, 0, len(known))
+			for knownName := range known {
+				available = append(available, knownName)
+			}
+			sort.Strings(available)
+			return nil, fmt.Errorf("unknown name %s, available are %s", name, strings.Join(available, ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// platformEnv returns the environment variables the platform injects into a function's
+// container, leaving out ones without a value
+func platformEnv(function *Function) map[string]string {
+	env := make(map[string]string, len(injectedEnvVars))
+	for _, name := range injectedEnvVars {
+		if value := platformEnvVars[name](function); value != "" {
+			env[name] = value
+		}
+	}
+	return env
+}
+
+// validatePlatformEnv checks that a function's env doesn't define a variable the platform injects
+func validatePlatformEnv(function *Function) error {
+	for _, name := range injectedEnvVars {
+		if _, exists := function.Env[name]; exists {
+			return fmt.Errorf("env var '%s' is set by the platform and can't be changed", name)
+		}
+	}
+	return nil
+}
+
+// applyPlatformHeaders sets the headers the platform injects into a forwarded request
+func applyPlatformHeaders(function *Function, header http.Header) {
+	for _, name := range injectedHeaders {
+		if value := platformHeaders[name](function); value != "" {
+			header.Set(name, value)
+		} else {
+			header.Del(name)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Image pull policies of a function, deciding whether its image is pulled before its
+// container starts
+const (
+	pullAlways       = "Always"       // Pull on every start, so a re-pushed tag is picked up
+	pullIfNotPresent = "IfNotPresent" // Pull only when the image isn't on the Docker host (default)
+	pullNever        = "Never"        // Never pull, the image must already be on the Docker host
+)
+
+// imagePullTimeout bounds a pull before a container start, configured with IMAGE_PULL_TIMEOUT
+var imagePullTimeout = 2 * time.Minute
+
+func init() {
+	if value := os.Getenv("IMAGE_PULL_TIMEOUT"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			imagePullTimeout = parsed
+		} else {
+			log.Printf("Invalid IMAGE_PULL_TIMEOUT %q, using default %s", value, imagePullTimeout)
+		}
+	}
+}
+
+// validateImagePullPolicy checks a function's image pull policy, normalizing its case
+func validateImagePullPolicy(function *Function) error {
+	if function.ImagePullPolicy == "" {
+		return nil
+	}
+	for _, policy := range []string{pullAlways, pullIfNotPresent, pullNever} {
+		if strings.EqualFold(function.ImagePullPolicy, policy) {
+			function.ImagePullPolicy = policy
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid image pull policy '%s', use Always, IfNotPresent or Never", function.ImagePullPolicy)
+}
+
+// pullImageForStart makes sure the image a function's container starts from is on the
+// Docker host before startContainer runs, pulling it as the function's pull policy
+// requires. Pulls take up to imagePullTimeout, so callers don't hold mutex.
+func pullImageForStart(function *Function) error {
+	mutex.RLock()
+	name, image, policy := function.Name, localImage(function.Image), function.ImagePullPolicy
+	mutex.RUnlock()
+
+	return pullFunctionImage(name, image, policy)
+}
+
+// pullFunctionImage makes sure an image of a function is on the Docker host, pulling it as
+// the pull policy requires
+func pullFunctionImage(functionName string, image string, policy string) error {
+	if policy == "" {
+		policy = pullIfNotPresent
+	}
+
+	if policy != pullAlways {
+		present := exec.Command("docker", "image", "inspect", "--format", "{{.Id}}", image).Run() == nil
+		if present {
+			return nil
+		}
+		if policy == pullNever {
+			return fmt.Errorf("image %s is not on the Docker host and the image pull policy is Never", image)
+		}
+	}
+
+	log.Printf("Pulling image %s for function %s (pull policy %s)", image, functionName, policy)
+	ctx, cancel := context.WithTimeout(context.Background(), imagePullTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, "docker", "pull", "--quiet", image).CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("pulling image %s timed out after %s", image, imagePullTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to pull image %s: %v: %s", image, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
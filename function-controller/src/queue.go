@@ -0,0 +1,467 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Headers telling a function invoked for a queue message where the message came from
+const (
+	queueHeader          = "X-Queue"
+	queueMessageIDHeader = "X-Queue-Message-ID"
+	queueAttemptHeader   = "X-Queue-Attempt"
+)
+
+// Limits and defaults of queue bindings
+const (
+	defaultQueueConcurrency = 1
+	maxQueueConcurrency     = 32
+	defaultQueueAttempts    = 3
+	maxQueueAttempts        = 10
+	defaultQueueBackoff     = time.Second
+	maxQueueBackoff         = 5 * time.Minute
+)
+
+// QueueMessage is a message consumed from a queue, invoking the bound function with its body
+type QueueMessage struct {
+	ID          string
+	Body        []byte
+	ContentType string
+	Attempts    int // Deliveries to the function so far
+}
+
+// MessageQueue is a queue backend consumers read messages from. Receive blocks until a
+// message is available or ctx is done. A received message is settled exactly once: acked
+// when the function handled it, or nacked to be delivered again after delay.
+type MessageQueue interface {
+	Publish(queue string, message *QueueMessage) error
+	Receive(ctx context.Context, queue string) (*QueueMessage, error)
+	Ack(queue string, message *QueueMessage)
+	Nack(queue string, message *QueueMessage, delay time.Duration)
+}
+
+// Available queue backends by name. The internal backend keeps messages in memory, so
+// pending messages are lost when the controller restarts.
+var queueBackends = map[string]func() MessageQueue{
+	"internal": func() MessageQueue { return newInternalQueue(internalQueueCapacity) },
+}
+
+// Messages each internal queue holds before publishing fails, configured with QUEUE_CAPACITY
+var internalQueueCapacity = 1000
+
+// Queue backend consumers read from, configured with QUEUE_BACKEND (default internal)
+var messageQueue MessageQueue
+
+func init() {
+	if value := os.Getenv("QUEUE_CAPACITY"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			internalQueueCapacity = parsed
+		} else {
+			log.Printf("Invalid QUEUE_CAPACITY %q, using default %d", value, internalQueueCapacity)
+		}
+	}
+
+	backend := "internal"
+	if value := os.Getenv("QUEUE_BACKEND"); value != "" {
+		if _, known := queueBackends[strings.ToLower(value)]; known {
+			backend = strings.ToLower(value)
+		} else {
+			log.Printf("Invalid QUEUE_BACKEND %q, using default %s", value, backend)
+		}
+	}
+	messageQueue = queueBackends[backend]()
+}
+
+// internalQueue is an in-memory MessageQueue with a bounded channel per queue
+type internalQueue struct {
+	capacity int
+	mutex    sync.Mutex
+	queues   map[string]chan *QueueMessage
+}
+
+func newInternalQueue(capacity int) *internalQueue {
+	return &internalQueue{capacity: capacity, queues: make(map[string]chan *QueueMessage)}
+}
+
+// channel returns the channel of a queue, creating it on first use
+func (q *internalQueue) channel(queue string) chan *QueueMessage {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	ch, exists := q.queues[queue]
+	if !exists {
+		ch = make(chan *QueueMessage, q.capacity)
+		q.queues[queue] = ch
+	}
+	return ch
+}
+
+func (q *internalQueue) Publish(queue string, message *QueueMessage) error {
+	select {
+	case q.channel(queue) <- message:
+		return nil
+	default:
+		return fmt.Errorf("queue is full (%d messages)", q.capacity)
+	}
+}
+
+func (q *internalQueue) Receive(ctx context.Context, queue string) (*QueueMessage, error) {
+	select {
+	case message := <-q.channel(queue):
+		return message, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Ack does nothing, a received message is already off the queue
+func (q *internalQueue) Ack(queue string, message *QueueMessage) {}
+
+func (q *internalQueue) Nack(queue string, message *QueueMessage, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		if err := q.Publish(queue, message); err != nil {
+			log.Printf("Dropping message %s of queue %s, it can't be requeued: %v", message.ID, queue, err)
+		}
+	})
+}
+
+// QueueBinding invokes a function for every message of one of its owner's queues
+type QueueBinding struct {
+	Queue       string    `json:"queue"`
+	Function    string    `json:"function"`
+	Path        string    `json:"path,omitempty"`    // Path below the function messages are posted to, default /
+	Concurrency int       `json:"concurrency"`       // Messages handled at once
+	MaxAttempts int       `json:"max_attempts"`      // Deliveries of a failing message before it is dropped
+	Backoff     string    `json:"backoff,omitempty"` // Wait before the first redelivery, doubled for each further one (default 1s)
+	UserID      string    `json:"user_id"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// QueueBindingRequest binds a queue to a function
+type QueueBindingRequest struct {
+	Queue       string `json:"queue"`
+	Function    string `json:"function"`
+	Path        string `json:"path,omitempty"`
+	Concurrency int    `json:"concurrency,omitempty"`  // Default 1
+	MaxAttempts int    `json:"max_attempts,omitempty"` // Default 3
+	Backoff     string `json:"backoff,omitempty"`
+}
+
+// Queue bindings, keyed by userID + "-" + queue like the function registry, and the
+// cancel functions of their running consumers
+var (
+	queueBindings     = make(map[string]*QueueBinding)
+	queueConsumers    = make(map[string]context.CancelFunc)
+	queueMutex        = &sync.RWMutex{}
+	queueBindingsFile = "/app/data/queue-bindings.json" // Path to store queue bindings
+)
+
+// queueBindingsHandler manages the requesting user's queue bindings: GET /queues lists
+// them, POST /queues binds a queue to a function, replacing its binding, and
+// DELETE /queues/{queue} stops consuming a queue
+func queueBindingsHandler(w http.ResponseWriter, r *http.Request, queue string) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		listQueueBindings(w, userID)
+	case http.MethodPost:
+		bindQueue(w, r, userID)
+	case http.MethodDelete:
+		queueMutex.Lock()
+		_, exists := queueBindings[userID+"-"+queue]
+		delete(queueBindings, userID+"-"+queue)
+		stopQueueConsumer(userID + "-" + queue)
+		queueMutex.Unlock()
+		if !exists {
+			http.Error(w, fmt.Sprintf("Queue '%s' is not bound", queue), http.StatusNotFound)
+			return
+		}
+		if err := saveQueueBindings(); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to save queue bindings: %v", err), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Unbound queue %s of user %s", queue, userID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r)
+	}
+}
+
+// listQueueBindings writes the user's queue bindings sorted by queue
+func listQueueBindings(w http.ResponseWriter, userID string) {
+	queueMutex.RLock()
+	userBindings := make([]QueueBinding, 0)
+	for _, binding := range queueBindings {
+		if binding.UserID == userID {
+			userBindings = append(userBindings, *binding)
+		}
+	}
+	queueMutex.RUnlock()
+
+	sort.Slice(userBindings, func(i, j int) bool { return userBindings[i].Queue < userBindings[j].Queue })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(userBindings)
+}
+
+// bindQueue binds a queue to a function and starts consuming it
+func bindQueue(w http.ResponseWriter, r *http.Request, userID string) {
+	var request QueueBindingRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	binding := &QueueBinding{
+		Queue:       request.Queue,
+		Function:    request.Function,
+		Path:        request.Path,
+		Concurrency: request.Concurrency,
+		MaxAttempts: request.MaxAttempts,
+		Backoff:     request.Backoff,
+		UserID:      userID,
+		UpdatedAt:   time.Now(),
+	}
+	if err := validateQueueBinding(binding); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, _, exists := findFunction(userID, binding.Function); !exists {
+		http.Error(w, fmt.Sprintf("Function '%s' not found", binding.Function), http.StatusNotFound)
+		return
+	}
+
+	// Replace the consumer of a queue that was bound before
+	key := userID + "-" + binding.Queue
+	queueMutex.Lock()
+	stopQueueConsumer(key)
+	queueBindings[key] = binding
+	startQueueConsumer(key, binding)
+	queueMutex.Unlock()
+	if err := saveQueueBindings(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save queue bindings: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Bound queue %s of user %s to function %s with %d consumers", binding.Queue, userID, binding.Function, binding.Concurrency)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(binding)
+}
+
+// validateQueueBinding checks a queue binding, filling in its defaults
+func validateQueueBinding(binding *QueueBinding) error {
+	if !aliasNamePattern.MatchString(binding.Queue) {
+		return fmt.Errorf("invalid queue '%s', use up to 63 letters, digits, '.', '-' and '_'", binding.Queue)
+	}
+	if binding.Function == "" {
+		return fmt.Errorf("function is required")
+	}
+	if binding.Path != "" && !strings.HasPrefix(binding.Path, "/") {
+		return fmt.Errorf("path must start with /")
+	}
+	if binding.Concurrency == 0 {
+		binding.Concurrency = defaultQueueConcurrency
+	}
+	if binding.Concurrency < 1 || binding.Concurrency > maxQueueConcurrency {
+		return fmt.Errorf("concurrency must be between 1 and %d", maxQueueConcurrency)
+	}
+	if binding.MaxAttempts == 0 {
+		binding.MaxAttempts = defaultQueueAttempts
+	}
+	if binding.MaxAttempts < 1 || binding.MaxAttempts > maxQueueAttempts {
+		return fmt.Errorf("max_attempts must be between 1 and %d", maxQueueAttempts)
+	}
+	if binding.Backoff != "" {
+		backoff, err := time.ParseDuration(binding.Backoff)
+		if err != nil || backoff <= 0 || backoff > maxQueueBackoff {
+			return fmt.Errorf("invalid backoff '%s', use a duration up to %s", binding.Backoff, maxQueueBackoff)
+		}
+	}
+	return nil
+}
+
+// backoff returns the wait before redelivering a message that failed attempts times
+func (b *QueueBinding) backoff(attempts int) time.Duration {
+	backoff := defaultQueueBackoff
+	if parsed, err := time.ParseDuration(b.Backoff); err == nil {
+		backoff = parsed
+	}
+	backoff <<= attempts - 1
+	if backoff > maxQueueBackoff || backoff <= 0 {
+		backoff = maxQueueBackoff
+	}
+	return backoff
+}
+
+// publishQueueMessageHandler adds the request body to one of the user's queues as a message
+func publishQueueMessageHandler(w http.ResponseWriter, r *http.Request, queue string) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+	if !aliasNamePattern.MatchString(queue) {
+		http.Error(w, fmt.Sprintf("Invalid queue '%s'", queue), http.StatusBadRequest)
+		return
+	}
+
+	body, err := readInvocationBody(r)
+	if err != nil {
+		writeInvocationError(w, err)
+		return
+	}
+	message := &QueueMessage{
+		ID:          newRequestID(),
+		Body:        body,
+		ContentType: r.Header.Get("Content-Type"),
+	}
+	if err := messageQueue.Publish(userID+"-"+queue, message); err != nil {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, fmt.Sprintf("Failed to publish to queue '%s': %v", queue, err), http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"queue": queue,
+		"id":    message.ID,
+	})
+}
+
+// startQueueConsumer starts the consumers of a binding. queueMutex must be held.
+func startQueueConsumer(key string, binding *QueueBinding) {
+	ctx, cancel := context.WithCancel(context.Background())
+	queueConsumers[key] = cancel
+	for i := 0; i < binding.Concurrency; i++ {
+		go consumeQueue(ctx, key, *binding)
+	}
+}
+
+// stopQueueConsumer stops the consumers of a binding, letting messages being handled
+// finish. queueMutex must be held.
+func stopQueueConsumer(key string) {
+	if cancel, exists := queueConsumers[key]; exists {
+		cancel()
+		delete(queueConsumers, key)
+	}
+}
+
+// consumeQueue invokes the bound function for each message of a queue until ctx is done.
+// Messages the function handled are acked, failed ones are redelivered with a backoff
+// until the binding's attempts are used up, and then dropped.
+func consumeQueue(ctx context.Context, key string, binding QueueBinding) {
+	for {
+		message, err := messageQueue.Receive(ctx, key)
+		if err != nil {
+			return
+		}
+
+		message.Attempts++
+		err = invokeForMessage(binding, message)
+		switch {
+		case err == nil:
+			messageQueue.Ack(key, message)
+		case message.Attempts < binding.MaxAttempts:
+			backoff := binding.backoff(message.Attempts)
+			log.Printf("Message %s of queue %s failed (attempt %d/%d), redelivering in %s: %v",
+				message.ID, binding.Queue, message.Attempts, binding.MaxAttempts, backoff, err)
+			messageQueue.Nack(key, message, backoff)
+		default:
+			log.Printf("Dropping message %s of queue %s after %d attempts: %v", message.ID, binding.Queue, message.Attempts, err)
+			messageQueue.Ack(key, message)
+		}
+	}
+}
+
+// invokeForMessage posts a message to the bound function like an invocation by its owner,
+// failing unless the function answers with a 2xx status
+func invokeForMessage(binding QueueBinding, message *QueueMessage) error {
+	function, _, exists := findFunction(binding.UserID, binding.Function)
+	if !exists {
+		return fmt.Errorf("function '%s' not found", binding.Function)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "/invoke/"+url.PathEscape(binding.Function)+binding.Path, nil)
+	if err != nil {
+		return err
+	}
+	if message.ContentType != "" {
+		req.Header.Set("Content-Type", message.ContentType)
+	}
+	req.Header.Set("X-User-ID", binding.UserID)
+	req.Header.Set("X-Request-ID", newRequestID())
+	req.Header.Set(queueHeader, binding.Queue)
+	req.Header.Set(queueMessageIDHeader, message.ID)
+	req.Header.Set(queueAttemptHeader, strconv.Itoa(message.Attempts))
+
+	response, err := bufferedInvocation(function, binding.Function, req, message.Body, resolveInvokeTimeout(function), time.Now())
+	if err != nil {
+		return err
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("function returned status %d", response.StatusCode)
+	}
+	return nil
+}
+
+// saveQueueBindings writes the queue bindings to disk
+func saveQueueBindings() error {
+	queueMutex.RLock()
+	data, err := json.MarshalIndent(queueBindings, "", "  ")
+	queueMutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(queueBindingsFile), 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(queueBindingsFile, data, 0644); err != nil {
+		log.Printf("Error writing queue bindings file: %v", err)
+		return err
+	}
+	return nil
+}
+
+// loadQueueBindings reads the queue bindings from disk and starts their consumers
+func loadQueueBindings() error {
+	if _, err := os.Stat(queueBindingsFile); os.IsNotExist(err) {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(queueBindingsFile)
+	if err != nil {
+		return err
+	}
+
+	queueMutex.Lock()
+	defer queueMutex.Unlock()
+	if err := json.Unmarshal(data, &queueBindings); err != nil {
+		return err
+	}
+	for key, binding := range queueBindings {
+		startQueueConsumer(key, binding)
+	}
+
+	log.Printf("Loaded %d queue bindings", len(queueBindings))
+	return nil
+}
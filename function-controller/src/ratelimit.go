@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Per-user invocation rate limit, as a token bucket refilled at invokeRateLimit tokens per second.
+// Configured with INVOKE_RATE_LIMIT and INVOKE_RATE_BURST; a rate of 0 disables the limit.
+var (
+	invokeRateLimit = 10.0
+	invokeRateBurst = 20
+)
+
+// defaultMaxConcurrency is how many invocations of a function may be in flight unless the
+// function overrides it, configured with FUNCTION_MAX_CONCURRENCY; 0 means unlimited
+var defaultMaxConcurrency = 0
+
+func init() {
+	if value := os.Getenv("INVOKE_RATE_LIMIT"); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil && parsed >= 0 {
+			invokeRateLimit = parsed
+		} else {
+			log.Printf("Invalid INVOKE_RATE_LIMIT %q, using default %g", value, invokeRateLimit)
+		}
+	}
+	if value := os.Getenv("INVOKE_RATE_BURST"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			invokeRateBurst = parsed
+		} else {
+			log.Printf("Invalid INVOKE_RATE_BURST %q, using default %d", value, invokeRateBurst)
+		}
+	}
+	if value := os.Getenv("FUNCTION_MAX_CONCURRENCY"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+			defaultMaxConcurrency = parsed
+		} else {
+			log.Printf("Invalid FUNCTION_MAX_CONCURRENCY %q, using default %d", value, defaultMaxConcurrency)
+		}
+	}
+}
+
+// tokenBucket tracks the invocations a user may still make
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// refill adds the tokens accumulated since the last update
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(float64(invokeRateBurst), b.tokens+now.Sub(b.updated).Seconds()*invokeRateLimit)
+	b.updated = now
+}
+
+var (
+	invokeBuckets  = make(map[string]*tokenBucket) // Keyed by user ID
+	inFlight       = make(map[string]int)          // In-flight invocations keyed by function key
+	rateLimitMutex sync.Mutex
+)
+
+// bucketFor returns a user's token bucket, refilled up to now. Callers hold rateLimitMutex.
+func bucketFor(userID string, now time.Time) *tokenBucket {
+	bucket, exists := invokeBuckets[userID]
+	if !exists {
+		bucket = &tokenBucket{tokens: float64(invokeRateBurst), updated: now}
+		invokeBuckets[userID] = bucket
+	}
+	bucket.refill(now)
+	return bucket
+}
+
+// allowInvocation takes a token from a user's bucket. When the bucket is empty it
+// returns false and how long until the next token is available.
+func allowInvocation(userID string) (bool, time.Duration) {
+	if invokeRateLimit <= 0 {
+		return true, 0
+	}
+
+	rateLimitMutex.Lock()
+	defer rateLimitMutex.Unlock()
+
+	bucket := bucketFor(userID, time.Now())
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / invokeRateLimit * float64(time.Second))
+		return false, wait
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// validateMaxConcurrency checks a function's concurrency limit
+func validateMaxConcurrency(function *Function) error {
+	if function.MaxConcurrency != nil && *function.MaxConcurrency < 0 {
+		return fmt.Errorf("max_concurrency must not be negative")
+	}
+	return nil
+}
+
+// resolveMaxConcurrency returns how many invocations of a function may be in flight, 0 for unlimited
+func resolveMaxConcurrency(function *Function) int {
+	if function.MaxConcurrency != nil {
+		return *function.MaxConcurrency
+	}
+	return defaultMaxConcurrency
+}
+
+// acquireInvocationSlot reserves one of a function's concurrent invocation slots.
+// It returns false when all slots are in use; otherwise releaseInvocationSlot must be called.
+func acquireInvocationSlot(functionKey string, maxConcurrency int) bool {
+	rateLimitMutex.Lock()
+	defer rateLimitMutex.Unlock()
+
+	if maxConcurrency > 0 && inFlight[functionKey] >= maxConcurrency {
+		return false
+	}
+	inFlight[functionKey]++
+	return true
+}
+
+// releaseInvocationSlot frees a slot reserved by acquireInvocationSlot
+func releaseInvocationSlot(functionKey string) {
+	rateLimitMutex.Lock()
+	defer rateLimitMutex.Unlock()
+
+	inFlight[functionKey]--
+	if inFlight[functionKey] <= 0 {
+		delete(inFlight, functionKey)
+	}
+}
+
+// retryAfterSeconds formats a wait for the Retry-After header, rounded up to whole seconds
+func retryAfterSeconds(wait time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(wait.Seconds())))
+}
+
+// FunctionUsage reports the in-flight invocations of a function against its limit
+type FunctionUsage struct {
+	InFlight       int `json:"in_flight"`
+	MaxConcurrency int `json:"max_concurrency"` // 0 means unlimited
+}
+
+// UsageResponse reports a user's invocation limits and current usage
+type UsageResponse struct {
+	RateLimit       float64                  `json:"rate_limit"` // Invocations per second, 0 means unlimited
+	Burst           int                      `json:"burst"`
+	TokensAvailable float64                  `json:"tokens_available"` // Invocations that can be made right away
+	Functions       map[string]FunctionUsage `json:"functions"`
+}
+
+// usageHandler returns the invocation limits of the requesting user and their current usage
+func usageHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	response := UsageResponse{
+		RateLimit: invokeRateLimit,
+		Burst:     invokeRateBurst,
+		Functions: make(map[string]FunctionUsage),
+	}
+
+	// Collect the user's functions and their limits
+	mutex.RLock()
+	limits := make(map[string]int)
+	names := make(map[string]string)
+	for key, function := range functions {
+		if function.UserID == userID {
+			limits[key] = resolveMaxConcurrency(function)
+			names[key] = function.Name
+		}
+	}
+	mutex.RUnlock()
+
+	rateLimitMutex.Lock()
+	if invokeRateLimit > 0 {
+		response.TokensAvailable = math.Floor(bucketFor(userID, time.Now()).tokens)
+	}
+	for key, limit := range limits {
+		response.Functions[names[key]] = FunctionUsage{
+			InFlight:       inFlight[key],
+			MaxConcurrency: limit,
+		}
+	}
+	rateLimitMutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Readiness probe configuration
+const (
+	readinessProbeInterval    = 250 * time.Millisecond
+	readinessProbeDialTimeout = 1 * time.Second
+)
+
+// readinessProbeTimeout is how long a freshly started function may take to accept
+// connections, unless the function sets its own startup timeout
+var readinessProbeTimeout = 15 * time.Second
+
+// Longest startup timeout a function may set
+const maxStartupTimeout = 10 * time.Minute
+
+func init() {
+	if value := os.Getenv("READINESS_PROBE_TIMEOUT"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			readinessProbeTimeout = parsed
+		} else {
+			log.Printf("Invalid READINESS_PROBE_TIMEOUT %q, using default %s", value, readinessProbeTimeout)
+		}
+	}
+}
+
+// validateStartupTimeout checks the startup timeout of a function
+func validateStartupTimeout(function *Function) error {
+	if function.StartupTimeout == nil {
+		return nil
+	}
+	if *function.StartupTimeout <= 0 {
+		return fmt.Errorf("startup timeout must be a positive number of seconds")
+	}
+	if time.Duration(*function.StartupTimeout)*time.Second > maxStartupTimeout {
+		return fmt.Errorf("startup timeout of %ds exceeds the maximum of %ds", *function.StartupTimeout, int(maxStartupTimeout.Seconds()))
+	}
+	return nil
+}
+
+// resolveStartupTimeout returns how long a started container of a function may take to
+// accept connections
+func resolveStartupTimeout(function *Function) time.Duration {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	if function.StartupTimeout != nil {
+		return time.Duration(*function.StartupTimeout) * time.Second
+	}
+	return readinessProbeTimeout
+}
+
+// ReadinessError is returned when a started function never accepted connections
+type ReadinessError struct {
+	Function string
+	Address  string
+	Err      error
+}
+
+func (e *ReadinessError) Error() string {
+	if e.Address == "" {
+		return fmt.Sprintf("function %s did not become ready: %v", e.Function, e.Err)
+	}
+	return fmt.Sprintf("function %s did not become ready on %s: %v", e.Function, e.Address, e.Err)
+}
+
+// discoverFunctionAddress asks the function proxy which address serves a function
+func discoverFunctionAddress(function *Function) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/discover/%s", functionProxyURL, function.Name), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Function-Owner", function.UserID)
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("discovery returned status %d", resp.StatusCode)
+	}
+
+	var discovery struct {
+		Address string `json:"address"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return "", fmt.Errorf("invalid discovery response: %v", err)
+	}
+	if discovery.Address == "" {
+		return "", fmt.Errorf("discovery returned no address")
+	}
+
+	return discovery.Address, nil
+}
+
+// waitForFunctionReady retries a TCP connect to a freshly started function until it
+// accepts connections, so the first request isn't forwarded before the app listens, then
+// sends the function's warmup request if it has one
+func waitForFunctionReady(function *Function) error {
+	deadline := time.Now().Add(resolveStartupTimeout(function))
+	var address string
+	var lastErr error
+
+	for {
+		// The proxy may not see the new container immediately, so keep resolving until found
+		if address == "" {
+			address, lastErr = discoverFunctionAddress(function)
+		}
+
+		if address != "" {
+			conn, err := net.DialTimeout("tcp", address, readinessProbeDialTimeout)
+			if err == nil {
+				conn.Close()
+				// A container failing its image's HEALTHCHECK isn't ready even if it listens
+				if containerHealth(function.Container) != healthUnhealthy {
+					log.Printf("Function %s is accepting connections on %s", function.Name, address)
+					if err := warmUpContainer(function, address, deadline); err != nil {
+						return &ReadinessError{Function: function.Name, Address: address, Err: err}
+					}
+					return nil
+				}
+				err = fmt.Errorf("container is unhealthy")
+			}
+			lastErr = err
+		}
+
+		if time.Now().After(deadline) {
+			return &ReadinessError{Function: function.Name, Address: address, Err: lastErr}
+		}
+		time.Sleep(readinessProbeInterval)
+	}
+}
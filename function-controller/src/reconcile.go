@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+)
+
+// reconcileContainers matches the function containers on the Docker host with the registry
+// after it was loaded, since the registry doesn't persist containers. A running container of
+// a registered function is adopted as the function's container; containers of functions
+// that aren't registered, stopped ones and any beyond the first of a function are removed.
+func reconcileContainers() error {
+	// Newest containers are listed first, so the most recent one of a function is adopted
+	output, err := exec.Command("docker", "ps", "-a", "--no-trunc",
+		"--filter", "label=function",
+		"--format", fmt.Sprintf("{{.ID}}\t{{.State}}\t{{.Label %q}}\t{{.Label %q}}", "function", "platform.user")).Output()
+	if err != nil {
+		return fmt.Errorf("failed to list function containers: %v", err)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var adopted, removed int
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		containerID, state, functionName, userID := fields[0], fields[1], fields[2], fields[3]
+
+		function, exists := functions[userID+"-"+functionName]
+		switch {
+		case !exists:
+			log.Printf("Removing orphaned container %s of unregistered function %s (user %s)", containerID, functionName, userID)
+		case state != "running":
+			log.Printf("Removing %s container %s of function %s", state, containerID, functionName)
+		case function.Container != "":
+			log.Printf("Removing extra container %s of function %s, adopted %s", containerID, functionName, function.Container)
+		default:
+			function.Container = containerID
+			function.Running = true
+			adopted++
+			log.Printf("Adopted running container %s of function %s", containerID, functionName)
+			continue
+		}
+
+		if output, err := exec.Command("docker", "rm", "-f", containerID).CombinedOutput(); err != nil {
+			log.Printf("Warning: failed to remove container %s: %v\nOutput: %s", containerID, err, string(output))
+			continue
+		}
+		removed++
+	}
+
+	log.Printf("Reconciled function containers: %d adopted, %d removed", adopted, removed)
+	return nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Port function containers listen on, the function proxy's default
+const functionPort = "8080"
+
+// refreshes makes sure only one refresh of a function runs at a time
+var refreshes singleflight.Group
+
+// RefreshResponse reports the outcome of refreshing a function's image
+type RefreshResponse struct {
+	Function  string `json:"function"`
+	Result    string `json:"result"` // up_to_date, pulled or restarted
+	Message   string `json:"message"`
+	Image     string `json:"image"`
+	ImageID   string `json:"image_id"` // ID of the image pulled for the function's tag
+	Container string `json:"container,omitempty"`
+}
+
+// localImage returns the address containers are started from; the registry is reached on
+// localhost from the Docker host
+func localImage(image string) string {
+	if strings.Contains(image, "registry:") {
+		return strings.Replace(image, "registry:", "localhost:", 1)
+	}
+	return image
+}
+
+// refreshFunctionHandler pulls a function's image again and, when its tag now points at a
+// different image than the one the function runs, replaces the container with one from the
+// new image. The new container serves alongside the old one until it is ready.
+func refreshFunctionHandler(w http.ResponseWriter, r *http.Request, functionName string) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	function, functionKey, exists := findFunction(userID, functionName)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Function '%s' not found", functionName), http.StatusNotFound)
+		return
+	}
+
+	result, err, _ := refreshes.Do(functionKey, func() (interface{}, error) {
+		return refreshFunction(function)
+	})
+	if err != nil {
+		log.Printf("Error refreshing function %s: %v", functionKey, err)
+		var refreshErr *invocationError
+		if errors.As(err, &refreshErr) {
+			http.Error(w, refreshErr.Message, refreshErr.Status)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Failed to refresh function: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// refreshFunction pulls a function's image and restarts its container if the image changed
+func refreshFunction(function *Function) (*RefreshResponse, error) {
+	mutex.RLock()
+	image := localImage(function.Image)
+	oldContainer := function.Container
+	running := function.Running && oldContainer != "" && isContainerRunning(oldContainer)
+	mutex.RUnlock()
+
+	if output, err := exec.Command("docker", "pull", "--quiet", image).CombinedOutput(); err != nil {
+		return nil, &invocationError{
+			Status:  http.StatusBadGateway,
+			Message: fmt.Sprintf("Failed to pull image %s: %s", image, strings.TrimSpace(string(output))),
+		}
+	}
+	imageID, err := dockerInspectFormat("image", image, "{{.Id}}")
+	if err != nil {
+		return nil, err
+	}
+	response := &RefreshResponse{Function: function.Name, Image: image, ImageID: imageID}
+
+	// A stopped function starts from the pulled image anyway
+	if !running {
+		response.Result = "pulled"
+		response.Message = fmt.Sprintf("Pulled image %s, function '%s' is not running and starts from it on its next start", image, function.Name)
+		return response, nil
+	}
+
+	containerImageID, err := dockerInspectFormat("container", oldContainer, "{{.Image}}")
+	if err != nil {
+		return nil, err
+	}
+	if containerImageID == imageID {
+		response.Result = "up_to_date"
+		response.Message = fmt.Sprintf("Function '%s' is up to date", function.Name)
+		response.Container = oldContainer
+		return response, nil
+	}
+
+	// Start the new container next to the old one, which keeps serving until it is ready
+	log.Printf("Image of function %s changed from %s to %s, restarting its container", function.Name, containerImageID, imageID)
+	mutex.Lock()
+	if err := validateEnv(function); err != nil {
+		mutex.Unlock()
+		return nil, &invocationError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	err = startContainer(function)
+	newContainer := function.Container
+	function.Container = oldContainer
+	mutex.Unlock()
+	if err == nil {
+		err = checkContainerStartup(function, newContainer)
+	}
+	if err != nil {
+		return nil, &invocationError{Status: http.StatusInternalServerError, Message: fmt.Sprintf("Failed to start function: %v", err)}
+	}
+
+	if err := waitForContainerReady(function, newContainer); err != nil {
+		log.Printf("New container %s of function %s did not become ready, keeping %s: %v", newContainer, function.Name, oldContainer, err)
+		if output, rmErr := exec.Command("docker", "rm", "-f", newContainer).CombinedOutput(); rmErr != nil {
+			log.Printf("Error removing container %s: %v\nOutput: %s", newContainer, rmErr, string(output))
+		}
+		return nil, &invocationError{Status: http.StatusServiceUnavailable, Message: fmt.Sprintf("New container did not become ready: %v", err)}
+	}
+
+	// Switch the function to the new container before retiring the old one
+	mutex.Lock()
+	function.Container = newContainer
+	function.Running = true
+	mutex.Unlock()
+	markRegistryDirty()
+
+	if output, err := exec.Command("docker", "stop", oldContainer).CombinedOutput(); err != nil {
+		log.Printf("Error stopping container %s: %v\nOutput: %s", oldContainer, err, string(output))
+	}
+	if output, err := exec.Command("docker", "rm", "-f", oldContainer).CombinedOutput(); err != nil {
+		log.Printf("Error removing container %s: %v\nOutput: %s", oldContainer, err, string(output))
+	}
+
+	log.Printf("Restarted function %s on container %s", function.Name, newContainer)
+	response.Result = "restarted"
+	response.Message = fmt.Sprintf("Function '%s' restarted from the new image", function.Name)
+	response.Container = newContainer
+	return response, nil
+}
+
+// waitForContainerReady retries a TCP connect to a specific container of a function until it
+// accepts connections, unlike waitForFunctionReady which probes whichever container the
+// proxy picks
+func waitForContainerReady(function *Function, containerID string) error {
+	deadline := time.Now().Add(resolveStartupTimeout(function))
+	var address string
+	var lastErr error
+
+	for {
+		info, err := inspectContainer(containerID)
+		switch {
+		case err != nil:
+			lastErr = err
+		case !info.State.Running:
+			return &ReadinessError{Function: function.Name, Err: fmt.Errorf("container exited with code %d", info.State.ExitCode)}
+		default:
+			if network, ok := info.NetworkSettings.Networks[functionNetworkName()]; ok && network.IPAddress != "" {
+				address = net.JoinHostPort(network.IPAddress, functionPort)
+				conn, err := net.DialTimeout("tcp", address, readinessProbeDialTimeout)
+				if err == nil {
+					conn.Close()
+					if info.State.healthStatus() != healthUnhealthy {
+						return warmUpContainer(function, address, deadline)
+					}
+					err = fmt.Errorf("container is unhealthy")
+				}
+				lastErr = err
+			} else {
+				lastErr = fmt.Errorf("container has no address in network %s", functionNetworkName())
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return &ReadinessError{Function: function.Name, Address: address, Err: lastErr}
+		}
+		time.Sleep(readinessProbeInterval)
+	}
+}
+
+// dockerInspectFormat returns a field of the docker inspect output of an image or container
+func dockerInspectFormat(kind string, name string, format string) (string, error) {
+	output, err := exec.Command("docker", kind, "inspect", "--format", format, name).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect %s %s: %v", kind, name, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
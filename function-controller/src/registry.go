@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// How often pending registry changes are written to disk
+const registryFlushPeriod = 3 * time.Second
+
+var (
+	registryDirty     int32      // Set to 1 when the registry has unsaved changes
+	registrySaveMutex sync.Mutex // Serializes writes of the registry file
+)
+
+// markRegistryDirty schedules the registry to be saved by the next flush
+func markRegistryDirty() {
+	atomic.StoreInt32(&registryDirty, 1)
+}
+
+// flushRegistry saves the registry if it has unsaved changes
+func flushRegistry() {
+	if !atomic.CompareAndSwapInt32(&registryDirty, 1, 0) {
+		return
+	}
+	if err := saveRegistry(); err != nil {
+		// Try again on the next flush
+		markRegistryDirty()
+	}
+}
+
+// startRegistryFlusher periodically saves pending registry changes
+func startRegistryFlusher() {
+	go func() {
+		ticker := time.NewTicker(registryFlushPeriod)
+		defer ticker.Stop()
+		for range ticker.C {
+			flushRegistry()
+		}
+	}()
+}
+
+// handleShutdown flushes pending state to disk when the controller is stopped
+func handleShutdown() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-signals
+		log.Printf("Received %s, flushing state before exit", sig)
+		flushRegistry()
+		saveMetrics()
+		os.Exit(0)
+	}()
+}
+
+// writeFileAtomic writes data to a temp file next to path and renames it into place,
+// so readers never see a partially written file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tempFile, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	if err := os.Chmod(tempPath, perm); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+	return nil
+}
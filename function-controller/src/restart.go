@@ -0,0 +1,236 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Docker restart policies a function can use
+var restartPolicies = map[string]bool{
+	"no":             true,
+	"on-failure":     true,
+	"always":         true,
+	"unless-stopped": true,
+}
+
+// Restart policy used when a function doesn't set one
+const defaultRestartPolicy = "unless-stopped"
+
+// Number of log lines kept when a function crashes
+const crashLogLines = 50
+
+// defaultMaxRestarts is how many times a container may be restarted before the function is marked crashed
+var defaultMaxRestarts = 5
+
+// restartWatchPeriod is how often running containers are checked for crash loops
+var restartWatchPeriod = 10 * time.Second
+
+func init() {
+	if value := os.Getenv("FUNCTION_MAX_RESTARTS"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+			defaultMaxRestarts = parsed
+		} else {
+			log.Printf("Invalid FUNCTION_MAX_RESTARTS %q, using default %d", value, defaultMaxRestarts)
+		}
+	}
+	if value := os.Getenv("RESTART_WATCH_INTERVAL"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			restartWatchPeriod = parsed
+		} else {
+			log.Printf("Invalid RESTART_WATCH_INTERVAL %q, using default %s", value, restartWatchPeriod)
+		}
+	}
+}
+
+// CrashReport describes why a function was marked crashed
+type CrashReport struct {
+	ExitCode     int       `json:"exit_code"`
+	RestartCount int       `json:"restart_count"`
+	Reason       string    `json:"reason"`
+	Logs         string    `json:"logs"` // Tail of the container logs when it crashed
+	CrashedAt    time.Time `json:"crashed_at"`
+}
+
+// validateRestartPolicy checks a function's restart policy and restart bound
+func validateRestartPolicy(function *Function) error {
+	if function.RestartPolicy != "" && !restartPolicies[function.RestartPolicy] {
+		return fmt.Errorf("invalid restart_policy '%s', expected no, on-failure, always or unless-stopped", function.RestartPolicy)
+	}
+	if function.MaxRestarts != nil && *function.MaxRestarts < 0 {
+		return fmt.Errorf("max_restarts must not be negative")
+	}
+	return nil
+}
+
+// resolveRestartPolicy returns the docker restart policy of a function
+func resolveRestartPolicy(function *Function) string {
+	if function.RestartPolicy != "" {
+		return function.RestartPolicy
+	}
+	return defaultRestartPolicy
+}
+
+// resolveMaxRestarts returns how many restarts a function's container is allowed
+func resolveMaxRestarts(function *Function) int {
+	if function.MaxRestarts != nil {
+		return *function.MaxRestarts
+	}
+	return defaultMaxRestarts
+}
+
+// isCrashed reports whether a function was stopped after crashing
+func isCrashed(function *Function) bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return function.Crash != nil
+}
+
+// crashReason returns why a container is considered crashed, or "" if it isn't
+func crashReason(function *Function, info *ContainerInspect) string {
+	maxRestarts := resolveMaxRestarts(function)
+	if info.RestartCount > maxRestarts {
+		return fmt.Sprintf("restarted %d times, exceeding max_restarts %d", info.RestartCount, maxRestarts)
+	}
+	// Docker gave up restarting a container that failed
+	if !info.State.Running && !info.State.Restarting && info.State.ExitCode != 0 {
+		return fmt.Sprintf("exited with code %d", info.State.ExitCode)
+	}
+	return ""
+}
+
+// checkForCrash stops a function whose container is crash looping and records why
+func checkForCrash(functionKey string, function *Function, containerID string) {
+	info, err := inspectContainer(containerID)
+	if err != nil {
+		return
+	}
+	reason := crashReason(function, info)
+	if reason == "" {
+		return
+	}
+
+	// Grab the tail of the logs before removing the container
+	logs := strings.TrimSpace(getContainerLogs(containerID, crashLogLines))
+	log.Printf("Function %s crashed (%s), stopping container %s", functionKey, reason, containerID)
+	if output, err := exec.Command("docker", "rm", "-f", containerID).CombinedOutput(); err != nil {
+		log.Printf("Error removing container %s: %v\nOutput: %s", containerID, err, string(output))
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// The function was restarted or stopped in the meantime
+	if function.Container != containerID {
+		return
+	}
+	function.Container = ""
+	function.Running = false
+	function.Crash = &CrashReport{
+		ExitCode:     info.State.ExitCode,
+		RestartCount: info.RestartCount,
+		Reason:       reason,
+		Logs:         logs,
+		CrashedAt:    time.Now(),
+	}
+	removeSecretsFile(function)
+	markRegistryDirty()
+}
+
+// watchRestarts checks the containers of running functions for crash loops
+func watchRestarts() {
+	type watched struct {
+		key       string
+		function  *Function
+		container string
+	}
+
+	mutex.RLock()
+	var running []watched
+	for key, function := range functions {
+		if function.Running && function.Container != "" {
+			running = append(running, watched{key, function, function.Container})
+		}
+	}
+	mutex.RUnlock()
+
+	for _, w := range running {
+		checkForCrash(w.key, w.function, w.container)
+	}
+}
+
+// startRestartWatcher periodically stops functions that are crash looping
+func startRestartWatcher() {
+	go func() {
+		ticker := time.NewTicker(restartWatchPeriod)
+		defer ticker.Stop()
+		for range ticker.C {
+			watchRestarts()
+		}
+	}()
+}
+
+// FunctionDescription is the detailed state of a function returned by the describe endpoint
+type FunctionDescription struct {
+	Name          string       `json:"name"`
+	Image         string       `json:"image"`
+	Status        string       `json:"status"` // running, stopped or crashed
+	Container     string       `json:"container,omitempty"`
+	RestartPolicy string       `json:"restart_policy"`
+	MaxRestarts   int          `json:"max_restarts"`
+	RestartCount  int          `json:"restart_count"`
+	Crash         *CrashReport `json:"crash,omitempty"`
+	Health        string       `json:"health,omitempty"` // starting, healthy or unhealthy for images with a HEALTHCHECK
+}
+
+// describeFunctionHandler returns the state of a function, including why it crashed
+func describeFunctionHandler(w http.ResponseWriter, r *http.Request, functionName string) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	function, _, exists := findFunction(userID, functionName)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Function '%s' not found", functionName), http.StatusNotFound)
+		return
+	}
+
+	mutex.RLock()
+	description := FunctionDescription{
+		Name:          function.Name,
+		Image:         function.Image,
+		Status:        "stopped",
+		Container:     function.Container,
+		RestartPolicy: resolveRestartPolicy(function),
+		MaxRestarts:   resolveMaxRestarts(function),
+		Crash:         function.Crash,
+	}
+	running := function.Running
+	mutex.RUnlock()
+
+	switch {
+	case description.Crash != nil:
+		description.Status = "crashed"
+		description.RestartCount = description.Crash.RestartCount
+	case running && description.Container != "":
+		if info, err := inspectContainer(description.Container); err == nil {
+			description.RestartCount = info.RestartCount
+			if info.State.Running {
+				description.Status = "running"
+				description.Health = info.State.healthStatus()
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(description)
+}
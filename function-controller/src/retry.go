@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header a client sets to true to let a non-idempotent invocation, e.g. a POST, be retried
+const retryHeader = "X-Retry"
+
+// Header reporting how many times an invocation was retried
+const retryAttemptsHeader = "X-Retry-Attempts"
+
+// Most retries a function may configure, and the longest backoff between them
+const (
+	maxRetryAttempts = 5
+	maxRetryBackoff  = 10 * time.Second
+)
+
+// Defaults of a function's retry policy
+var (
+	defaultRetryStatusCodes = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	defaultRetryBackoff     = 200 * time.Millisecond
+)
+
+// RetryPolicy retries invocations that failed transiently before the client sees the error
+type RetryPolicy struct {
+	Attempts    int    `json:"attempts"`               // Retries after the first attempt
+	StatusCodes []int  `json:"status_codes,omitempty"` // Statuses retried, default 502, 503 and 504
+	Backoff     string `json:"backoff,omitempty"`      // Wait before the first retry, doubled for each further one (default 200ms)
+}
+
+// validateRetryPolicy checks a function's retry policy
+func validateRetryPolicy(function *Function) error {
+	policy := function.Retry
+	if policy == nil {
+		return nil
+	}
+	if policy.Attempts < 0 || policy.Attempts > maxRetryAttempts {
+		return fmt.Errorf("retry attempts must be between 0 and %d", maxRetryAttempts)
+	}
+	for _, status := range policy.StatusCodes {
+		if status < 500 && status != http.StatusTooManyRequests && status != http.StatusRequestTimeout {
+			return fmt.Errorf("retry status %d is not transient, use 408, 429 or a 5xx status", status)
+		}
+		if status > 599 {
+			return fmt.Errorf("invalid retry status %d", status)
+		}
+	}
+	if policy.Backoff != "" {
+		backoff, err := time.ParseDuration(policy.Backoff)
+		if err != nil || backoff <= 0 || backoff > maxRetryBackoff {
+			return fmt.Errorf("invalid retry backoff '%s', use a duration up to %s", policy.Backoff, maxRetryBackoff)
+		}
+	}
+	return nil
+}
+
+// retryEnabled reports whether a failed invocation may be retried: the function must
+// configure retries, and the method must be idempotent unless the client opts in
+func retryEnabled(function *Function, r *http.Request) bool {
+	if function.Retry == nil || function.Retry.Attempts == 0 {
+		return false
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return strings.EqualFold(r.Header.Get(retryHeader), "true")
+}
+
+// retryable reports whether an invocation that ended with status is retried
+func (p *RetryPolicy) retryable(status int) bool {
+	codes := p.StatusCodes
+	if len(codes) == 0 {
+		codes = defaultRetryStatusCodes
+	}
+	for _, code := range codes {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the wait before a retry, doubling from the policy's initial backoff
+func (p *RetryPolicy) backoff(retry int) time.Duration {
+	backoff := defaultRetryBackoff
+	if parsed, err := time.ParseDuration(p.Backoff); err == nil {
+		backoff = parsed
+	}
+	backoff <<= retry - 1
+	if backoff > maxRetryBackoff {
+		backoff = maxRetryBackoff
+	}
+	return backoff
+}
+
+// retryingInvocation sends an invocation like sendInvocation, retrying it with backoff
+// while it fails with a status the function's retry policy retries. The request body is
+// buffered so it can be sent again. Each attempt gets the full timeout.
+func retryingInvocation(w http.ResponseWriter, function *Function, functionName string, r *http.Request, timeout time.Duration, startTime time.Time) (*http.Response, func(), error) {
+	body, err := readInvocationBody(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	mutex.RLock()
+	policy := *function.Retry
+	mutex.RUnlock()
+
+	for retry := 0; ; retry++ {
+		resp, release, err := sendInvocation(function, functionName, r, bytes.NewReader(body), timeout, startTime)
+
+		status := 0
+		var invokeErr *invocationError
+		switch {
+		case err == nil:
+			status = resp.StatusCode
+		case errors.As(err, &invokeErr):
+			status = invokeErr.Status
+		}
+		if retry >= policy.Attempts || !policy.retryable(status) {
+			if retry > 0 {
+				w.Header().Set(retryAttemptsHeader, strconv.Itoa(retry))
+			}
+			return resp, release, err
+		}
+
+		// Drop the failed attempt before waiting for the next one
+		if err == nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, maxBufferedBodySize))
+			resp.Body.Close()
+			release()
+		}
+		backoff := policy.backoff(retry + 1)
+		log.Printf("Invocation of function %s failed with status %d, retry %d/%d in %s", functionName, status, retry+1, policy.Attempts, backoff)
+		requestTrace(r).record("retry-backoff", backoff)
+		select {
+		case <-time.After(backoff):
+		case <-r.Context().Done():
+			return nil, nil, &invocationError{Status: http.StatusServiceUnavailable, Message: "Client went away while the invocation was retried"}
+		}
+	}
+}
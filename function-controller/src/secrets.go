@@ -0,0 +1,248 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Default location of the rendered secrets file inside the function container
+const defaultSecretsPath = "/run/secrets/config.json"
+
+// secretsDir is the tmpfs-backed directory where rendered secrets files are written.
+// It must be bind mounted at the same path on the host so docker can mount files from it.
+var secretsDir = "/run/nabla/secrets"
+
+// Prefix of secret values encrypted at rest, telling them apart from the plaintext values
+// of registries written before secrets were encrypted
+const encryptedSecretPrefix = "enc:v1:"
+
+// Key secrets are encrypted with: SECRETS_KEY, a base64-encoded 32 byte key, or else the
+// key in SECRETS_KEY_FILE, generated when missing. A generated key kept on the data volume
+// only protects the secrets if it is left out of backups and copies of the registry.
+var (
+	secretsKeyFile = "/app/data/secrets.key"
+	secretsAEAD    cipher.AEAD
+	secretsKeyErr  error
+	secretsKeyOnce sync.Once
+)
+
+func init() {
+	if dir := os.Getenv("SECRETS_DIR"); dir != "" {
+		secretsDir = dir
+	}
+	if path := os.Getenv("SECRETS_KEY_FILE"); path != "" {
+		secretsKeyFile = path
+	}
+}
+
+// secretsCipher returns the cipher secrets are encrypted with, loading its key on first use
+func secretsCipher() (cipher.AEAD, error) {
+	secretsKeyOnce.Do(func() {
+		key, err := loadSecretsKey()
+		if err != nil {
+			secretsKeyErr = err
+			return
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			secretsKeyErr = fmt.Errorf("invalid secrets key: %v", err)
+			return
+		}
+		secretsAEAD, secretsKeyErr = cipher.NewGCM(block)
+	})
+	return secretsAEAD, secretsKeyErr
+}
+
+// loadSecretsKey decodes SECRETS_KEY or reads, and if needed generates, the key file
+func loadSecretsKey() ([]byte, error) {
+	if encodedKey := os.Getenv("SECRETS_KEY"); encodedKey != "" {
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("SECRETS_KEY must be a base64-encoded 32 byte key")
+		}
+		return key, nil
+	}
+
+	if data, err := ioutil.ReadFile(secretsKeyFile); err == nil {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid key in %s", secretsKeyFile)
+		}
+		return key, nil
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read secrets key: %v", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate secrets key: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(secretsKeyFile), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create secrets key directory: %v", err)
+	}
+	if err := ioutil.WriteFile(secretsKeyFile, []byte(base64.StdEncoding.EncodeToString(key)), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write secrets key: %v", err)
+	}
+	log.Printf("Generated secrets key at %s, set SECRETS_KEY to keep it elsewhere", secretsKeyFile)
+	return key, nil
+}
+
+// secretAssociatedData binds an encrypted secret to its function and name, so a value
+// can't be moved to another function or secret
+func secretAssociatedData(function *Function, name string) []byte {
+	return []byte(function.UserID + "-" + function.Name + "/" + name)
+}
+
+// sealSecret encrypts a secret value of a function
+func sealSecret(aead cipher.AEAD, function *Function, name, value string) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to encrypt secret %s: %v", name, err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), secretAssociatedData(function, name))
+	return encryptedSecretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// encryptSecrets encrypts the plaintext secrets of a function being registered
+func encryptSecrets(function *Function) error {
+	if len(function.Secrets) == 0 {
+		return nil
+	}
+	aead, err := secretsCipher()
+	if err != nil {
+		return err
+	}
+
+	encrypted := make(map[string]string, len(function.Secrets))
+	for name, value := range function.Secrets {
+		if encrypted[name], err = sealSecret(aead, function, name, value); err != nil {
+			return err
+		}
+	}
+	function.Secrets = encrypted
+	return nil
+}
+
+// decryptSecrets returns the plaintext secrets of a function
+func decryptSecrets(function *Function) (map[string]string, error) {
+	aead, err := secretsCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	decrypted := make(map[string]string, len(function.Secrets))
+	for name, value := range function.Secrets {
+		data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedSecretPrefix))
+		if !strings.HasPrefix(value, encryptedSecretPrefix) || err != nil || len(data) < aead.NonceSize() {
+			return nil, fmt.Errorf("secret %s is corrupted", name)
+		}
+		nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+		plaintext, err := aead.Open(nil, nonce, ciphertext, secretAssociatedData(function, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt secret %s: %v", name, err)
+		}
+		decrypted[name] = string(plaintext)
+	}
+	return decrypted, nil
+}
+
+// encryptLegacySecrets encrypts the secrets a registry written before secrets were
+// encrypted kept in plaintext. It reports whether any were encrypted.
+func encryptLegacySecrets(function *Function) (bool, error) {
+	encrypted := make(map[string]string, len(function.Secrets))
+	migrated := false
+	for name, value := range function.Secrets {
+		encrypted[name] = value
+		if strings.HasPrefix(value, encryptedSecretPrefix) {
+			continue
+		}
+		aead, err := secretsCipher()
+		if err != nil {
+			return false, err
+		}
+		if encrypted[name], err = sealSecret(aead, function, name, value); err != nil {
+			return false, err
+		}
+		migrated = true
+	}
+	if migrated {
+		function.Secrets = encrypted
+	}
+	return migrated, nil
+}
+
+// secretsFileFor returns the host path of the rendered secrets file for a function
+func secretsFileFor(function *Function) string {
+	dirName := strings.ReplaceAll(function.UserID+"-"+function.Name, "/", "_")
+	return filepath.Join(secretsDir, dirName, filepath.Base(function.secretsMountPath()))
+}
+
+// secretsMountPath returns the path the secrets file is mounted at inside the container
+func (f *Function) secretsMountPath() string {
+	if f.SecretsPath != "" {
+		return f.SecretsPath
+	}
+	return defaultSecretsPath
+}
+
+// renderSecretsFile writes the function's secrets to a file and returns the docker
+// volume argument that mounts it read-only into the container
+func renderSecretsFile(function *Function) (string, error) {
+	if len(function.Secrets) == 0 {
+		return "", nil
+	}
+
+	mountPath := function.secretsMountPath()
+	if !filepath.IsAbs(mountPath) {
+		return "", fmt.Errorf("secrets path must be absolute: %s", mountPath)
+	}
+
+	// Secrets are only decrypted to render them, as a flat JSON object
+	secrets, err := decryptSecrets(function)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(secrets, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to render secrets: %v", err)
+	}
+
+	hostPath := secretsFileFor(function)
+	if err := os.MkdirAll(filepath.Dir(hostPath), 0700); err != nil {
+		return "", fmt.Errorf("failed to create secrets directory: %v", err)
+	}
+
+	// The file must be readable by whichever user the container runs as
+	if err := ioutil.WriteFile(hostPath, data, 0444); err != nil {
+		// A read-only file from a previous start can't be truncated, replace it
+		os.Remove(hostPath)
+		if err := ioutil.WriteFile(hostPath, data, 0444); err != nil {
+			return "", fmt.Errorf("failed to write secrets file: %v", err)
+		}
+	}
+
+	log.Printf("Rendered %d secrets for function %s to %s", len(function.Secrets), function.Name, mountPath)
+	return fmt.Sprintf("%s:%s:ro", hostPath, mountPath), nil
+}
+
+// removeSecretsFile removes the rendered secrets file of a function
+func removeSecretsFile(function *Function) {
+	if len(function.Secrets) == 0 {
+		return
+	}
+
+	dir := filepath.Dir(secretsFileFor(function))
+	if err := os.RemoveAll(dir); err != nil {
+		log.Printf("Warning: failed to remove secrets for function %s: %v", function.Name, err)
+	}
+}
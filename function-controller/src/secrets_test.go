@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "function-controller-test")
+	if err != nil {
+		panic(err)
+	}
+	secretsKeyFile = filepath.Join(dir, "secrets.key")
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func TestEncryptSecrets(t *testing.T) {
+	function := &Function{Name: "api", UserID: "user1", Secrets: map[string]string{"db_password": "hunter2"}}
+	if err := encryptSecrets(function); err != nil {
+		t.Fatal(err)
+	}
+
+	encrypted := function.Secrets["db_password"]
+	if !strings.HasPrefix(encrypted, encryptedSecretPrefix) || strings.Contains(encrypted, "hunter2") {
+		t.Fatalf("secret stored as %q, want it encrypted", encrypted)
+	}
+	secrets, err := decryptSecrets(function)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secrets["db_password"] != "hunter2" {
+		t.Errorf("decrypted secret = %q, want hunter2", secrets["db_password"])
+	}
+
+	// A value can't be moved to another function
+	other := &Function{Name: "api", UserID: "user2", Secrets: map[string]string{"db_password": encrypted}}
+	if _, err := decryptSecrets(other); err == nil {
+		t.Error("decrypted the secret of another user's function")
+	}
+}
+
+func TestEncryptLegacySecrets(t *testing.T) {
+	function := &Function{Name: "api", UserID: "user1", Secrets: map[string]string{"token": "plain"}}
+	migrated, err := encryptLegacySecrets(function)
+	if err != nil || !migrated {
+		t.Fatalf("encryptLegacySecrets() = %v, %v, want true, nil", migrated, err)
+	}
+	encrypted := function.Secrets["token"]
+
+	// Encrypted values are kept as they are
+	if migrated, err := encryptLegacySecrets(function); err != nil || migrated {
+		t.Fatalf("encryptLegacySecrets() of encrypted secrets = %v, %v, want false, nil", migrated, err)
+	}
+	if function.Secrets["token"] != encrypted {
+		t.Error("encrypted secret was encrypted again")
+	}
+	secrets, err := decryptSecrets(function)
+	if err != nil || secrets["token"] != "plain" {
+		t.Errorf("decryptSecrets() = %v, %v, want the legacy value", secrets, err)
+	}
+}
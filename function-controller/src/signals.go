@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Signals a function's container may be stopped with instead of docker's default SIGTERM,
+// e.g. SIGQUIT for servers that drain connections on it but exit at once on SIGTERM
+var stopSignals = map[string]bool{
+	"SIGTERM":  true,
+	"SIGINT":   true,
+	"SIGQUIT":  true,
+	"SIGHUP":   true,
+	"SIGUSR1":  true,
+	"SIGUSR2":  true,
+	"SIGWINCH": true,
+	"SIGKILL":  true,
+}
+
+// validateStopSignal checks a function's stop signal and normalizes it, e.g. quit to SIGQUIT
+func validateStopSignal(function *Function) error {
+	if function.StopSignal == "" {
+		return nil
+	}
+	signal := strings.ToUpper(function.StopSignal)
+	if !strings.HasPrefix(signal, "SIG") {
+		signal = "SIG" + signal
+	}
+	if !stopSignals[signal] {
+		return fmt.Errorf("invalid stop_signal '%s', expected one of SIGTERM, SIGINT, SIGQUIT, SIGHUP, SIGUSR1, SIGUSR2, SIGWINCH or SIGKILL", function.StopSignal)
+	}
+	function.StopSignal = signal
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Largest smoke test request accepted, including the sample body
+const maxSmokeTestRequestSize = 64 * 1024
+
+// Response bytes a smoke test reads from the function; larger responses are reported as truncated
+const maxSmokeTestResponseSize = 10 * 1024 * 1024
+
+// SmokeTestRequest is the sample request a smoke test sends to a function. All fields are optional.
+type SmokeTestRequest struct {
+	Method       string            `json:"method,omitempty"` // Default GET
+	Path         string            `json:"path,omitempty"`   // Path below the function, default /
+	Headers      map[string]string `json:"headers,omitempty"`
+	Body         string            `json:"body,omitempty"`
+	ExpectStatus int               `json:"expect_status,omitempty"` // Status the function must return, default any 2xx
+}
+
+// SmokeTestReport is the outcome of a smoke test
+type SmokeTestReport struct {
+	Function          string `json:"function"`
+	Passed            bool   `json:"passed"`
+	ColdStart         bool   `json:"cold_start"`              // Whether the test had to start the function
+	ColdStartMs       int64  `json:"cold_start_ms,omitempty"` // Time to start the container and pass the health check
+	HealthCheckPassed bool   `json:"health_check_passed"`     // Whether the function accepted connections
+	Status            int    `json:"status,omitempty"`        // Status of the sample request
+	LatencyMs         int64  `json:"latency_ms,omitempty"`    // Time until the full response was received
+	ResponseBytes     int64  `json:"response_bytes"`
+	ResponseTruncated bool   `json:"response_truncated,omitempty"` // Whether the response exceeded the size read
+	Error             string `json:"error,omitempty"`
+}
+
+// smokeTestHandler starts a function if needed, sends it a sample request and reports
+// on the function's health
+func smokeTestHandler(w http.ResponseWriter, r *http.Request, functionName string) {
+	// Extract user ID from request headers
+	userID := r.Header.Get("X-User-ID")
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	function, functionKey, exists := findFunction(userID, functionName)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Function '%s' not found", functionName), http.StatusNotFound)
+		return
+	}
+
+	// Read the sample request, an empty body uses the defaults
+	var sample SmokeTestRequest
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSmokeTestRequestSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Smoke test request must not exceed %d bytes", maxSmokeTestRequestSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err := json.Unmarshal(data, &sample); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid smoke test request: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	if sample.Method == "" {
+		sample.Method = http.MethodGet
+	}
+	sample.Method = strings.ToUpper(sample.Method)
+	if sample.ExpectStatus != 0 && (sample.ExpectStatus < 100 || sample.ExpectStatus > 599) {
+		http.Error(w, fmt.Sprintf("Invalid expect_status %d", sample.ExpectStatus), http.StatusBadRequest)
+		return
+	}
+
+	report := runSmokeTest(function, functionKey, sample)
+	log.Printf("Smoke test of function %s: passed=%v status=%d latency=%dms", functionName, report.Passed, report.Status, report.LatencyMs)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// runSmokeTest runs a smoke test of a function and reports on each step
+func runSmokeTest(function *Function, functionKey string, sample SmokeTestRequest) SmokeTestReport {
+	report := SmokeTestReport{Function: function.Name}
+
+	if isCrashed(function) {
+		report.Error = "function crashed and must be started again"
+		return report
+	}
+
+	// Start the function if needed, otherwise check it still accepts connections
+	if needsColdStart(function) {
+		report.ColdStart = true
+		startTime := time.Now()
+		err := coldStart(functionKey, function)
+		report.ColdStartMs = time.Since(startTime).Milliseconds()
+		if err != nil {
+			report.Error = fmt.Sprintf("failed to start function: %v", err)
+			return report
+		}
+	} else if err := waitForFunctionReady(function); err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	report.HealthCheckPassed = true
+
+	// The sample request counts against the function's concurrency limit
+	if !acquireInvocationSlot(functionKey, resolveMaxConcurrency(function)) {
+		report.Error = "function is at its concurrency limit"
+		return report
+	}
+	defer releaseInvocationSlot(functionKey)
+
+	functionURL := fmt.Sprintf("%s/function/%s/%s", functionProxyURL, function.Name, strings.TrimPrefix(sample.Path, "/"))
+	req, err := http.NewRequest(sample.Method, functionURL, strings.NewReader(sample.Body))
+	if err != nil {
+		report.Error = fmt.Sprintf("invalid sample request: %v", err)
+		return report
+	}
+	for key, value := range sample.Headers {
+		req.Header.Set(key, value)
+	}
+	applyRequestHeaderRules(function, req.Header)
+	req.Header.Set("X-Function-Owner", function.UserID)
+	timeout := resolveInvokeTimeout(function)
+	req.Header.Set(invokeTimeoutHeader, strconv.Itoa(int(timeout.Seconds())))
+
+	client := &http.Client{Timeout: timeout, Transport: invokeTransport}
+	startTime := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		report.LatencyMs = time.Since(startTime).Milliseconds()
+		report.Error = fmt.Sprintf("sample request failed: %v", err)
+		return report
+	}
+	defer resp.Body.Close()
+
+	report.Status = resp.StatusCode
+	report.ResponseBytes, err = io.Copy(io.Discard, io.LimitReader(resp.Body, maxSmokeTestResponseSize))
+	report.LatencyMs = time.Since(startTime).Milliseconds()
+	if err != nil {
+		report.Error = fmt.Sprintf("failed to read response: %v", err)
+		return report
+	}
+	if report.ResponseBytes == maxSmokeTestResponseSize {
+		report.ResponseTruncated = true
+	}
+
+	// Check the status against the expected one
+	if sample.ExpectStatus != 0 {
+		if resp.StatusCode != sample.ExpectStatus {
+			report.Error = fmt.Sprintf("expected status %d, got %d", sample.ExpectStatus, resp.StatusCode)
+			return report
+		}
+	} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		report.Error = fmt.Sprintf("function returned status %d", resp.StatusCode)
+		return report
+	}
+
+	report.Passed = true
+	return report
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// invokeTransport is shared by invocations so connections to the function proxy are reused.
+// Compression is left to the function and the client: the transport would otherwise
+// request gzip and decompress the body itself, hiding the function's own encoding.
+var invokeTransport = &http.Transport{
+	DialContext: (&net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext,
+	DisableCompression:    true,
+	MaxIdleConns:          100,
+	IdleConnTimeout:       90 * time.Second,
+	ExpectContinueTimeout: 1 * time.Second,
+}
+
+// streamResponse copies a function's response body to the client, flushing after every
+// chunk so streamed responses (chunked, server-sent events, long polling) arrive as the
+// function writes them instead of once the body is complete
+func streamResponse(w http.ResponseWriter, body io.Reader) error {
+	flusher, canFlush := w.(http.Flusher)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+			if canFlush {
+				flusher.Flush()
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// cancelOnClose is the body of a function response that cancels its request once closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// disableProxyBuffering asks proxies in front of the controller, e.g. NGINX, to pass
+// the response through as it is written
+func disableProxyBuffering(w http.ResponseWriter) {
+	w.Header().Set("X-Accel-Buffering", "no")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// withFunctionProxy points invocations at a test server standing in for the function proxy
+func withFunctionProxy(t *testing.T, handler http.HandlerFunc) {
+	proxy := httptest.NewServer(handler)
+	previous := functionProxyURL
+	functionProxyURL = proxy.URL
+	t.Cleanup(func() {
+		functionProxyURL = previous
+		proxy.Close()
+	})
+}
+
+// A chunked function response reaches the client chunk by chunk, and keeps streaming
+// past the invocation timeout, which only bounds the wait for the response headers
+func TestStreamedInvocation(t *testing.T) {
+	firstChunkRead := make(chan struct{})
+	withFunctionProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: first\n\n"))
+		w.(http.Flusher).Flush()
+
+		// The client has to see the first event before the next one is written
+		select {
+		case <-firstChunkRead:
+		case <-time.After(5 * time.Second):
+			t.Error("first event wasn't streamed to the client")
+			return
+		}
+		time.Sleep(300 * time.Millisecond)
+		w.Write([]byte("data: second\n\n"))
+	})
+
+	function := &Function{Name: "events", UserID: "user1", Image: "events:latest", Running: true}
+	controller := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp, err := forwardInvocation(function, function.Name, r, r.Body, 100*time.Millisecond, time.Now())
+		if err != nil {
+			writeInvocationError(w, err)
+			return
+		}
+		defer resp.Body.Close()
+		disableProxyBuffering(w)
+		w.WriteHeader(resp.StatusCode)
+		if err := streamResponse(w, resp.Body); err != nil {
+			t.Errorf("streamResponse() = %v", err)
+		}
+	}))
+	defer controller.Close()
+
+	resp, err := http.Get(controller.URL + "/function/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if len(resp.TransferEncoding) == 0 || resp.TransferEncoding[0] != "chunked" {
+		t.Errorf("transfer encoding = %v, want chunked", resp.TransferEncoding)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	for _, want := range []string{"data: first\n", "\n", "data: second\n", "\n"} {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading %q: %v", want, err)
+		}
+		if line != want {
+			t.Fatalf("read %q, want %q", line, want)
+		}
+		if want == "data: first\n" {
+			close(firstChunkRead)
+		}
+	}
+}
+
+// The invocation timeout still applies while waiting for the response headers
+func TestInvocationHeaderTimeout(t *testing.T) {
+	withFunctionProxy(t, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	})
+
+	function := &Function{Name: "slow", UserID: "user1", Image: "slow:latest", Running: true}
+	r := httptest.NewRequest(http.MethodGet, "/function/slow", nil)
+	_, err := forwardInvocation(function, function.Name, r, http.NoBody, 50*time.Millisecond, time.Now())
+	invokeErr, ok := err.(*invocationError)
+	if !ok || invokeErr.Status != http.StatusGatewayTimeout {
+		t.Fatalf("forwardInvocation() = %v, want a gateway timeout", err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Header clients use to override the invocation timeout of a single request, in seconds
+const invokeTimeoutHeader = "X-Invoke-Timeout"
+
+// Default time an invocation may take, less than the client-side 30s
+const defaultInvokeTimeout = 25 * time.Second
+
+// maxInvokeTimeout is the largest timeout a client may request
+var maxInvokeTimeout = 300 * time.Second
+
+func init() {
+	if value := os.Getenv("MAX_INVOKE_TIMEOUT"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			maxInvokeTimeout = time.Duration(seconds) * time.Second
+		} else {
+			log.Printf("Invalid MAX_INVOKE_TIMEOUT %q, using default %s", value, maxInvokeTimeout)
+		}
+	}
+}
+
+// invokeTimeout returns the timeout for an invocation, honoring the X-Invoke-Timeout header
+func invokeTimeout(r *http.Request) (time.Duration, error) {
+	value := r.Header.Get(invokeTimeoutHeader)
+	if value == "" {
+		return defaultInvokeTimeout, nil
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid %s '%s', expected a positive number of seconds", invokeTimeoutHeader, value)
+	}
+
+	timeout := time.Duration(seconds) * time.Second
+	if timeout > maxInvokeTimeout {
+		return 0, fmt.Errorf("%s of %ds exceeds the platform maximum of %ds",
+			invokeTimeoutHeader, seconds, int(maxInvokeTimeout.Seconds()))
+	}
+
+	return timeout, nil
+}
+
+// validateTimeout checks a function's own invocation timeout
+func validateTimeout(function *Function) error {
+	if function.Timeout == nil {
+		return nil
+	}
+	if *function.Timeout <= 0 {
+		return fmt.Errorf("timeout must be a positive number of seconds")
+	}
+	if time.Duration(*function.Timeout)*time.Second > maxInvokeTimeout {
+		return fmt.Errorf("timeout of %ds exceeds the platform maximum of %ds", *function.Timeout, int(maxInvokeTimeout.Seconds()))
+	}
+	return nil
+}
+
+// resolveInvokeTimeout returns the timeout of a function's invocations without a per-request override
+func resolveInvokeTimeout(function *Function) time.Duration {
+	if function.Timeout != nil {
+		return time.Duration(*function.Timeout) * time.Second
+	}
+	return defaultInvokeTimeout
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Header a client sets to true to trace an invocation of a function that doesn't trace
+// all its invocations. Forwarded to the function proxy so it reports its own timings.
+const traceHeader = "X-Trace"
+
+// Header the function proxy answers traced requests with, e.g. route=0.4,container=35.2,
+// the milliseconds spent routing the request and waiting for the container's response
+const proxyTimingHeader = "X-Proxy-Timing"
+
+// invocationTrace breaks the latency of an invocation down into phases: queue until it is
+// forwarded, cold-start, proxy routing, network hops, function execution until the
+// response headers, and copying the response to the client
+type invocationTrace struct {
+	mutex     sync.Mutex
+	startTime time.Time
+	phases    []tracePhase
+}
+
+// tracePhase is the time spent in one phase, summed over retries
+type tracePhase struct {
+	name     string
+	duration time.Duration
+}
+
+type traceContextKey struct{}
+
+// traceEnabled reports whether an invocation is traced, because its function traces every
+// invocation or the client asked for it
+func traceEnabled(function *Function, r *http.Request) bool {
+	mutex.RLock()
+	enabled := function.Trace
+	mutex.RUnlock()
+	return enabled || strings.EqualFold(r.Header.Get(traceHeader), "true")
+}
+
+// startInvocationTrace attaches a trace to an invocation's request
+func startInvocationTrace(r *http.Request, startTime time.Time) (*http.Request, *invocationTrace) {
+	trace := &invocationTrace{startTime: startTime}
+	return r.WithContext(context.WithValue(r.Context(), traceContextKey{}, trace)), trace
+}
+
+// requestTrace returns the trace of an invocation, nil when it isn't traced
+func requestTrace(r *http.Request) *invocationTrace {
+	trace, _ := r.Context().Value(traceContextKey{}).(*invocationTrace)
+	return trace
+}
+
+// record adds time spent in a phase; a nil trace records nothing
+func (t *invocationTrace) record(name string, duration time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for i := range t.phases {
+		if t.phases[i].name == name {
+			t.phases[i].duration += duration
+			return
+		}
+	}
+	t.phases = append(t.phases, tracePhase{name: name, duration: duration})
+}
+
+// recordOnce records a phase unless it was recorded already, e.g. the queue of a retry
+func (t *invocationTrace) recordOnce(name string, duration time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mutex.Lock()
+	for _, phase := range t.phases {
+		if phase.name == name {
+			t.mutex.Unlock()
+			return
+		}
+	}
+	t.mutex.Unlock()
+	t.record(name, duration)
+}
+
+// recordUpstream splits the time a request to the function proxy took into the proxy's
+// routing, the function's execution and the network hops left over, using the timings
+// the proxy reported. The proxy's header isn't passed on to the client.
+func (t *invocationTrace) recordUpstream(header http.Header, upstream time.Duration) {
+	timing := header.Get(proxyTimingHeader)
+	header.Del(proxyTimingHeader)
+	if t == nil {
+		return
+	}
+
+	var route, container time.Duration
+	for _, field := range strings.Split(timing, ",") {
+		parts := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, value := parts[0], parts[1]
+		ms, err := strconv.ParseFloat(value, 64)
+		if err != nil || ms < 0 {
+			continue
+		}
+		switch key {
+		case "route":
+			route = time.Duration(ms * float64(time.Millisecond))
+		case "container":
+			container = time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	if container == 0 || route+container > upstream {
+		// Without the proxy's timings only the whole hop is known
+		t.record("upstream", upstream)
+		return
+	}
+	t.record("proxy", route)
+	t.record("network", upstream-route-container)
+	t.record("function", container)
+}
+
+// serverTiming formats the phases recorded so far as a Server-Timing header value
+func (t *invocationTrace) serverTiming() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	metrics := make([]string, 0, len(t.phases)+1)
+	for _, phase := range t.phases {
+		metrics = append(metrics, fmt.Sprintf("%s;dur=%s", phase.name, formatTraceMs(phase.duration)))
+	}
+	metrics = append(metrics, fmt.Sprintf("total;dur=%s", formatTraceMs(time.Since(t.startTime))))
+	return strings.Join(metrics, ", ")
+}
+
+// finish logs the trace once the invocation is answered
+func (t *invocationTrace) finish(function *Function, r *http.Request) {
+	t.mutex.Lock()
+	phases := make(map[string]float64, len(t.phases))
+	for _, phase := range t.phases {
+		phases[phase.name] = traceMs(phase.duration)
+	}
+	t.mutex.Unlock()
+
+	line, err := json.Marshal(map[string]interface{}{
+		"request_id": r.Header.Get(requestIDHeader),
+		"function":   function.Name,
+		"owner":      function.UserID,
+		"phases_ms":  phases,
+		"total_ms":   traceMs(time.Since(t.startTime)),
+	})
+	if err != nil {
+		log.Printf("Error encoding invocation trace: %v", err)
+		return
+	}
+	log.Printf("[trace] %s", line)
+}
+
+// traceMs converts a duration to milliseconds with microsecond precision
+func traceMs(duration time.Duration) float64 {
+	return float64(duration.Microseconds()) / 1000
+}
+
+func formatTraceMs(duration time.Duration) string {
+	return strconv.FormatFloat(traceMs(duration), 'f', -1, 64)
+}
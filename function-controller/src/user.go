@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// defaultRunAsUser is the user functions run as unless they override it (e.g. "1000:1000")
+var defaultRunAsUser = os.Getenv("FUNCTION_RUN_AS_USER")
+
+// How long a container started as a non-default user is watched for an early crash
+const runAsUserStartupCheck = 2 * time.Second
+
+// Matches user[:group] where each part is a name or a numeric id
+var runAsUserPattern = regexp.MustCompile(`^[a-z_][a-z0-9_-]*[$]?(:[a-z_][a-z0-9_-]*[$]?)?$|^[0-9]+(:[0-9]+)?$`)
+
+// validateRunAsUser checks that a runAsUser value is a valid docker --user argument
+func validateRunAsUser(user string) error {
+	if user == "" {
+		return nil
+	}
+	if !runAsUserPattern.MatchString(user) {
+		return fmt.Errorf("invalid run_as_user '%s', expected uid[:gid] or user[:group]", user)
+	}
+	return nil
+}
+
+// resolveRunAsUser returns the user a function's container should run as
+func resolveRunAsUser(function *Function) string {
+	if function.RunAsUser != "" {
+		return function.RunAsUser
+	}
+	return defaultRunAsUser
+}
+
+// checkContainerStartup verifies a container of a function just started as a specific
+// user didn't immediately crash, which usually means the image's files aren't accessible
+// to it. It waits runAsUserStartupCheck, so callers don't hold mutex.
+func checkContainerStartup(function *Function, containerID string) error {
+	mutex.RLock()
+	user := resolveRunAsUser(function)
+	mutex.RUnlock()
+	if user == "" || containerID == "" {
+		return nil
+	}
+
+	time.Sleep(runAsUserStartupCheck)
+
+	info, err := inspectContainer(containerID)
+	if err != nil {
+		return err
+	}
+
+	if info.State.Running && !info.State.Restarting && info.RestartCount == 0 {
+		return nil
+	}
+
+	// Grab the tail of the logs for the error message before removing the container
+	logs := strings.TrimSpace(getContainerLogs(containerID, 20))
+	log.Printf("Container %s for function %s failed to start as user %s (exit code %d)",
+		containerID, function.Name, user, info.State.ExitCode)
+
+	// Don't leave a crash-looping container behind
+	if output, err := exec.Command("docker", "rm", "-f", containerID).CombinedOutput(); err != nil {
+		log.Printf("Error removing container %s: %v\nOutput: %s", containerID, err, string(output))
+	}
+	mutex.Lock()
+	if function.Container == containerID {
+		function.Container = ""
+		function.Running = false
+		removeSecretsFile(function)
+	}
+	mutex.Unlock()
+
+	return fmt.Errorf("container exited with code %d when running as user %s; "+
+		"make sure the image's files are readable and executable by this user. Logs:\n%s",
+		info.State.ExitCode, user, logs)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Default location of the data volume inside the function container
+const defaultDataPath = "/data"
+
+// Characters docker doesn't accept in volume names
+var volumeNameInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// dataMountPath returns the path the data volume is mounted at inside the container
+func (f *Function) dataMountPath() string {
+	if f.DataPath != "" {
+		return f.DataPath
+	}
+	return defaultDataPath
+}
+
+// dataVolumeName returns the name of a function's data volume. The hash of the owner
+// and name keeps volumes of functions whose names only differ in invalid characters apart.
+func dataVolumeName(function *Function) string {
+	key := function.UserID + "-" + function.Name
+	hash := sha256.Sum256([]byte(key))
+	return fmt.Sprintf("function-data-%s-%s", volumeNameInvalidChars.ReplaceAllString(key, "_"), hex.EncodeToString(hash[:])[:8])
+}
+
+// validateDataVolume checks the data volume can be mounted where the function asks
+func validateDataVolume(function *Function) error {
+	if function.DataPath == "" {
+		return nil
+	}
+	if !function.DataVolume {
+		return fmt.Errorf("data_path requires data_volume")
+	}
+
+	path := function.DataPath
+	if !filepath.IsAbs(path) || filepath.Clean(path) != path || path == "/" {
+		return fmt.Errorf("data_path must be a clean absolute path other than /: %s", path)
+	}
+	if len(function.Secrets) > 0 && strings.HasPrefix(function.secretsMountPath(), path+"/") {
+		return fmt.Errorf("data_path %s must not contain the secrets path %s", path, function.secretsMountPath())
+	}
+	return nil
+}
+
+// dataVolumeArgs creates the function's data volume if needed and returns the docker run
+// arguments mounting it. The volume outlives the container, so data persists across restarts.
+func dataVolumeArgs(function *Function) ([]string, error) {
+	if !function.DataVolume {
+		return nil, nil
+	}
+
+	name := dataVolumeName(function)
+	output, err := exec.Command("docker", "volume", "create",
+		"--label", fmt.Sprintf("function=%s", function.Name),
+		"--label", fmt.Sprintf("platform.user=%s", function.UserID),
+		name).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create data volume %s: %v, output: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return []string{"-v", fmt.Sprintf("%s:%s", name, function.dataMountPath())}, nil
+}
+
+// removeDataVolume removes a function's data volume and everything stored in it
+func removeDataVolume(function *Function) error {
+	name := dataVolumeName(function)
+	output, err := exec.Command("docker", "volume", "rm", name).CombinedOutput()
+	if err != nil && !strings.Contains(string(output), "no such volume") {
+		return fmt.Errorf("failed to remove data volume %s: %v, output: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	log.Printf("Removed data volume %s of function %s", name, function.Name)
+	return nil
+}
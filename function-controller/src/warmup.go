@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Header set on warmup requests so functions can tell them from real traffic
+const warmupHeader = "X-Warmup"
+
+// WarmupRequest is sent to a freshly started container once it accepts connections, so
+// lazy initialization happens before the first real request rather than during it
+type WarmupRequest struct {
+	Path   string `json:"path"`             // e.g. /health
+	Method string `json:"method,omitempty"` // Default GET
+}
+
+// validateWarmup checks a function's warmup request
+func validateWarmup(function *Function) error {
+	warmup := function.Warmup
+	if warmup == nil {
+		return nil
+	}
+	if !strings.HasPrefix(warmup.Path, "/") {
+		return fmt.Errorf("warmup path must start with /")
+	}
+	if warmup.Method == "" {
+		return nil
+	}
+	warmup.Method = strings.ToUpper(warmup.Method)
+	switch warmup.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodOptions:
+		return nil
+	}
+	return fmt.Errorf("unsupported warmup method '%s'", warmup.Method)
+}
+
+// warmUpContainer sends a function's warmup request to the container at address, waiting
+// for the response until deadline. Any response counts, whatever its status: the request
+// only has to run through the function's initialization.
+func warmUpContainer(function *Function, address string, deadline time.Time) error {
+	mutex.RLock()
+	warmup := function.Warmup
+	mutex.RUnlock()
+	if warmup == nil {
+		return nil
+	}
+
+	method := warmup.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequest(method, "http://"+address+warmup.Path, nil)
+	if err != nil {
+		return fmt.Errorf("invalid warmup request: %v", err)
+	}
+	req.Header.Set(warmupHeader, "true")
+
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return fmt.Errorf("no time left for the warmup request")
+	}
+	startTime := time.Now()
+	client := &http.Client{Timeout: remaining}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("warmup request failed: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	log.Printf("Warmed up function %s with %s %s in %s, status %d", function.Name, method, warmup.Path, time.Since(startTime).Round(time.Millisecond), resp.StatusCode)
+	return nil
+}
@@ -268,7 +268,8 @@ export const functionService = {
       
       // Always register with Function Controller to update the image
       // Use the API Gateway as a proxy to ensure user ID is passed correctly
-      await api.post(`${API_URL}/function/register`, {
+      // Redeployments replace the existing function and its old image
+      await api.post(`${API_URL}/function/register${isRedeployment ? '?overwrite=true' : ''}`, {
         name: fullFunctionName,
         image: response.data.image,
         port: 0  // Let the controller assign a port
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// IsAdmin reports whether a user may manage the platform. Admins are listed by user ID in
+// PLATFORM_ADMINS, separated by commas; when it is unset no user is an admin.
+func IsAdmin(userID string) bool {
+	if userID == "" {
+		return false
+	}
+	for _, admin := range strings.Split(os.Getenv("PLATFORM_ADMINS"), ",") {
+		if strings.TrimSpace(admin) == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminMiddleware is a middleware that validates JWT tokens and only lets platform admins
+// through
+func AdminMiddleware(next http.Handler) http.Handler {
+	return AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !IsAdmin(GetUserID(r)) {
+			log.Printf("User %s is not allowed to access %s", GetUserID(r), r.URL.Path)
+			http.Error(w, "Admin access required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
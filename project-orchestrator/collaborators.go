@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/auth"
+	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
+)
+
+// CollaboratorRequest sets the role of a collaborator
+type CollaboratorRequest struct {
+	Role string `json:"role"`
+}
+
+// listCollaboratorsHandler lists the users a project is shared with: GET /projects/{name}/collaborators
+func listCollaboratorsHandler(w http.ResponseWriter, r *http.Request, projectName string) {
+	// Extract user ID from request headers
+	userID := auth.GetUserID(r)
+
+	project, _, exists := findProject(projectName, userID)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Project %s not found", projectName), http.StatusNotFound)
+		return
+	}
+	if !project.HasRole(userID, models.RoleViewer) {
+		http.Error(w, "You do not have permission to view this project", http.StatusForbidden)
+		return
+	}
+
+	projectsMutex.RLock()
+	collaborators := append([]models.Collaborator{}, project.Collaborators...)
+	projectsMutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collaborators)
+}
+
+// setCollaboratorHandler shares a project with a user or changes their role:
+// PUT /projects/{name}/collaborators/{userID} with {"role": "viewer"|"editor"}
+func setCollaboratorHandler(w http.ResponseWriter, r *http.Request, projectName, collaboratorID string) {
+	// Extract user ID from request headers
+	userID := auth.GetUserID(r)
+
+	project, ok := findOwnedProject(w, projectName, userID)
+	if !ok {
+		return
+	}
+
+	var request CollaboratorRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if !models.ValidCollaboratorRole(request.Role) {
+		http.Error(w, fmt.Sprintf("Invalid role '%s', use %s or %s", request.Role, models.RoleViewer, models.RoleEditor), http.StatusBadRequest)
+		return
+	}
+	if collaboratorID == project.UserID {
+		http.Error(w, "The owner of a project can't be a collaborator", http.StatusBadRequest)
+		return
+	}
+
+	projectsMutex.Lock()
+	project.SetCollaborator(collaboratorID, request.Role)
+	collaborators := project.Collaborators
+	projectsMutex.Unlock()
+
+	if err := saveProjectStatus(project); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save project: %v", err), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Shared project %s with user %s as %s", project.Name, collaboratorID, request.Role)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collaborators)
+}
+
+// removeCollaboratorHandler stops sharing a project with a user:
+// DELETE /projects/{name}/collaborators/{userID}
+func removeCollaboratorHandler(w http.ResponseWriter, r *http.Request, projectName, collaboratorID string) {
+	// Extract user ID from request headers
+	userID := auth.GetUserID(r)
+
+	project, ok := findOwnedProject(w, projectName, userID)
+	if !ok {
+		return
+	}
+
+	projectsMutex.Lock()
+	removed := project.RemoveCollaborator(collaboratorID)
+	projectsMutex.Unlock()
+	if !removed {
+		http.Error(w, fmt.Sprintf("User %s is not a collaborator of project %s", collaboratorID, projectName), http.StatusNotFound)
+		return
+	}
+
+	if err := saveProjectStatus(project); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to save project: %v", err), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Stopped sharing project %s with user %s", project.Name, collaboratorID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// findOwnedProject looks up a project whose collaborators the user may manage, writing
+// the error response when there is none
+func findOwnedProject(w http.ResponseWriter, projectName, userID string) (*models.Project, bool) {
+	project, _, exists := findProject(projectName, userID)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Project %s not found", projectName), http.StatusNotFound)
+		return nil, false
+	}
+	if !project.HasRole(userID, models.RoleOwner) {
+		http.Error(w, "Only the owner can manage the collaborators of this project", http.StatusForbidden)
+		return nil, false
+	}
+	return project, true
+}
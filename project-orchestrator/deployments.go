@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os/exec"
+	"sync"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/auth"
+	"github.com/neeraj-menon/Nabla/project-orchestrator/handlers"
+	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
+)
+
+// deployment is a build or deployment in progress that can be cancelled
+type deployment struct {
+	userID string
+	names  map[string]bool // Upload and manifest names the project may be referred to by
+	cancel context.CancelFunc
+}
+
+// In-progress deployments keyed by project directory
+var (
+	deployments      = make(map[string]*deployment)
+	deploymentsMutex sync.Mutex
+)
+
+// beginDeployment registers a cancellable build or deployment of the project in projectDir.
+// The returned function must be called once it is over.
+func beginDeployment(projectDir, userID, name string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	entry := &deployment{
+		userID: userID,
+		names:  map[string]bool{name: true},
+		cancel: cancel,
+	}
+
+	deploymentsMutex.Lock()
+	deployments[projectDir] = entry
+	deploymentsMutex.Unlock()
+
+	return ctx, func() {
+		deploymentsMutex.Lock()
+		if deployments[projectDir] == entry {
+			delete(deployments, projectDir)
+		}
+		deploymentsMutex.Unlock()
+		cancel()
+	}
+}
+
+// Deploy locks of projects being built or deployed, keyed by userID:projectName like
+// activeProjects. The channel is closed when the lock is released.
+var (
+	deployLocks      = make(map[string]chan struct{})
+	deployLocksMutex sync.Mutex
+)
+
+// tryLockDeploy takes the deploy lock of a user's project, so that two deployments of
+// the same project don't race to create its containers, and returns the function releasing
+// it. It reports false when another deployment holds the lock.
+func tryLockDeploy(userID, projectName string) (func(), bool) {
+	key := fmt.Sprintf("%s:%s", userID, projectName)
+
+	deployLocksMutex.Lock()
+	defer deployLocksMutex.Unlock()
+
+	if _, held := deployLocks[key]; held {
+		return nil, false
+	}
+	released := make(chan struct{})
+	deployLocks[key] = released
+	return func() {
+		deployLocksMutex.Lock()
+		delete(deployLocks, key)
+		deployLocksMutex.Unlock()
+		close(released)
+	}, true
+}
+
+// lockDeploy waits for the deploy lock of a user's project like tryLockDeploy, until ctx
+// is cancelled
+func lockDeploy(ctx context.Context, userID, projectName string) (func(), error) {
+	key := fmt.Sprintf("%s:%s", userID, projectName)
+	for {
+		if unlock, ok := tryLockDeploy(userID, projectName); ok {
+			return unlock, nil
+		}
+
+		deployLocksMutex.Lock()
+		released, held := deployLocks[key]
+		deployLocksMutex.Unlock()
+		if !held {
+			continue
+		}
+
+		log.Printf("Waiting for the deployment of project %s in progress to finish", projectName)
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// addDeploymentName lets an in-progress deployment be found by another name, e.g. the manifest name
+func addDeploymentName(projectDir, name string) {
+	deploymentsMutex.Lock()
+	defer deploymentsMutex.Unlock()
+
+	if entry, exists := deployments[projectDir]; exists && name != "" {
+		entry.names[name] = true
+	}
+}
+
+// cancelDeployment cancels a user's in-progress build or deployment of a project and
+// reports whether one was found. Only deployments owned by the user are cancelled.
+func cancelDeployment(projectName, userID string) bool {
+	if userID == "" {
+		return false
+	}
+
+	deploymentsMutex.Lock()
+	defer deploymentsMutex.Unlock()
+
+	for projectDir, entry := range deployments {
+		if entry.names[projectName] && entry.userID == userID {
+			log.Printf("Cancelling deployment of project %s in %s", projectName, projectDir)
+			entry.cancel()
+			return true
+		}
+	}
+	return false
+}
+
+// cleanupCancelledDeployment removes the containers and NGINX mappings a cancelled
+// deployment already created and marks the project as cancelled. A project cancelled
+// while building has no new containers and is only marked as cancelled.
+func cleanupCancelledDeployment(project *models.Project, reason string) {
+	projectsMutex.Lock()
+	services := make(map[string]models.ServiceStatus, len(project.Services))
+	for name, service := range project.Services {
+		services[name] = service
+	}
+	projectsMutex.Unlock()
+
+	for name, service := range services {
+		// Only services this deployment reached have new containers, the others may still
+		// be served by a previous deployment
+		if service.Status != "deploying" && service.Status != "running" {
+			continue
+		}
+
+		handlers.RemoveProcessContainers(service)
+		containerName := fmt.Sprintf("project-%s-%s", project.Name, name)
+		if output, err := exec.Command("docker", "rm", "-f", containerName).CombinedOutput(); err != nil {
+			log.Printf("Note: could not remove container %s of cancelled deployment: %v (%s)", containerName, err, string(output))
+		}
+		if nginxConfig != nil && (service.PublicURL != "" || service.TCPEndpoint != "") {
+			if err := nginxConfig.DeleteMapping(project.Name, name); err != nil {
+				log.Printf("Error removing NGINX mapping for service %s: %v", name, err)
+			}
+		}
+	}
+
+	projectsMutex.Lock()
+	for name, service := range project.Services {
+		if service.Status != "deploying" && service.Status != "running" && service.Status != "building" {
+			continue
+		}
+		service.Status = "cancelled"
+		service.ContainerID = ""
+		service.Processes = nil
+		service.URL = ""
+		service.PublicURL = ""
+		service.Subdomain = ""
+		service.TCPEndpoint = ""
+		project.Services[name] = service
+	}
+	project.Status = "cancelled"
+	project.Error = reason
+	project.ErrorKind = "cancelled"
+	projectsMutex.Unlock()
+
+	saveProjectStatus(project)
+	log.Printf("Deployment of project %s was cancelled", project.Name)
+}
+
+// cancelProjectHandler cancels a project's in-progress build or deployment
+func cancelProjectHandler(w http.ResponseWriter, r *http.Request, projectName string) {
+	// Extract user ID from request headers
+	userID := auth.GetUserID(r)
+
+	// Editors cancel deployments of projects shared with them on behalf of the owner
+	project, _, exists := findProject(projectName, userID)
+	ownerID := userID
+	if exists && project.HasRole(userID, models.RoleEditor) {
+		ownerID = project.UserID
+	}
+
+	if !cancelDeployment(projectName, ownerID) {
+		if !exists {
+			http.Error(w, fmt.Sprintf("Project %s not found", projectName), http.StatusNotFound)
+			return
+		}
+		if !project.HasRole(userID, models.RoleEditor) {
+			http.Error(w, "You do not have permission to cancel this project", http.StatusForbidden)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Project %s has no build or deployment in progress", projectName), http.StatusConflict)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":  "cancelling",
+		"message": fmt.Sprintf("Deployment of project %s is being cancelled", projectName),
+	})
+}
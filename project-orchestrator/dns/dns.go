@@ -12,13 +12,15 @@ import (
 type DNSManager struct {
 	ZonesDir string
 	ZoneFile string
+	Domain   string // Base domain the zone resolves
 }
 
-// NewDNSManager creates a new DNS manager
-func NewDNSManager() *DNSManager {
+// NewDNSManager creates a new DNS manager for the zone of a base domain
+func NewDNSManager(domain string) *DNSManager {
 	return &DNSManager{
 		ZonesDir: "/app/dns/zones",
-		ZoneFile: "/app/dns/zones/platform.test.zone",
+		ZoneFile: fmt.Sprintf("/app/dns/zones/%s.zone", domain),
+		Domain:   domain,
 	}
 }
 
@@ -34,18 +36,18 @@ func (dm *DNSManager) EnsureZoneFile() error {
 		}
 		
 		// Create the zone file with default content
-		zoneContent := fmt.Sprintf(`$ORIGIN platform.test.
-@   3600 IN SOA ns.platform.test. admin.platform.test. (
-        %d ; serial
+		zoneContent := fmt.Sprintf(`$ORIGIN %[1]s.
+@   3600 IN SOA ns.%[1]s. admin.%[1]s. (
+        %[2]d ; serial
         7200       ; refresh
         3600       ; retry
         1209600    ; expire
         3600 )     ; minimum
 
-    IN NS ns.platform.test.
+    IN NS ns.%[1]s.
 ns  IN A 127.0.0.1
 *   IN A 127.0.0.1
-`, time.Now().Unix())
+`, dm.Domain, time.Now().Unix())
 		
 		if err := os.WriteFile(dm.ZoneFile, []byte(zoneContent), 0644); err != nil {
 			return fmt.Errorf("failed to create zone file: %v", err)
@@ -1,20 +1,22 @@
 package handlers
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
 )
 
-// BuildHandler handles the building of project components
-func BuildHandler(projectDir string, manifest *models.ProjectManifest, userID, username string) (*models.Project, error) {
+// BuildHandler handles the building of project components. The commands it runs are
+// killed when ctx is cancelled.
+func BuildHandler(ctx context.Context, projectDir string, manifest *models.ProjectManifest, userID, username string) (*models.Project, error) {
 	log.Printf("Building project %s from directory %s", manifest.Name, projectDir)
 	
 	// Create a new project object
@@ -30,6 +32,9 @@ func BuildHandler(projectDir string, manifest *models.ProjectManifest, userID, u
 		Username:  username,
 	}
 	
+	// Resolve the package registries used to install dependencies
+	registries := ResolvePackageRegistries(manifest)
+	
 	// Build each service
 	for name, service := range manifest.Services {
 		log.Printf("Building service %s of type %s", name, service.Type)
@@ -42,16 +47,29 @@ func BuildHandler(projectDir string, manifest *models.ProjectManifest, userID, u
 		
 		var err error
 		
-		// Build based on service type
-		switch service.Type {
-		case "static":
-			err = buildStaticService(projectDir, name, service)
-		case "api":
-			err = buildApiService(projectDir, name, service)
-		case "worker":
-			err = buildWorkerService(projectDir, name, service)
-		default:
-			err = fmt.Errorf("unsupported service type: %s", service.Type)
+		// Build based on service type, unless the service brings its own Dockerfile or image
+		if service.Image != "" {
+			err = pullServiceImage(ctx, projectDir, name, service)
+		} else if service.Dockerfile != "" {
+			err = checkCustomDockerfile(projectDir, name, service)
+		} else {
+			switch service.Type {
+			case "static":
+				err = buildStaticService(ctx, projectDir, name, service, registries)
+			case "api":
+				err = buildApiService(ctx, projectDir, name, service, registries)
+			case "worker":
+				err = buildWorkerService(ctx, projectDir, name, service, registries)
+			case "tcp":
+				err = buildTcpService(ctx, projectDir, name, service, registries)
+			default:
+				err = newDeployError(UserError, "unsupported service type: %s", service.Type)
+			}
+		}
+		
+		// The .env file is read at deploy time, static builds may still use it
+		if err == nil && service.Type != "static" && service.Image == "" {
+			err = excludeEnvFile(filepath.Join(projectDir, service.Path))
 		}
 		
 		if err != nil {
@@ -61,7 +79,7 @@ func BuildHandler(projectDir string, manifest *models.ProjectManifest, userID, u
 				Status: "failed",
 			}
 			project.Status = "failed"
-			return project, err
+			return project, withService(err, name)
 		}
 		
 		// Update service status
@@ -75,14 +93,72 @@ func BuildHandler(projectDir string, manifest *models.ProjectManifest, userID, u
 	return project, nil
 }
 
+// checkCustomDockerfile checks the Dockerfile of a service that is built entirely by its
+// own Dockerfile, in which case dependencies aren't installed and no Dockerfile is generated
+func checkCustomDockerfile(projectDir string, name string, service models.Service) error {
+	servicePath := filepath.Join(projectDir, service.Path)
+	if _, err := os.Stat(servicePath); os.IsNotExist(err) {
+		return newDeployError(UserError, "service directory %s does not exist", servicePath)
+	}
+	
+	// The build context may be outside the service directory, but not outside the project,
+	// also through symlinks
+	contextDir := service.BuildContextDir(projectDir)
+	if service.BuildContext != "" {
+		resolvedProject, err := filepath.EvalSymlinks(projectDir)
+		if err != nil {
+			return newDeployError(InfraError, "failed to resolve project directory: %v", err)
+		}
+		resolvedContext, err := filepath.EvalSymlinks(contextDir)
+		if err != nil {
+			return newDeployError(UserError, "build context %s does not exist", service.BuildContext)
+		}
+		if resolvedContext != resolvedProject && !strings.HasPrefix(resolvedContext, resolvedProject+string(os.PathSeparator)) {
+			return newDeployError(UserError, "build context %s must be inside the project directory", service.BuildContext)
+		}
+	}
+
+	dockerfilePath := filepath.Join(contextDir, service.Dockerfile)
+	if !strings.HasPrefix(dockerfilePath, filepath.Clean(contextDir)+string(os.PathSeparator)) {
+		return newDeployError(UserError, "dockerfile %s must be inside the build context", service.Dockerfile)
+	}
+	if info, err := os.Stat(dockerfilePath); err != nil || info.IsDir() {
+		contextName := service.Path
+		if service.BuildContext != "" {
+			contextName = service.BuildContext
+		}
+		return newDeployError(UserError, "dockerfile %s does not exist in build context %s", service.Dockerfile, contextName)
+	}
+	
+	log.Printf("Service %s uses its own Dockerfile %s", name, service.Dockerfile)
+	return nil
+}
+
+// pullServiceImage pulls the pre-built image of a service, which is run as is
+func pullServiceImage(ctx context.Context, projectDir string, name string, service models.Service) error {
+	log.Printf("Service %s runs pre-built image %s, pulling it", name, service.Image)
+	
+	cmd := exec.CommandContext(ctx, "docker", "pull", "--quiet", service.Image)
+	output := NewBuildLogBuffer()
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := runCommand(ctx, cmd); err != nil {
+		log.Printf("Pulling image %s failed: %v, output: %s", service.Image, err, output.String())
+		return classifyCommandError(fmt.Errorf("failed to pull image %s: %w", service.Image, err), output.String(), UserError)
+	}
+	
+	log.Printf("Pulled image %s", service.Image)
+	return nil
+}
+
 // buildStaticService builds a static frontend service
-func buildStaticService(projectDir string, name string, service models.Service) error {
+func buildStaticService(ctx context.Context, projectDir string, name string, service models.Service, registries PackageRegistries) error {
 	// Get absolute path to service directory
 	servicePath := filepath.Join(projectDir, service.Path)
 	
 	// Check if the directory exists
 	if _, err := os.Stat(servicePath); os.IsNotExist(err) {
-		return fmt.Errorf("service directory %s does not exist", servicePath)
+		return newDeployError(UserError, "service directory %s does not exist", servicePath)
 	}
 	
 	// Check for package.json to determine if this is a Node.js project
@@ -91,20 +167,28 @@ func buildStaticService(projectDir string, name string, service models.Service)
 		log.Printf("Installing npm dependencies for %s", name)
 		
 		// Create the npm install command
-		cmd := exec.Command("npm", "install")
+		cmd := exec.CommandContext(ctx, "npm", "install")
 		cmd.Dir = servicePath
 		
-		// Capture stdout and stderr
-		var stdout, stderr bytes.Buffer
-		cmd.Stdout = &stdout
-		cmd.Stderr = &stderr
+		// Install from the configured registry
+		env, cleanup, err := registries.npmEnv()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		cmd.Env = withBuildEnv(env, service)
+		
+		// Capture the tail of stdout and stderr
+		stdout, stderr := NewBuildLogBuffer(), NewBuildLogBuffer()
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
 		
 		// Run the command
-		if err := cmd.Run(); err != nil {
+		if err := runCommand(ctx, cmd); err != nil {
 			log.Printf("npm install failed: %v", err)
 			log.Printf("Stdout: %s", stdout.String())
 			log.Printf("Stderr: %s", stderr.String())
-			return fmt.Errorf("npm install failed: %v", err)
+			return classifyCommandError(fmt.Errorf("npm install failed: %w", err), stderr.String(), UserError)
 		}
 		
 		log.Printf("npm dependencies installed successfully")
@@ -117,44 +201,45 @@ func buildStaticService(projectDir string, name string, service models.Service)
 		// Split the build command into parts
 		cmdParts := strings.Fields(service.Build)
 		if len(cmdParts) == 0 {
-			return fmt.Errorf("invalid build command: %s", service.Build)
+			return newDeployError(UserError, "invalid build command: %s", service.Build)
 		}
 		
-		// Create the command
-		cmd := exec.Command(cmdParts[0], cmdParts[1:]...)
+		// Create the command, with the service's build-time variables
+		cmd := exec.CommandContext(ctx, cmdParts[0], cmdParts[1:]...)
 		cmd.Dir = servicePath
+		cmd.Env = withBuildEnv(os.Environ(), service)
 		
-		// Capture stdout and stderr
-		var stdout, stderr bytes.Buffer
-		cmd.Stdout = &stdout
-		cmd.Stderr = &stderr
+		// Capture the tail of stdout and stderr
+		stdout, stderr := NewBuildLogBuffer(), NewBuildLogBuffer()
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
 		
 		// Run the command
-		if err := cmd.Run(); err != nil {
+		if err := runCommand(ctx, cmd); err != nil {
 			log.Printf("Build command failed: %v", err)
 			log.Printf("Stdout: %s", stdout.String())
 			log.Printf("Stderr: %s", stderr.String())
-			return fmt.Errorf("build command failed: %v", err)
+			return classifyCommandError(fmt.Errorf("build command failed: %w", err), stderr.String(), UserError)
 		}
 		log.Printf("Build command completed successfully")
 	}
 	
 	// Create Dockerfile for the static service
-	if err := createStaticDockerfile(projectDir, name, service); err != nil {
-		return fmt.Errorf("failed to create Dockerfile: %v", err)
+	if err := createStaticDockerfile(projectDir, name, service, registries); err != nil {
+		return fmt.Errorf("failed to create Dockerfile: %w", err)
 	}
 	
 	return nil
 }
 
 // buildApiService builds an API backend service
-func buildApiService(projectDir string, name string, service models.Service) error {
+func buildApiService(ctx context.Context, projectDir string, name string, service models.Service, registries PackageRegistries) error {
 	// Get absolute path to service directory
 	servicePath := filepath.Join(projectDir, service.Path)
 	
 	// Check if the directory exists
 	if _, err := os.Stat(servicePath); os.IsNotExist(err) {
-		return fmt.Errorf("service directory %s does not exist", servicePath)
+		return newDeployError(UserError, "service directory %s does not exist", servicePath)
 	}
 	
 	// Install dependencies based on runtime
@@ -165,28 +250,29 @@ func buildApiService(projectDir string, name string, service models.Service) err
 			log.Printf("Installing Python dependencies for %s", name)
 			
 			// Create the pip install command
-			cmd := exec.Command("pip", "install", "-r", "requirements.txt")
+			cmd := exec.CommandContext(ctx, "pip", "install", "-r", "requirements.txt")
 			cmd.Dir = servicePath
+			cmd.Env = withBuildEnv(registries.pipEnv(), service)
 			
-			// Capture stdout and stderr
-			var stdout, stderr bytes.Buffer
-			cmd.Stdout = &stdout
-			cmd.Stderr = &stderr
+			// Capture the tail of stdout and stderr
+			stdout, stderr := NewBuildLogBuffer(), NewBuildLogBuffer()
+			cmd.Stdout = stdout
+			cmd.Stderr = stderr
 			
 			// Run the command
-			if err := cmd.Run(); err != nil {
+			if err := runCommand(ctx, cmd); err != nil {
 				log.Printf("pip install failed: %v", err)
 				log.Printf("Stdout: %s", stdout.String())
 				log.Printf("Stderr: %s", stderr.String())
-				return fmt.Errorf("pip install failed: %v", err)
+				return classifyCommandError(fmt.Errorf("pip install failed: %w", err), stderr.String(), UserError)
 			}
 			
 			log.Printf("Python dependencies installed successfully")
 		}
 		
 		// Create Python Dockerfile
-		if err := createPythonDockerfile(projectDir, name, service); err != nil {
-			return fmt.Errorf("failed to create Python Dockerfile: %v", err)
+		if err := createPythonDockerfile(projectDir, name, service, registries); err != nil {
+			return fmt.Errorf("failed to create Python Dockerfile: %w", err)
 		}
 		
 	case "node":
@@ -195,45 +281,63 @@ func buildApiService(projectDir string, name string, service models.Service) err
 			log.Printf("Installing Node.js dependencies for %s", name)
 			
 			// Create the npm install command
-			cmd := exec.Command("npm", "install")
+			cmd := exec.CommandContext(ctx, "npm", "install")
 			cmd.Dir = servicePath
 			
-			// Capture stdout and stderr
-			var stdout, stderr bytes.Buffer
-			cmd.Stdout = &stdout
-			cmd.Stderr = &stderr
+			// Install from the configured registry
+			env, cleanup, err := registries.npmEnv()
+			if err != nil {
+				return err
+			}
+			defer cleanup()
+			cmd.Env = withBuildEnv(env, service)
+			
+			// Capture the tail of stdout and stderr
+			stdout, stderr := NewBuildLogBuffer(), NewBuildLogBuffer()
+			cmd.Stdout = stdout
+			cmd.Stderr = stderr
 			
 			// Run the command
-			if err := cmd.Run(); err != nil {
+			if err := runCommand(ctx, cmd); err != nil {
 				log.Printf("npm install failed: %v", err)
 				log.Printf("Stdout: %s", stdout.String())
 				log.Printf("Stderr: %s", stderr.String())
-				return fmt.Errorf("npm install failed: %v", err)
+				return classifyCommandError(fmt.Errorf("npm install failed: %w", err), stderr.String(), UserError)
 			}
 			
 			log.Printf("Node.js dependencies installed successfully")
 		}
 		
 		// Create Node.js Dockerfile
-		if err := createNodeDockerfile(projectDir, name, service); err != nil {
-			return fmt.Errorf("failed to create Node.js Dockerfile: %v", err)
+		if err := createNodeDockerfile(projectDir, name, service, registries); err != nil {
+			return fmt.Errorf("failed to create Node.js Dockerfile: %w", err)
 		}
 		
 	default:
-		return fmt.Errorf("unsupported runtime: %s", service.Runtime)
+		return newDeployError(UserError, "unsupported runtime: %s", service.Runtime)
 	}
 	
 	return nil
 }
 
 // buildWorkerService builds a background worker service
-func buildWorkerService(projectDir string, name string, service models.Service) error {
+func buildWorkerService(ctx context.Context, projectDir string, name string, service models.Service, registries PackageRegistries) error {
 	// Worker services are similar to API services for now
-	return buildApiService(projectDir, name, service)
+	return buildApiService(ctx, projectDir, name, service, registries)
+}
+
+// buildTcpService builds a service exposing a raw TCP protocol
+func buildTcpService(ctx context.Context, projectDir string, name string, service models.Service, registries PackageRegistries) error {
+	if service.Port == 0 {
+		return newDeployError(UserError, "tcp service %s must specify a port", name)
+	}
+	
+	// TCP services are built like API services, only their routing differs
+	return buildApiService(ctx, projectDir, name, service, registries)
 }
 
 // createStaticDockerfile creates a Dockerfile for a static frontend service
-func createStaticDockerfile(projectDir string, _ string, service models.Service) error {
+func createStaticDockerfile(projectDir string, _ string, service models.Service, registries PackageRegistries) error {
 	// Get absolute path to service directory
 	servicePath := filepath.Join(projectDir, service.Path)
 	
@@ -260,13 +364,13 @@ WORKDIR /app
 COPY package*.json ./
 
 # Install dependencies
-RUN npm install
+%s
 
 # Copy the source code
 COPY . .
 
 # Build the application
-RUN npm run build
+%sRUN npm run build
 
 # Production stage
 FROM nginx:alpine
@@ -281,7 +385,7 @@ COPY nginx.conf /etc/nginx/conf.d/default.conf
 EXPOSE 80
 
 # Start nginx
-CMD ["nginx", "-g", "daemon off;"]`, outputDir)
+CMD ["nginx", "-g", "daemon off;"]`, registries.npmInstallSteps("npm install"), buildArgDeclarations(service), outputDir)
 	} else {
 		// Check if the output directory exists
 		outputDirExists := true
@@ -316,7 +420,7 @@ CMD ["nginx", "-g", "daemon off;"]`
 	// Write the Dockerfile to the service directory
 	dockerfilePath := filepath.Join(servicePath, "Dockerfile")
 	if err := os.WriteFile(dockerfilePath, []byte(dockerfileContent), 0644); err != nil {
-		return fmt.Errorf("failed to write Dockerfile: %v", err)
+		return newDeployError(InfraError, "failed to write Dockerfile: %v", err)
 	}
 	
 	// Create a default nginx.conf if needed for SPA routing
@@ -365,10 +469,28 @@ CMD ["nginx", "-g", "daemon off;"]`
         }
     }
 
-    # Cache static assets
-    location ~* \.(js|css|png|jpg|jpeg|gif|ico)$ {
+    # Never cache the HTML entry points, they reference the hashed assets of the current
+    # deployment and a stale copy points at assets a redeploy removed
+    location = /index.html {
+        add_header Cache-Control "no-cache" always;
+        add_header 'Access-Control-Allow-Origin' '*' always;
+        add_header 'Access-Control-Allow-Methods' 'GET, POST, OPTIONS, PUT, DELETE' always;
+        add_header 'Access-Control-Allow-Headers' 'Origin, X-Requested-With, Content-Type, Accept, Authorization' always;
+    }
+
+    location ~* \.html$ {
+        add_header Cache-Control "no-cache" always;
+    }
+
+    # Cache assets with a content hash in their name for a year, e.g. main.3f9a1c2b.js
+    location ~* "[.-](?=[a-z_-]*[0-9])[a-z0-9_-]{8,}\.(js|mjs|css|png|jpg|jpeg|gif|ico|svg|webp|woff2?|ttf|map)$" {
         expires 1y;
-        add_header Cache-Control "public, max-age=31536000";
+        add_header Cache-Control "public, max-age=31536000, immutable";
+    }
+
+    # Revalidate other static assets, their content changes under the same name
+    location ~* \.(js|mjs|css|png|jpg|jpeg|gif|ico|svg|webp|woff2?|ttf|map)$ {
+        add_header Cache-Control "no-cache";
     }
 }`
 		
@@ -383,7 +505,7 @@ CMD ["nginx", "-g", "daemon off;"]`
 }
 
 // createPythonDockerfile creates a Dockerfile for a Python backend service
-func createPythonDockerfile(projectDir string, _ string, service models.Service) error {
+func createPythonDockerfile(projectDir string, _ string, service models.Service, registries PackageRegistries) error {
 	// Get absolute path to service directory
 	servicePath := filepath.Join(projectDir, service.Path)
 	
@@ -420,8 +542,7 @@ WORKDIR /app
 
 # Install dependencies
 COPY requirements.txt .
-RUN pip install --no-cache-dir -r requirements.txt
-RUN pip install --no-cache-dir gunicorn
+%s%s
 
 # Set environment variables for CORS
 ENV FLASK_ENV=production
@@ -435,7 +556,10 @@ COPY . .
 EXPOSE %d
 
 # Run with gunicorn
-CMD ["gunicorn", "--bind", "0.0.0.0:%d", "%s:app"]`, entrypoint, port, port, moduleName)
+CMD ["gunicorn", "--bind", "0.0.0.0:%d", "%s:app"]`,
+			buildArgDeclarations(service),
+			registries.pipInstallSteps("pip install --no-cache-dir -r requirements.txt", "pip install --no-cache-dir gunicorn"),
+			entrypoint, port, port, moduleName)
 	} else {
 		// Simple Python app
 		dockerfileContent = fmt.Sprintf(`FROM python:3.9-slim
@@ -444,7 +568,7 @@ WORKDIR /app
 
 # Install dependencies
 COPY requirements.txt .
-RUN pip install --no-cache-dir -r requirements.txt
+%s%s
 
 # Set environment variables for CORS
 ENV FLASK_ENV=production
@@ -458,20 +582,23 @@ COPY . .
 EXPOSE %d
 
 # Run the application
-CMD ["python", "%s"]`, entrypoint, port, entrypoint)
+CMD ["python", "%s"]`,
+			buildArgDeclarations(service),
+			registries.pipInstallSteps("pip install --no-cache-dir -r requirements.txt"),
+			entrypoint, port, entrypoint)
 	}
 	
 	// Write the Dockerfile to the service directory
 	dockerfilePath := filepath.Join(servicePath, "Dockerfile")
 	if err := os.WriteFile(dockerfilePath, []byte(dockerfileContent), 0644); err != nil {
-		return fmt.Errorf("failed to write Dockerfile: %v", err)
+		return newDeployError(InfraError, "failed to write Dockerfile: %v", err)
 	}
 	
 	return nil
 }
 
 // createNodeDockerfile creates a Dockerfile for a Node.js backend service
-func createNodeDockerfile(projectDir string, _ string, service models.Service) error {
+func createNodeDockerfile(projectDir string, _ string, service models.Service, registries PackageRegistries) error {
 	// Get absolute path to service directory
 	servicePath := filepath.Join(projectDir, service.Path)
 	
@@ -509,7 +636,7 @@ WORKDIR /app
 COPY package*.json ./
 
 # Install dependencies
-RUN npm ci
+%s%s
 
 # Copy application code
 COPY . .
@@ -518,7 +645,7 @@ COPY . .
 EXPOSE %d
 
 # Run the application
-CMD ["node", "%s"]`, port, entrypoint)
+CMD ["node", "%s"]`, buildArgDeclarations(service), registries.npmInstallSteps("npm ci"), port, entrypoint)
 	} else {
 		// Simple Node.js app
 		dockerfileContent = fmt.Sprintf(`FROM node:16-alpine
@@ -529,7 +656,7 @@ WORKDIR /app
 COPY package*.json ./
 
 # Install dependencies
-RUN npm ci
+%s%s
 
 # Copy application code
 COPY . .
@@ -538,14 +665,43 @@ COPY . .
 EXPOSE %d
 
 # Run the application
-CMD ["node", "%s"]`, port, entrypoint)
+CMD ["node", "%s"]`, buildArgDeclarations(service), registries.npmInstallSteps("npm ci"), port, entrypoint)
 	}
 	
 	// Write the Dockerfile to the service directory
 	dockerfilePath := filepath.Join(servicePath, "Dockerfile")
 	if err := os.WriteFile(dockerfilePath, []byte(dockerfileContent), 0644); err != nil {
-		return fmt.Errorf("failed to write Dockerfile: %v", err)
+		return newDeployError(InfraError, "failed to write Dockerfile: %v", err)
 	}
 	
 	return nil
 }
+
+// withBuildEnv returns env with the service's build-time variables added, sorted so build
+// commands see them in a stable order
+func withBuildEnv(env []string, service models.Service) []string {
+	for _, key := range sortedKeys(service.BuildEnv) {
+		env = append(env, fmt.Sprintf("%s=%s", key, service.BuildEnv[key]))
+	}
+	return env
+}
+
+// buildArgDeclarations returns the ARG instructions making the service's build-time
+// variables, passed as build args, visible to the RUN steps of a generated Dockerfile
+func buildArgDeclarations(service models.Service) string {
+	var lines strings.Builder
+	for _, key := range sortedKeys(service.BuildEnv) {
+		fmt.Fprintf(&lines, "ARG %s\n", key)
+	}
+	return lines.String()
+}
+
+// sortedKeys returns the keys of a map in lexical order
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Docker build backends
+const (
+	BuilderLegacy   = "legacy"   // docker build with the classic builder
+	BuilderBuildKit = "buildkit" // docker build with DOCKER_BUILDKIT=1
+	BuilderBuildx   = "buildx"   // docker buildx build
+)
+
+// DockerBuilder selects the backend used to build service images.
+// It can be configured with the DOCKER_BUILDER environment variable.
+var DockerBuilder = BuilderLegacy
+
+func init() {
+	if value := os.Getenv("DOCKER_BUILDER"); value != "" {
+		switch value {
+		case BuilderLegacy, BuilderBuildKit, BuilderBuildx:
+			DockerBuilder = value
+		default:
+			log.Printf("Unknown DOCKER_BUILDER %q, using %s", value, DockerBuilder)
+		}
+	}
+}
+
+// dockerBuildCommand returns the command that builds the tagged imageName from contextDir
+// using the configured backend. The image is also tagged latest; BuildKit builds embed
+// their cache in the image and reuse latest as a cache source. extraArgs are added before
+// the context.
+func dockerBuildCommand(ctx context.Context, contextDir string, imageName string, extraArgs []string) *exec.Cmd {
+	var args []string
+	latest := strings.SplitN(imageName, ":", 2)[0] + ":latest"
+	
+	switch DockerBuilder {
+	case BuilderBuildKit:
+		args = []string{"build",
+			"-t", imageName,
+			"-t", latest,
+			"--build-arg", "BUILDKIT_INLINE_CACHE=1",
+			"--cache-from", latest}
+	case BuilderBuildx:
+		args = []string{"buildx", "build",
+			"--load",
+			"-t", imageName,
+			"-t", latest,
+			"--cache-to", "type=inline",
+			"--cache-from", latest}
+	default:
+		args = []string{"build", "-t", imageName, "-t", latest}
+	}
+	args = append(append(args, extraArgs...), ".")
+	
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	if DockerBuilder == BuilderBuildKit {
+		cmd.Env = append(os.Environ(), "DOCKER_BUILDKIT=1")
+	}
+	
+	cmd.Dir = contextDir
+	return cmd
+}
+
+// describeBuildError turns a failed BuildKit/buildx build into an actionable error
+func describeBuildError(err error, stderr string) error {
+	if DockerBuilder == BuilderLegacy {
+		return fmt.Errorf("failed to build Docker image: %v", err)
+	}
+	
+	switch {
+	case strings.Contains(stderr, "is not a docker command") || strings.Contains(stderr, "unknown command"):
+		return fmt.Errorf("docker buildx is not available on this host, set DOCKER_BUILDER=%s or %s: %v",
+			BuilderBuildKit, BuilderLegacy, err)
+	case strings.Contains(stderr, "BuildKit is enabled but the buildx component is missing"):
+		return fmt.Errorf("BuildKit requires the buildx plugin on this host, set DOCKER_BUILDER=%s: %v",
+			BuilderLegacy, err)
+	}
+	
+	// BuildKit reports the failing step on the last error lines
+	lines := strings.Split(strings.TrimSpace(stderr), "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.HasPrefix(strings.TrimSpace(lines[i]), "ERROR") {
+			return fmt.Errorf("failed to build Docker image with %s: %s", DockerBuilder, strings.TrimSpace(lines[i]))
+		}
+	}
+	
+	return fmt.Errorf("failed to build Docker image with %s: %v", DockerBuilder, err)
+}
@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// Default amount of build output kept in memory per stream, in KB
+const defaultBuildLogMaxKB = 64
+
+// BuildLogMaxBytes is the maximum build output kept in memory per stream.
+// It can be configured with the BUILD_LOG_MAX_KB environment variable.
+var BuildLogMaxBytes = defaultBuildLogMaxKB * 1024
+
+func init() {
+	if value := os.Getenv("BUILD_LOG_MAX_KB"); value != "" {
+		kb, err := strconv.Atoi(value)
+		if err != nil || kb <= 0 {
+			log.Printf("Invalid BUILD_LOG_MAX_KB %q, using default %d", value, defaultBuildLogMaxKB)
+			return
+		}
+		BuildLogMaxBytes = kb * 1024
+	}
+}
+
+// BuildLogBuffer is an io.Writer that keeps only the last N bytes written to it.
+// It is used to capture build output so a verbose build can't exhaust memory.
+type BuildLogBuffer struct {
+	mu        sync.Mutex
+	data      []byte
+	start     int   // Position of the oldest byte once the buffer is full
+	full      bool  // Whether the buffer has wrapped
+	truncated int64 // Number of bytes dropped from the head of the output
+}
+
+// NewBuildLogBuffer creates a buffer that keeps the last BuildLogMaxBytes of output
+func NewBuildLogBuffer() *BuildLogBuffer {
+	return &BuildLogBuffer{data: make([]byte, 0, BuildLogMaxBytes)}
+}
+
+// Write appends p to the buffer, discarding the oldest output when it is full
+func (b *BuildLogBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	size := cap(b.data)
+
+	// Only the tail of an oversized write can be kept
+	if len(p) >= size {
+		b.truncated += int64(len(b.data) + len(p) - size)
+		b.data = append(b.data[:0], p[len(p)-size:]...)
+		b.start = 0
+		b.full = true
+		return n, nil
+	}
+
+	// Fill the buffer until it reaches capacity
+	if !b.full {
+		free := size - len(b.data)
+		if len(p) <= free {
+			b.data = append(b.data, p...)
+			b.full = len(b.data) == size
+			return n, nil
+		}
+		b.data = append(b.data, p[:free]...)
+		p = p[free:]
+		b.full = true
+	}
+
+	// Overwrite the oldest bytes
+	b.truncated += int64(len(p))
+	for len(p) > 0 {
+		copied := copy(b.data[b.start:], p)
+		p = p[copied:]
+		b.start = (b.start + copied) % size
+	}
+
+	return n, nil
+}
+
+// String returns the retained output, oldest first
+func (b *BuildLogBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.full {
+		return string(b.data)
+	}
+
+	output := make([]byte, 0, len(b.data)+64)
+	if b.truncated > 0 {
+		output = append(output, "... ("...)
+		output = strconv.AppendInt(output, b.truncated, 10)
+		output = append(output, " bytes truncated)\n"...)
+	}
+	output = append(output, b.data[b.start:]...)
+	output = append(output, b.data[:b.start]...)
+	return string(output)
+}
@@ -2,18 +2,77 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"os/exec"
 )
 
 // ContainerState represents the state of a Docker container
 type ContainerState struct {
-	Running bool `json:"Running"`
+	Running bool             `json:"Running"`
+	Health  *ContainerHealth `json:"Health,omitempty"` // Only set when the image defines a HEALTHCHECK
+}
+
+// HealthUnhealthy is the health status docker reports for containers failing their HEALTHCHECK
+const HealthUnhealthy = "unhealthy"
+
+// ContainerHealth represents the result of a container's HEALTHCHECK
+type ContainerHealth struct {
+	Status string `json:"Status"` // starting, healthy or unhealthy
+}
+
+// ContainerNetwork represents a container's attachment to a Docker network
+type ContainerNetwork struct {
+	IPAddress  string   `json:"IPAddress"`
+	Gateway    string   `json:"Gateway"`
+	MacAddress string   `json:"MacAddress"`
+	Aliases    []string `json:"Aliases"`
+}
+
+// ContainerNetworkSettings represents the network settings of a Docker container
+type ContainerNetworkSettings struct {
+	Networks map[string]ContainerNetwork `json:"Networks"`
 }
 
 // ContainerInspect represents the Docker inspect output
 type ContainerInspect struct {
-	State ContainerState `json:"State"`
+	State           ContainerState           `json:"State"`
+	NetworkSettings ContainerNetworkSettings `json:"NetworkSettings"`
+}
+
+// InspectContainer returns the Docker inspect output of a container
+func InspectContainer(containerID string) (*ContainerInspect, error) {
+	output, err := exec.Command("docker", "inspect", containerID).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %v", containerID, err)
+	}
+
+	var containers []ContainerInspect
+	if err := json.Unmarshal(output, &containers); err != nil {
+		return nil, fmt.Errorf("failed to parse container inspect output: %v", err)
+	}
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("container %s not found", containerID)
+	}
+	return &containers[0], nil
+}
+
+// ContainerStatus reports whether a container is running and its health status, which is
+// empty when its image has no HEALTHCHECK
+func ContainerStatus(containerID string) (bool, string) {
+	if containerID == "" {
+		return false, ""
+	}
+
+	info, err := InspectContainer(containerID)
+	if err != nil {
+		log.Printf("Error inspecting container %s: %v", containerID, err)
+		return false, ""
+	}
+	if !info.State.Running || info.State.Health == nil {
+		return info.State.Running, ""
+	}
+	return true, info.State.Health.Status
 }
 
 // IsContainerRunning checks if a container is actually running
@@ -2,43 +2,78 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
+	"github.com/neeraj-menon/Nabla/project-orchestrator/proxy"
 )
 
 // NginxConfigManager defines the interface for NGINX configuration management
 type NginxConfigManager interface {
 	CreateMapping(projectName, serviceName, containerName string, port int) (string, error)
 	DeleteMapping(projectName, serviceName string) error
+	CreateStreamMapping(projectName, serviceName, containerName string, port int) (int, error)
+	SetErrorPages(projectName string, pages proxy.ErrorPages)
+	SetHealthCheck(projectName string, check proxy.HealthCheck)
+	SetSnippets(projectName string, snippets map[string]string)
 }
 
 // Global NGINX configuration manager
 var nginxManager NginxConfigManager
 
+// RequireNginx fails deployments when no NGINX manager is available instead of deploying
+// services without public routes. It can be set with the REQUIRE_NGINX environment variable.
+var RequireNginx = false
+
+func init() {
+	if value := os.Getenv("REQUIRE_NGINX"); value != "" {
+		if require, err := strconv.ParseBool(value); err == nil {
+			RequireNginx = require
+		} else {
+			log.Printf("Invalid REQUIRE_NGINX %q, using default %v", value, RequireNginx)
+		}
+	}
+}
+
+// Reason recorded on services deployed without an NGINX manager
+const nginxUnavailableReason = "NGINX manager not available, the service was not given a public route"
+
 // SetNginxManager sets the NGINX configuration manager
 func SetNginxManager(manager NginxConfigManager) {
 	nginxManager = manager
 }
 
-// DeployHandler handles the deployment of a built project
-func DeployHandler(project *models.Project) error {
+// DeployHandler handles the deployment of a built project. The commands it runs are
+// killed when ctx is cancelled.
+func DeployHandler(ctx context.Context, project *models.Project) error {
 	log.Printf("Deploying project %s", project.Name)
 	
 	// Update project status
 	project.Status = "deploying"
 	project.UpdatedAt = time.Now()
 	
+	// Fail before deploying anything when services couldn't be reached
+	if nginxManager == nil && RequireNginx {
+		log.Printf("Error deploying project %s: NGINX manager not available", project.Name)
+		project.Status = "failed"
+		return newDeployError(InfraError, "NGINX manager not available, services can't be given public routes")
+	}
+	
 	// Create a Docker network for the project
 	networkName := fmt.Sprintf("project-%s-network", project.Name)
-	if err := createDockerNetwork(networkName); err != nil {
+	if err := createDockerNetwork(ctx, networkName, project.Name); err != nil {
 		log.Printf("Error creating Docker network: %v", err)
 		project.Status = "failed"
 		return err
@@ -52,30 +87,78 @@ func DeployHandler(project *models.Project) error {
 		}
 	}
 	
+	// Check the services' resources against the project quota
+	allocations, usage, err := allocateResources(project.Manifest)
+	if err != nil {
+		log.Printf("Error allocating resources for project %s: %v", project.Name, err)
+		project.Status = "failed"
+		return &DeployError{Kind: UserError, Err: err}
+	}
+	project.Resources = usage
+	
+	// Reject unsafe NGINX snippets before any service is deployed
+	for name, service := range project.Manifest.Services {
+		if service.NginxSnippet == "" {
+			continue
+		}
+		if err := models.ValidateNginxSnippet(service.NginxSnippet); err != nil {
+			project.Status = "failed"
+			return &DeployError{Kind: UserError, Service: name, Err: err}
+		}
+	}
+	
+	// Serve the project's custom error pages from its frontend
+	if nginxManager != nil {
+		nginxManager.SetErrorPages(project.Name, ErrorPagesFor(project))
+		nginxManager.SetHealthCheck(project.Name, HealthCheckFor(project))
+		nginxManager.SetSnippets(project.Name, NginxSnippetsFor(project))
+	}
+	
 	// Deploy each service
-	for name, serviceStatus := range project.Services {
+	for _, name := range deployOrder(project) {
+		serviceStatus := project.Services[name]
 		service := project.Manifest.Services[name]
+		if allocation, ok := allocations[name]; ok {
+			service.Resources = &allocation
+		}
 		
 		log.Printf("Deploying service %s of type %s", name, service.Type)
 		
+		// Tag the image so earlier images stay available for rollbacks, services running a
+		// pre-built image run it as is
+		if service.Image != "" {
+			serviceStatus.Image = service.Image
+		} else {
+			tag, err := imageTag(project, service)
+			if err != nil {
+				log.Printf("Error tagging image of service %s: %v", name, err)
+				serviceStatus.Status = "failed"
+				project.Services[name] = serviceStatus
+				project.Status = "failed"
+				return &DeployError{Kind: InfraError, Service: name, Err: err}
+			}
+			serviceStatus.Image = fmt.Sprintf("%s:%s", imageRepository(project.Name, name), tag)
+		}
+		
 		// Update service status
 		serviceStatus.Status = "deploying"
 		project.Services[name] = serviceStatus
 		
-		var err error
 		var containerId string
 		var port int
 		
 		// Deploy based on service type
 		switch service.Type {
 		case "static":
-			containerId, port, err = deployStaticService(project, name, service, networkName)
+			containerId, port, err = deployStaticService(ctx, project, name, service, networkName)
 		case "api":
-			containerId, port, err = deployApiService(project, name, service, networkName)
+			containerId, port, err = deployApiService(ctx, project, name, service, networkName)
 		case "worker":
-			containerId, port, err = deployWorkerService(project, name, service, networkName)
+			containerId, port, err = deployWorkerService(ctx, project, name, service, networkName)
+		case "tcp":
+			containerId, port, err = deployTcpService(ctx, project, name, service, networkName)
 		default:
-			err = fmt.Errorf("unsupported service type: %s", service.Type)
+			err = newDeployError(UserError, "unsupported service type: %s", service.Type)
 		}
 		
 		if err != nil {
@@ -83,7 +166,51 @@ func DeployHandler(project *models.Project) error {
 			serviceStatus.Status = "failed"
 			project.Services[name] = serviceStatus
 			project.Status = "failed"
-			return err
+			return withService(err, name)
+		}
+		
+		// Hold back slow-starting services until their startup probe or health path
+		// succeeds, so they are neither marked running nor routed before they can serve requests
+		if service.ReadinessProbe() != nil {
+			containerName := fmt.Sprintf("project-%s-%s", project.Name, name)
+			if err := waitForStartup(ctx, project, name, service, containerName, port, networkName); err != nil {
+				log.Printf("Error waiting for service %s to start: %v", name, err)
+				serviceStatus.Status = "failed"
+				serviceStatus.ContainerID = containerId
+				project.Services[name] = serviceStatus
+				project.Status = "failed"
+				return withService(err, name)
+			}
+		}
+		
+		// Run the service's other processes next to its container
+		if service.Type != "static" {
+			processes, err := deployServiceProcesses(ctx, project, name, service, networkName)
+			serviceStatus.Processes = processes
+			if err != nil {
+				log.Printf("Error deploying processes of service %s: %v", name, err)
+				serviceStatus.Status = "failed"
+				serviceStatus.ContainerID = containerId
+				project.Services[name] = serviceStatus
+				project.Status = "failed"
+				return withService(err, name)
+			}
+		}
+		
+		// Run the post-deploy hook, e.g. seeding, once the service is up
+		if hookCommand(service, HookPostDeploy) != "" {
+			env, err := serviceEnv(project, service)
+			if err == nil {
+				err = runDeployHook(ctx, project, name, service, HookPostDeploy, networkName, env)
+			}
+			if err != nil {
+				log.Printf("Error running post-deploy hook of service %s: %v", name, err)
+				serviceStatus.Status = "failed"
+				serviceStatus.ContainerID = containerId
+				project.Services[name] = serviceStatus
+				project.Status = "failed"
+				return withService(err, name)
+			}
 		}
 		
 		// Update service status
@@ -97,31 +224,58 @@ func DeployHandler(project *models.Project) error {
 			serviceStatus.URL = fmt.Sprintf("http://%s", containerName)
 		} else if service.Type == "api" {
 			serviceStatus.URL = fmt.Sprintf("http://%s%s", containerName, service.Route)
+		} else if service.Type == "tcp" {
+			serviceStatus.URL = fmt.Sprintf("tcp://%s:%d", containerName, port)
 		}
 		
-		// Create NGINX mapping for the service if NGINX manager is available
-		if nginxManager != nil {
-			containerName := fmt.Sprintf("project-%s-%s", project.Name, name)
-			// For API services, use the container port (typically 5000)
-			containerPort := 80
-			if service.Type == "api" {
-				if service.Port != 0 {
-					containerPort = service.Port
+		// TCP services are exposed through an NGINX stream proxy instead of an HTTP mapping
+		if service.Type == "tcp" {
+			if nginxManager != nil {
+				publicPort, err := nginxManager.CreateStreamMapping(project.Name, name, containerName, port)
+				if err != nil {
+					log.Printf("Warning: failed to create NGINX stream mapping for service %s: %v", name, err)
+					serviceStatus.Routing = models.RoutingFailed
+					serviceStatus.RoutingReason = fmt.Sprintf("failed to create NGINX stream mapping: %v", err)
 				} else {
-					containerPort = 5000
+					serviceStatus.TCPEndpoint = fmt.Sprintf("%s:%d", proxy.GenerateProjectDomain(project.Name), publicPort)
+					serviceStatus.Routing = models.RoutingRouted
+					log.Printf("Created TCP endpoint for service %s: %s", name, serviceStatus.TCPEndpoint)
 				}
+			} else {
+				log.Printf("NGINX manager not available, skipping TCP endpoint creation for service %s", name)
+				serviceStatus.Routing = models.RoutingSkipped
+				serviceStatus.RoutingReason = nginxUnavailableReason
 			}
-			subdomain, err := nginxManager.CreateMapping(project.Name, name, containerName, containerPort)
-			if err != nil {
+		} else if nginxManager != nil {
+			containerName := fmt.Sprintf("project-%s-%s", project.Name, name)
+			// Route to the port the service was deployed with
+			subdomain, err := nginxManager.CreateMapping(project.Name, name, containerName, port)
+			var snippetErr *proxy.SnippetError
+			if errors.As(err, &snippetErr) {
+				// The service runs but its snippet was rejected by nginx -t
+				log.Printf("Error creating NGINX mapping for service %s: %v", name, err)
+				serviceStatus.Status = "failed"
+				serviceStatus.Routing = models.RoutingFailed
+				serviceStatus.RoutingReason = err.Error()
+				serviceStatus.ContainerID = containerId
+				project.Services[name] = serviceStatus
+				project.Status = "failed"
+				return &DeployError{Kind: UserError, Service: name, Err: err}
+			} else if err != nil {
 				log.Printf("Warning: failed to create NGINX mapping for service %s: %v", name, err)
+				serviceStatus.Routing = models.RoutingFailed
+				serviceStatus.RoutingReason = fmt.Sprintf("failed to create NGINX mapping: %v", err)
 			} else {
 				// Set public URL and subdomain
 				serviceStatus.Subdomain = subdomain
 				serviceStatus.PublicURL = fmt.Sprintf("http://%s", subdomain)
+				serviceStatus.Routing = models.RoutingRouted
 				log.Printf("Created public URL for service %s: %s", name, serviceStatus.PublicURL)
 			}
 		} else {
 			log.Printf("NGINX manager not available, skipping public URL creation for service %s", name)
+			serviceStatus.Routing = models.RoutingSkipped
+			serviceStatus.RoutingReason = nginxUnavailableReason
 		}
 		
 		project.Services[name] = serviceStatus
@@ -136,27 +290,128 @@ func DeployHandler(project *models.Project) error {
 		log.Printf("Warning: failed to save project status: %v", err)
 	}
 	
+	// Remove the init volumes no service mounts anymore, now that the containers using them were replaced
+	removeStaleInitVolumes(ctx, project)
+	
+	// Keep the newest images of each service for rollbacks and remove older and dangling ones
+	for name := range project.Services {
+		pruneServiceImages(project, name)
+		pruneDanglingImages(project.Name, name)
+	}
+	
 	return nil
 }
 
+// Services are deployed by type so the ones others depend on, such as databases exposed
+// as tcp services, are up before the hooks and containers of the services using them
+var deployPriority = map[string]int{
+	"tcp":    0,
+	"worker": 1,
+	"api":    2,
+	"static": 3,
+}
+
+// deployOrder returns the names of a project's services in the order they are deployed
+func deployOrder(project *models.Project) []string {
+	names := make([]string, 0, len(project.Services))
+	for name := range project.Services {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		pi := deployPriority[project.Manifest.Services[names[i]].Type]
+		pj := deployPriority[project.Manifest.Services[names[j]].Type]
+		if pi != pj {
+			return pi < pj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+// HealthCheckFor returns the proxy health checks configured in a project's manifest,
+// using the defaults for unset or invalid thresholds
+func HealthCheckFor(project *models.Project) proxy.HealthCheck {
+	check := proxy.DefaultHealthCheck
+	if project.Manifest == nil || project.Manifest.HealthCheck == nil {
+		return check
+	}
+	
+	if maxFails := project.Manifest.HealthCheck.MaxFails; maxFails != nil && *maxFails >= 0 {
+		check.MaxFails = *maxFails
+	}
+	failTimeout, err := project.Manifest.HealthCheck.FailTimeoutSeconds()
+	if err != nil {
+		log.Printf("Warning: ignoring invalid health check of project %s: %v", project.Name, err)
+	} else if failTimeout > 0 {
+		check.FailTimeout = failTimeout
+	}
+	return check
+}
+
+// NginxSnippetsFor returns the NGINX snippets declared by a project's services, skipping invalid ones
+func NginxSnippetsFor(project *models.Project) map[string]string {
+	snippets := make(map[string]string)
+	if project.Manifest == nil {
+		return snippets
+	}
+	
+	for name, service := range project.Manifest.Services {
+		if service.NginxSnippet == "" || service.Type == "tcp" {
+			continue
+		}
+		if err := models.ValidateNginxSnippet(service.NginxSnippet); err != nil {
+			log.Printf("Warning: ignoring nginx_snippet of service %s in project %s: %v", name, project.Name, err)
+			continue
+		}
+		snippets[name] = service.NginxSnippet
+	}
+	return snippets
+}
+
+// ErrorPagesFor returns the custom error pages declared in a project's manifest, skipping invalid paths
+func ErrorPagesFor(project *models.Project) proxy.ErrorPages {
+	var pages proxy.ErrorPages
+	if project.Manifest == nil || project.Manifest.ErrorPages == nil {
+		return pages
+	}
+	
+	if path := project.Manifest.ErrorPages.NotFound; path != "" {
+		if models.ValidErrorPagePath(path) {
+			pages.NotFound = path
+		} else {
+			log.Printf("Warning: ignoring invalid 404 page path %q for project %s", path, project.Name)
+		}
+	}
+	if path := project.Manifest.ErrorPages.ServerError; path != "" {
+		if models.ValidErrorPagePath(path) {
+			pages.ServerError = path
+		} else {
+			log.Printf("Warning: ignoring invalid 50x page path %q for project %s", path, project.Name)
+		}
+	}
+	return pages
+}
+
 // createDockerNetwork creates a Docker network for the project
-func createDockerNetwork(networkName string) error {
+func createDockerNetwork(ctx context.Context, networkName string, projectName string) error {
 	// Check if network already exists
-	cmd := exec.Command("docker", "network", "inspect", networkName)
-	if err := cmd.Run(); err == nil {
+	cmd := exec.CommandContext(ctx, "docker", "network", "inspect", networkName)
+	if err := runCommand(ctx, cmd); err == nil {
 		// Network already exists
 		log.Printf("Network %s already exists", networkName)
 		return nil
+	} else if kind := ErrorKindOf(err); kind == Timeout || kind == Cancelled {
+		return err
 	}
 	
-	// Create the network
-	cmd = exec.Command("docker", "network", "create", networkName)
+	// Create the network, labelled so it can be told apart from networks of other tools
+	cmd = exec.CommandContext(ctx, "docker", "network", "create", "--label", fmt.Sprintf("platform.project=%s", projectName), networkName)
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create network: %v, stderr: %s", err, stderr.String())
+	if err := runCommand(ctx, cmd); err != nil {
+		return classifyCommandError(fmt.Errorf("failed to create network: %w, stderr: %s", err, stderr.String()), stderr.String(), InfraError)
 	}
 	
 	log.Printf("Created Docker network: %s", networkName)
@@ -164,14 +419,11 @@ func createDockerNetwork(networkName string) error {
 }
 
 // deployStaticService deploys a static frontend service
-func deployStaticService(project *models.Project, name string, service models.Service, networkName string) (string, int, error) {
-	// Get absolute path to service directory
-	servicePath := filepath.Join(project.Path, service.Path)
-	
+func deployStaticService(ctx context.Context, project *models.Project, name string, service models.Service, networkName string) (string, int, error) {
 	// Build the Docker image
-	imageName := fmt.Sprintf("project-%s-%s", project.Name, name)
-	if err := buildDockerImage(servicePath, imageName); err != nil {
-		return "", 0, fmt.Errorf("failed to build Docker image: %v", err)
+	imageName := serviceImage(project, name)
+	if err := buildServiceImage(ctx, project, name, service, imageName); err != nil {
+		return "", 0, fmt.Errorf("failed to build Docker image: %w", err)
 	}
 	
 	// Container port for static services is typically 80
@@ -180,6 +432,7 @@ func deployStaticService(project *models.Project, name string, service models.Se
 	// Run the Docker container with labels for internal routing
 	containerName := fmt.Sprintf("project-%s-%s", project.Name, name)
 	containerId, err := runDockerContainerWithLabels(
+		ctx,
 		imageName, 
 		containerName, 
 		project.Name, 
@@ -187,50 +440,48 @@ func deployStaticService(project *models.Project, name string, service models.Se
 		"static", 
 		containerPort, 
 		networkName, 
+		nil, 
+		service.Resources,
+		nil,
+		service.StopSignal,
+		serviceMetadata(project, service),
 		nil,
 	)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to run Docker container: %v", err)
+		return "", 0, fmt.Errorf("failed to run Docker container: %w", err)
 	}
 
 	return containerId, containerPort, nil
 }
 
 // deployApiService deploys an API backend service
-func deployApiService(project *models.Project, name string, service models.Service, networkName string) (string, int, error) {
-	// Get absolute path to service directory
-	servicePath := filepath.Join(project.Path, service.Path)
-	
+func deployApiService(ctx context.Context, project *models.Project, name string, service models.Service, networkName string) (string, int, error) {
 	// Build the Docker image
-	imageName := fmt.Sprintf("project-%s-%s", project.Name, name)
-	if err := buildDockerImage(servicePath, imageName); err != nil {
-		return "", 0, fmt.Errorf("failed to build Docker image: %v", err)
+	imageName := serviceImage(project, name)
+	if err := buildServiceImage(ctx, project, name, service, imageName); err != nil {
+		return "", 0, fmt.Errorf("failed to build Docker image: %w", err)
 	}
 	
 	// Prepare environment variables
-	env := make(map[string]string)
+	env, err := serviceEnv(project, service)
+	if err != nil {
+		return "", 0, err
+	}
 	
-	// Add service-specific environment variables
-	for k, v := range service.Env {
-		env[k] = v
+	// Run the web process instead of the default command if the service declares one
+	webCommand, err := webProcessCommand(project, service)
+	if err != nil {
+		return "", 0, err
 	}
 	
-	// Add project-wide environment variables
-	for k, v := range project.Manifest.Environment {
-		// Service-specific env vars take precedence
-		if _, exists := env[k]; !exists {
-			env[k] = v
-		}
+	// Run the pre-deploy hook, e.g. database migrations, before the service starts
+	if err := runDeployHook(ctx, project, name, service, HookPreDeploy, networkName, env); err != nil {
+		return "", 0, err
 	}
 	
-	// Add database connection info if applicable
-	if project.Manifest.Database != nil {
-		if project.Manifest.Database.Type == "sqlite" {
-			dbPath := project.Manifest.Database.Path
-			if dbPath != "" {
-				env["DATABASE_URL"] = fmt.Sprintf("sqlite:///app/%s", dbPath)
-			}
-		}
+	// Run the init container, which must succeed before the service container starts
+	if err := runInitContainer(ctx, project, name, service, networkName, env); err != nil {
+		return "", 0, err
 	}
 	
 	// Determine container port
@@ -242,6 +493,7 @@ func deployApiService(project *models.Project, name string, service models.Servi
 	// Run the Docker container with labels for internal routing
 	containerName := fmt.Sprintf("project-%s-%s", project.Name, name)
 	containerId, err := runDockerContainerWithLabels(
+		ctx,
 		imageName, 
 		containerName, 
 		project.Name, 
@@ -249,46 +501,55 @@ func deployApiService(project *models.Project, name string, service models.Servi
 		"api", 
 		containerPort, 
 		networkName, 
-		env,
+		env, 
+		service.Resources,
+		webCommand,
+		service.StopSignal,
+		serviceMetadata(project, service),
+		initVolumeArgs(project.Name, name, service),
 	)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to run Docker container: %v", err)
+		return "", 0, fmt.Errorf("failed to run Docker container: %w", err)
 	}
 	
 	return containerId, containerPort, nil
 }
 
 // deployWorkerService deploys a background worker service
-func deployWorkerService(project *models.Project, name string, service models.Service, networkName string) (string, int, error) {
+func deployWorkerService(ctx context.Context, project *models.Project, name string, service models.Service, networkName string) (string, int, error) {
 	// Worker services are similar to API services but don't need port mapping
-	// Get absolute path to service directory
-	servicePath := filepath.Join(project.Path, service.Path)
-	
 	// Build the Docker image
-	imageName := fmt.Sprintf("project-%s-%s", project.Name, name)
-	if err := buildDockerImage(servicePath, imageName); err != nil {
-		return "", 0, fmt.Errorf("failed to build Docker image: %v", err)
+	imageName := serviceImage(project, name)
+	if err := buildServiceImage(ctx, project, name, service, imageName); err != nil {
+		return "", 0, fmt.Errorf("failed to build Docker image: %w", err)
 	}
 	
 	// Prepare environment variables
-	env := make(map[string]string)
+	env, err := serviceEnv(project, service)
+	if err != nil {
+		return "", 0, err
+	}
 	
-	// Add service-specific environment variables
-	for k, v := range service.Env {
-		env[k] = v
+	// Run the web process instead of the default command if the service declares one
+	webCommand, err := webProcessCommand(project, service)
+	if err != nil {
+		return "", 0, err
 	}
 	
-	// Add project-wide environment variables
-	for k, v := range project.Manifest.Environment {
-		// Service-specific env vars take precedence
-		if _, exists := env[k]; !exists {
-			env[k] = v
-		}
+	// Run the pre-deploy hook, e.g. database migrations, before the service starts
+	if err := runDeployHook(ctx, project, name, service, HookPreDeploy, networkName, env); err != nil {
+		return "", 0, err
+	}
+	
+	// Run the init container, which must succeed before the service container starts
+	if err := runInitContainer(ctx, project, name, service, networkName, env); err != nil {
+		return "", 0, err
 	}
 	
 	// Run the Docker container with labels for internal routing
 	containerName := fmt.Sprintf("project-%s-%s", project.Name, name)
 	containerId, err := runDockerContainerWithLabels(
+		ctx,
 		imageName, 
 		containerName, 
 		project.Name, 
@@ -296,72 +557,280 @@ func deployWorkerService(project *models.Project, name string, service models.Se
 		"worker", 
 		0, // Workers don't expose ports
 		networkName, 
-		env,
+		env, 
+		service.Resources,
+		webCommand,
+		service.StopSignal,
+		serviceMetadata(project, service),
+		initVolumeArgs(project.Name, name, service),
 	)
 	if err != nil {
-		return "", 0, fmt.Errorf("failed to run Docker container: %v", err)
+		return "", 0, fmt.Errorf("failed to run Docker container: %w", err)
 	}
 	
 	return containerId, 0, nil
 }
 
-// buildDockerImage builds a Docker image from a Dockerfile
-func buildDockerImage(contextDir string, imageName string) error {
-	log.Printf("Building Docker image %s from directory %s", imageName, contextDir)
+// deployTcpService deploys a service exposing a raw TCP protocol
+func deployTcpService(ctx context.Context, project *models.Project, name string, service models.Service, networkName string) (string, int, error) {
+	// Build the Docker image
+	imageName := serviceImage(project, name)
+	if err := buildServiceImage(ctx, project, name, service, imageName); err != nil {
+		return "", 0, fmt.Errorf("failed to build Docker image: %w", err)
+	}
+	
+	// Prepare environment variables
+	env, err := serviceEnv(project, service)
+	if err != nil {
+		return "", 0, err
+	}
+	
+	// Run the web process instead of the default command if the service declares one
+	webCommand, err := webProcessCommand(project, service)
+	if err != nil {
+		return "", 0, err
+	}
+	
+	// Run the pre-deploy hook, e.g. database migrations, before the service starts
+	if err := runDeployHook(ctx, project, name, service, HookPreDeploy, networkName, env); err != nil {
+		return "", 0, err
+	}
+	
+	// Run the init container, which must succeed before the service container starts
+	if err := runInitContainer(ctx, project, name, service, networkName, env); err != nil {
+		return "", 0, err
+	}
+	
+	// TCP services have no sensible default port
+	if service.Port == 0 {
+		return "", 0, newDeployError(UserError, "tcp service %s must specify a port", name)
+	}
+	
+	// Run the Docker container with labels for internal routing
+	containerName := fmt.Sprintf("project-%s-%s", project.Name, name)
+	containerId, err := runDockerContainerWithLabels(
+		ctx,
+		imageName, 
+		containerName, 
+		project.Name, 
+		name, 
+		"tcp", 
+		service.Port, 
+		networkName, 
+		env, 
+		service.Resources,
+		webCommand,
+		service.StopSignal,
+		serviceMetadata(project, service),
+		initVolumeArgs(project.Name, name, service),
+	)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to run Docker container: %w", err)
+	}
+	
+	return containerId, service.Port, nil
+}
+
+// serviceEnv returns the environment of a service's containers: its own variables, then
+// the project-wide ones and the project config, each without overriding the previous,
+// and the database URL for API services. Secret references are resolved.
+func serviceEnv(project *models.Project, service models.Service) (map[string]string, error) {
+	env := make(map[string]string)
+	
+	// Add service-specific environment variables
+	for k, v := range service.Env {
+		env[k] = v
+	}
+	
+	// Add project-wide environment variables
+	for k, v := range project.Manifest.Environment {
+		// Service-specific env vars take precedence
+		if _, exists := env[k]; !exists {
+			env[k] = v
+		}
+	}
+	
+	// Add the project config, explicit environment variables take precedence
+	if err := addConfigEnv(env, project.Manifest); err != nil {
+		return nil, err
+	}
+	
+	// Add the service's .env file, the manifest takes precedence
+	fileEnv, err := loadEnvFile(project, service)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range fileEnv {
+		if _, exists := env[k]; !exists {
+			env[k] = v
+		}
+	}
+	
+	// Add database connection info if applicable
+	if service.Type == "api" && project.Manifest.Database != nil {
+		if project.Manifest.Database.Type == "sqlite" {
+			dbPath := project.Manifest.Database.Path
+			if dbPath != "" {
+				env["DATABASE_URL"] = fmt.Sprintf("sqlite:///app/%s", dbPath)
+			}
+		}
+	}
+	
+	// Secrets are resolved last so they never end up in the project status
+	if err := resolveSecrets(env, project.UserID); err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// addConfigEnv adds the manifest's flattened config block to env without overriding existing variables
+func addConfigEnv(env map[string]string, manifest *models.ProjectManifest) error {
+	if len(manifest.Config) == 0 {
+		return nil
+	}
+	
+	configEnv, err := models.FlattenConfig(manifest.Config)
+	if err != nil {
+		return newDeployError(UserError, "invalid project config: %v", err)
+	}
+	for k, v := range configEnv {
+		if _, exists := env[k]; !exists {
+			env[k] = v
+		}
+	}
+	return nil
+}
+
+// serviceMetadata returns the metadata a service container is labelled with
+func serviceMetadata(project *models.Project, service models.Service) map[string]string {
+	version := project.Version
+	if version == "" {
+		version = project.Manifest.Version
+	}
+	description := service.Description
+	if description == "" {
+		description = project.Manifest.Description
+	}
+	return map[string]string{
+		"description": description,
+		"owner":       project.Username,
+		"version":     version,
+	}
+}
+
+// buildServiceImage builds the image of a service from its directory, unless the service
+// runs a pre-built image pulled by BuildHandler
+func buildServiceImage(ctx context.Context, project *models.Project, name string, service models.Service, imageName string) error {
+	if service.Image != "" {
+		return nil
+	}
+	return buildDockerImage(ctx, project, name, service.BuildContextDir(project.Path), service.Dockerfile, imageName)
+}
+
+// buildDockerImage builds a Docker image for a project's service from a Dockerfile. dockerfile
+// is relative to contextDir, the default Dockerfile is used when it is empty.
+func buildDockerImage(ctx context.Context, project *models.Project, serviceName string, contextDir string, dockerfile string, imageName string) error {
+	log.Printf("Building Docker image %s from directory %s using the %s builder", imageName, contextDir, DockerBuilder)
+	
+	// Pass the package registries and their credentials to the build
+	registryArgs, cleanup, err := ResolvePackageRegistries(project.Manifest).buildArgs()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	
+	// Label the image so the images it leaves dangling when replaced can be pruned
+	extraArgs := append(registryArgs,
+		"--label", fmt.Sprintf("platform.project=%s", project.Name),
+		"--label", fmt.Sprintf("platform.service=%s", serviceName))
+	
+	// Pass the service's build-time variables, declared as ARGs by the generated Dockerfiles
+	service := project.Manifest.Services[serviceName]
+	for _, key := range sortedKeys(service.BuildEnv) {
+		extraArgs = append(extraArgs, "--build-arg", fmt.Sprintf("%s=%s", key, service.BuildEnv[key]))
+	}
+	
+	// Build from the service's own Dockerfile if it has one
+	if dockerfile != "" {
+		extraArgs = append(extraArgs, "-f", dockerfile)
+	}
 	
 	// Build the Docker image
-	cmd := exec.Command("docker", "build", "-t", imageName, ".")
-	cmd.Dir = contextDir
+	cmd := dockerBuildCommand(ctx, contextDir, imageName, extraArgs)
 	
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	// Only the tail of the build output is kept
+	stdout, stderr := NewBuildLogBuffer(), NewBuildLogBuffer()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
 	
-	if err := cmd.Run(); err != nil {
+	if err := runCommand(ctx, cmd); err != nil {
 		log.Printf("Docker build output: %s", stdout.String())
 		log.Printf("Docker build error: %s", stderr.String())
-		return fmt.Errorf("failed to build Docker image: %v", err)
+		if kind := ErrorKindOf(err); kind == Timeout || kind == Cancelled {
+			return err
+		}
+		return classifyCommandError(describeBuildError(err, stderr.String()), stderr.String(), UserError)
 	}
 	
 	log.Printf("Built Docker image: %s", imageName)
 	return nil
 }
 
+// stopSignalArgs returns the docker run flags setting a container's stop signal, none for
+// docker's default SIGTERM
+func stopSignalArgs(stopSignal string) []string {
+	if stopSignal == "" {
+		return nil
+	}
+	return []string{"--stop-signal", stopSignal}
+}
+
+// containerNameFilter returns the docker ps filter matching exactly the container named
+// containerName. Docker matches the filter as a regular expression against names with a
+// leading slash.
+func containerNameFilter(containerName string) string {
+	return fmt.Sprintf("name=^/%s$", regexp.QuoteMeta(containerName))
+}
+
 // cleanupContainer checks if a container exists and removes it if it does
-func cleanupContainer(containerName string) error {
+func cleanupContainer(ctx context.Context, containerName string) error {
 	log.Printf("Checking if container %s already exists", containerName)
 	
-	// Check if the container exists
-	cmd := exec.Command("docker", "ps", "-a", "--filter", fmt.Sprintf("name=%s", containerName), "--format", "{{.ID}}")
+	// Check if the container exists. The name filter matches substrings, so it is anchored
+	// to keep the process containers of a service (project-<p>-<svc>.<proc>) from matching.
+	cmd := exec.CommandContext(ctx, "docker", "ps", "-a", "--filter", containerNameFilter(containerName), "--format", "{{.ID}}")
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	
-	if err := cmd.Run(); err != nil {
+	if err := runCommand(ctx, cmd); err != nil {
 		log.Printf("Error checking if container exists: %v", err)
+		if kind := ErrorKindOf(err); kind == Timeout || kind == Cancelled {
+			return err
+		}
 		return nil // Continue anyway
 	}
 	
-	containerId := strings.TrimSpace(stdout.String())
-	if containerId == "" {
+	containerIds := strings.Fields(stdout.String())
+	if len(containerIds) == 0 {
 		// Container doesn't exist
 		return nil
 	}
-	
-	log.Printf("Container %s already exists with ID %s, stopping and removing", containerName, containerId)
-	
+
+	log.Printf("Container %s already exists with ID %s, stopping and removing", containerName, strings.Join(containerIds, ", "))
+
 	// Stop the container
-	stopCmd := exec.Command("docker", "stop", containerId)
-	if err := stopCmd.Run(); err != nil {
+	stopCmd := exec.CommandContext(ctx, "docker", append([]string{"stop"}, containerIds...)...)
+	if err := runCommand(ctx, stopCmd); err != nil {
 		log.Printf("Warning: Error stopping container %s: %v", containerName, err)
 		// Continue anyway
 	}
-	
+
 	// Remove the container
-	removeCmd := exec.Command("docker", "rm", containerId)
-	if err := removeCmd.Run(); err != nil {
+	removeCmd := exec.CommandContext(ctx, "docker", append([]string{"rm"}, containerIds...)...)
+	if err := runCommand(ctx, removeCmd); err != nil {
 		log.Printf("Warning: Error removing container %s: %v", containerName, err)
-		return fmt.Errorf("failed to remove existing container: %v", err)
+		return classifyCommandError(fmt.Errorf("failed to remove existing container: %w", err), "", InfraError)
 	}
 	
 	log.Printf("Successfully removed existing container %s", containerName)
@@ -370,11 +839,11 @@ func cleanupContainer(containerName string) error {
 
 // runDockerContainer runs a Docker container with port mapping
 // This is kept for backward compatibility
-func runDockerContainer(imageName string, containerName string, hostPort int, containerPort int, networkName string, env map[string]string) (string, error) {
+func runDockerContainer(ctx context.Context, imageName string, containerName string, hostPort int, containerPort int, networkName string, env map[string]string, resources *models.Resources) (string, error) {
 	log.Printf("Running Docker container %s from image %s with port mapping %d:%d", containerName, imageName, hostPort, containerPort)
 	
 	// Clean up any existing container with the same name
-	if err := cleanupContainer(containerName); err != nil {
+	if err := cleanupContainer(ctx, containerName); err != nil {
 		return "", err
 	}
 	
@@ -395,20 +864,23 @@ func runDockerContainer(imageName string, containerName string, hostPort int, co
 		args = append(args, "-e", fmt.Sprintf("%s=%s", k, v))
 	}
 	
+	// Limit the container to its share of the project quota
+	args = append(args, resourceArgs(resources)...)
+	
 	// Add the image name
 	args = append(args, imageName)
 	
 	// Run the container
-	cmd := exec.Command("docker", args...)
+	cmd := exec.CommandContext(ctx, "docker", args...)
 	
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	
-	if err := cmd.Run(); err != nil {
+	if err := runCommand(ctx, cmd); err != nil {
 		log.Printf("Docker run output: %s", stdout.String())
 		log.Printf("Docker run error: %s", stderr.String())
-		return "", fmt.Errorf("failed to run Docker container: %v", err)
+		return "", classifyCommandError(fmt.Errorf("failed to run Docker container: %w", err), stderr.String(), InfraError)
 	}
 	
 	// Get the container ID
@@ -419,12 +891,13 @@ func runDockerContainer(imageName string, containerName string, hostPort int, co
 }
 
 // runDockerContainerWithLabels runs a Docker container without host port binding
-// but with service discovery labels for internal routing
-func runDockerContainerWithLabels(imageName string, containerName string, projectName string, serviceName string, serviceType string, containerPort int, networkName string, env map[string]string) (string, error) {
+// but with service discovery labels for internal routing. A non-empty command
+// overrides the image's default command.
+func runDockerContainerWithLabels(ctx context.Context, imageName string, containerName string, projectName string, serviceName string, serviceType string, containerPort int, networkName string, env map[string]string, resources *models.Resources, command []string, stopSignal string, metadata map[string]string, volumes []string) (string, error) {
 	log.Printf("Running Docker container %s from image %s with internal routing", containerName, imageName)
 	
 	// Clean up any existing container with the same name
-	if err := cleanupContainer(containerName); err != nil {
+	if err := cleanupContainer(ctx, containerName); err != nil {
 		return "", err
 	}
 	
@@ -445,25 +918,44 @@ func runDockerContainerWithLabels(imageName string, containerName string, projec
 		"--label", fmt.Sprintf("platform.port=%d", containerPort),
 	)
 	
+	// Add the user metadata shown in listings, kept apart from the platform labels
+	for name, value := range metadata {
+		if value != "" {
+			args = append(args, "--label", fmt.Sprintf("meta.%s=%s", name, value))
+		}
+	}
+	
 	// Add environment variables
 	for k, v := range env {
 		args = append(args, "-e", fmt.Sprintf("%s=%s", k, v))
 	}
 	
+	// Limit the container to its share of the project quota
+	args = append(args, resourceArgs(resources)...)
+	
+	// Stop the container with the signal the service shuts down gracefully on
+	args = append(args, stopSignalArgs(stopSignal)...)
+	
+	// Mount the volumes the service's init container prepared
+	args = append(args, volumes...)
+	
 	// Add the image name
 	args = append(args, imageName)
 	
+	// Run a process other than the image's default command
+	args = append(args, command...)
+	
 	// Run the container
-	cmd := exec.Command("docker", args...)
+	cmd := exec.CommandContext(ctx, "docker", args...)
 	
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	
-	if err := cmd.Run(); err != nil {
+	if err := runCommand(ctx, cmd); err != nil {
 		log.Printf("Docker run output: %s", stdout.String())
 		log.Printf("Docker run error: %s", stderr.String())
-		return "", fmt.Errorf("failed to run Docker container: %v", err)
+		return "", classifyCommandError(fmt.Errorf("failed to run Docker container: %w", err), stderr.String(), InfraError)
 	}
 	
 	// Get the container ID
@@ -474,11 +966,11 @@ func runDockerContainerWithLabels(imageName string, containerName string, projec
 }
 
 // runDockerContainerWithoutPort runs a Docker container without port mapping (for workers)
-func runDockerContainerWithoutPort(imageName string, containerName string, networkName string, env map[string]string) (string, error) {
+func runDockerContainerWithoutPort(ctx context.Context, imageName string, containerName string, networkName string, env map[string]string) (string, error) {
 	log.Printf("Running Docker container %s from image %s (no port mapping)", containerName, imageName)
 	
 	// Clean up any existing container with the same name
-	if err := cleanupContainer(containerName); err != nil {
+	if err := cleanupContainer(ctx, containerName); err != nil {
 		return "", err
 	}
 	
@@ -500,16 +992,16 @@ func runDockerContainerWithoutPort(imageName string, containerName string, netwo
 	args = append(args, imageName)
 	
 	// Run the container
-	cmd := exec.Command("docker", args...)
+	cmd := exec.CommandContext(ctx, "docker", args...)
 	
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 	
-	if err := cmd.Run(); err != nil {
+	if err := runCommand(ctx, cmd); err != nil {
 		log.Printf("Docker run output: %s", stdout.String())
 		log.Printf("Docker run error: %s", stderr.String())
-		return "", fmt.Errorf("failed to run Docker container: %v", err)
+		return "", classifyCommandError(fmt.Errorf("failed to run Docker container: %w", err), stderr.String(), InfraError)
 	}
 	
 	// Get the container ID
@@ -538,7 +1030,7 @@ func saveProjectStatus(project *models.Project) error {
 	}
 	
 	// Write the status file
-	if err := os.WriteFile(statusFile, data, 0644); err != nil {
+	if err := WriteStatusFile(statusFile, data); err != nil {
 		return fmt.Errorf("failed to write status file: %v", err)
 	}
 	
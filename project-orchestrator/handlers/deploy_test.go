@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// The filter used to clean up a service's container doesn't match its process containers
+func TestContainerNameFilter(t *testing.T) {
+	filter := containerNameFilter("project-shop-web")
+	pattern := regexp.MustCompile(strings.TrimPrefix(filter, "name="))
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"/project-shop-web", true},
+		{"/project-shop-web.worker", false},
+		{"/project-shop-web.init", false},
+		{"/project-shop-webapp", false},
+		{"/old-project-shop-web", false},
+	}
+	for _, test := range tests {
+		if got := pattern.MatchString(test.name); got != test.want {
+			t.Errorf("%s matching %s = %v, want %v", filter, test.name, got, test.want)
+		}
+	}
+
+	// Dots in names are matched literally
+	if regexp.MustCompile(strings.TrimPrefix(containerNameFilter("project-shop-web.worker"), "name=")).MatchString("/project-shop-web-worker") {
+		t.Error("the filter of project-shop-web.worker matches project-shop-web-worker")
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
+)
+
+// Name of the environment file read from a service directory
+const envFileName = ".env"
+
+// Valid environment variable names in an environment file
+var envKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+
+// loadEnvFile reads the .env file of a service, returning no variables when there is none
+func loadEnvFile(project *models.Project, service models.Service) (map[string]string, error) {
+	// Services running a pre-built image have no directory to read it from
+	if service.Image != "" {
+		return nil, nil
+	}
+	
+	data, err := os.ReadFile(filepath.Join(project.Path, service.Path, envFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, newDeployError(InfraError, "failed to read %s: %v", envFileName, err)
+	}
+
+	env, err := parseEnvFile(string(data))
+	if err != nil {
+		return nil, newDeployError(UserError, "invalid %s in service directory %s: %v", envFileName, service.Path, err)
+	}
+	return env, nil
+}
+
+// parseEnvFile parses KEY=VALUE lines. Blank lines and lines starting with # are skipped,
+// and keys may be prefixed with export. Values may be double quoted, with \n, \t, \" and \\
+// escapes, or single quoted, taken literally; unquoted values end at a # preceded by a space.
+func parseEnvFile(content string) (map[string]string, error) {
+	env := make(map[string]string)
+
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || !envKeyPattern.MatchString(key) {
+			return nil, fmt.Errorf("line %d: expected KEY=VALUE", i+1)
+		}
+
+		value, err := parseEnvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		env[key] = value
+	}
+	return env, nil
+}
+
+// parseEnvValue parses the value of a .env line
+func parseEnvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+
+	switch value[0] {
+	case '\'':
+		end := strings.IndexByte(value[1:], '\'')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated single quote")
+		}
+		if rest := strings.TrimSpace(value[end+2:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected text after quoted value")
+		}
+		return value[1 : end+1], nil
+	case '"':
+		var result strings.Builder
+		for i := 1; i < len(value); i++ {
+			switch char := value[i]; {
+			case char == '\\' && i+1 < len(value):
+				i++
+				switch value[i] {
+				case 'n':
+					result.WriteByte('\n')
+				case 't':
+					result.WriteByte('\t')
+				case 'r':
+					result.WriteByte('\r')
+				default:
+					result.WriteByte(value[i])
+				}
+			case char == '"':
+				if rest := strings.TrimSpace(value[i+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+					return "", fmt.Errorf("unexpected text after quoted value")
+				}
+				return result.String(), nil
+			default:
+				result.WriteByte(char)
+			}
+		}
+		return "", fmt.Errorf("unterminated double quote")
+	}
+
+	// Inline comments need a space before the # so values like URLs with fragments survive
+	if index := strings.Index(value, " #"); index >= 0 {
+		value = value[:index]
+	}
+	return strings.TrimSpace(value), nil
+}
+
+// excludeEnvFile adds the .env file to the service's .dockerignore so it is injected when
+// the container starts instead of being copied into the image
+func excludeEnvFile(servicePath string) error {
+	if _, err := os.Stat(filepath.Join(servicePath, envFileName)); err != nil {
+		return nil
+	}
+
+	ignorePath := filepath.Join(servicePath, ".dockerignore")
+	data, err := os.ReadFile(ignorePath)
+	if err != nil && !os.IsNotExist(err) {
+		return newDeployError(InfraError, "failed to read .dockerignore: %v", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if pattern := strings.TrimSpace(line); pattern == envFileName || pattern == "/"+envFileName {
+			return nil
+		}
+	}
+
+	content := string(data)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += envFileName + "\n"
+	if err := os.WriteFile(ignorePath, []byte(content), 0644); err != nil {
+		return newDeployError(InfraError, "failed to write .dockerignore: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrorKind classifies why a build or deployment failed
+type ErrorKind string
+
+const (
+	// UserError means the project itself is broken (bad manifest, failing build); retrying won't help
+	UserError ErrorKind = "user"
+	// InfraError means the platform failed (docker, filesystem); an operator needs to look
+	InfraError ErrorKind = "infra"
+	// Transient means the failure is likely temporary (daemon restarting, network hiccup); retry
+	Transient ErrorKind = "transient"
+	// Timeout means the build or deploy exceeded its time budget and was stopped by the watchdog
+	Timeout ErrorKind = "timeout"
+	// Cancelled means the user cancelled the build or deploy
+	Cancelled ErrorKind = "cancelled"
+)
+
+// DeployError is a classified error from the build/deploy pipeline
+type DeployError struct {
+	Kind    ErrorKind
+	Service string // Service the error relates to, if any
+	Err     error
+}
+
+func (e *DeployError) Error() string {
+	if e.Service != "" {
+		return fmt.Sprintf("service %s: %v", e.Service, e.Err)
+	}
+	return e.Err.Error()
+}
+
+func (e *DeployError) Unwrap() error {
+	return e.Err
+}
+
+// newDeployError creates a classified error with a formatted cause
+func newDeployError(kind ErrorKind, format string, args ...interface{}) error {
+	return &DeployError{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// withService attaches the service name to a classified error
+func withService(err error, service string) error {
+	var deployErr *DeployError
+	if errors.As(err, &deployErr) && deployErr.Service == "" {
+		deployErr.Service = service
+		return err
+	}
+	if deployErr == nil {
+		return &DeployError{Kind: InfraError, Service: service, Err: err}
+	}
+	return err
+}
+
+// ErrorKindOf returns the kind of a pipeline error. Unclassified errors are treated as infra errors.
+func ErrorKindOf(err error) ErrorKind {
+	var deployErr *DeployError
+	if errors.As(err, &deployErr) {
+		return deployErr.Kind
+	}
+	return InfraError
+}
+
+// StatusCode returns the HTTP status reporting a pipeline error of the given kind
+func StatusCode(kind ErrorKind) int {
+	switch kind {
+	case UserError:
+		return http.StatusUnprocessableEntity
+	case Transient:
+		return http.StatusServiceUnavailable
+	case Timeout:
+		return http.StatusGatewayTimeout
+	case Cancelled:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// IsTransient reports whether retrying the failed operation may succeed
+func IsTransient(err error) bool {
+	return err != nil && ErrorKindOf(err) == Transient
+}
+
+// Output fragments that indicate a temporary failure of docker or the network
+var transientMarkers = []string{
+	"Cannot connect to the Docker daemon",
+	"connection refused",
+	"connection reset",
+	"i/o timeout",
+	"TLS handshake timeout",
+	"toomanyrequests",
+	"temporary failure in name resolution",
+	"ETIMEDOUT",
+	"ECONNRESET",
+	"EAI_AGAIN",
+}
+
+// classifyCommandError classifies the failure of an external command from its output,
+// falling back to the given kind when the output doesn't point at a temporary problem.
+// Errors that are already classified, such as watchdog timeouts, keep their kind.
+func classifyCommandError(err error, output string, fallback ErrorKind) error {
+	var deployErr *DeployError
+	if errors.As(err, &deployErr) {
+		return err
+	}
+	
+	kind := fallback
+	for _, marker := range transientMarkers {
+		if strings.Contains(output, marker) {
+			kind = Transient
+			break
+		}
+	}
+	return &DeployError{Kind: kind, Err: err}
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		kind ErrorKind
+		want int
+	}{
+		{UserError, http.StatusUnprocessableEntity},
+		{InfraError, http.StatusInternalServerError},
+		{Transient, http.StatusServiceUnavailable},
+		{Timeout, http.StatusGatewayTimeout},
+		{Cancelled, http.StatusConflict},
+		{ErrorKind("unknown"), http.StatusInternalServerError},
+	}
+
+	for _, test := range tests {
+		if got := StatusCode(test.kind); got != test.want {
+			t.Errorf("StatusCode(%q) = %d, want %d", test.kind, got, test.want)
+		}
+	}
+}
+
+func TestErrorKindOf(t *testing.T) {
+	tests := []struct {
+		err  error
+		want ErrorKind
+	}{
+		{newDeployError(UserError, "invalid manifest"), UserError},
+		{fmt.Errorf("failed to build Docker image: %w", newDeployError(Transient, "toomanyrequests")), Transient},
+		{withService(fmt.Errorf("docker is down"), "api"), InfraError},
+		{fmt.Errorf("unclassified"), InfraError},
+	}
+
+	for _, test := range tests {
+		if got := ErrorKindOf(test.err); got != test.want {
+			t.Errorf("ErrorKindOf(%v) = %s, want %s", test.err, got, test.want)
+		}
+	}
+}
+
+func TestClassifyCommandError(t *testing.T) {
+	err := classifyCommandError(fmt.Errorf("pull failed"), "Error response from daemon: toomanyrequests", UserError)
+	if kind := ErrorKindOf(err); kind != Transient {
+		t.Errorf("kind of rate limited pull = %s, want transient", kind)
+	}
+
+	err = classifyCommandError(fmt.Errorf("npm install failed"), "npm ERR! 404 Not Found", UserError)
+	if kind := ErrorKindOf(err); kind != UserError {
+		t.Errorf("kind of failed install = %s, want user", kind)
+	}
+
+	// Watchdog errors keep their kind
+	err = classifyCommandError(fmt.Errorf("build: %w", newDeployError(Timeout, "build timed out")), "", UserError)
+	if kind := ErrorKindOf(err); kind != Timeout {
+		t.Errorf("kind of timed out build = %s, want timeout", kind)
+	}
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
+)
+
+// ExportMetadataFile is the name of the metadata file stored in a project export archive
+const ExportMetadataFile = "nabla-export.json"
+
+// ExportMetadata describes a project in an export archive
+type ExportMetadata struct {
+	FormatVersion int                     `json:"formatVersion"`
+	Name          string                  `json:"name"`
+	Status        string                  `json:"status"`
+	Manifest      *models.ProjectManifest `json:"manifest"`
+	CreatedAt     time.Time               `json:"createdAt"`
+	UpdatedAt     time.Time               `json:"updatedAt"`
+	ExportedAt    time.Time               `json:"exportedAt"`
+}
+
+// Files and directories that are regenerated on import and not worth exporting
+var exportSkipNames = map[string]bool{
+	"status.json":  true,
+	"upload.zip":   true,
+	"node_modules": true,
+	".git":         true,
+}
+
+// ExportProject writes a zip archive containing the project source and metadata
+func ExportProject(w io.Writer, project *models.Project) error {
+	if project.Path == "" {
+		return fmt.Errorf("project %s has no source directory", project.Name)
+	}
+
+	archive := zip.NewWriter(w)
+
+	// Add the project source
+	err := filepath.Walk(project.Path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(project.Path, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+
+		if exportSkipNames[info.Name()] {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Only regular files and directories are exported
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(relPath)
+		if info.IsDir() {
+			header.Name += "/"
+		} else {
+			header.Method = zip.Deflate
+		}
+
+		writer, err := archive.CreateHeader(header)
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(writer, file)
+		return err
+	})
+	if err != nil {
+		archive.Close()
+		return fmt.Errorf("failed to archive project source: %v", err)
+	}
+
+	// Add the metadata file
+	metadata := ExportMetadata{
+		FormatVersion: 1,
+		Name:          project.Name,
+		Status:        project.Status,
+		Manifest:      project.Manifest,
+		CreatedAt:     project.CreatedAt,
+		UpdatedAt:     project.UpdatedAt,
+		ExportedAt:    time.Now(),
+	}
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		archive.Close()
+		return fmt.Errorf("failed to marshal export metadata: %v", err)
+	}
+
+	writer, err := archive.Create(ExportMetadataFile)
+	if err != nil {
+		archive.Close()
+		return fmt.Errorf("failed to add export metadata: %v", err)
+	}
+	if _, err := writer.Write(data); err != nil {
+		archive.Close()
+		return fmt.Errorf("failed to write export metadata: %v", err)
+	}
+
+	return archive.Close()
+}
+
+// ImportHandler extracts a project export archive into the user's projects directory.
+// It returns the project name and directory so the caller can rebuild the project.
+func ImportHandler(w http.ResponseWriter, r *http.Request, userID string) (string, string, error) {
+	// Parse the multipart form, 32 MB max
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		log.Printf("Error parsing form: %v", err)
+		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		return "", "", fmt.Errorf("error parsing form: %v", err)
+	}
+
+	// Get the archive from the form
+	file, handler, err := r.FormFile("archive")
+	if err != nil {
+		log.Printf("Error getting archive: %v", err)
+		http.Error(w, "Error getting archive", http.StatusBadRequest)
+		return "", "", fmt.Errorf("error getting archive: %v", err)
+	}
+	defer file.Close()
+
+	log.Printf("Received project export: %s, size: %d bytes", handler.Filename, handler.Size)
+
+	// Save the archive to a temporary file so the metadata can be read before extraction
+	tempFile, err := os.CreateTemp("", "project-import-*.zip")
+	if err != nil {
+		log.Printf("Error creating temp file: %v", err)
+		http.Error(w, "Error saving uploaded archive", http.StatusInternalServerError)
+		return "", "", fmt.Errorf("error creating temp file: %v", err)
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	if _, err := io.Copy(tempFile, file); err != nil {
+		log.Printf("Error copying archive data: %v", err)
+		http.Error(w, "Error saving uploaded archive", http.StatusInternalServerError)
+		return "", "", fmt.Errorf("error copying archive data: %v", err)
+	}
+
+	metadata, err := readExportMetadata(tempFile.Name())
+	if err != nil {
+		log.Printf("Error reading export metadata: %v", err)
+		http.Error(w, fmt.Sprintf("Invalid project export: %v", err), http.StatusBadRequest)
+		return "", "", err
+	}
+
+	projectName := sanitizeProjectName(metadata.Name)
+	if projectName == "" {
+		http.Error(w, "Invalid project export: missing project name", http.StatusBadRequest)
+		return "", "", fmt.Errorf("export metadata has no project name")
+	}
+
+	// Refuse to overwrite an existing project
+	projectDir := filepath.Join("projects", userID, projectName)
+	if _, err := os.Stat(projectDir); err == nil {
+		http.Error(w, fmt.Sprintf("Project %s already exists", projectName), http.StatusConflict)
+		return "", "", fmt.Errorf("project %s already exists", projectName)
+	}
+
+	if err := extractZip(tempFile.Name(), projectDir); err != nil {
+		log.Printf("Error extracting project export: %v", err)
+		os.RemoveAll(projectDir)
+		http.Error(w, "Error extracting project export", http.StatusInternalServerError)
+		return "", "", fmt.Errorf("error extracting project export: %v", err)
+	}
+
+	// The metadata file isn't part of the project source
+	os.Remove(filepath.Join(projectDir, ExportMetadataFile))
+
+	// Restore the manifest if the source doesn't carry one
+	if _, err := models.LoadManifest(projectDir); err != nil && metadata.Manifest != nil {
+		if err := models.SaveManifest(metadata.Manifest, projectDir); err != nil {
+			log.Printf("Warning: failed to restore manifest for imported project %s: %v", projectName, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":      "success",
+		"message":     fmt.Sprintf("Project %s imported, rebuild started", projectName),
+		"projectName": projectName,
+	})
+
+	return projectName, projectDir, nil
+}
+
+// readExportMetadata reads the metadata file from a project export archive
+func readExportMetadata(archivePath string) (*ExportMetadata, error) {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("not a zip archive: %v", err)
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if strings.TrimPrefix(file.Name, "./") != ExportMetadataFile {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+
+		var metadata ExportMetadata
+		if err := json.NewDecoder(rc).Decode(&metadata); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %v", ExportMetadataFile, err)
+		}
+		return &metadata, nil
+	}
+
+	return nil, fmt.Errorf("archive does not contain %s", ExportMetadataFile)
+}
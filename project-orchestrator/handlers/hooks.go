@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
+)
+
+// Deploy hook phases
+const (
+	HookPreDeploy  = "pre-deploy"  // Before the service container starts
+	HookPostDeploy = "post-deploy" // Once the service and its processes are running
+)
+
+// hookCommand returns the command a service runs for a hook phase, empty if it has none
+func hookCommand(service models.Service, phase string) string {
+	if service.Hooks == nil {
+		return ""
+	}
+	switch phase {
+	case HookPreDeploy:
+		return service.Hooks.PreDeploy
+	case HookPostDeploy:
+		return service.Hooks.PostDeploy
+	}
+	return ""
+}
+
+// runDeployHook runs a service's hook for a phase in a one-shot container from the service
+// image, with the service's environment and network, and waits for it to exit. The hook
+// runs under the deploy watchdog; a non-zero exit fails the deployment.
+func runDeployHook(ctx context.Context, project *models.Project, name string, service models.Service, phase string, networkName string, env map[string]string) error {
+	command := hookCommand(service, phase)
+	if command == "" {
+		return nil
+	}
+
+	imageName := serviceImage(project, name)
+	containerName := fmt.Sprintf("project-%s-%s-%s", project.Name, name, phase)
+
+	// Clean up a hook container left over from an interrupted deployment
+	if err := cleanupContainer(ctx, containerName); err != nil {
+		return err
+	}
+
+	args := []string{
+		"run",
+		"--rm",
+		"--name", containerName,
+		"--network", networkName,
+		"--label", fmt.Sprintf("platform.project=%s", project.Name),
+		"--label", fmt.Sprintf("platform.hook=%s.%s", name, phase),
+	}
+
+	// Add environment variables
+	for k, v := range env {
+		args = append(args, "-e", fmt.Sprintf("%s=%s", k, v))
+	}
+
+	// Hooks run within the service's resource allocation
+	args = append(args, resourceArgs(service.Resources)...)
+
+	args = append(args, imageName)
+	args = append(args, processCommand(command)...)
+
+	log.Printf("Running %s hook of service %s: %s", phase, name, command)
+
+	// Only the tail of the hook output is kept
+	output := NewBuildLogBuffer()
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err := runCommand(ctx, cmd)
+	log.Printf("Output of %s hook of service %s:\n%s", phase, name, output.String())
+	if err != nil {
+		// Killing docker run leaves the container running
+		if kind := ErrorKindOf(err); kind == Timeout || kind == Cancelled {
+			exec.Command("docker", "rm", "-f", containerName).Run()
+			return err
+		}
+		return classifyCommandError(describeHookError(phase, err, output.String()), output.String(), UserError)
+	}
+
+	log.Printf("%s hook of service %s completed", phase, name)
+	return nil
+}
+
+// describeHookError reports a failed hook with the last line of its output
+func describeHookError(phase string, err error, output string) error {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		return fmt.Errorf("%s hook failed: %v: %s", phase, err, last)
+	}
+	return fmt.Errorf("%s hook failed: %v", phase, err)
+}
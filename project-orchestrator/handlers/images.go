@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Base images used by the generated Dockerfiles, kept pulled so first builds are fast
+var BaseImages = []string{
+	"python:3.9-slim",
+	"node:16-alpine",
+	"nginx:alpine",
+	"golang:1.19-alpine",
+}
+
+// BaseImageRefreshInterval is how often base images are pulled again to pick up updates
+var BaseImageRefreshInterval = 24 * time.Hour
+
+// ImagePullResult describes the outcome of pulling one base image
+type ImagePullResult struct {
+	Image    string `json:"image"`
+	Status   string `json:"status"` // pulled or failed
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Only one refresh runs at a time
+var warmImagesMutex sync.Mutex
+
+func init() {
+	// Allow the set of base images to be configured as a comma separated list
+	if value := os.Getenv("BASE_IMAGES"); value != "" {
+		var images []string
+		for _, image := range strings.Split(value, ",") {
+			if image = strings.TrimSpace(image); image != "" {
+				images = append(images, image)
+			}
+		}
+		BaseImages = images
+	}
+
+	if value := os.Getenv("BASE_IMAGE_REFRESH_INTERVAL"); value != "" {
+		if interval, err := time.ParseDuration(value); err == nil && interval > 0 {
+			BaseImageRefreshInterval = interval
+		} else {
+			log.Printf("Invalid BASE_IMAGE_REFRESH_INTERVAL %q, using default %s", value, BaseImageRefreshInterval)
+		}
+	}
+}
+
+// WarmBaseImages pulls all base images and reports the result of each pull
+func WarmBaseImages() []ImagePullResult {
+	warmImagesMutex.Lock()
+	defer warmImagesMutex.Unlock()
+
+	results := make([]ImagePullResult, 0, len(BaseImages))
+	for _, image := range BaseImages {
+		start := time.Now()
+		result := ImagePullResult{Image: image, Status: "pulled"}
+
+		cmd := exec.Command("docker", "pull", "--quiet", image)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			result.Status = "failed"
+			result.Error = strings.TrimSpace(string(output))
+			if result.Error == "" {
+				result.Error = err.Error()
+			}
+			log.Printf("Failed to pull base image %s: %s", image, result.Error)
+		}
+
+		result.Duration = time.Since(start).Round(time.Millisecond).String()
+		results = append(results, result)
+	}
+
+	log.Printf("Refreshed %d base images", len(results))
+	return results
+}
+
+// StartBaseImageWarmer pulls the base images in the background now and on every refresh interval
+func StartBaseImageWarmer() {
+	if len(BaseImages) == 0 {
+		return
+	}
+
+	go func() {
+		WarmBaseImages()
+
+		ticker := time.NewTicker(BaseImageRefreshInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			WarmBaseImages()
+		}
+	}()
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
+)
+
+// ImageRetention is how many tagged images are kept per service for rollbacks, not counting
+// latest. It can be configured with the IMAGE_RETENTION environment variable.
+var ImageRetention = 5
+
+// Docker's format for image tags
+var imageTagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+func init() {
+	if value := os.Getenv("IMAGE_RETENTION"); value != "" {
+		if retention, err := strconv.Atoi(value); err == nil && retention > 0 {
+			ImageRetention = retention
+		} else {
+			log.Printf("Invalid IMAGE_RETENTION %q, using default %d", value, ImageRetention)
+		}
+	}
+}
+
+// ValidImageTag reports whether tag can be used as a Docker image tag
+func ValidImageTag(tag string) bool {
+	return imageTagPattern.MatchString(tag) && tag != "latest"
+}
+
+// imageRepository returns the name of a service's images, without a tag
+func imageRepository(projectName, serviceName string) string {
+	return fmt.Sprintf("project-%s-%s", projectName, serviceName)
+}
+
+// serviceImage returns the tagged image a service is deployed from, falling back to
+// latest for services deployed before images were tagged
+func serviceImage(project *models.Project, name string) string {
+	if image := project.Services[name].Image; image != "" {
+		return image
+	}
+	return imageRepository(project.Name, name) + ":latest"
+}
+
+// imageTag returns the tag of a service's image: the version given at upload, or a hash of
+// the service's files and manifest so identical sources always get the same tag
+func imageTag(project *models.Project, service models.Service) (string, error) {
+	if project.Version != "" {
+		return project.Version, nil
+	}
+
+	hash := sha256.New()
+	manifest, err := json.Marshal(service)
+	if err != nil {
+		return "", err
+	}
+	hash.Write(manifest)
+
+	// Walk visits files in lexical order, so the hash doesn't depend on the file system
+	servicePath := filepath.Join(project.Path, service.Path)
+	err = filepath.Walk(servicePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(servicePath, path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(hash, "%s\x00%o\x00%d\x00", filepath.ToSlash(relPath), info.Mode().Perm(), info.Size())
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(hash, file)
+		return err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to hash service directory %s: %v", service.Path, err)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))[:12], nil
+}
+
+// serviceImageTags returns the tags of a service's images, newest first, without latest
+func serviceImageTags(projectName, serviceName string) ([]string, error) {
+	cmd := exec.Command("docker", "images", "--format", "{{.Tag}}", imageRepository(projectName, serviceName))
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %v", err)
+	}
+
+	var tags []string
+	for _, tag := range strings.Fields(string(output)) {
+		if tag != "latest" && tag != "<none>" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// pruneServiceImages removes the tagged images of a service beyond the newest ImageRetention,
+// never the image it is running
+func pruneServiceImages(project *models.Project, name string) {
+	tags, err := serviceImageTags(project.Name, name)
+	if err != nil {
+		log.Printf("Warning: failed to prune images of service %s: %v", name, err)
+		return
+	}
+	if len(tags) <= ImageRetention {
+		return
+	}
+
+	current := serviceImage(project, name)
+	for _, tag := range tags[ImageRetention:] {
+		image := imageRepository(project.Name, name) + ":" + tag
+		if image == current {
+			continue
+		}
+		if output, err := exec.Command("docker", "rmi", image).CombinedOutput(); err != nil {
+			log.Printf("Warning: failed to remove image %s: %v, output: %s", image, err, strings.TrimSpace(string(output)))
+			continue
+		}
+		log.Printf("Pruned image %s", image)
+	}
+}
+
+// pruneDanglingImages removes the untagged images of a service, left behind when a rebuild
+// moves latest or an existing tag to a new image
+func pruneDanglingImages(projectName, serviceName string) {
+	output, err := exec.Command("docker", "image", "prune", "-f",
+		"--filter", fmt.Sprintf("label=platform.project=%s", projectName),
+		"--filter", fmt.Sprintf("label=platform.service=%s", serviceName)).CombinedOutput()
+	if err != nil {
+		log.Printf("Warning: failed to prune dangling images of service %s: %v, output: %s", serviceName, err, strings.TrimSpace(string(output)))
+		return
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, "Total reclaimed space:") {
+			log.Printf("Pruned dangling images of service %s, %s", serviceName, strings.ToLower(line[:1])+line[1:])
+		}
+	}
+}
+
+// RemoveServiceImages removes every image of a service, including latest and dangling ones
+func RemoveServiceImages(projectName, serviceName string) {
+	tags, err := serviceImageTags(projectName, serviceName)
+	if err != nil {
+		log.Printf("Warning: failed to remove images of service %s: %v", serviceName, err)
+		return
+	}
+
+	for _, tag := range append(tags, "latest") {
+		image := imageRepository(projectName, serviceName) + ":" + tag
+		if err := exec.Command("docker", "rmi", "-f", image).Run(); err != nil {
+			log.Printf("Error removing image %s: %v (this may be normal if image doesn't exist)", image, err)
+		}
+	}
+	pruneDanglingImages(projectName, serviceName)
+}
@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
+)
+
+// initVolumeName returns the name of the volume a service's init container shares at path.
+// It is derived from the cleaned path, so a volume keeps its contents when the list of
+// volumes is reordered.
+func initVolumeName(projectName, serviceName string, path string) string {
+	hash := sha256.Sum256([]byte(filepath.Clean(path)))
+	return fmt.Sprintf("project-%s-%s.init-%s", projectName, serviceName, hex.EncodeToString(hash[:])[:12])
+}
+
+// initVolumeArgs returns the docker run arguments mounting the volumes of a service's init
+// container, for the init container and every container of the service
+func initVolumeArgs(projectName, serviceName string, service models.Service) []string {
+	if service.Init == nil {
+		return nil
+	}
+	var args []string
+	for _, path := range service.Init.Volumes {
+		args = append(args, "-v", fmt.Sprintf("%s:%s", initVolumeName(projectName, serviceName, path), filepath.Clean(path)))
+	}
+	return args
+}
+
+// runInitContainer runs a service's init command in a one-shot container from the service
+// image, with the service's environment, network and init volumes, and waits for it to
+// exit. Volumes are created labelled with the project so they are removed with it, and
+// keep their contents across deployments. The init runs under the deploy watchdog; a
+// non-zero exit fails the deployment.
+func runInitContainer(ctx context.Context, project *models.Project, name string, service models.Service, networkName string, env map[string]string) error {
+	if service.Init == nil {
+		return nil
+	}
+
+	for _, path := range service.Init.Volumes {
+		volumeName := initVolumeName(project.Name, name, path)
+		cmd := exec.CommandContext(ctx, "docker", "volume", "create",
+			"--label", fmt.Sprintf("platform.project=%s", project.Name),
+			"--label", fmt.Sprintf("platform.init=%s", name),
+			volumeName)
+		var output bytes.Buffer
+		cmd.Stdout = &output
+		cmd.Stderr = &output
+		if err := runCommand(ctx, cmd); err != nil {
+			return classifyCommandError(fmt.Errorf("failed to create init volume %s: %w", volumeName, err), output.String(), InfraError)
+		}
+	}
+
+	imageName := serviceImage(project, name)
+	// Service names can't contain '.', so this can't be the container name of another service
+	containerName := fmt.Sprintf("project-%s-%s.init", project.Name, name)
+
+	// Clean up an init container left over from an interrupted deployment
+	if err := cleanupContainer(ctx, containerName); err != nil {
+		return err
+	}
+
+	args := []string{
+		"run",
+		"--rm",
+		"--name", containerName,
+		"--network", networkName,
+		"--label", fmt.Sprintf("platform.project=%s", project.Name),
+		"--label", fmt.Sprintf("platform.init=%s", name),
+	}
+
+	// Add environment variables
+	for k, v := range env {
+		args = append(args, "-e", fmt.Sprintf("%s=%s", k, v))
+	}
+
+	// The init runs within the service's resource allocation
+	args = append(args, resourceArgs(service.Resources)...)
+	args = append(args, initVolumeArgs(project.Name, name, service)...)
+
+	args = append(args, imageName)
+	args = append(args, processCommand(service.Init.Command)...)
+
+	log.Printf("Running init container of service %s: %s", name, service.Init.Command)
+
+	// Only the tail of the init output is kept
+	output := NewBuildLogBuffer()
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout = output
+	cmd.Stderr = output
+
+	err := runCommand(ctx, cmd)
+	log.Printf("Output of init container of service %s:\n%s", name, output.String())
+	if err != nil {
+		// Killing docker run leaves the container running
+		if kind := ErrorKindOf(err); kind == Timeout || kind == Cancelled {
+			exec.Command("docker", "rm", "-f", containerName).Run()
+			return err
+		}
+		lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+		if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+			err = fmt.Errorf("init container failed: %v: %s", err, last)
+		} else {
+			err = fmt.Errorf("init container failed: %v", err)
+		}
+		return classifyCommandError(err, output.String(), UserError)
+	}
+
+	log.Printf("Init container of service %s completed", name)
+	return nil
+}
+
+// RemoveInitVolumes removes the volumes shared by the init containers of a project's service
+func RemoveInitVolumes(projectName, serviceName string) {
+	output, err := exec.Command("docker", "volume", "ls", "--quiet",
+		"--filter", fmt.Sprintf("label=platform.project=%s", projectName),
+		"--filter", fmt.Sprintf("label=platform.init=%s", serviceName)).Output()
+	if err != nil {
+		log.Printf("Error listing init volumes of service %s: %v", serviceName, err)
+		return
+	}
+	for _, volumeName := range strings.Fields(string(output)) {
+		if output, err := exec.Command("docker", "volume", "rm", volumeName).CombinedOutput(); err != nil {
+			log.Printf("Error removing init volume %s: %v, output: %s", volumeName, err, string(output))
+		}
+	}
+}
+
+// removeStaleInitVolumes removes the init volumes of a project that none of its services
+// mounts anymore, such as the volumes of services removed from the manifest. Volumes still
+// used by a container are kept.
+func removeStaleInitVolumes(ctx context.Context, project *models.Project) {
+	cmd := exec.CommandContext(ctx, "docker", "volume", "ls",
+		"--filter", fmt.Sprintf("label=platform.project=%s", project.Name),
+		"--filter", "label=platform.init",
+		"--format", "{{.Name}}")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := runCommand(ctx, cmd); err != nil {
+		log.Printf("Warning: failed to list init volumes of project %s: %v, stderr: %s", project.Name, err, stderr.String())
+		return
+	}
+
+	current := make(map[string]bool)
+	for name, service := range project.Manifest.Services {
+		if service.Init == nil {
+			continue
+		}
+		for _, path := range service.Init.Volumes {
+			current[initVolumeName(project.Name, name, path)] = true
+		}
+	}
+
+	for _, volumeName := range strings.Fields(stdout.String()) {
+		if current[volumeName] {
+			continue
+		}
+		log.Printf("Removing init volume %s, which no service of project %s mounts anymore", volumeName, project.Name)
+		removeCmd := exec.CommandContext(ctx, "docker", "volume", "rm", volumeName)
+		var output bytes.Buffer
+		removeCmd.Stdout = &output
+		removeCmd.Stderr = &output
+		if err := runCommand(ctx, removeCmd); err != nil {
+			log.Printf("Warning: failed to remove init volume %s: %v, output: %s", volumeName, err, output.String())
+		}
+	}
+}
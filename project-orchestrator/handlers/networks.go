@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FunctionNetwork is the network shared by function containers, configured with
+// FUNCTION_NETWORK like on the function controller
+var FunctionNetwork = "platform-repository_function-network"
+
+// Names of the networks created for projects, also matched for networks created before
+// they were labelled
+var projectNetworkPattern = regexp.MustCompile(`^project-(.+)-network$`)
+
+func init() {
+	if value := os.Getenv("FUNCTION_NETWORK"); value != "" {
+		FunctionNetwork = value
+	}
+}
+
+// PlatformNetwork is a Docker network created by the platform
+type PlatformNetwork struct {
+	Name       string             `json:"name"`
+	ID         string             `json:"id"`
+	Kind       string             `json:"kind"` // project or function
+	Project    string             `json:"project,omitempty"`
+	Containers []NetworkContainer `json:"containers"`
+	Orphaned   bool               `json:"orphaned"` // No project references the network
+	CreatedAt  string             `json:"createdAt"`
+}
+
+// NetworkContainer is a container connected to a network
+type NetworkContainer struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	IPAddress string `json:"ipAddress,omitempty"`
+}
+
+// dockerNetwork is the docker network inspect output
+type dockerNetwork struct {
+	Name       string            `json:"Name"`
+	ID         string            `json:"Id"`
+	Created    string            `json:"Created"`
+	Labels     map[string]string `json:"Labels"`
+	Containers map[string]struct {
+		Name        string `json:"Name"`
+		IPv4Address string `json:"IPv4Address"`
+	} `json:"Containers"`
+}
+
+// ListPlatformNetworks returns the project networks and the function network with the
+// containers connected to them, sorted by name. A project network is orphaned when
+// projectExists doesn't know its project.
+func ListPlatformNetworks(projectExists func(name string) bool) ([]PlatformNetwork, error) {
+	output, err := exec.Command("docker", "network", "ls", "--format", "{{.Name}}").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %v", err)
+	}
+
+	var names []string
+	for _, name := range strings.Fields(string(output)) {
+		if name == FunctionNetwork || projectNetworkPattern.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	networks := []PlatformNetwork{}
+	if len(names) == 0 {
+		return networks, nil
+	}
+
+	inspected, err := inspectNetworks(names)
+	if err != nil {
+		return nil, err
+	}
+	for _, network := range inspected {
+		platformNetwork := PlatformNetwork{
+			Name:       network.Name,
+			ID:         network.ID,
+			Kind:       "function",
+			Containers: []NetworkContainer{},
+			CreatedAt:  network.Created,
+		}
+		if network.Name != FunctionNetwork {
+			platformNetwork.Kind = "project"
+			platformNetwork.Project = network.Labels["platform.project"]
+			if platformNetwork.Project == "" {
+				platformNetwork.Project = projectNetworkPattern.FindStringSubmatch(network.Name)[1]
+			}
+			platformNetwork.Orphaned = !projectExists(platformNetwork.Project)
+		}
+		for id, container := range network.Containers {
+			platformNetwork.Containers = append(platformNetwork.Containers, NetworkContainer{
+				ID:        id,
+				Name:      container.Name,
+				IPAddress: strings.SplitN(container.IPv4Address, "/", 2)[0],
+			})
+		}
+		sort.Slice(platformNetwork.Containers, func(i, j int) bool {
+			return platformNetwork.Containers[i].Name < platformNetwork.Containers[j].Name
+		})
+		networks = append(networks, platformNetwork)
+	}
+
+	sort.Slice(networks, func(i, j int) bool { return networks[i].Name < networks[j].Name })
+	return networks, nil
+}
+
+// inspectNetworks returns the docker network inspect output of networks
+func inspectNetworks(names []string) ([]dockerNetwork, error) {
+	output, err := exec.Command("docker", append([]string{"network", "inspect"}, names...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect networks: %v", err)
+	}
+
+	var networks []dockerNetwork
+	if err := json.Unmarshal(output, &networks); err != nil {
+		return nil, fmt.Errorf("failed to parse network inspect output: %v", err)
+	}
+	return networks, nil
+}
+
+// RemoveNetwork disconnects every container still connected to a network, e.g. NGINX or
+// containers left behind by a failed deploy, and removes the network
+func RemoveNetwork(networkName string) error {
+	output, err := exec.Command("docker", "network", "inspect", networkName, "--format", "{{range .Containers}}{{.Name}} {{end}}").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to inspect network %s: %v, output: %s", networkName, err, strings.TrimSpace(string(output)))
+	}
+	for _, container := range strings.Fields(string(output)) {
+		log.Printf("Disconnecting container %s from network %s", container, networkName)
+		if err := exec.Command("docker", "network", "disconnect", "--force", networkName, container).Run(); err != nil {
+			log.Printf("Note: Could not disconnect container %s from network %s: %v", container, networkName, err)
+		}
+	}
+
+	if output, err := exec.Command("docker", "network", "rm", networkName).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to remove network %s: %v, output: %s", networkName, err, strings.TrimSpace(string(output)))
+	}
+	log.Printf("Removed network %s", networkName)
+	return nil
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
+)
+
+// processCommand returns the docker run arguments running a process command through a shell
+func processCommand(command string) []string {
+	return []string{"sh", "-c", command}
+}
+
+// webProcessCommand returns the command of a service's web process, or nil to use the image's default
+func webProcessCommand(project *models.Project, service models.Service) ([]string, error) {
+	processes, err := models.LoadProcesses(project.Path, service)
+	if err != nil {
+		return nil, newDeployError(UserError, "%v", err)
+	}
+	if command, exists := processes[models.WebProcess]; exists {
+		return processCommand(command), nil
+	}
+	return nil, nil
+}
+
+// deployServiceProcesses runs a container for each of a service's processes other than the web
+// process, from the service's image and with its environment
+func deployServiceProcesses(ctx context.Context, project *models.Project, name string, service models.Service, networkName string) (map[string]models.ProcessStatus, error) {
+	processes, err := models.LoadProcesses(project.Path, service)
+	if err != nil {
+		return nil, newDeployError(UserError, "%v", err)
+	}
+	removeStaleProcessContainers(ctx, project.Name, name, processes)
+	if len(processes) == 0 {
+		return nil, nil
+	}
+
+	env, err := serviceEnv(project, service)
+	if err != nil {
+		return nil, err
+	}
+
+	imageName := serviceImage(project, name)
+	statuses := make(map[string]models.ProcessStatus)
+	for process, command := range processes {
+		if process == models.WebProcess {
+			continue
+		}
+
+		containerName := processContainerName(project.Name, name, process)
+		log.Printf("Starting process %s of service %s: %s", process, name, command)
+		containerId, err := runProcessContainer(ctx, imageName, containerName, project.Name, name, process, networkName, env, service.Resources, service.StopSignal, command, initVolumeArgs(project.Name, name, service))
+		if err != nil {
+			return statuses, fmt.Errorf("failed to run process %s: %w", process, err)
+		}
+
+		statuses[process] = models.ProcessStatus{
+			Command:     command,
+			Status:      "running",
+			ContainerID: containerId,
+		}
+	}
+
+	return statuses, nil
+}
+
+// processContainerName returns the name of a process container. Service names can't
+// contain '.', so it can't be the container name of another service.
+func processContainerName(projectName, serviceName, process string) string {
+	return fmt.Sprintf("project-%s-%s.%s", projectName, serviceName, process)
+}
+
+// removeStaleProcessContainers removes the process containers of a service that don't run one
+// of its current processes, such as the containers of processes removed from its Procfile
+func removeStaleProcessContainers(ctx context.Context, projectName, serviceName string, processes map[string]string) {
+	cmd := exec.CommandContext(ctx, "docker", "ps", "-a",
+		"--filter", fmt.Sprintf("label=platform.project=%s", projectName),
+		"--filter", "label=platform.process",
+		"--format", `{{.Names}} {{.Label "platform.process"}}`)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := runCommand(ctx, cmd); err != nil {
+		log.Printf("Warning: failed to list process containers of service %s: %v, stderr: %s", serviceName, err, stderr.String())
+		return
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		containerName, label := fields[0], fields[1]
+		service, process, found := strings.Cut(label, ".")
+		if !found || service != serviceName {
+			continue
+		}
+		// Containers of declared processes are replaced, unless they still have an older name
+		_, declared := processes[process]
+		if declared && process != models.WebProcess && containerName == processContainerName(projectName, serviceName, process) {
+			continue
+		}
+
+		log.Printf("Removing container %s of process %s of service %s, which is no longer declared", containerName, process, serviceName)
+		removeCmd := exec.CommandContext(ctx, "docker", "rm", "-f", containerName)
+		var output bytes.Buffer
+		removeCmd.Stdout = &output
+		removeCmd.Stderr = &output
+		if err := runCommand(ctx, removeCmd); err != nil {
+			log.Printf("Warning: failed to remove container %s: %v, output: %s", containerName, err, output.String())
+		}
+	}
+}
+
+// runProcessContainer runs a process from a service's image. Process containers don't
+// receive traffic, so they carry no service discovery labels.
+func runProcessContainer(ctx context.Context, imageName string, containerName string, projectName string, serviceName string, process string, networkName string, env map[string]string, resources *models.Resources, stopSignal string, command string, volumes []string) (string, error) {
+	// Clean up any existing container with the same name
+	if err := cleanupContainer(ctx, containerName); err != nil {
+		return "", err
+	}
+
+	args := []string{
+		"run",
+		"-d",
+		"--name", containerName,
+		"--network", networkName,
+		"--restart", "unless-stopped",
+		"--label", fmt.Sprintf("platform.project=%s", projectName),
+		"--label", fmt.Sprintf("platform.process=%s.%s", serviceName, process),
+	}
+
+	// Add environment variables
+	for k, v := range env {
+		args = append(args, "-e", fmt.Sprintf("%s=%s", k, v))
+	}
+
+	// Processes share the service's resource allocation limits and stop signal
+	args = append(args, resourceArgs(resources)...)
+	args = append(args, stopSignalArgs(stopSignal)...)
+
+	// Processes see the volumes the service's init container prepared
+	args = append(args, volumes...)
+
+	args = append(args, imageName)
+	args = append(args, processCommand(command)...)
+
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := runCommand(ctx, cmd); err != nil {
+		log.Printf("Docker run error: %s", stderr.String())
+		return "", classifyCommandError(fmt.Errorf("failed to run Docker container: %w", err), stderr.String(), InfraError)
+	}
+
+	containerId := strings.TrimSpace(stdout.String())
+	log.Printf("Started process container %s (%s)", containerName, containerId)
+	return containerId, nil
+}
+
+// RemoveProcessContainers removes the process containers of a service
+func RemoveProcessContainers(service models.ServiceStatus) {
+	for process, status := range service.Processes {
+		if status.ContainerID == "" {
+			continue
+		}
+		if output, err := exec.Command("docker", "rm", "-f", status.ContainerID).CombinedOutput(); err != nil {
+			log.Printf("Error removing container %s of process %s: %v, output: %s", status.ContainerID, process, err, string(output))
+		}
+	}
+}
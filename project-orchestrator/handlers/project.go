@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
 )
 
+// statusFileMutex serializes writers of project status files
+var statusFileMutex sync.Mutex
+
 // SaveProjectStatus saves the project status to disk
 func SaveProjectStatus(project *models.Project) error {
 	// Create the status file
@@ -21,9 +25,53 @@ func SaveProjectStatus(project *models.Project) error {
 	}
 	
 	// Write the status file
-	if err := os.WriteFile(statusFile, data, 0644); err != nil {
+	if err := WriteStatusFile(statusFile, data); err != nil {
 		return fmt.Errorf("failed to write status file: %v", err)
 	}
 	
 	return nil
 }
+
+// WriteStatusFile atomically replaces a status file. The data is written to a temp
+// file in the same directory and renamed over the original, so an interrupted write
+// never leaves a truncated status.json behind.
+func WriteStatusFile(statusFile string, data []byte) error {
+	statusFileMutex.Lock()
+	defer statusFileMutex.Unlock()
+	
+	tempFile, err := os.CreateTemp(filepath.Dir(statusFile), ".status-*.json.tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	
+	// Clean up the temp file if anything goes wrong before the rename
+	committed := false
+	defer func() {
+		if !committed {
+			os.Remove(tempPath)
+		}
+	}()
+	
+	if _, err := tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tempPath, 0644); err != nil {
+		return err
+	}
+	
+	if err := os.Rename(tempPath, statusFile); err != nil {
+		return err
+	}
+	committed = true
+	
+	return nil
+}
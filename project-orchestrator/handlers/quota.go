@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
+)
+
+// Resources of static services that don't request their own. NGINX serving files needs
+// little, and the limits keep a busy site from taking the host's memory. They can be
+// configured with the STATIC_DEFAULT_CPUS and STATIC_DEFAULT_MEMORY environment variables,
+// where 0 or an empty memory value leaves that resource unlimited.
+var StaticDefaultResources = models.Resources{CPUs: 0.25, Memory: "64m"}
+
+func init() {
+	if value := os.Getenv("STATIC_DEFAULT_CPUS"); value != "" {
+		if cpus, err := strconv.ParseFloat(value, 64); err == nil && cpus >= 0 {
+			StaticDefaultResources.CPUs = cpus
+		} else {
+			log.Printf("Invalid STATIC_DEFAULT_CPUS %q, using default %.2f", value, StaticDefaultResources.CPUs)
+		}
+	}
+	if value, ok := os.LookupEnv("STATIC_DEFAULT_MEMORY"); ok {
+		if memory, err := models.ParseMemory(value); err == nil && (memory == 0 || memory >= 6<<20) {
+			StaticDefaultResources.Memory = value
+		} else {
+			log.Printf("Invalid STATIC_DEFAULT_MEMORY %q, using default %s", value, StaticDefaultResources.Memory)
+		}
+	}
+}
+
+// allocateResources checks the services' resource requests against the project quota
+// and returns the resources each service container is limited to. Static services
+// without a request get StaticDefaultResources, other services without a request share
+// whatever is left of the quota equally.
+func allocateResources(manifest *models.ProjectManifest) (map[string]models.Resources, *models.ResourceUsage, error) {
+	allocations := make(map[string]models.Resources)
+	usage := &models.ResourceUsage{}
+	
+	// Sum the explicit requests
+	var unrequestedCPU, unrequestedMemory []string
+	for name, service := range manifest.Services {
+		var request models.Resources
+		if service.Resources != nil {
+			request = *service.Resources
+		}
+		if service.Type == "static" {
+			if request.CPUs == 0 {
+				request.CPUs = StaticDefaultResources.CPUs
+			}
+			if request.Memory == "" {
+				request.Memory = StaticDefaultResources.Memory
+			}
+		}
+		
+		if request.CPUs < 0 {
+			return nil, nil, fmt.Errorf("service %s requests a negative number of CPUs", name)
+		}
+		memory, err := models.ParseMemory(request.Memory)
+		if err != nil {
+			return nil, nil, fmt.Errorf("service %s: %v", name, err)
+		}
+		
+		if request.CPUs == 0 {
+			unrequestedCPU = append(unrequestedCPU, name)
+		}
+		if memory == 0 {
+			unrequestedMemory = append(unrequestedMemory, name)
+		}
+		
+		usage.CPUAllocated += request.CPUs
+		usage.MemoryAllocated += memory
+		allocations[name] = request
+	}
+	
+	// Without a quota services only get the limits they asked for
+	if manifest.Resources == nil {
+		return allocations, usage, nil
+	}
+	
+	quotaMemory, err := models.ParseMemory(manifest.Resources.Memory)
+	if err != nil {
+		return nil, nil, fmt.Errorf("project quota: %v", err)
+	}
+	usage.CPUQuota = manifest.Resources.CPUs
+	usage.MemoryQuota = quotaMemory
+	
+	// Reject requests exceeding the quota
+	if usage.CPUQuota > 0 && usage.CPUAllocated > usage.CPUQuota {
+		return nil, nil, fmt.Errorf("services request %.2f CPUs, exceeding the project quota of %.2f",
+			usage.CPUAllocated, usage.CPUQuota)
+	}
+	if usage.MemoryQuota > 0 && usage.MemoryAllocated > usage.MemoryQuota {
+		return nil, nil, fmt.Errorf("services request %s of memory, exceeding the project quota of %s",
+			models.FormatMemory(usage.MemoryAllocated), models.FormatMemory(usage.MemoryQuota))
+	}
+	
+	// Split the remaining CPU budget between services without a CPU request
+	if usage.CPUQuota > 0 && len(unrequestedCPU) > 0 {
+		remaining := usage.CPUQuota - usage.CPUAllocated
+		if remaining <= 0 {
+			return nil, nil, fmt.Errorf("no CPU left in the project quota for services %v", unrequestedCPU)
+		}
+		share := remaining / float64(len(unrequestedCPU))
+		if share < 0.01 {
+			return nil, nil, fmt.Errorf("not enough CPU left in the project quota for services %v", unrequestedCPU)
+		}
+		for _, name := range unrequestedCPU {
+			allocation := allocations[name]
+			allocation.CPUs = share
+			allocations[name] = allocation
+		}
+		usage.CPUAllocated = usage.CPUQuota
+	}
+	
+	// Split the remaining memory budget between services without a memory request
+	if usage.MemoryQuota > 0 && len(unrequestedMemory) > 0 {
+		remaining := usage.MemoryQuota - usage.MemoryAllocated
+		// Docker refuses memory limits below 6MB
+		share := remaining / int64(len(unrequestedMemory))
+		if share < 6<<20 {
+			return nil, nil, fmt.Errorf("not enough memory left in the project quota for services %v", unrequestedMemory)
+		}
+		share -= share % (1 << 20) // Round down to whole megabytes
+		for _, name := range unrequestedMemory {
+			allocation := allocations[name]
+			allocation.Memory = models.FormatMemory(share)
+			allocations[name] = allocation
+		}
+		usage.MemoryAllocated += share * int64(len(unrequestedMemory))
+	}
+	
+	return allocations, usage, nil
+}
+
+// resourceArgs returns the docker run flags limiting a container to the given resources
+func resourceArgs(resources *models.Resources) []string {
+	if resources == nil {
+		return nil
+	}
+	
+	var args []string
+	if resources.CPUs > 0 {
+		args = append(args, "--cpus", fmt.Sprintf("%.2f", resources.CPUs))
+	}
+	if resources.Memory != "" {
+		args = append(args, "--memory", resources.Memory)
+	}
+	return args
+}
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
+)
+
+// Default package registries and credentials, configured on the orchestrator.
+// NPM_REGISTRY_TOKEN and credentials in PIP_INDEX_URL are only ever sent to these
+// registries and are passed to image builds as build secrets.
+var (
+	NPMRegistry      = os.Getenv("NPM_REGISTRY")
+	NPMRegistryToken = os.Getenv("NPM_REGISTRY_TOKEN")
+	PipIndexURL      = os.Getenv("PIP_INDEX_URL")
+)
+
+// Registry used by npm when none is configured
+const defaultNPMRegistry = "https://registry.npmjs.org/"
+
+// PackageRegistries are the registries used to install a project's dependencies
+type PackageRegistries struct {
+	NPM      string // npm registry URL
+	NPMToken string // Auth token for the npm registry
+	Pip      string // pip index URL, may include credentials
+}
+
+// ResolvePackageRegistries returns the registries for a project. The manifest may point
+// at other registries, in which case the orchestrator's credentials aren't used.
+func ResolvePackageRegistries(manifest *models.ProjectManifest) PackageRegistries {
+	registries := PackageRegistries{
+		NPM:      NPMRegistry,
+		NPMToken: NPMRegistryToken,
+		Pip:      PipIndexURL,
+	}
+	if manifest == nil || manifest.Registries == nil {
+		return registries
+	}
+
+	if manifest.Registries.NPM != "" && manifest.Registries.NPM != NPMRegistry {
+		registries.NPM = manifest.Registries.NPM
+		registries.NPMToken = ""
+	}
+	if manifest.Registries.Pip != "" && manifest.Registries.Pip != redactURL(PipIndexURL) {
+		registries.Pip = manifest.Registries.Pip
+	}
+	return registries
+}
+
+// hasPipCredentials reports whether the pip index URL contains credentials
+func (r PackageRegistries) hasPipCredentials() bool {
+	parsed, err := url.Parse(r.Pip)
+	return err == nil && parsed.User != nil
+}
+
+// hasSecrets reports whether building images requires registry credentials
+func (r PackageRegistries) hasSecrets() bool {
+	return r.NPMToken != "" || r.hasPipCredentials()
+}
+
+// npmrc returns an .npmrc pointing at the npm registry, including the auth token
+func (r PackageRegistries) npmrc() string {
+	registry := r.NPM
+	if registry == "" {
+		registry = defaultNPMRegistry
+	}
+
+	content := fmt.Sprintf("registry=%s\n", registry)
+	if r.NPMToken != "" {
+		// The token is scoped to the registry's host and path
+		scope := strings.TrimPrefix(strings.TrimPrefix(registry, "https:"), "http:")
+		if !strings.HasSuffix(scope, "/") {
+			scope += "/"
+		}
+		content += fmt.Sprintf("%s:_authToken=%s\n", scope, r.NPMToken)
+	}
+	return content
+}
+
+// pipConf returns a pip config file pointing at the pip index
+func (r PackageRegistries) pipConf() string {
+	return fmt.Sprintf("[global]\nindex-url = %s\n", r.Pip)
+}
+
+// writeSecretFile writes sensitive content to a private temp file
+func writeSecretFile(pattern string, content string) (string, error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(content); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// npmEnv returns the environment for npm commands run on the orchestrator.
+// The returned cleanup function removes any credentials written to disk.
+func (r PackageRegistries) npmEnv() ([]string, func(), error) {
+	env := os.Environ()
+	if r.NPMToken == "" {
+		if r.NPM != "" {
+			env = append(env, "npm_config_registry="+r.NPM)
+		}
+		return env, func() {}, nil
+	}
+
+	npmrcPath, err := writeSecretFile("npmrc-*", r.npmrc())
+	if err != nil {
+		return nil, nil, newDeployError(InfraError, "failed to write npm registry config: %v", err)
+	}
+	env = append(env, "NPM_CONFIG_USERCONFIG="+npmrcPath)
+	return env, func() { os.Remove(npmrcPath) }, nil
+}
+
+// pipEnv returns the environment for pip commands run on the orchestrator
+func (r PackageRegistries) pipEnv() []string {
+	env := os.Environ()
+	if r.Pip != "" {
+		env = append(env, "PIP_INDEX_URL="+r.Pip)
+	}
+	return env
+}
+
+// buildArgs returns the docker build flags passing the registries to the image build.
+// Registry URLs are passed as build args, credentials as build secrets.
+// The returned cleanup function removes the secret files once the build is done.
+func (r PackageRegistries) buildArgs() ([]string, func(), error) {
+	var args []string
+	var files []string
+	cleanup := func() {
+		for _, file := range files {
+			os.Remove(file)
+		}
+	}
+
+	if r.hasSecrets() && DockerBuilder == BuilderLegacy {
+		return nil, nil, newDeployError(InfraError,
+			"private registry credentials require DOCKER_BUILDER=%s or %s", BuilderBuildKit, BuilderBuildx)
+	}
+
+	if r.NPMToken != "" {
+		npmrcPath, err := writeSecretFile("npmrc-*", r.npmrc())
+		if err != nil {
+			return nil, nil, newDeployError(InfraError, "failed to write npm registry config: %v", err)
+		}
+		files = append(files, npmrcPath)
+		args = append(args, "--secret", "id=npmrc,src="+npmrcPath)
+	} else if r.NPM != "" {
+		args = append(args, "--build-arg", "npm_config_registry="+r.NPM)
+	}
+
+	if r.hasPipCredentials() {
+		pipConfPath, err := writeSecretFile("pipconf-*", r.pipConf())
+		if err != nil {
+			cleanup()
+			return nil, nil, newDeployError(InfraError, "failed to write pip registry config: %v", err)
+		}
+		files = append(files, pipConfPath)
+		args = append(args, "--secret", "id=pipconf,src="+pipConfPath)
+	} else if r.Pip != "" {
+		args = append(args, "--build-arg", "PIP_INDEX_URL="+r.Pip)
+	}
+
+	return args, cleanup, nil
+}
+
+// npmInstallSteps returns the Dockerfile instructions running npm commands against the registry
+func (r PackageRegistries) npmInstallSteps(commands ...string) string {
+	var steps []string
+	switch {
+	case r.NPMToken != "":
+		// The .npmrc is mounted for the step only and never stored in a layer
+		for _, command := range commands {
+			steps = append(steps, "RUN --mount=type=secret,id=npmrc,target=/root/.npmrc "+command)
+		}
+	case r.NPM != "":
+		steps = append(steps, "ARG npm_config_registry")
+		fallthrough
+	default:
+		for _, command := range commands {
+			steps = append(steps, "RUN "+command)
+		}
+	}
+	return strings.Join(steps, "\n")
+}
+
+// pipInstallSteps returns the Dockerfile instructions running pip commands against the index
+func (r PackageRegistries) pipInstallSteps(commands ...string) string {
+	var steps []string
+	switch {
+	case r.hasPipCredentials():
+		// The pip config is mounted for the step only and never stored in a layer
+		for _, command := range commands {
+			steps = append(steps, "RUN --mount=type=secret,id=pipconf,target=/etc/pip.conf "+command)
+		}
+	case r.Pip != "":
+		steps = append(steps, "ARG PIP_INDEX_URL")
+		fallthrough
+	default:
+		for _, command := range commands {
+			steps = append(steps, "RUN "+command)
+		}
+	}
+	return strings.Join(steps, "\n")
+}
+
+// redactURL removes credentials from a URL
+func redactURL(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.User == nil {
+		return value
+	}
+	parsed.User = nil
+	return parsed.String()
+}
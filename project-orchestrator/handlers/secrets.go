@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/secrets"
+)
+
+// Provider resolving the secrets referenced in service environments
+var secretProvider secrets.SecretProvider
+
+// SetSecretProvider sets the secret provider
+func SetSecretProvider(provider secrets.SecretProvider) {
+	secretProvider = provider
+}
+
+// resolveSecrets replaces the secret references in env, such as ${secret:db-password},
+// with the secrets of the project owner. Resolved values are only passed to containers.
+func resolveSecrets(env map[string]string, userID string) error {
+	for k, v := range env {
+		if len(secrets.References(v)) == 0 {
+			continue
+		}
+		if secretProvider == nil {
+			return newDeployError(InfraError, "%s references a secret but no secret provider is configured", k)
+		}
+
+		resolved, err := secrets.Expand(v, func(name string) (string, error) {
+			value, err := secretProvider.Get(secrets.Key(userID, name))
+			if errors.Is(err, secrets.ErrNotFound) {
+				return "", newDeployError(UserError, "secret %s referenced by %s is not defined", name, k)
+			}
+			if err != nil {
+				return "", newDeployError(InfraError, "failed to resolve secret %s: %v", name, err)
+			}
+			return value, nil
+		})
+		if err != nil {
+			var deployErr *DeployError
+			if !errors.As(err, &deployErr) {
+				err = newDeployError(UserError, "%s: %v", k, err)
+			}
+			return err
+		}
+		env[k] = resolved
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
+)
+
+// ProbeImage is the image of the helper container startup probes run in, which needs
+// wget and nc. It can be configured with the PROBE_IMAGE environment variable.
+var ProbeImage = "busybox:1.36"
+
+func init() {
+	if value := os.Getenv("PROBE_IMAGE"); value != "" {
+		ProbeImage = value
+	}
+}
+
+// waitForStartup probes a service until its readiness probe succeeds. The orchestrator isn't
+// attached to project networks, so the probes run in a helper container on the network.
+func waitForStartup(ctx context.Context, project *models.Project, name string, service models.Service, containerName string, port int, networkName string) error {
+	probe := service.ReadinessProbe()
+	if probe == nil {
+		return nil
+	}
+	delay, period, err := probe.Durations()
+	if err != nil {
+		return &DeployError{Kind: UserError, Err: err}
+	}
+	successThreshold, failureThreshold := probe.Thresholds()
+
+	// Keep the helper around for as long as the probes can take
+	helperName := fmt.Sprintf("project-%s-%s-probe", project.Name, name)
+	if err := cleanupContainer(ctx, helperName); err != nil {
+		return err
+	}
+	lifetime := delay + time.Duration(successThreshold+failureThreshold)*period*2
+	cmd := exec.CommandContext(ctx, "docker", "run", "-d", "--rm",
+		"--name", helperName,
+		"--network", networkName,
+		"--label", fmt.Sprintf("platform.project=%s", project.Name),
+		ProbeImage, "sleep", strconv.Itoa(int(lifetime.Seconds())))
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := runCommand(ctx, cmd); err != nil {
+		return classifyCommandError(fmt.Errorf("failed to start startup probe container: %w", err), output.String(), InfraError)
+	}
+	defer exec.Command("docker", "rm", "-f", helperName).Run()
+
+	log.Printf("Waiting %s before probing service %s", delay, name)
+	if err := sleepContext(ctx, delay); err != nil {
+		return err
+	}
+
+	successes, failures := 0, 0
+	for {
+		// A container that exited will never pass the probe
+		running, health := ContainerStatus(containerName)
+		if !running {
+			return newDeployError(UserError, "container exited before its startup probe succeeded, check the service logs")
+		}
+
+		err := runProbe(ctx, project, helperName, probe, containerName, port, period)
+		var deployErr *DeployError
+		if errors.As(err, &deployErr) {
+			// The deployment timed out or was cancelled
+			return err
+		}
+
+		// A container failing its image's HEALTHCHECK hasn't started properly either
+		if err == nil && health == HealthUnhealthy {
+			err = fmt.Errorf("container is unhealthy")
+		}
+
+		if err == nil {
+			successes++
+			if successes >= successThreshold {
+				log.Printf("Startup probe of service %s succeeded", name)
+				return nil
+			}
+		} else {
+			successes = 0
+			failures++
+			log.Printf("Startup probe %d/%d of service %s failed: %v", failures, failureThreshold, name, err)
+			if failures >= failureThreshold {
+				return newDeployError(UserError, "startup probe failed %d times: %v", failures, err)
+			}
+		}
+		if err := sleepContext(ctx, period); err != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext waits for d, returning early with a cancellation error once ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return newDeployError(Cancelled, "deployment was cancelled")
+	}
+}
+
+// runProbe probes a service once from the helper container, with an HTTP request to the
+// probe's path or a TCP connect when it has none
+func runProbe(ctx context.Context, project *models.Project, helperName string, probe *models.StartupProbe, containerName string, port int, period time.Duration) error {
+	timeout := strconv.Itoa(int(period.Seconds()))
+
+	var cmd *exec.Cmd
+	if probe.Path != "" {
+		url := fmt.Sprintf("http://%s:%d%s", containerName, port, probe.Path)
+		cmd = exec.CommandContext(ctx, "docker", "exec", helperName, "wget", "-q", "-T", timeout, "-O", "/dev/null", url)
+	} else {
+		cmd = exec.CommandContext(ctx, "docker", "exec", helperName, "nc", "-z", "-w", timeout, containerName, strconv.Itoa(port))
+	}
+
+	output := NewBuildLogBuffer()
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err := runCommand(ctx, cmd)
+	var deployErr *DeployError
+	if err == nil || errors.As(err, &deployErr) {
+		return err
+	}
+	if last := strings.TrimSpace(output.String()); last != "" {
+		return fmt.Errorf("%v: %s", err, last)
+	}
+	return err
+}
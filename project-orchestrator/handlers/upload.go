@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"archive/zip"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -10,19 +11,83 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
 )
 
+// UploadError describes a single problem with an uploaded project
+type UploadError = models.ValidationError
+
+// UploadResponse is the JSON envelope returned by the upload endpoint for success and errors
+type UploadResponse struct {
+	Status       string        `json:"status"` // success or error
+	Message      string        `json:"message"`
+	ProjectName  string        `json:"projectName,omitempty"`  // Name the project is deployed under
+	DetectedName string        `json:"detectedName,omitempty"` // Name derived from the upload
+	ManifestName string        `json:"manifestName,omitempty"` // Name declared in project.yaml
+	Warnings     []string      `json:"warnings"`
+	Errors       []UploadError `json:"errors,omitempty"`
+}
+
+// WriteUploadResponse writes an upload response envelope with the given status code
+func WriteUploadResponse(w http.ResponseWriter, statusCode int, response UploadResponse) {
+	if response.Warnings == nil {
+		response.Warnings = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
+// WriteUploadError writes an error envelope for a failed upload
+func WriteUploadError(w http.ResponseWriter, statusCode int, field, message string) {
+	WriteUploadResponse(w, statusCode, UploadResponse{
+		Status:  "error",
+		Message: message,
+		Errors:  []UploadError{{Field: field, Message: message}},
+	})
+}
+
+// validateUploadedProject checks the extracted project can be built and returns the
+// manifest name (if any), validation warnings and errors
+func validateUploadedProject(projectDir string) (string, []string, []UploadError) {
+	manifest, err := models.LoadManifest(projectDir)
+	if err != nil {
+		// Distinguish a broken manifest from a missing one
+		if !strings.Contains(err.Error(), "not found") {
+			return "", nil, []UploadError{{Field: "manifest", Message: err.Error()}}
+		}
+
+		manifest, err = models.DetectProjectStructure(projectDir)
+		if err != nil {
+			return "", nil, []UploadError{{
+				Field:   "manifest",
+				Message: "no manifest found and the project structure could not be auto-detected",
+			}}
+		}
+		warnings := []string{"no manifest found, structure was auto-detected"}
+		for name, service := range manifest.Services {
+			warnings = append(warnings, fmt.Sprintf("detected %s service %s in %s", service.Type, name, service.Path))
+		}
+		return "", warnings, nil
+	}
+
+	warnings, errors := models.ValidateManifest(manifest, projectDir)
+	return manifest.Name, warnings, errors
+}
+
 // UploadHandler handles project zip file uploads
 func UploadHandler(w http.ResponseWriter, r *http.Request, userID, username string) (string, string, error) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		w.Header().Set("Allow", "POST, OPTIONS")
+		WriteUploadError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
 		return "", "", fmt.Errorf("method not allowed")
 	}
 
 	// Parse the multipart form, 32 MB max
 	if err := r.ParseMultipartForm(32 << 20); err != nil {
 		log.Printf("Error parsing form: %v", err)
-		http.Error(w, "Error parsing form", http.StatusBadRequest)
+		WriteUploadError(w, http.StatusBadRequest, "project", "Error parsing form")
 		return "", "", fmt.Errorf("error parsing form: %v", err)
 	}
 
@@ -30,13 +95,19 @@ func UploadHandler(w http.ResponseWriter, r *http.Request, userID, username stri
 	file, handler, err := r.FormFile("project")
 	if err != nil {
 		log.Printf("Error getting file: %v", err)
-		http.Error(w, "Error getting file", http.StatusBadRequest)
+		WriteUploadError(w, http.StatusBadRequest, "project", "Error getting file")
 		return "", "", fmt.Errorf("error getting file: %v", err)
 	}
 	defer file.Close()
 
 	log.Printf("Received file: %s, size: %d bytes", handler.Filename, handler.Size)
 
+	// The optional version tags the project's images instead of a hash of their sources
+	if version := r.FormValue("version"); version != "" && !ValidImageTag(version) {
+		WriteUploadError(w, http.StatusBadRequest, "version", "Version must be a valid image tag: letters, digits, '_', '.' and '-', at most 128 characters, not 'latest'")
+		return "", "", fmt.Errorf("invalid version %q", version)
+	}
+
 	// Create a timestamp-based project name if not provided
 	projectName := r.FormValue("name")
 	if projectName == "" {
@@ -52,7 +123,7 @@ func UploadHandler(w http.ResponseWriter, r *http.Request, userID, username stri
 	projectDir := filepath.Join("projects", userID, projectName)
 	if err := os.MkdirAll(projectDir, 0755); err != nil {
 		log.Printf("Error creating project directory: %v", err)
-		http.Error(w, "Error creating project directory", http.StatusInternalServerError)
+		WriteUploadError(w, http.StatusInternalServerError, "", "Error creating project directory")
 		return "", "", fmt.Errorf("error creating project directory: %v", err)
 	}
 
@@ -61,7 +132,7 @@ func UploadHandler(w http.ResponseWriter, r *http.Request, userID, username stri
 	tempFile, err := os.Create(tempZipPath)
 	if err != nil {
 		log.Printf("Error creating temp file: %v", err)
-		http.Error(w, "Error saving uploaded file", http.StatusInternalServerError)
+		WriteUploadError(w, http.StatusInternalServerError, "", "Error saving uploaded file")
 		return "", "", fmt.Errorf("error creating temp file: %v", err)
 	}
 	defer tempFile.Close()
@@ -69,14 +140,14 @@ func UploadHandler(w http.ResponseWriter, r *http.Request, userID, username stri
 	// Copy the file data to the temp file
 	if _, err := io.Copy(tempFile, file); err != nil {
 		log.Printf("Error copying file data: %v", err)
-		http.Error(w, "Error saving uploaded file", http.StatusInternalServerError)
+		WriteUploadError(w, http.StatusInternalServerError, "", "Error saving uploaded file")
 		return "", "", fmt.Errorf("error copying file data: %v", err)
 	}
 
 	// Extract the zip file
 	if err := extractZip(tempZipPath, projectDir); err != nil {
 		log.Printf("Error extracting zip: %v", err)
-		http.Error(w, "Error extracting zip file", http.StatusInternalServerError)
+		WriteUploadError(w, http.StatusInternalServerError, "project", "Error extracting zip file")
 		return "", "", fmt.Errorf("error extracting zip: %v", err)
 	}
 
@@ -85,12 +156,40 @@ func UploadHandler(w http.ResponseWriter, r *http.Request, userID, username stri
 		log.Printf("Warning: could not remove temporary zip file: %v", err)
 	}
 
-	// TODO: Analyze project structure
-	// TODO: Build and deploy the project
+	// Validate the project before it is built
+	manifestName, warnings, validationErrors := validateUploadedProject(projectDir)
+	if len(validationErrors) > 0 {
+		log.Printf("Uploaded project %s failed validation: %v", projectName, validationErrors)
+		os.RemoveAll(projectDir)
+		WriteUploadResponse(w, http.StatusUnprocessableEntity, UploadResponse{
+			Status:       "error",
+			Message:      fmt.Sprintf("Project %s failed validation", projectName),
+			DetectedName: projectName,
+			ManifestName: manifestName,
+			Warnings:     warnings,
+			Errors:       validationErrors,
+		})
+		return "", "", fmt.Errorf("project %s failed validation", projectName)
+	}
+
+	// The manifest name takes precedence over the upload name
+	effectiveName := projectName
+	if manifestName != "" {
+		effectiveName = manifestName
+		if manifestName != projectName {
+			warnings = append(warnings, fmt.Sprintf("manifest name %s is used instead of upload name %s", manifestName, projectName))
+		}
+	}
 
 	// Return success response
-	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"status":"success","message":"Project %s uploaded and extracted successfully","projectName":"%s"}`, projectName, projectName)
+	WriteUploadResponse(w, http.StatusOK, UploadResponse{
+		Status:       "success",
+		Message:      fmt.Sprintf("Project %s uploaded and extracted successfully", effectiveName),
+		ProjectName:  effectiveName,
+		DetectedName: projectName,
+		ManifestName: manifestName,
+		Warnings:     warnings,
+	})
 	
 	return projectName, projectDir, nil
 }
@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Labels identifying the containers of deployed workloads: project services and functions
+const (
+	projectLabel  = "platform.project"
+	functionLabel = "function"
+)
+
+// UsageReport aggregates the resources used by everything deployed on the platform
+type UsageReport struct {
+	Containers        ContainerCounts `json:"containers"`
+	Images            ImageUsage      `json:"images"`
+	ProjectsDiskBytes int64           `json:"projectsDiskBytes"` // Size of the projects directory on disk
+	CPUPercent        float64         `json:"cpuPercent"`        // Sum over running workloads, 100 is one full core
+	MemoryBytes       int64           `json:"memoryBytes"`       // Sum over running workloads
+	Workloads         []WorkloadUsage `json:"workloads"`
+	Errors            []string        `json:"errors"` // Parts of the report that couldn't be collected
+	GeneratedAt       time.Time       `json:"generatedAt"`
+}
+
+// ContainerCounts counts the containers of deployed workloads
+type ContainerCounts struct {
+	Total     int `json:"total"`
+	Running   int `json:"running"`
+	Projects  int `json:"projects"`  // Containers of project services, processes and helpers
+	Functions int `json:"functions"` // Function containers
+}
+
+// ImageUsage counts the images on the Docker host
+type ImageUsage struct {
+	Total             int   `json:"total"`
+	Projects          int   `json:"projects"`          // Images built for project services
+	ProjectsSizeBytes int64 `json:"projectsSizeBytes"` // Size of the project images, shared layers counted once per image
+}
+
+// WorkloadUsage is the resource usage of one running workload container
+type WorkloadUsage struct {
+	Container   string  `json:"container"`
+	Kind        string  `json:"kind"` // project or function
+	Project     string  `json:"project,omitempty"`
+	Service     string  `json:"service,omitempty"`
+	Function    string  `json:"function,omitempty"`
+	CPUPercent  float64 `json:"cpuPercent"`
+	MemoryBytes int64   `json:"memoryBytes"`
+}
+
+// dockerContainer is a line of docker ps --format '{{json .}}'
+type dockerContainer struct {
+	ID     string `json:"ID"`
+	Names  string `json:"Names"`
+	State  string `json:"State"`
+	Labels string `json:"Labels"` // Comma separated key=value pairs
+}
+
+// dockerStats is a line of docker stats --format '{{json .}}'
+type dockerStats struct {
+	ID       string `json:"ID"`
+	CPUPerc  string `json:"CPUPerc"`  // e.g. 0.52%
+	MemUsage string `json:"MemUsage"` // e.g. 21.4MiB / 1.94GiB
+}
+
+// dockerImage is a line of docker images --format '{{json .}}'
+type dockerImage struct {
+	Size string `json:"Size"` // e.g. 125MB
+}
+
+// Sizes printed by docker, with binary or decimal units
+var dockerSizePattern = regexp.MustCompile(`^([0-9.]+)\s*([A-Za-z]*)$`)
+
+var dockerSizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"kb":  1e3,
+	"mb":  1e6,
+	"gb":  1e9,
+	"tb":  1e12,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+	"tib": 1 << 40,
+}
+
+// PlatformUsage reports the containers, images and resources used by all deployed workloads
+// and the disk used by the projects directory. Parts that fail are listed in the report's
+// errors, the rest is still reported.
+func PlatformUsage(projectsDir string) *UsageReport {
+	report := &UsageReport{
+		Workloads:   []WorkloadUsage{},
+		Errors:      []string{},
+		GeneratedAt: time.Now(),
+	}
+
+	// Find the workload containers and which are running
+	workloads := make(map[string]WorkloadUsage)
+	var running []string
+	for _, label := range []string{projectLabel, functionLabel} {
+		containers, err := listDockerContainers(label)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		for _, container := range containers {
+			if _, seen := workloads[container.ID]; seen {
+				continue
+			}
+			labels := parseDockerLabels(container.Labels)
+			workload := WorkloadUsage{
+				Container: container.Names,
+				Project:   labels[projectLabel],
+				Service:   labels["platform.service"],
+				Function:  labels[functionLabel],
+			}
+			if workload.Project != "" {
+				workload.Kind = "project"
+				report.Containers.Projects++
+			} else {
+				workload.Kind = "function"
+				report.Containers.Functions++
+			}
+			workloads[container.ID] = workload
+			report.Containers.Total++
+			if container.State == "running" {
+				report.Containers.Running++
+				running = append(running, container.ID)
+			}
+		}
+	}
+
+	// Add up the CPU and memory used by the running ones
+	if len(running) > 0 {
+		stats, err := collectDockerStats(running)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+		for _, stat := range stats {
+			workload, ok := workloads[stat.ID]
+			if !ok {
+				// docker stats prints truncated IDs
+				for id, candidate := range workloads {
+					if strings.HasPrefix(id, stat.ID) {
+						workload, ok = candidate, true
+						break
+					}
+				}
+			}
+			if !ok {
+				continue
+			}
+			workload.CPUPercent, _ = strconv.ParseFloat(strings.TrimSuffix(stat.CPUPerc, "%"), 64)
+			memory := strings.TrimSpace(strings.SplitN(stat.MemUsage, "/", 2)[0])
+			workload.MemoryBytes, _ = parseDockerSize(memory)
+
+			report.CPUPercent += workload.CPUPercent
+			report.MemoryBytes += workload.MemoryBytes
+			report.Workloads = append(report.Workloads, workload)
+		}
+	}
+
+	// Count the images, and the size of the ones built for projects
+	if output, err := exec.Command("docker", "images", "-q").Output(); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to list images: %v", err))
+	} else {
+		report.Images.Total = len(strings.Fields(string(output)))
+	}
+	output, err := exec.Command("docker", "images", "--format", "{{json .}}", "--filter", "label="+projectLabel).Output()
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to list project images: %v", err))
+	} else {
+		for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			var image dockerImage
+			if line == "" || json.Unmarshal([]byte(line), &image) != nil {
+				continue
+			}
+			report.Images.Projects++
+			size, _ := parseDockerSize(image.Size)
+			report.Images.ProjectsSizeBytes += size
+		}
+	}
+
+	// Sum the files of all uploaded projects
+	diskBytes, err := directorySize(projectsDir)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to measure projects directory: %v", err))
+	}
+	report.ProjectsDiskBytes = diskBytes
+
+	return report
+}
+
+// listDockerContainers lists all containers, running or not, that have a label
+func listDockerContainers(label string) ([]dockerContainer, error) {
+	output, err := exec.Command("docker", "ps", "-a", "--no-trunc", "--format", "{{json .}}", "--filter", "label="+label).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers labelled %s: %v", label, err)
+	}
+
+	var containers []dockerContainer
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if line == "" {
+			continue
+		}
+		var container dockerContainer
+		if err := json.Unmarshal([]byte(line), &container); err != nil {
+			return nil, fmt.Errorf("failed to parse container list: %v", err)
+		}
+		containers = append(containers, container)
+	}
+	return containers, nil
+}
+
+// collectDockerStats takes one sample of the resource usage of running containers
+func collectDockerStats(containerIDs []string) ([]dockerStats, error) {
+	args := append([]string{"stats", "--no-stream", "--format", "{{json .}}"}, containerIDs...)
+	output, err := exec.Command("docker", args...).Output()
+	if err != nil {
+		// A container stopping between listing and sampling fails the whole command
+		return nil, fmt.Errorf("failed to collect container stats: %v", err)
+	}
+
+	var stats []dockerStats
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		var stat dockerStats
+		if line == "" || json.Unmarshal([]byte(line), &stat) != nil {
+			continue
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// parseDockerLabels parses the comma separated labels printed by docker ps
+func parseDockerLabels(value string) map[string]string {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		if key, val, ok := strings.Cut(pair, "="); ok {
+			labels[key] = val
+		}
+	}
+	return labels
+}
+
+// parseDockerSize parses a size printed by docker, e.g. 21.4MiB or 125MB, into bytes
+func parseDockerSize(value string) (int64, error) {
+	match := dockerSizePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	multiplier, ok := dockerSizeUnits[strings.ToLower(match[2])]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit in %q", value)
+	}
+	number, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return int64(number * multiplier), nil
+}
+
+// directorySize returns the total size of the regular files in a directory tree
+func directorySize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
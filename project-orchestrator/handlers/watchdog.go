@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Pipeline phases guarded by a watchdog
+const (
+	PhaseBuild  = "build"
+	PhaseDeploy = "deploy"
+)
+
+// Time budgets for a project's build and deploy phases, including retries.
+// They can be configured with the BUILD_TIMEOUT and DEPLOY_TIMEOUT environment variables.
+var (
+	BuildTimeout  = 20 * time.Minute
+	DeployTimeout = 10 * time.Minute
+)
+
+func init() {
+	if value := os.Getenv("BUILD_TIMEOUT"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			BuildTimeout = parsed
+		} else {
+			log.Printf("Invalid BUILD_TIMEOUT %q, using default %s", value, BuildTimeout)
+		}
+	}
+	if value := os.Getenv("DEPLOY_TIMEOUT"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			DeployTimeout = parsed
+		} else {
+			log.Printf("Invalid DEPLOY_TIMEOUT %q, using default %s", value, DeployTimeout)
+		}
+	}
+}
+
+// Watchdog enforces a time budget on a project's build or deploy phase. When the
+// budget is exceeded or the phase is cancelled, the commands it tracks are killed
+// and no new ones are started.
+type Watchdog struct {
+	projectDir string
+	phase      string
+	budget     time.Duration
+	timer      *time.Timer
+	done       chan struct{}
+
+	mu        sync.Mutex
+	commands  map[*exec.Cmd]struct{}
+	expired   bool
+	cancelled bool
+}
+
+// watchdogKey is the context key of the watchdog guarding a phase
+type watchdogKey struct{}
+
+// StartWatchdog starts enforcing a time budget on a project's phase, which is also
+// stopped when ctx is cancelled. Commands run with runCommand and the returned context
+// are tracked until Stop is called.
+func StartWatchdog(ctx context.Context, projectDir string, phase string, budget time.Duration) (context.Context, *Watchdog) {
+	watchdog := &Watchdog{
+		projectDir: projectDir,
+		phase:      phase,
+		budget:     budget,
+		done:       make(chan struct{}),
+		commands:   make(map[*exec.Cmd]struct{}),
+	}
+	watchdog.timer = time.AfterFunc(budget, watchdog.expire)
+	go func() {
+		select {
+		case <-ctx.Done():
+			watchdog.cancel()
+		case <-watchdog.done:
+		}
+	}()
+
+	return context.WithValue(ctx, watchdogKey{}, watchdog), watchdog
+}
+
+// Stop ends the watchdog without affecting running commands
+func (w *Watchdog) Stop() {
+	w.timer.Stop()
+	close(w.done)
+}
+
+// expire kills the commands still running once the budget is exceeded
+func (w *Watchdog) expire() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.expired {
+		return
+	}
+	w.expired = true
+	log.Printf("Watchdog: %s of project in %s exceeded %s, killing %d running commands",
+		w.phase, w.projectDir, w.budget, len(w.commands))
+	w.killCommands()
+}
+
+// cancel kills the commands still running once the phase is cancelled
+func (w *Watchdog) cancel() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.expired {
+		return
+	}
+	w.expired = true
+	w.cancelled = true
+	log.Printf("Watchdog: %s of project in %s was cancelled, killing %d running commands",
+		w.phase, w.projectDir, len(w.commands))
+	w.killCommands()
+}
+
+// killCommands kills the tracked commands. Callers hold w.mu.
+func (w *Watchdog) killCommands() {
+	for cmd := range w.commands {
+		if cmd.Process != nil {
+			cmd.Process.Kill()
+		}
+	}
+}
+
+// stopError describes why the phase was stopped. Callers hold w.mu.
+func (w *Watchdog) stopError() error {
+	if w.cancelled {
+		return newDeployError(Cancelled, "%s was cancelled", w.phase)
+	}
+	return newDeployError(Timeout, "%s timed out after %s", w.phase, w.budget)
+}
+
+// start starts a command and tracks it, refusing once the budget is exceeded
+func (w *Watchdog) start(cmd *exec.Cmd) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.expired {
+		return w.stopError()
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	w.commands[cmd] = struct{}{}
+	return nil
+}
+
+// finish stops tracking a command and returns why it was killed by the watchdog, if it was
+func (w *Watchdog) finish(cmd *exec.Cmd) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	delete(w.commands, cmd)
+	if w.expired {
+		return w.stopError()
+	}
+	return nil
+}
+
+// runCommand runs a command under the watchdog of ctx, if any. A command killed because
+// ctx was cancelled fails with a Cancelled error.
+func runCommand(ctx context.Context, cmd *exec.Cmd) error {
+	watchdog, _ := ctx.Value(watchdogKey{}).(*Watchdog)
+	if watchdog == nil {
+		err := cmd.Run()
+		if err != nil && ctx.Err() != nil {
+			return newDeployError(Cancelled, "command was cancelled")
+		}
+		return err
+	}
+
+	if err := watchdog.start(cmd); err != nil {
+		return err
+	}
+	err := cmd.Wait()
+	if stopErr := watchdog.finish(cmd); stopErr != nil {
+		return stopErr
+	}
+	if err != nil && ctx.Err() != nil {
+		return newDeployError(Cancelled, "%s was cancelled", watchdog.phase)
+	}
+	return err
+}
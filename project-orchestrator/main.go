@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -21,24 +23,41 @@ import (
 
 // ProjectResponse represents the API response for a project
 type ProjectResponse struct {
-	Name        string                 `json:"name"`
-	Status      string                 `json:"status"`
-	Services    map[string]ServiceInfo `json:"services"`
-	CreatedAt   string                 `json:"createdAt"`
-	UpdatedAt   string                 `json:"updatedAt"`
-	Description string                 `json:"description,omitempty"`
-	UserID      string                 `json:"user_id,omitempty"`
-	Username    string                 `json:"username,omitempty"`
+	Name          string                 `json:"name"`
+	Status        string                 `json:"status"`
+	Services      map[string]ServiceInfo `json:"services"`
+	CreatedAt     string                 `json:"createdAt"`
+	UpdatedAt     string                 `json:"updatedAt"`
+	Description   string                 `json:"description,omitempty"`
+	UserID        string                 `json:"user_id,omitempty"`
+	Username      string                 `json:"username,omitempty"`
+	Resources     *models.ResourceUsage  `json:"resources,omitempty"`     // Quota and aggregate allocation
+	Error         string                 `json:"error,omitempty"`         // Last build or deploy error
+	ErrorKind     string                 `json:"errorKind,omitempty"`     // user, infra, transient, timeout or cancelled
+	ErrorStatus   int                    `json:"errorStatus,omitempty"`   // HTTP status matching the error kind
+	Collaborators []models.Collaborator  `json:"collaborators,omitempty"` // Users the project is shared with
 }
 
 // ServiceInfo represents the API response for a service
 type ServiceInfo struct {
-	Type      string `json:"type"`
-	Status    string `json:"status"`
-	URL       string `json:"url,omitempty"` // Internal URL (will be deprecated)
-	Port      int    `json:"port,omitempty"`
-	PublicURL string `json:"publicUrl,omitempty"` // Public URL via NGINX
-	Subdomain string `json:"subdomain,omitempty"` // Subdomain for the service
+	Type          string                 `json:"type"`
+	Status        string                 `json:"status"`
+	URL           string                 `json:"url,omitempty"` // Internal URL (will be deprecated)
+	Port          int                    `json:"port,omitempty"`
+	PublicURL     string                 `json:"publicUrl,omitempty"`     // Public URL via NGINX
+	Subdomain     string                 `json:"subdomain,omitempty"`     // Subdomain for the service
+	Endpoint      string                 `json:"tcpEndpoint,omitempty"`   // Public host:port for tcp services
+	Image         string                 `json:"image,omitempty"`         // Tagged image the service runs
+	Routing       string                 `json:"routing,omitempty"`       // routed, skipped or failed
+	RoutingReason string                 `json:"routingReason,omitempty"` // Why the service has no public route
+	Health        string                 `json:"health,omitempty"`        // starting, healthy or unhealthy for images with a HEALTHCHECK
+	Processes     map[string]ProcessInfo `json:"processes,omitempty"`     // Additional processes run from the service's image
+}
+
+// ProcessInfo represents a process of a service in API responses
+type ProcessInfo struct {
+	Command string `json:"command"`
+	Status  string `json:"status"`
 }
 
 // Global variables
@@ -53,12 +72,15 @@ var (
 func initNginxConfig() {
 	configDir := "/app/proxy/nginx/conf"
 	nginxConfig = proxy.NewNginxConfig(configDir)
+	if err := nginxConfig.EnsureNotFoundConfig(); err != nil {
+		log.Printf("Warning: failed to write not found page config: %v", err)
+	}
 	log.Printf("Initialized NGINX configuration manager with config directory: %s", configDir)
 }
 
 // initDNSManager initializes the DNS manager
 func initDNSManager() {
-	dnsManager = dns.NewDNSManager()
+	dnsManager = dns.NewDNSManager(proxy.BaseDomain)
 
 	// Ensure the zone file exists
 	if err := dnsManager.EnsureZoneFile(); err != nil {
@@ -69,9 +91,13 @@ func initDNSManager() {
 }
 
 // processProject handles the building and deployment of a project
-func processProject(projectName, projectDir string, userID, username string) {
+func processProject(projectName, projectDir string, userID, username string, version string) {
 	log.Printf("Processing project %s in directory %s", projectName, projectDir)
 
+	// Let the user cancel the build and deployment
+	ctx, done := beginDeployment(projectDir, userID, projectName)
+	defer done()
+
 	// Look for project manifest
 	manifest, err := models.LoadManifest(projectDir)
 	if err != nil {
@@ -97,14 +123,33 @@ func processProject(projectName, projectDir string, userID, username string) {
 	if manifest.Name != "" {
 		projectName = manifest.Name
 		log.Printf("Using manifest name as project name: %s", projectName)
+		addDeploymentName(projectDir, projectName)
 	}
 
-	// Build the project with user information
-	project, err := handlers.BuildHandler(projectDir, manifest, userID, username)
+	// Wait for another build or deployment of the same project to finish first
+	unlock, err := lockDeploy(ctx, userID, projectName)
 	if err != nil {
-		log.Printf("Error building project: %v", err)
+		log.Printf("Deployment of project %s was cancelled while waiting for another one: %v", projectName, err)
 		return
 	}
+	defer unlock()
+
+	// Build the project with user information, retrying temporary failures within the build budget
+	var project *models.Project
+	buildCtx, watchdog := handlers.StartWatchdog(ctx, projectDir, handlers.PhaseBuild, handlers.BuildTimeout)
+	err = retryTransient(ctx, fmt.Sprintf("build of project %s", projectName), func() error {
+		var buildErr error
+		project, buildErr = handlers.BuildHandler(buildCtx, projectDir, manifest, userID, username)
+		return buildErr
+	})
+	watchdog.Stop()
+	if err != nil {
+		kind := handlers.ErrorKindOf(err)
+		log.Printf("Error building project (%s error, status %d): %v", kind, handlers.StatusCode(kind), err)
+		if project == nil {
+			return
+		}
+	}
 
 	// Ensure project name is consistent with manifest
 	project.Name = manifest.Name
@@ -113,18 +158,40 @@ func processProject(projectName, projectDir string, userID, username string) {
 	// Set user information
 	project.UserID = userID
 	project.Username = username
+	project.Version = version
 	log.Printf("Setting project owner: user ID %s, username %s", userID, username)
 
 	// Add to active projects using a user-specific key format
 	projectsMutex.Lock()
 	// Create a key that includes both user ID and project name to ensure uniqueness across users
 	projectKey := fmt.Sprintf("%s:%s", userID, project.Name)
+	// Redeploying keeps the project shared with the same collaborators
+	if previous, exists := activeProjects[projectKey]; exists {
+		project.Collaborators = previous.Collaborators
+	}
 	activeProjects[projectKey] = project
 	projectsMutex.Unlock()
 	log.Printf("Added project to activeProjects with key: %s", projectKey)
 
+	// Stop before deploying a cancelled project
+	if ctx.Err() != nil {
+		cleanupCancelledDeployment(project, "build was cancelled")
+		return
+	}
+
+	// Record a failed build so the user can see why
+	if err != nil {
+		projectsMutex.Lock()
+		project.Status = "failed"
+		project.Error = err.Error()
+		project.ErrorKind = string(handlers.ErrorKindOf(err))
+		projectsMutex.Unlock()
+		saveProjectStatus(project)
+		return
+	}
+
 	// Deploy the project
-	if err := handlers.DeployHandler(project); err != nil {
+	if err := deployProject(ctx, project); err != nil {
 		log.Printf("Error deploying project: %v", err)
 		return
 	}
@@ -132,6 +199,64 @@ func processProject(projectName, projectDir string, userID, username string) {
 	log.Printf("Project %s deployed successfully", projectName)
 }
 
+// Retry policy for transient build and deploy failures
+const (
+	transientRetries    = 3
+	transientRetryDelay = 5 * time.Second
+)
+
+// retryTransient runs op, retrying with a growing delay while it fails with a transient error
+// and ctx isn't cancelled
+func retryTransient(ctx context.Context, description string, op func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !handlers.IsTransient(err) || attempt == transientRetries {
+			return err
+		}
+
+		delay := transientRetryDelay * time.Duration(attempt)
+		log.Printf("Transient failure in %s (attempt %d/%d), retrying in %s: %v",
+			description, attempt, transientRetries, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// deployProject deploys a project, retrying transient failures within the deploy budget,
+// and records the outcome on the project. A cancelled deployment is cleaned up.
+func deployProject(ctx context.Context, project *models.Project) error {
+	deployCtx, watchdog := handlers.StartWatchdog(ctx, project.Path, handlers.PhaseDeploy, handlers.DeployTimeout)
+	err := retryTransient(ctx, fmt.Sprintf("deployment of project %s", project.Name), func() error {
+		return handlers.DeployHandler(deployCtx, project)
+	})
+	watchdog.Stop()
+
+	if ctx.Err() != nil {
+		cleanupCancelledDeployment(project, "deployment was cancelled")
+		return ctx.Err()
+	}
+
+	projectsMutex.Lock()
+	if err != nil {
+		project.Error = err.Error()
+		project.ErrorKind = string(handlers.ErrorKindOf(err))
+	} else {
+		project.Error = ""
+		project.ErrorKind = ""
+	}
+	projectsMutex.Unlock()
+
+	if err != nil {
+		kind := handlers.ErrorKindOf(err)
+		log.Printf("Deployment of project %s failed with a %s error (status %d)", project.Name, kind, handlers.StatusCode(kind))
+		saveProjectStatus(project)
+	}
+	return err
+}
+
 // loadExistingProjects loads projects from the projects directory
 func loadExistingProjects() {
 	log.Println("Loading existing projects...")
@@ -184,6 +309,8 @@ func loadExistingProjects() {
 
 						// Store the directory name in the project for reference
 						project.Path = projectDir
+						rememberNotifiedStatus(&project)
+						failInterruptedProject(&project)
 
 						// Ensure user information is set
 						if project.UserID == "" {
@@ -237,6 +364,8 @@ func loadExistingProjects() {
 
 					// Store the directory name in the project for reference
 					project.Path = projectDir
+					rememberNotifiedStatus(&project)
+					failInterruptedProject(&project)
 
 					projectsMutex.Lock()
 					log.Printf("Loading legacy project from directory %s with manifest name %s", projectName, project.Name)
@@ -252,6 +381,20 @@ func loadExistingProjects() {
 	log.Printf("Loaded %d existing projects", len(activeProjects))
 }
 
+// failInterruptedProject marks a project that was building or deploying when the
+// orchestrator stopped as failed, since nothing will resume it
+func failInterruptedProject(project *models.Project) {
+	if project.Status != "building" && project.Status != "deploying" {
+		return
+	}
+
+	log.Printf("Project %s was interrupted while %s, marking it as failed", project.Name, project.Status)
+	project.Error = fmt.Sprintf("interrupted while %s by an orchestrator restart", project.Status)
+	project.ErrorKind = string(handlers.InfraError)
+	project.Status = "failed"
+	saveProjectStatus(project)
+}
+
 // isUserDirectory checks if a directory is a user directory by looking for project subdirectories
 func isUserDirectory(dirPath string) bool {
 	entries, err := os.ReadDir(dirPath)
@@ -287,23 +430,32 @@ func getProjectNames() []string {
 // projectToResponse converts a Project to a ProjectResponse
 func projectToResponse(project *models.Project) ProjectResponse {
 	response := ProjectResponse{
-		Name:        project.Name,
-		CreatedAt:   project.CreatedAt.Format(time.RFC3339),
-		UpdatedAt:   project.UpdatedAt.Format(time.RFC3339),
-		Description: project.Manifest.Description,
-		UserID:      project.UserID,
-		Username:    project.Username,
-		Services:    make(map[string]ServiceInfo),
+		Name:          project.Name,
+		CreatedAt:     project.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:     project.UpdatedAt.Format(time.RFC3339),
+		Description:   project.Manifest.Description,
+		UserID:        project.UserID,
+		Username:      project.Username,
+		Services:      make(map[string]ServiceInfo),
+		Resources:     project.Resources,
+		Error:         project.Error,
+		ErrorKind:     project.ErrorKind,
+		Collaborators: project.Collaborators,
+	}
+	if project.ErrorKind != "" {
+		response.ErrorStatus = handlers.StatusCode(handlers.ErrorKind(project.ErrorKind))
 	}
 
 	// Verify container status if project is marked as running
+	serviceHealth := make(map[string]string)
 	if project.Status == "running" {
 		allRunning := true
 
 		// Check if all service containers are running
 		for name, service := range project.Services {
 			if service.ContainerID != "" {
-				isRunning := handlers.IsContainerRunning(service.ContainerID)
+				isRunning, health := handlers.ContainerStatus(service.ContainerID)
+				serviceHealth[name] = health
 				if !isRunning {
 					log.Printf("Service %s container %s is not running", name, service.ContainerID)
 					allRunning = false
@@ -332,12 +484,31 @@ func projectToResponse(project *models.Project) ProjectResponse {
 	// Convert services
 	for name, service := range project.Services {
 		response.Services[name] = ServiceInfo{
-			Type:      service.Type,
-			Status:    service.Status,
-			URL:       service.URL,
-			Port:      service.Port,
-			PublicURL: service.PublicURL,
-			Subdomain: service.Subdomain,
+			Type:          service.Type,
+			Status:        service.Status,
+			URL:           service.URL,
+			Port:          service.Port,
+			PublicURL:     service.PublicURL,
+			Subdomain:     service.Subdomain,
+			Endpoint:      service.TCPEndpoint,
+			Image:         service.Image,
+			Routing:       service.Routing,
+			RoutingReason: service.RoutingReason,
+			Health:        serviceHealth[name],
+		}
+		// Running containers failing their image's HEALTHCHECK aren't ready to serve
+		if serviceHealth[name] == handlers.HealthUnhealthy && service.Status == "running" {
+			info := response.Services[name]
+			info.Status = handlers.HealthUnhealthy
+			response.Services[name] = info
+		}
+		if len(service.Processes) > 0 {
+			info := response.Services[name]
+			info.Processes = make(map[string]ProcessInfo, len(service.Processes))
+			for process, status := range service.Processes {
+				info.Processes[process] = ProcessInfo{Command: status.Command, Status: status.Status}
+			}
+			response.Services[name] = info
 		}
 	}
 
@@ -364,17 +535,72 @@ func saveProjectStatus(project *models.Project) error {
 		return err
 	}
 
-	// Write to the status file
-	err = os.WriteFile(statusFile, data, 0644)
+	// Write to the status file atomically
+	err = handlers.WriteStatusFile(statusFile, data)
 	if err != nil {
 		log.Printf("Error writing status file for project %s: %v", project.Name, err)
 		return err
 	}
 
 	log.Printf("Updated status file for project %s", project.Name)
+
+	// Tell the project's webhook when its status changed
+	notifyStatusChange(project)
 	return nil
 }
 
+// allowedMethods returns the HTTP methods supported by an orchestrator route
+func allowedMethods(path string) []string {
+	switch {
+	case path == "/health":
+		return []string{http.MethodGet}
+	case path == "/upload":
+		return []string{http.MethodPost}
+	case path == "/projects", path == "/admin/usage":
+		return []string{http.MethodGet}
+	case path == "/projects/import", path == "/admin/warm-images", path == "/admin/nginx/reconcile", path == "/validate-manifest":
+		return []string{http.MethodPost}
+	case path == "/secrets":
+		return []string{http.MethodGet}
+	case path == "/admin/networks":
+		return []string{http.MethodGet, http.MethodDelete}
+	case strings.HasPrefix(path, "/admin/networks/"):
+		return []string{http.MethodDelete}
+	case strings.HasPrefix(path, "/secrets/"):
+		return []string{http.MethodPut, http.MethodDelete}
+	case strings.HasPrefix(path, "/projects/"):
+		parts := strings.Split(strings.TrimPrefix(path, "/projects/"), "/")
+		if len(parts) > 1 {
+			switch parts[1] {
+			case "stop", "start", "pause", "resume", "cancel":
+				return []string{http.MethodPost}
+			case "export", "urls", "services":
+				return []string{http.MethodGet}
+			case "collaborators":
+				if len(parts) > 2 {
+					return []string{http.MethodPut, http.MethodDelete}
+				}
+				return []string{http.MethodGet}
+			}
+		}
+		return []string{http.MethodGet, http.MethodDelete}
+	}
+	return nil
+}
+
+// setAllowHeader advertises the methods supported by the requested route
+func setAllowHeader(w http.ResponseWriter, r *http.Request) {
+	if methods := allowedMethods(r.URL.Path); len(methods) > 0 {
+		w.Header().Set("Allow", strings.Join(append(methods, http.MethodOptions), ", "))
+	}
+}
+
+// methodNotAllowed writes a 405 response including the route's Allow header
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	setAllowHeader(w, r)
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
+
 // CORS middleware to handle cross-origin requests
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -385,6 +611,7 @@ func corsMiddleware(next http.Handler) http.Handler {
 
 		// Handle preflight requests
 		if r.Method == "OPTIONS" {
+			setAllowHeader(w, r)
 			w.WriteHeader(http.StatusOK)
 			return
 		}
@@ -402,6 +629,12 @@ func main() {
 		log.Fatalf("Failed to create projects directory: %v", err)
 	}
 
+	// Projects are served on subdomains of the base domain
+	if err := proxy.ValidateBaseDomain(proxy.BaseDomain); err != nil {
+		log.Fatalf("Invalid PLATFORM_BASE_DOMAIN: %v", err)
+	}
+	log.Printf("Using base domain %s", proxy.BaseDomain)
+
 	// Load existing projects
 	loadExistingProjects()
 
@@ -411,6 +644,9 @@ func main() {
 	// Initialize DNS manager
 	initDNSManager()
 
+	// Initialize the provider secret references are resolved through
+	initSecretProvider()
+
 	// Set up HTTP server
 	mux := http.NewServeMux()
 
@@ -421,6 +657,17 @@ func main() {
 	mux.Handle("/upload", corsMiddleware(auth.AuthMiddleware(http.HandlerFunc(uploadProjectHandler))))
 	mux.Handle("/projects", corsMiddleware(auth.AuthMiddleware(http.HandlerFunc(listProjectsHandler))))
 	mux.Handle("/projects/", corsMiddleware(auth.AuthMiddleware(http.HandlerFunc(projectHandler))))
+	mux.Handle("/admin/warm-images", corsMiddleware(auth.AdminMiddleware(http.HandlerFunc(warmImagesHandler))))
+	mux.Handle("/admin/nginx/reconcile", corsMiddleware(auth.AdminMiddleware(http.HandlerFunc(reconcileNginxHandler))))
+	mux.Handle("/admin/usage", corsMiddleware(auth.AdminMiddleware(http.HandlerFunc(usageHandler))))
+	mux.Handle("/admin/networks", corsMiddleware(auth.AdminMiddleware(http.HandlerFunc(networksHandler))))
+	mux.Handle("/admin/networks/", corsMiddleware(auth.AdminMiddleware(http.HandlerFunc(networksHandler))))
+	mux.Handle("/validate-manifest", corsMiddleware(auth.AuthMiddleware(http.HandlerFunc(validateManifestHandler))))
+	mux.Handle("/secrets", corsMiddleware(auth.AuthMiddleware(http.HandlerFunc(secretsHandler))))
+	mux.Handle("/secrets/", corsMiddleware(auth.AuthMiddleware(http.HandlerFunc(secretsHandler))))
+
+	// Keep common base images pulled so builds don't wait on them
+	handlers.StartBaseImageWarmer()
 
 	// Set the NGINX manager in the handlers package
 	handlers.SetNginxManager(nginxConfig)
@@ -437,6 +684,256 @@ func main() {
 	log.Fatal(http.ListenAndServe(":"+port, corsMiddleware(mux)))
 }
 
+// warmImagesHandler pulls the common base images on demand and reports the result
+func warmImagesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r)
+		return
+	}
+
+	results := handlers.WarmBaseImages()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"images": results,
+	})
+}
+
+// usageHandler reports the resources used by all deployed workloads, for capacity planning
+func usageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r)
+		return
+	}
+
+	report := handlers.PlatformUsage("./projects")
+	for _, err := range report.Errors {
+		log.Printf("Warning: incomplete usage report: %s", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// networksHandler manages the Docker networks created by the platform: GET /admin/networks
+// lists them, DELETE /admin/networks removes every orphaned one and DELETE
+// /admin/networks/{name} removes one if it is orphaned
+func networksHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/admin/networks")
+	name = strings.TrimPrefix(name, "/")
+	if r.Method != http.MethodDelete && (r.Method != http.MethodGet || name != "") {
+		methodNotAllowed(w, r)
+		return
+	}
+
+	networks, err := handlers.ListPlatformNetworks(projectExists)
+	if err != nil {
+		log.Printf("Error listing networks: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"networks": networks,
+		})
+		return
+	}
+
+	// Only orphaned networks are removed, a named one must exist and be orphaned
+	var orphaned []handlers.PlatformNetwork
+	found := false
+	for _, network := range networks {
+		if name != "" && network.Name != name {
+			continue
+		}
+		found = true
+		if network.Orphaned {
+			orphaned = append(orphaned, network)
+		}
+	}
+	if name != "" && !found {
+		http.Error(w, fmt.Sprintf("Network %s is not a platform network", name), http.StatusNotFound)
+		return
+	}
+	if name != "" && len(orphaned) == 0 {
+		http.Error(w, fmt.Sprintf("Network %s is still used by the platform", name), http.StatusConflict)
+		return
+	}
+
+	removed := []string{}
+	failures := []string{}
+	for _, network := range orphaned {
+		if err := handlers.RemoveNetwork(network.Name); err != nil {
+			log.Printf("Error removing orphaned network %s: %v", network.Name, err)
+			failures = append(failures, err.Error())
+			continue
+		}
+		removed = append(removed, network.Name)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"removed": removed,
+		"errors":  failures,
+	})
+}
+
+// projectExists reports whether any user has a project with the given name, whose
+// network is then in use
+func projectExists(name string) bool {
+	projectsMutex.RLock()
+	defer projectsMutex.RUnlock()
+	for _, project := range activeProjects {
+		if project.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// reconcileNginxHandler regenerates the NGINX configuration of every active project from its
+// service status, removes orphaned configuration files and reloads NGINX
+func reconcileNginxHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r)
+		return
+	}
+	if nginxConfig == nil {
+		http.Error(w, "NGINX manager not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Collect the mappings each project should have
+	projectsMutex.RLock()
+	var desired []proxy.ReconcileProject
+	for _, project := range activeProjects {
+		desired = append(desired, reconcileStateOf(project))
+	}
+	projectsMutex.RUnlock()
+
+	report, err := nginxConfig.Reconcile(desired)
+	if err != nil {
+		log.Printf("Error reconciling NGINX configuration: %v", err)
+		report.Errors = append(report.Errors, err.Error())
+	}
+
+	// Record TCP endpoints whose public port changed
+	projectsMutex.Lock()
+	var changed []*models.Project
+	for _, project := range activeProjects {
+		updated := false
+		for name, service := range project.Services {
+			port, ok := report.StreamPorts[project.Name+"/"+name]
+			if !ok {
+				continue
+			}
+			endpoint := fmt.Sprintf("%s:%d", proxy.GenerateProjectDomain(project.Name), port)
+			if service.TCPEndpoint != endpoint {
+				service.TCPEndpoint = endpoint
+				project.Services[name] = service
+				updated = true
+			}
+		}
+		if updated {
+			changed = append(changed, project)
+		}
+	}
+	projectsMutex.Unlock()
+	for _, project := range changed {
+		saveProjectStatus(project)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// reconcileStateOf describes the NGINX mappings a project's services should have
+func reconcileStateOf(project *models.Project) proxy.ReconcileProject {
+	state := proxy.ReconcileProject{
+		Name:        project.Name,
+		Paused:      project.Status == "paused",
+		ErrorPages:  handlers.ErrorPagesFor(project),
+		HealthCheck: handlers.HealthCheckFor(project),
+		Snippets:    handlers.NginxSnippetsFor(project),
+	}
+
+	for name, service := range project.Services {
+		containerName := fmt.Sprintf("project-%s-%s", project.Name, name)
+		switch {
+		case service.Type == "tcp" && service.TCPEndpoint != "":
+			state.Services = append(state.Services, proxy.ReconcileService{
+				Name:          name,
+				ContainerName: containerName,
+				Port:          service.Port,
+				TCP:           true,
+			})
+		case service.Subdomain != "":
+			// Same port the deployment mapped: the one the service was deployed with
+			state.Services = append(state.Services, proxy.ReconcileService{
+				Name:          name,
+				ContainerName: containerName,
+				Port:          service.Port,
+			})
+		}
+	}
+	return state
+}
+
+// Maximum size of a manifest accepted by the validation endpoint
+const maxManifestSize = 1 << 20
+
+// ManifestValidationResponse reports the problems found in a manifest
+type ManifestValidationResponse struct {
+	Valid    bool                     `json:"valid"`
+	Name     string                   `json:"name,omitempty"`
+	Warnings []string                 `json:"warnings"`
+	Errors   []models.ValidationError `json:"errors"`
+}
+
+// validateManifestHandler checks a raw project.yaml, or project.json sent as JSON, without
+// uploading a project, so editors and CI can lint manifests. Service directories aren't
+// checked.
+func validateManifestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxManifestSize))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Manifest must not exceed %d bytes", maxManifestSize), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	response := ManifestValidationResponse{
+		Warnings: []string{},
+		Errors:   []models.ValidationError{},
+	}
+
+	// A project.json manifest is sent as JSON
+	parse := models.ParseManifest
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		parse = models.ParseJSONManifest
+	}
+	manifest, err := parse(data)
+	if err != nil {
+		response.Errors = append(response.Errors, models.ValidationError{Field: "manifest", Message: err.Error()})
+	} else {
+		warnings, errors := models.ValidateManifest(manifest, "")
+		response.Name = manifest.Name
+		response.Warnings = append(response.Warnings, warnings...)
+		response.Errors = append(response.Errors, errors...)
+	}
+	response.Valid = len(response.Errors) == 0
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // healthCheckHandler returns a simple health check response
 func healthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -449,11 +946,12 @@ func uploadProjectHandler(w http.ResponseWriter, r *http.Request) {
 	userID := auth.GetUserID(r)
 	username := auth.GetUsername(r)
 	if userID == "" {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
+		handlers.WriteUploadError(w, http.StatusBadRequest, "user", "User ID is required")
 		return
 	}
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		setAllowHeader(w, r)
+		handlers.WriteUploadError(w, http.StatusMethodNotAllowed, "", "Method not allowed")
 		return
 	}
 
@@ -477,7 +975,7 @@ func uploadProjectHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Process the project asynchronously
-	go processProject(projectName, projectDir, userID, username)
+	go processProject(projectName, projectDir, userID, username, r.FormValue("version"))
 }
 
 // listProjectsHandler returns a list of all deployed projects
@@ -485,7 +983,7 @@ func listProjectsHandler(w http.ResponseWriter, r *http.Request) {
 	// Extract user ID from request headers
 	userID := auth.GetUserID(r)
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, r)
 		return
 	}
 
@@ -509,12 +1007,14 @@ func listProjectsHandler(w http.ResponseWriter, r *http.Request) {
 		// Include projects if and only if:
 		// 1. The project belongs to the current user (UserID field matches) OR
 		// 2. The project has a user-specific key for the current user OR
-		// 3. The project has no user ID (backward compatibility) AND is not in a user-specific directory
+		// 3. The project has no user ID (backward compatibility) AND is not in a user-specific directory OR
 		belongsToUser := project.UserID == userID
 		hasUserSpecificKey := len(keyParts) == 2 && keyParts[0] == userID
 		isLegacyProject := project.UserID == "" && len(keyParts) == 1
+		// 4. The project is shared with the current user
+		isShared := userID != "" && project.CollaboratorRole(userID) != ""
 
-		if belongsToUser || hasUserSpecificKey || isLegacyProject {
+		if belongsToUser || hasUserSpecificKey || isLegacyProject || isShared {
 			response := projectToResponse(project)
 
 			// If status changed, update the original project in the map
@@ -557,23 +1057,55 @@ func projectHandler(w http.ResponseWriter, r *http.Request) {
 
 	projectName := parts[0]
 
+	// Importing creates a new project rather than acting on an existing one
+	if projectName == "import" && len(parts) == 1 && r.Method == http.MethodPost {
+		importProjectHandler(w, r)
+		return
+	}
+
 	// Handle different HTTP methods
 	switch r.Method {
 	case http.MethodGet:
-		getProjectHandler(w, r, projectName)
+		if len(parts) > 1 && parts[1] == "export" {
+			exportProjectHandler(w, r, projectName)
+		} else if len(parts) > 1 && parts[1] == "urls" {
+			projectURLsHandler(w, r, projectName)
+		} else if len(parts) == 4 && parts[1] == "services" && parts[3] == "network" {
+			serviceNetworkHandler(w, r, projectName, parts[2])
+		} else if len(parts) == 2 && parts[1] == "collaborators" {
+			listCollaboratorsHandler(w, r, projectName)
+		} else {
+			getProjectHandler(w, r, projectName)
+		}
+	case http.MethodPut:
+		if len(parts) == 3 && parts[1] == "collaborators" && parts[2] != "" {
+			setCollaboratorHandler(w, r, projectName, parts[2])
+		} else {
+			methodNotAllowed(w, r)
+		}
 	case http.MethodDelete:
-		deleteProjectHandler(w, r, projectName)
+		if len(parts) == 3 && parts[1] == "collaborators" && parts[2] != "" {
+			removeCollaboratorHandler(w, r, projectName, parts[2])
+		} else {
+			deleteProjectHandler(w, r, projectName)
+		}
 	case http.MethodPost:
 		// Check for action in the URL path
 		if len(parts) > 1 && parts[1] == "stop" {
 			stopProjectHandler(w, r, projectName)
 		} else if len(parts) > 1 && parts[1] == "start" {
 			startProjectHandler(w, r, projectName)
+		} else if len(parts) > 1 && parts[1] == "pause" {
+			pauseProjectHandler(w, r, projectName)
+		} else if len(parts) > 1 && parts[1] == "resume" {
+			resumeProjectHandler(w, r, projectName)
+		} else if len(parts) > 1 && parts[1] == "cancel" {
+			cancelProjectHandler(w, r, projectName)
 		} else {
 			http.Error(w, "Invalid action", http.StatusBadRequest)
 		}
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, r)
 	}
 }
 
@@ -600,6 +1132,15 @@ func findProject(projectName string, userID string) (*models.Project, string, bo
 		}
 	}
 
+	// Then look for a project of another user shared with this one
+	if userID != "" {
+		for key, project := range activeProjects {
+			if project.Name == projectName && project.CollaboratorRole(userID) != "" {
+				return project, key, true
+			}
+		}
+	}
+
 	// For backward compatibility, try to find the project by its key without user prefix
 	if project, ok := activeProjects[projectName]; ok {
 		// If the project doesn't have a user ID or the user ID matches, return it
@@ -639,7 +1180,7 @@ func getProjectHandler(w http.ResponseWriter, r *http.Request, projectName strin
 	}
 
 	// Check if the user has permission to view this project
-	if project.UserID != "" && project.UserID != userID {
+	if !project.HasRole(userID, models.RoleViewer) {
 		http.Error(w, "You do not have permission to view this project", http.StatusForbidden)
 		return
 	}
@@ -649,6 +1190,203 @@ func getProjectHandler(w http.ResponseWriter, r *http.Request, projectName strin
 	json.NewEncoder(w).Encode(projectToResponse(project))
 }
 
+// exportProjectHandler streams a project's source and metadata as a zip archive
+func exportProjectHandler(w http.ResponseWriter, r *http.Request, projectName string) {
+	// Extract user ID from request headers
+	userID := auth.GetUserID(r)
+	log.Printf("Exporting project: %s", projectName)
+
+	// Find the project
+	project, _, exists := findProject(projectName, userID)
+
+	if !exists {
+		http.Error(w, fmt.Sprintf("Project %s not found", projectName), http.StatusNotFound)
+		return
+	}
+
+	// Check if the user has permission to export this project. Exports include the
+	// source with its .env files, so viewers can't export.
+	if !project.HasRole(userID, models.RoleEditor) {
+		http.Error(w, "You do not have permission to export this project", http.StatusForbidden)
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s.zip", project.Name, time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	// Headers are already sent once writing starts, so errors can only be logged
+	if err := handlers.ExportProject(w, project); err != nil {
+		log.Printf("Error exporting project %s: %v", project.Name, err)
+	}
+}
+
+// ServiceURLs represents the public endpoints of a service
+type ServiceURLs struct {
+	PublicURL   string `json:"publicUrl,omitempty"`
+	Subdomain   string `json:"subdomain,omitempty"`
+	TCPEndpoint string `json:"tcpEndpoint,omitempty"`
+	Mapped      bool   `json:"mapped"` // Whether the NGINX mapping currently exists
+}
+
+// ProjectURLsResponse represents the public URLs of a project and its services
+type ProjectURLsResponse struct {
+	Name       string                 `json:"name"`
+	Domain     string                 `json:"domain"`
+	ProjectURL string                 `json:"projectUrl,omitempty"`
+	Services   map[string]ServiceURLs `json:"services"`
+}
+
+// projectURLsHandler returns the public URLs of a project's services, verified against the NGINX mappings
+func projectURLsHandler(w http.ResponseWriter, r *http.Request, projectName string) {
+	// Extract user ID from request headers
+	userID := auth.GetUserID(r)
+
+	// Find the project
+	project, _, exists := findProject(projectName, userID)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Project %s not found", projectName), http.StatusNotFound)
+		return
+	}
+
+	// Check if the user has permission to view this project
+	if !project.HasRole(userID, models.RoleViewer) {
+		http.Error(w, "You do not have permission to view this project", http.StatusForbidden)
+		return
+	}
+
+	response := ProjectURLsResponse{
+		Name:     project.Name,
+		Domain:   proxy.GenerateProjectDomain(project.Name),
+		Services: make(map[string]ServiceURLs),
+	}
+
+	projectsMutex.RLock()
+	services := make(map[string]models.ServiceStatus, len(project.Services))
+	for name, service := range project.Services {
+		services[name] = service
+	}
+	projectsMutex.RUnlock()
+
+	// Only report URLs whose mappings still exist
+	if nginxConfig != nil && nginxConfig.ProjectConfigExists(project.Name) {
+		response.ProjectURL = fmt.Sprintf("http://%s", response.Domain)
+	}
+	for name, service := range services {
+		urls := ServiceURLs{}
+		if nginxConfig != nil && nginxConfig.MappingExists(project.Name, name) {
+			urls.Mapped = true
+			urls.PublicURL = service.PublicURL
+			urls.Subdomain = service.Subdomain
+			urls.TCPEndpoint = service.TCPEndpoint
+		} else if service.PublicURL != "" || service.TCPEndpoint != "" {
+			log.Printf("NGINX mapping for service %s of project %s is missing", name, project.Name)
+		}
+		response.Services[name] = urls
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// NetworkAttachment describes a container's address in a network
+type NetworkAttachment struct {
+	IPAddress  string   `json:"ipAddress"`
+	Gateway    string   `json:"gateway,omitempty"`
+	MacAddress string   `json:"macAddress,omitempty"`
+	Aliases    []string `json:"aliases,omitempty"`
+}
+
+// ServiceNetworkResponse reports the networks a service's container is attached to
+type ServiceNetworkResponse struct {
+	Project         string                       `json:"project"`
+	Service         string                       `json:"service"`
+	ContainerID     string                       `json:"containerId"`
+	ExpectedNetwork string                       `json:"expectedNetwork"` // Project network NGINX reaches the service on
+	Attached        bool                         `json:"attached"`        // Whether the container has an address in the expected network
+	Networks        map[string]NetworkAttachment `json:"networks"`
+}
+
+// serviceNetworkHandler reports the networks and addresses of a service's container,
+// to diagnose services the proxy can't reach
+func serviceNetworkHandler(w http.ResponseWriter, r *http.Request, projectName, serviceName string) {
+	// Extract user ID from request headers
+	userID := auth.GetUserID(r)
+
+	// Find the project
+	project, _, exists := findProject(projectName, userID)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Project %s not found", projectName), http.StatusNotFound)
+		return
+	}
+
+	// Check if the user has permission to view this project
+	if !project.HasRole(userID, models.RoleViewer) {
+		http.Error(w, "You do not have permission to view this project", http.StatusForbidden)
+		return
+	}
+
+	projectsMutex.RLock()
+	service, exists := project.Services[serviceName]
+	projectsMutex.RUnlock()
+	if !exists {
+		http.Error(w, fmt.Sprintf("Service %s not found in project %s", serviceName, projectName), http.StatusNotFound)
+		return
+	}
+	if service.ContainerID == "" {
+		http.Error(w, fmt.Sprintf("Service %s is not running", serviceName), http.StatusConflict)
+		return
+	}
+
+	info, err := handlers.InspectContainer(service.ContainerID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	response := ServiceNetworkResponse{
+		Project:         project.Name,
+		Service:         serviceName,
+		ContainerID:     service.ContainerID,
+		ExpectedNetwork: fmt.Sprintf("project-%s-network", project.Name),
+		Networks:        make(map[string]NetworkAttachment),
+	}
+	for name, network := range info.NetworkSettings.Networks {
+		response.Networks[name] = NetworkAttachment{
+			IPAddress:  network.IPAddress,
+			Gateway:    network.Gateway,
+			MacAddress: network.MacAddress,
+			Aliases:    network.Aliases,
+		}
+		if name == response.ExpectedNetwork && network.IPAddress != "" {
+			response.Attached = true
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// importProjectHandler recreates a project from an export archive and rebuilds it
+func importProjectHandler(w http.ResponseWriter, r *http.Request) {
+	// Extract user ID from request headers
+	userID := auth.GetUserID(r)
+	username := auth.GetUsername(r)
+	if userID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	projectName, projectDir, err := handlers.ImportHandler(w, r, userID)
+	if err != nil {
+		// Error is already handled by the ImportHandler
+		return
+	}
+
+	// Rebuild images and deploy the imported project asynchronously
+	go processProject(projectName, projectDir, userID, username, "")
+}
+
 // deleteProjectHandler deletes a project
 func deleteProjectHandler(w http.ResponseWriter, r *http.Request, projectName string) {
 	// Extract user ID from request headers
@@ -668,13 +1406,15 @@ func deleteProjectHandler(w http.ResponseWriter, r *http.Request, projectName st
 	}
 
 	// Check if the user has permission to delete this project
-	if project.UserID != "" && project.UserID != userID {
+	if !project.HasRole(userID, models.RoleOwner) {
 		http.Error(w, "You do not have permission to delete this project", http.StatusForbidden)
 		return
 	}
 
-	// Stop and remove all containers
-	for name, service := range project.Services {
+	// Stop and remove all containers, several services at a time
+	results := teardownServices(copyServices(project), func(name string, service models.ServiceStatus) []string {
+		var errs []string
+		handlers.RemoveProcessContainers(service)
 		if service.ContainerID != "" {
 			log.Printf("Stopping container %s for service %s", service.ContainerID, name)
 
@@ -682,28 +1422,36 @@ func deleteProjectHandler(w http.ResponseWriter, r *http.Request, projectName st
 			stopCmd := exec.Command("docker", "stop", service.ContainerID)
 			if err := stopCmd.Run(); err != nil {
 				log.Printf("Error stopping container %s: %v", service.ContainerID, err)
+				errs = append(errs, fmt.Sprintf("failed to stop container %s: %v", service.ContainerID, err))
 			}
 
 			// Remove the container
 			removeCmd := exec.Command("docker", "rm", "-f", service.ContainerID)
 			if err := removeCmd.Run(); err != nil {
 				log.Printf("Error removing container %s: %v", service.ContainerID, err)
+				errs = append(errs, fmt.Sprintf("failed to remove container %s: %v", service.ContainerID, err))
 			}
 
-			// Try to remove any associated images based on naming convention
-			if service.Type == "api" {
-				imageName := fmt.Sprintf("%s-%s:latest", project.Name, name)
-				log.Printf("Attempting to remove container image: %s", imageName)
-				removeImageCmd := exec.Command("docker", "rmi", "-f", imageName)
-				if err := removeImageCmd.Run(); err != nil {
-					log.Printf("Error removing image %s: %v (this may be normal if image doesn't exist)", imageName, err)
-				}
-			}
+			// Remove the service's images, including the ones kept for rollbacks
+			handlers.RemoveServiceImages(project.Name, name)
 		}
-	}
+		handlers.RemoveInitVolumes(project.Name, name)
+		return errs
+	})
 
 	// Remove NGINX configurations for all services
 	if nginxConfig != nil {
+		// Restore the mappings of a paused project so they are removed below
+		if project.Status == "paused" {
+			serviceNames := make([]string, 0, len(project.Services))
+			for name := range project.Services {
+				serviceNames = append(serviceNames, name)
+			}
+			if err := nginxConfig.ResumeProject(project.Name, serviceNames); err != nil {
+				log.Printf("Error restoring NGINX mappings for paused project %s: %v", project.Name, err)
+			}
+		}
+
 		log.Printf("Removing NGINX configurations for project %s", project.Name)
 		for name := range project.Services {
 			if err := nginxConfig.DeleteMapping(project.Name, name); err != nil {
@@ -774,35 +1522,8 @@ func deleteProjectHandler(w http.ResponseWriter, r *http.Request, projectName st
 		} else {
 			if strings.TrimSpace(string(output)) == networkName {
 				log.Printf("Network %s found, attempting to disconnect containers", networkName)
-
-				// First disconnect the NGINX container from the network
-				disconnectNginxCmd := exec.Command("docker", "network", "disconnect", "--force", networkName, "platform-repository-nginx-1")
-				if err := disconnectNginxCmd.Run(); err != nil {
-					log.Printf("Note: Could not disconnect NGINX from network %s: %v", networkName, err)
-				} else {
-					log.Printf("Successfully disconnected NGINX from network %s", networkName)
-				}
-
-				// Get all containers connected to the network
-				listContainersCmd := exec.Command("docker", "network", "inspect", networkName, "--format", "{{range .Containers}}{{.Name}} {{end}}")
-				containersOutput, err := listContainersCmd.CombinedOutput()
-				if err == nil {
-					containers := strings.Fields(string(containersOutput))
-					for _, container := range containers {
-						log.Printf("Disconnecting container %s from network %s", container, networkName)
-						disconnectCmd := exec.Command("docker", "network", "disconnect", "--force", networkName, container)
-						if err := disconnectCmd.Run(); err != nil {
-							log.Printf("Note: Could not disconnect container %s from network %s: %v", container, networkName, err)
-						}
-					}
-				}
-
-				// Now try to remove the network
-				removeNetworkCmd := exec.Command("docker", "network", "rm", networkName)
-				if err := removeNetworkCmd.Run(); err != nil {
+				if err := handlers.RemoveNetwork(networkName); err != nil {
 					log.Printf("Error removing network %s: %v", networkName, err)
-				} else {
-					log.Printf("Successfully removed network %s", networkName)
 				}
 			} else {
 				log.Printf("Network %s does not exist, skipping removal", networkName)
@@ -812,9 +1533,10 @@ func deleteProjectHandler(w http.ResponseWriter, r *http.Request, projectName st
 
 	// Return success
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "success",
-		"message": fmt.Sprintf("Project %s and all associated resources have been completely deleted", projectName),
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":   "success",
+		"message":  fmt.Sprintf("Project %s and all associated resources have been completely deleted", projectName),
+		"services": results,
 	})
 }
 
@@ -837,30 +1559,113 @@ func stopProjectHandler(w http.ResponseWriter, r *http.Request, projectName stri
 	}
 
 	// Check if the user has permission to stop this project
-	if project.UserID != "" && project.UserID != userID {
+	if !project.HasRole(userID, models.RoleEditor) {
 		http.Error(w, "You do not have permission to stop this project", http.StatusForbidden)
 		return
 	}
 
+	// Stop all containers, several services at a time
+	results := teardownServices(copyServices(project), func(name string, service models.ServiceStatus) []string {
+		handlers.RemoveProcessContainers(service)
+		if service.ContainerID == "" {
+			return nil
+		}
+		log.Printf("Stopping container %s for service %s", service.ContainerID, name)
+		var errs []string
+		if err := exec.Command("docker", "stop", service.ContainerID).Run(); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to stop container %s: %v", service.ContainerID, err))
+		}
+		if err := exec.Command("docker", "rm", service.ContainerID).Run(); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to remove container %s: %v", service.ContainerID, err))
+		}
+		return errs
+	})
+
 	projectsMutex.Lock()
-	// Stop all containers
+	for _, result := range results {
+		for _, err := range result.Errors {
+			log.Printf("Error stopping service %s of project %s: %s", result.Service, project.Name, err)
+		}
+		service, exists := project.Services[result.Service]
+		if !exists {
+			continue
+		}
+		service.Processes = nil
+		if service.ContainerID != "" {
+			// Update service status
+			service.Status = "stopped"
+		}
+		project.Services[result.Service] = service
+	}
+
+	// Update project status
+	project.Status = "stopped"
+	project.UpdatedAt = time.Now()
+	projectsMutex.Unlock()
+
+	// Save project status
+	saveProjectStatus(project)
+
+	// Return success
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(projectToResponse(project))
+}
+
+// pauseProjectHandler stops a project's containers and serves a "paused" page on its domains
+func pauseProjectHandler(w http.ResponseWriter, r *http.Request, projectName string) {
+	// Extract user ID from request headers
+	userID := auth.GetUserID(r)
+	log.Printf("Pausing project: %s", projectName)
+
+	// Find the project
+	project, _, exists := findProject(projectName, userID)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Project %s not found", projectName), http.StatusNotFound)
+		return
+	}
+
+	// Check if the user has permission to pause this project
+	if !project.HasRole(userID, models.RoleEditor) {
+		http.Error(w, "You do not have permission to pause this project", http.StatusForbidden)
+		return
+	}
+
+	if project.Status != "running" {
+		http.Error(w, fmt.Sprintf("Project %s is %s, only running projects can be paused", projectName, project.Status), http.StatusConflict)
+		return
+	}
+
+	projectsMutex.Lock()
+	// Stop the containers but keep them so they can be resumed
+	serviceNames := make([]string, 0, len(project.Services))
 	for name, service := range project.Services {
+		serviceNames = append(serviceNames, name)
 		if service.ContainerID != "" {
-			log.Printf("Stopping container %s for service %s", service.ContainerID, name)
-			exec.Command("docker", "stop", service.ContainerID).Run()
-			exec.Command("docker", "rm", service.ContainerID).Run()
+			for _, containerID := range service.ContainerIDs() {
+				log.Printf("Pausing container %s for service %s", containerID, name)
+				if err := exec.Command("docker", "stop", containerID).Run(); err != nil {
+					log.Printf("Error stopping container %s: %v", containerID, err)
+				}
+			}
 
 			// Update service status
-			service.Status = "stopped"
+			service.Status = "paused"
 			project.Services[name] = service
 		}
 	}
 
 	// Update project status
-	project.Status = "stopped"
+	project.Status = "paused"
 	project.UpdatedAt = time.Now()
 	projectsMutex.Unlock()
 
+	// Swap the routing to the paused page
+	if nginxConfig != nil {
+		if err := nginxConfig.PauseProject(project.Name, serviceNames); err != nil {
+			log.Printf("Error serving paused page for project %s: %v", project.Name, err)
+		}
+	}
+
 	// Save project status
 	saveProjectStatus(project)
 
@@ -869,6 +1674,83 @@ func stopProjectHandler(w http.ResponseWriter, r *http.Request, projectName stri
 	json.NewEncoder(w).Encode(projectToResponse(project))
 }
 
+// resumeProjectHandler restarts a paused project's containers and restores its routing
+func resumeProjectHandler(w http.ResponseWriter, r *http.Request, projectName string) {
+	// Extract user ID from request headers
+	userID := auth.GetUserID(r)
+	log.Printf("Resuming project: %s", projectName)
+
+	// Find the project
+	project, _, exists := findProject(projectName, userID)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Project %s not found", projectName), http.StatusNotFound)
+		return
+	}
+
+	// Check if the user has permission to resume this project
+	if !project.HasRole(userID, models.RoleEditor) {
+		http.Error(w, "You do not have permission to resume this project", http.StatusForbidden)
+		return
+	}
+
+	if project.Status != "paused" {
+		http.Error(w, fmt.Sprintf("Project %s is not paused", projectName), http.StatusConflict)
+		return
+	}
+
+	projectsMutex.Lock()
+	// Start the stopped containers again
+	serviceNames := make([]string, 0, len(project.Services))
+	var failed []string
+	for name, service := range project.Services {
+		serviceNames = append(serviceNames, name)
+		if service.ContainerID == "" {
+			continue
+		}
+
+		service.Status = "running"
+		for _, containerID := range service.ContainerIDs() {
+			log.Printf("Resuming container %s for service %s", containerID, name)
+			if output, err := exec.Command("docker", "start", containerID).CombinedOutput(); err != nil {
+				log.Printf("Error starting container %s: %v, output: %s", containerID, err, string(output))
+				service.Status = "failed"
+			}
+		}
+		if service.Status == "failed" {
+			failed = append(failed, name)
+		}
+		project.Services[name] = service
+	}
+
+	// Update project status
+	if len(failed) > 0 {
+		project.Status = "failed"
+	} else {
+		project.Status = "running"
+	}
+	project.UpdatedAt = time.Now()
+	projectsMutex.Unlock()
+
+	// Restore the routing even if some services failed, so their errors are visible
+	if nginxConfig != nil {
+		if err := nginxConfig.ResumeProject(project.Name, serviceNames); err != nil {
+			log.Printf("Error restoring NGINX mappings for project %s: %v", project.Name, err)
+		}
+	}
+
+	// Save project status
+	saveProjectStatus(project)
+
+	if len(failed) > 0 {
+		http.Error(w, fmt.Sprintf("Failed to resume services: %s", strings.Join(failed, ", ")), http.StatusInternalServerError)
+		return
+	}
+
+	// Return success
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(projectToResponse(project))
+}
+
 // startProjectHandler starts all services in a project
 func startProjectHandler(w http.ResponseWriter, r *http.Request, projectName string) {
 	// Extract user ID from request headers
@@ -888,7 +1770,7 @@ func startProjectHandler(w http.ResponseWriter, r *http.Request, projectName str
 	}
 
 	// Check if the user has permission to start this project
-	if project.UserID != "" && project.UserID != userID {
+	if !project.HasRole(userID, models.RoleEditor) {
 		http.Error(w, "You do not have permission to start this project", http.StatusForbidden)
 		return
 	}
@@ -902,9 +1784,25 @@ func startProjectHandler(w http.ResponseWriter, r *http.Request, projectName str
 		return
 	}
 
-	// Start deployment in a goroutine
+	// Paused projects keep their containers and are brought back with resume
+	if project.Status == "paused" {
+		http.Error(w, fmt.Sprintf("Project %s is paused, resume it instead", projectName), http.StatusConflict)
+		return
+	}
+
+	// Only one deployment of a project runs at a time
+	unlock, ok := tryLockDeploy(project.UserID, project.Name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("Deployment of project %s already in progress", projectName), http.StatusConflict)
+		return
+	}
+
+	// Start deployment in a goroutine, it can be cancelled like an upload's
+	ctx, done := beginDeployment(project.Path, project.UserID, project.Name)
 	go func() {
-		if err := handlers.DeployHandler(project); err != nil {
+		defer unlock()
+		defer done()
+		if err := deployProject(ctx, project); err != nil {
 			log.Printf("Error deploying project %s: %v", projectName, err)
 		}
 	}()
@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+// Roles a user can have on a project, from least to most privileged. Viewers can read
+// the project, editors can also deploy and stop it, and only the owner can delete it or
+// manage its collaborators.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleOwner  = "owner"
+)
+
+// Privilege of each role, used to compare them
+var roleRanks = map[string]int{
+	RoleViewer: 1,
+	RoleEditor: 2,
+	RoleOwner:  3,
+}
+
+// Collaborator is a user a project is shared with
+type Collaborator struct {
+	UserID  string    `json:"userId"`
+	Role    string    `json:"role"`
+	AddedAt time.Time `json:"addedAt"`
+}
+
+// ValidCollaboratorRole reports whether role can be given to a collaborator
+func ValidCollaboratorRole(role string) bool {
+	return role == RoleViewer || role == RoleEditor
+}
+
+// CollaboratorRole returns the role the project is shared with userID with, empty when it isn't
+func (p *Project) CollaboratorRole(userID string) string {
+	for _, collaborator := range p.Collaborators {
+		if collaborator.UserID == userID {
+			return collaborator.Role
+		}
+	}
+	return ""
+}
+
+// RoleOf returns the role userID has on the project, empty when it has none. Projects
+// without an owner predate user IDs and are owned by everyone.
+func (p *Project) RoleOf(userID string) string {
+	if p.UserID == "" || p.UserID == userID {
+		return RoleOwner
+	}
+	if userID == "" {
+		return ""
+	}
+	return p.CollaboratorRole(userID)
+}
+
+// HasRole reports whether userID has at least the given role on the project
+func (p *Project) HasRole(userID, role string) bool {
+	return roleRanks[p.RoleOf(userID)] >= roleRanks[role]
+}
+
+// SetCollaborator shares the project with userID, replacing the role of an existing
+// collaborator. The list is copied so readers holding the old one are unaffected.
+func (p *Project) SetCollaborator(userID, role string) {
+	collaborators := make([]Collaborator, 0, len(p.Collaborators)+1)
+	for _, collaborator := range p.Collaborators {
+		if collaborator.UserID == userID {
+			collaborator.Role = role
+			role = ""
+		}
+		collaborators = append(collaborators, collaborator)
+	}
+	if role != "" {
+		collaborators = append(collaborators, Collaborator{UserID: userID, Role: role, AddedAt: time.Now()})
+	}
+	p.Collaborators = collaborators
+}
+
+// RemoveCollaborator stops sharing the project with userID and reports whether it was shared
+func (p *Project) RemoveCollaborator(userID string) bool {
+	collaborators := make([]Collaborator, 0, len(p.Collaborators))
+	for _, collaborator := range p.Collaborators {
+		if collaborator.UserID != userID {
+			collaborators = append(collaborators, collaborator)
+		}
+	}
+	removed := len(collaborators) < len(p.Collaborators)
+	p.Collaborators = collaborators
+	return removed
+}
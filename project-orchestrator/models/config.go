@@ -0,0 +1,139 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Characters not allowed in environment variable names
+var envNameInvalidChars = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// FlattenConfig turns a manifest config block into environment variables:
+//
+//   - keys are upper-cased, nested keys are joined with underscores and any character
+//     other than letters, digits and underscores becomes an underscore, so
+//     config: {db: {max-connections: 10}} becomes DB_MAX_CONNECTIONS=10
+//   - strings are used as-is, booleans become true or false, numbers are written
+//     without exponents or trailing zeros, and null becomes an empty string
+//   - lists are JSON-encoded, e.g. [a, b] becomes ["a","b"]
+//
+// Two keys flattening to the same variable, or to a name starting with a digit, are an error.
+func FlattenConfig(config map[string]interface{}) (map[string]string, error) {
+	env := make(map[string]string)
+	sources := make(map[string]string) // Config path each variable came from
+
+	var flatten func(prefix []string, path string, value interface{}) error
+	flatten = func(prefix []string, path string, value interface{}) error {
+		if nested, ok := toStringMap(value); ok {
+			keys := make([]string, 0, len(nested))
+			for key := range nested {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				childPath := key
+				if path != "" {
+					childPath = path + "." + key
+				}
+				if err := flatten(append(prefix, key), childPath, nested[key]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		name := envNameInvalidChars.ReplaceAllString(strings.ToUpper(strings.Join(prefix, "_")), "_")
+		if name == "" || (name[0] >= '0' && name[0] <= '9') {
+			return fmt.Errorf("config key '%s' does not map to a valid environment variable name", path)
+		}
+		if other, exists := sources[name]; exists {
+			return fmt.Errorf("config keys '%s' and '%s' both map to environment variable %s", other, path, name)
+		}
+
+		formatted, err := formatConfigValue(value)
+		if err != nil {
+			return fmt.Errorf("config key '%s': %v", path, err)
+		}
+		env[name] = formatted
+		sources[name] = path
+		return nil
+	}
+
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := flatten([]string{key}, key, config[key]); err != nil {
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+// formatConfigValue converts a scalar or list config value to its environment variable form
+func formatConfigValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint64:
+		return strconv.FormatUint(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case []interface{}:
+		encoded, err := json.Marshal(toJSONValue(v))
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// toStringMap converts a YAML mapping to a map with string keys
+func toStringMap(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = item
+		}
+		return converted, true
+	}
+	return nil, false
+}
+
+// toJSONValue converts YAML values nested in lists to values encoding/json can marshal
+func toJSONValue(value interface{}) interface{} {
+	if mapping, ok := toStringMap(value); ok {
+		converted := make(map[string]interface{}, len(mapping))
+		for key, item := range mapping {
+			converted[key] = toJSONValue(item)
+		}
+		return converted
+	}
+	if list, ok := value.([]interface{}); ok {
+		converted := make([]interface{}, len(list))
+		for i, item := range list {
+			converted[i] = toJSONValue(item)
+		}
+		return converted
+	}
+	return value
+}
@@ -0,0 +1,184 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Largest NGINX snippet a service may declare
+const maxNginxSnippetSize = 4096
+
+// Directives a snippet may not use: they read or write files on the proxy, load code,
+// send requests to other upstreams than the service's, e.g. platform services trusting
+// the X-User-ID header, or only belong to other contexts of the shared configuration
+var forbiddenNginxDirectives = map[string]bool{
+	"include":                 true,
+	"load_module":             true,
+	"root":                    true,
+	"alias":                   true,
+	"access_log":              true,
+	"error_log":               true,
+	"auth_basic_user_file":    true,
+	"ssl_certificate":         true,
+	"ssl_certificate_key":     true,
+	"ssl_client_certificate":  true,
+	"ssl_trusted_certificate": true,
+	"proxy_store":             true,
+	"proxy_temp_path":         true,
+	"client_body_temp_path":   true,
+	"fastcgi_temp_path":       true,
+	"uwsgi_temp_path":         true,
+	"scgi_temp_path":          true,
+	"js_import":               true,
+	"js_include":              true,
+	"js_path":                 true,
+	"perl":                    true,
+	"perl_modules":            true,
+	"perl_require":            true,
+	"proxy_pass":              true,
+	"fastcgi_pass":            true,
+	"uwsgi_pass":              true,
+	"scgi_pass":               true,
+	"grpc_pass":               true,
+	"memcached_pass":          true,
+	"location":                true,
+	"server":                  true,
+	"upstream":                true,
+	"http":                    true,
+	"stream":                  true,
+	"events":                  true,
+}
+
+// ValidateNginxSnippet checks a snippet injected into a service's location block. It only
+// catches what can be checked statically; the generated configuration is also tested
+// with nginx -t before it is loaded.
+func ValidateNginxSnippet(snippet string) error {
+	if len(snippet) > maxNginxSnippetSize {
+		return fmt.Errorf("nginx_snippet must not exceed %d bytes", maxNginxSnippetSize)
+	}
+
+	depth := 0
+	expectDirective := true
+	for _, token := range nginxTokens(snippet) {
+		switch token {
+		case "{":
+			depth++
+			expectDirective = true
+		case "}":
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("nginx_snippet closes a block it didn't open")
+			}
+			expectDirective = true
+		case ";":
+			expectDirective = true
+		default:
+			if expectDirective {
+				// NGINX strips the quotes and escapes of directive names
+				directive := strings.ToLower(nginxUnquote(token))
+				// Lua directives (content_by_lua_block, ...) run arbitrary code on the proxy
+				if forbiddenNginxDirectives[directive] || strings.Contains(directive, "_by_lua") {
+					return fmt.Errorf("directive '%s' is not allowed in nginx_snippet", token)
+				}
+				expectDirective = false
+			}
+		}
+	}
+	if depth != 0 {
+		return fmt.Errorf("nginx_snippet has an unclosed block")
+	}
+	if !expectDirective {
+		return fmt.Errorf("nginx_snippet must end its last directive with ';'")
+	}
+	return nil
+}
+
+// nginxTokens splits NGINX configuration into words, quoted strings, and the
+// ';', '{' and '}' delimiters, dropping comments. Words and strings keep their quotes and
+// escapes, so an escaped or quoted delimiter isn't mistaken for one.
+func nginxTokens(config string) []string {
+	var tokens []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	var quote rune
+	escaped := false
+	comment := false
+	for _, char := range config {
+		switch {
+		case comment:
+			if char == '\n' {
+				comment = false
+			}
+		case quote != 0:
+			current.WriteRune(char)
+			if escaped {
+				escaped = false
+			} else if char == '\\' {
+				escaped = true
+			} else if char == quote {
+				quote = 0
+			}
+		case escaped:
+			current.WriteRune(char)
+			escaped = false
+		case char == '\\':
+			current.WriteRune(char)
+			escaped = true
+		case (char == '"' || char == '\'') && current.Len() == 0:
+			// Only a quote starting a word opens a string, like in NGINX
+			quote = char
+			current.WriteRune(char)
+		case char == '#':
+			flush()
+			comment = true
+		case char == ';' || char == '{' || char == '}':
+			flush()
+			tokens = append(tokens, string(char))
+		case char == ' ' || char == '\t' || char == '\n' || char == '\r':
+			flush()
+		default:
+			current.WriteRune(char)
+		}
+	}
+	flush()
+	return tokens
+}
+
+// nginxUnquote returns the value NGINX reads from a word or quoted string: the quotes
+// around a string are dropped and escaped quotes, backslashes and control characters
+// resolved, other escapes are kept
+func nginxUnquote(token string) string {
+	if len(token) >= 2 && (token[0] == '"' || token[0] == '\'') && token[len(token)-1] == token[0] {
+		token = token[1 : len(token)-1]
+	}
+
+	var value strings.Builder
+	for i := 0; i < len(token); i++ {
+		if token[i] == '\\' && i+1 < len(token) {
+			switch token[i+1] {
+			case '"', '\'', '\\':
+				i++
+			case 't':
+				value.WriteByte('\t')
+				i++
+				continue
+			case 'r':
+				value.WriteByte('\r')
+				i++
+				continue
+			case 'n':
+				value.WriteByte('\n')
+				i++
+				continue
+			}
+		}
+		value.WriteByte(token[i])
+	}
+	return value.String()
+}
@@ -0,0 +1,60 @@
+package models
+
+import "testing"
+
+func TestValidateNginxSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		snippet string
+		valid   bool
+	}{
+		{"headers", "add_header X-Frame-Options DENY;\nproxy_read_timeout 60s;", true},
+		{"quoted argument", `add_header Content-Security-Policy "default-src 'self'; img-src *";`, true},
+		{"if block", "if ($request_method = POST) { return 405; }", true},
+		{"include", "include /etc/nginx/nginx.conf;", false},
+		{"double quoted include", `"include" /etc/nginx/nginx.conf;`, false},
+		{"single quoted root", `'root' /;`, false},
+		{"quoted alias", `"alias" /etc/;`, false},
+		{"upper case root", "ROOT /;", false},
+		{"proxy_pass", "proxy_pass http://function-controller:8081;", false},
+		{"quoted proxy_pass", `"proxy_pass" http://function-controller:8081;`, false},
+		{"proxy_pass in if", "if ($arg_x) { proxy_set_header X-User-ID victim; proxy_pass http://function-controller:8081; }", false},
+		{"nested location", "location /internal { return 200; }", false},
+		{"grpc_pass", "grpc_pass grpc://function-controller:8081;", false},
+		{"lua", "content_by_lua_block { ngx.say('hi') }", false},
+		{"quote inside word", `add_header x"; proxy_pass http://function-controller:8081; ";`, false},
+		{"unclosed block", "if ($arg_x) { return 403;", false},
+		{"unterminated directive", "add_header X-A a", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateNginxSnippet(test.snippet)
+			if test.valid && err != nil {
+				t.Errorf("ValidateNginxSnippet(%q) = %v, want nil", test.snippet, err)
+			}
+			if !test.valid && err == nil {
+				t.Errorf("ValidateNginxSnippet(%q) = nil, want an error", test.snippet)
+			}
+		})
+	}
+}
+
+func TestNginxUnquote(t *testing.T) {
+	tests := map[string]string{
+		`include`:      "include",
+		`"include"`:    "include",
+		`'root'`:       "root",
+		`"al\"ias"`:    `al"ias`,
+		`"a\\b"`:       `a\b`,
+		`"tab\tx"`:     "tab\tx",
+		`"inc\lude"`:   `inc\lude`,
+		`"unbalanced'`: `"unbalanced'`,
+	}
+
+	for token, want := range tests {
+		if got := nginxUnquote(token); got != want {
+			t.Errorf("nginxUnquote(%q) = %q, want %q", token, got, want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// WebProcess is the process that runs in the service container itself and receives its traffic.
+// Every other process runs in a container of its own.
+const WebProcess = "web"
+
+// Process names are used in container names
+var processNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ParseProcfile parses a Heroku-style Procfile with one "name: command" line per process
+func ParseProcfile(data []byte) (map[string]string, error) {
+	processes := make(map[string]string)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: expected 'name: command'", lineNumber)
+		}
+		name, command := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if _, exists := processes[name]; exists {
+			return nil, fmt.Errorf("line %d: process %s is declared twice", lineNumber, name)
+		}
+		processes[name] = command
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return processes, validateProcesses(processes)
+}
+
+// LoadProcesses returns the processes of a service, declared in the manifest or in a
+// Procfile in the service directory. Services without processes return nil.
+func LoadProcesses(projectDir string, service Service) (map[string]string, error) {
+	if len(service.Processes) > 0 {
+		return service.Processes, validateProcesses(service.Processes)
+	}
+	// Services running a pre-built image have no directory to read a Procfile from
+	if service.Image != "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(projectDir, service.Path, "Procfile"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	processes, err := ParseProcfile(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Procfile: %v", err)
+	}
+	return processes, nil
+}
+
+// validateProcesses checks process names and commands
+func validateProcesses(processes map[string]string) error {
+	for name, command := range processes {
+		if !processNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid process name '%s', use letters, digits, '-' and '_'", name)
+		}
+		if strings.TrimSpace(command) == "" {
+			return fmt.Errorf("process %s has no command", name)
+		}
+	}
+	return nil
+}
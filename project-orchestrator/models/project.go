@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -11,79 +12,319 @@ import (
 
 // ProjectManifest represents the structure of a project.yaml file
 type ProjectManifest struct {
-	Name        string                 `yaml:"name"`
-	Version     string                 `yaml:"version"`
-	Description string                 `yaml:"description,omitempty"`
-	Services    map[string]Service     `yaml:"services"`
-	Database    *Database              `yaml:"database,omitempty"`
-	Environment map[string]string      `yaml:"environment,omitempty"`
-	Config      map[string]interface{} `yaml:"config,omitempty"`
+	Name        string                 `yaml:"name" json:"name"`
+	Version     string                 `yaml:"version" json:"version"`
+	Description string                 `yaml:"description,omitempty" json:"description,omitempty"`
+	Services    map[string]Service     `yaml:"services" json:"services"`
+	Database    *Database              `yaml:"database,omitempty" json:"database,omitempty"`
+	Environment map[string]string      `yaml:"environment,omitempty" json:"environment,omitempty"`
+	Config      map[string]interface{} `yaml:"config,omitempty" json:"config,omitempty"`
+	Resources   *Resources             `yaml:"resources,omitempty" json:"resources,omitempty"` // Total budget shared by all services
+	Registries  *Registries            `yaml:"registries,omitempty" json:"registries,omitempty"`
+	ErrorPages  *ErrorPages            `yaml:"error_pages,omitempty" json:"error_pages,omitempty"`
+	HealthCheck *HealthCheck           `yaml:"health_check,omitempty" json:"health_check,omitempty"`
+	Webhook     *Webhook               `yaml:"webhook,omitempty" json:"webhook,omitempty"` // Notified of status changes
 }
 
 // Service represents a service within a project (frontend, backend, etc.)
 type Service struct {
-	Path       string            `yaml:"path"`
-	Type       string            `yaml:"type"` // static, api, worker
-	Runtime    string            `yaml:"runtime,omitempty"`
-	Entrypoint string            `yaml:"entrypoint,omitempty"`
-	Build      string            `yaml:"build,omitempty"`
-	Output     string            `yaml:"output,omitempty"`
-	Port       int               `yaml:"port,omitempty"`
-	Route      string            `yaml:"route,omitempty"`
-	Env        map[string]string `yaml:"env,omitempty"`
+	Path        string            `yaml:"path,omitempty" json:"path,omitempty"`
+	Type        string            `yaml:"type" json:"type"`                                   // static, api, worker, tcp
+	Description string            `yaml:"description,omitempty" json:"description,omitempty"` // Shown in service listings, defaults to the project description
+	Runtime     string            `yaml:"runtime,omitempty" json:"runtime,omitempty"`
+	Entrypoint  string            `yaml:"entrypoint,omitempty" json:"entrypoint,omitempty"`
+	Build       string            `yaml:"build,omitempty" json:"build,omitempty"`
+	Output      string            `yaml:"output,omitempty" json:"output,omitempty"`
+	Port        int               `yaml:"port,omitempty" json:"port,omitempty"`
+	Route       string            `yaml:"route,omitempty" json:"route,omitempty"`
+	Env         map[string]string `yaml:"env,omitempty" json:"env,omitempty"`             // Set in the running container
+	BuildEnv    map[string]string `yaml:"build_env,omitempty" json:"build_env,omitempty"` // Set while building, e.g. REACT_APP_API_URL baked into a static bundle
+	Resources   *Resources        `yaml:"resources,omitempty" json:"resources,omitempty"`
+	Dockerfile  string            `yaml:"dockerfile,omitempty" json:"dockerfile,omitempty"` // Dockerfile relative to the build context, used instead of a generated one
+	Processes   map[string]string `yaml:"processes,omitempty" json:"processes,omitempty"`   // Process name to command, read from a Procfile when not set
+	Hooks       *Hooks            `yaml:"hooks,omitempty" json:"hooks,omitempty"`
+	Init        *InitContainer    `yaml:"init,omitempty" json:"init,omitempty"`
+	StopSignal  string            `yaml:"stop_signal,omitempty" json:"stop_signal,omitempty"` // Signal docker stop sends, e.g. SIGQUIT for a graceful NGINX drain
+	// Pre-built image run instead of building the service from its path, e.g. an image
+	// pushed by the team's own CI such as registry.example.com/shop/api:1.4
+	Image string `yaml:"image,omitempty" json:"image,omitempty"`
+	// Directory relative to the project root the service's image is built from instead of
+	// the service directory, e.g. a monorepo root with shared protobufs. Requires a dockerfile.
+	BuildContext string `yaml:"build_context,omitempty" json:"build_context,omitempty"`
+	// Probe holding back the service until it has started, for services slow to boot
+	StartupProbe *StartupProbe `yaml:"startup_probe,omitempty" json:"startup_probe,omitempty"`
+	// HTTP path answering 2xx while the service is healthy, e.g. /healthz. The service is
+	// probed on it before it is routed, by the startup probe when it has no path of its own.
+	HealthPath string `yaml:"health_path,omitempty" json:"health_path,omitempty"`
+	// NGINX directives added verbatim to the location block proxying the service, e.g.
+	// rate limits or extra headers. Checked against a list of forbidden directives and
+	// with nginx -t before they are loaded.
+	NginxSnippet string `yaml:"nginx_snippet,omitempty" json:"nginx_snippet,omitempty"`
+}
+
+// Hooks are commands run to completion in one-shot containers from the service's image
+// during a deployment. A failing hook fails the deployment.
+type Hooks struct {
+	PreDeploy  string `yaml:"pre_deploy,omitempty" json:"pre_deploy,omitempty"`   // Run before the service container starts, e.g. database migrations
+	PostDeploy string `yaml:"post_deploy,omitempty" json:"post_deploy,omitempty"` // Run once the service is running, e.g. seeding
+}
+
+// InitContainer is a command run to completion in a one-shot container from the service's
+// image before the service container starts, e.g. downloading assets or waiting for a
+// dependency. A failing init fails the deployment.
+type InitContainer struct {
+	Command string   `yaml:"command" json:"command"`
+	Volumes []string `yaml:"volumes,omitempty" json:"volumes,omitempty"` // Paths the init shares with the service's containers, e.g. /app/assets
+}
+
+// Registries overrides the package registries used to install dependencies.
+// Credentials are configured on the orchestrator and never in the manifest.
+type Registries struct {
+	NPM string `yaml:"npm,omitempty" json:"npm,omitempty"` // npm registry URL
+	Pip string `yaml:"pip,omitempty" json:"pip,omitempty"` // pip index URL
+}
+
+// ErrorPages are custom error pages served from the project's static frontend
+type ErrorPages struct {
+	NotFound    string `yaml:"404,omitempty" json:"404,omitempty"` // Path of the page for 404 responses, e.g. /404.html
+	ServerError string `yaml:"50x,omitempty" json:"50x,omitempty"` // Path of the page for 500, 502, 503 and 504 responses
+}
+
+// Webhook is sent a POST with a JSON payload whenever the project's status changes, e.g.
+// from building to running or to failed, for chat notifications or CI callbacks
+type Webhook struct {
+	URL    string   `yaml:"url" json:"url"`
+	Events []string `yaml:"events,omitempty" json:"events,omitempty"` // Statuses notified, e.g. [running, failed], all when empty
+}
+
+// WebhookEvents are the project statuses a webhook can be notified of
+var WebhookEvents = map[string]bool{
+	"building":  true,
+	"built":     true,
+	"deploying": true,
+	"running":   true,
+	"failed":    true,
+	"stopped":   true,
+	"paused":    true,
+	"cancelled": true,
+}
+
+// Notifies reports whether the webhook is notified when the project's status changes to status
+func (w Webhook) Notifies(status string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, event := range w.Events {
+		if event == status {
+			return true
+		}
+	}
+	return false
+}
+
+// HealthCheck configures the passive health checks the proxy runs against the project's
+// containers. A container failing max_fails requests within fail_timeout is taken out of
+// rotation for fail_timeout.
+type HealthCheck struct {
+	MaxFails    *int   `yaml:"max_fails,omitempty" json:"max_fails,omitempty"`       // 0 disables the checks
+	FailTimeout string `yaml:"fail_timeout,omitempty" json:"fail_timeout,omitempty"` // Duration such as 10s or 1m
+}
+
+// FailTimeoutSeconds returns the fail timeout in whole seconds, or 0 when it isn't set
+func (h HealthCheck) FailTimeoutSeconds() (int, error) {
+	if h.FailTimeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(h.FailTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid fail_timeout '%s', expected a duration like 10s", h.FailTimeout)
+	}
+	if timeout < time.Second || timeout%time.Second != 0 {
+		return 0, fmt.Errorf("fail_timeout must be a whole number of seconds, at least 1s")
+	}
+	return int(timeout / time.Second), nil
+}
+
+// StartupProbe holds back a slow-starting service until it answers. Once its container
+// starts, the service is probed every period after initial_delay, and it is only marked
+// running and given a public route after success_threshold probes in a row succeed. The
+// deployment fails after failure_threshold failed probes.
+type StartupProbe struct {
+	Path             string `yaml:"path,omitempty" json:"path,omitempty"`                           // HTTP path answering 2xx once started, a TCP connect is tried when empty
+	InitialDelay     string `yaml:"initial_delay,omitempty" json:"initial_delay,omitempty"`         // Duration such as 30s before the first probe
+	Period           string `yaml:"period,omitempty" json:"period,omitempty"`                       // Duration between probes, 2s by default
+	SuccessThreshold int    `yaml:"success_threshold,omitempty" json:"success_threshold,omitempty"` // 1 by default
+	FailureThreshold int    `yaml:"failure_threshold,omitempty" json:"failure_threshold,omitempty"` // 30 by default
+}
+
+// BuildContextDir returns the directory the service's image is built from: its build
+// context when set, otherwise its service directory
+func (s Service) BuildContextDir(projectDir string) string {
+	if s.BuildContext != "" {
+		return filepath.Join(projectDir, s.BuildContext)
+	}
+	return filepath.Join(projectDir, s.Path)
+}
+
+// ReadinessProbe returns the probe a deployment waits on before routing the service: its
+// startup probe, probing its health path unless the probe has a path, or a probe with the
+// default settings when only a health path is set. Services with neither aren't probed.
+func (s Service) ReadinessProbe() *StartupProbe {
+	if s.StartupProbe == nil {
+		if s.HealthPath == "" {
+			return nil
+		}
+		return &StartupProbe{Path: s.HealthPath}
+	}
+	probe := *s.StartupProbe
+	if probe.Path == "" {
+		probe.Path = s.HealthPath
+	}
+	return &probe
+}
+
+// Defaults of the startup probe settings
+const (
+	DefaultProbePeriod           = 2 * time.Second
+	DefaultProbeSuccessThreshold = 1
+	DefaultProbeFailureThreshold = 30
+)
+
+// Durations returns the probe's initial delay and period, applying the default period
+func (p StartupProbe) Durations() (time.Duration, time.Duration, error) {
+	var delay time.Duration
+	if p.InitialDelay != "" {
+		parsed, err := time.ParseDuration(p.InitialDelay)
+		if err != nil || parsed < 0 {
+			return 0, 0, fmt.Errorf("invalid initial_delay '%s', expected a duration like 30s", p.InitialDelay)
+		}
+		delay = parsed
+	}
+
+	period := DefaultProbePeriod
+	if p.Period != "" {
+		parsed, err := time.ParseDuration(p.Period)
+		if err != nil || parsed < time.Second {
+			return 0, 0, fmt.Errorf("invalid period '%s', expected a duration of at least 1s", p.Period)
+		}
+		period = parsed
+	}
+	return delay, period, nil
+}
+
+// Thresholds returns the probe's success and failure thresholds, applying the defaults
+func (p StartupProbe) Thresholds() (int, int) {
+	success, failure := p.SuccessThreshold, p.FailureThreshold
+	if success <= 0 {
+		success = DefaultProbeSuccessThreshold
+	}
+	if failure <= 0 {
+		failure = DefaultProbeFailureThreshold
+	}
+	return success, failure
 }
 
 // Database represents database configuration
 type Database struct {
-	Type    string `yaml:"type"` // sqlite, postgres, etc.
-	Path    string `yaml:"path,omitempty"`
-	Version string `yaml:"version,omitempty"`
+	Type    string `yaml:"type" json:"type"` // sqlite, postgres, etc.
+	Path    string `yaml:"path,omitempty" json:"path,omitempty"`
+	Version string `yaml:"version,omitempty" json:"version,omitempty"`
 }
 
 // Project represents a deployed project
 type Project struct {
-	Name        string
-	Path        string
-	Manifest    *ProjectManifest
-	Status      string
-	Services    map[string]ServiceStatus
-	CreatedAt   time.Time
-	UpdatedAt   time.Time
-	UserID      string                 // User ID of the project owner
-	Username    string                 // Username of the project owner
+	Name          string
+	Path          string
+	Manifest      *ProjectManifest
+	Status        string
+	Services      map[string]ServiceStatus
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	UserID        string         // User ID of the project owner
+	Username      string         // Username of the project owner
+	Resources     *ResourceUsage // Resource quota and allocation, set at deploy
+	Error         string         // Last build or deploy error, cleared on success
+	ErrorKind     string         // Classification of the last error (user, infra, transient, timeout, cancelled)
+	Version       string         // Version given at upload, used as the tag of the service images
+	Collaborators []Collaborator // Users the project is shared with, besides its owner
 }
 
 // ServiceStatus represents the status of a deployed service
 type ServiceStatus struct {
-	Type        string
+	Type          string
+	Status        string
+	ContainerID   string
+	URL           string                   // Internal URL (will be deprecated in favor of PublicURL)
+	Port          int
+	PublicURL     string                   // New field for the public URL (e.g., http://project-service.platform.local)
+	Subdomain     string                   // New field for the subdomain (e.g., project-service.platform.local)
+	TCPEndpoint   string                   // Public host:port of the stream proxy for tcp services
+	Image         string                   // Tagged image the service runs, e.g. project-shop-backend:3f2a9c1e04b7
+	Routing       string                   // Whether the service got a public route: routed, skipped or failed
+	RoutingReason string                   // Why the service has no public route
+	Processes     map[string]ProcessStatus // Containers running the service's additional processes
+}
+
+// Public routing states of a deployed service
+const (
+	RoutingRouted  = "routed"
+	RoutingSkipped = "skipped"
+	RoutingFailed  = "failed"
+)
+
+// ProcessStatus represents the status of a process running from a service's image
+type ProcessStatus struct {
+	Command     string
 	Status      string
 	ContainerID string
-	URL         string // Internal URL (will be deprecated in favor of PublicURL)
-	Port        int
-	PublicURL   string // New field for the public URL (e.g., http://project-service.platform.local)
-	Subdomain   string // New field for the subdomain (e.g., project-service.platform.local)
 }
 
-// LoadManifest loads a project manifest from a file
+// ContainerIDs returns the IDs of the service container and its process containers
+func (s ServiceStatus) ContainerIDs() []string {
+	var ids []string
+	if s.ContainerID != "" {
+		ids = append(ids, s.ContainerID)
+	}
+	for _, process := range s.Processes {
+		if process.ContainerID != "" {
+			ids = append(ids, process.ContainerID)
+		}
+	}
+	return ids
+}
+
+// Manifest file names, in the order LoadManifest looks for them
+var manifestFileNames = []string{"project.yaml", "project.yml", "project.json"}
+
+// LoadManifest loads a project manifest from a file, the first of manifestFileNames present
+// in the project directory
 func LoadManifest(projectDir string) (*ProjectManifest, error) {
-	manifestPath := filepath.Join(projectDir, "project.yaml")
-	
-	// Check if manifest exists
-	if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
-		// Try project.yml as an alternative
-		manifestPath = filepath.Join(projectDir, "project.yml")
-		if _, err := os.Stat(manifestPath); os.IsNotExist(err) {
-			return nil, fmt.Errorf("manifest file not found in project directory")
+	manifestPath := ""
+	for _, fileName := range manifestFileNames {
+		candidate := filepath.Join(projectDir, fileName)
+		if _, err := os.Stat(candidate); err == nil {
+			manifestPath = candidate
+			break
 		}
 	}
-	
+	if manifestPath == "" {
+		return nil, fmt.Errorf("manifest file not found in project directory")
+	}
+
 	// Read the manifest file
 	data, err := os.ReadFile(manifestPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read manifest file: %v", err)
 	}
-	
-	// Parse the manifest
+
+	if filepath.Ext(manifestPath) == ".json" {
+		return ParseJSONManifest(data)
+	}
+	return ParseManifest(data)
+}
+
+// ParseManifest parses the contents of a project.yaml file
+func ParseManifest(data []byte) (*ProjectManifest, error) {
 	var manifest ProjectManifest
 	if err := yaml.Unmarshal(data, &manifest); err != nil {
 		return nil, fmt.Errorf("failed to parse manifest file: %v", err)
@@ -92,6 +333,17 @@ func LoadManifest(projectDir string) (*ProjectManifest, error) {
 	return &manifest, nil
 }
 
+// ParseJSONManifest parses the contents of a project.json file, which uses the same keys
+// as project.yaml
+func ParseJSONManifest(data []byte) (*ProjectManifest, error) {
+	var manifest ProjectManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest file: %v", err)
+	}
+
+	return &manifest, nil
+}
+
 // DetectProjectStructure attempts to infer the project structure if no manifest is provided
 func DetectProjectStructure(projectDir string) (*ProjectManifest, error) {
 	manifest := ProjectManifest{
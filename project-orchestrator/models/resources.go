@@ -0,0 +1,70 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Resources represents a CPU and memory budget (for a project) or request (for a service)
+type Resources struct {
+	CPUs   float64 `yaml:"cpus,omitempty" json:"cpus,omitempty"`     // Number of CPUs, e.g. 0.5
+	Memory string  `yaml:"memory,omitempty" json:"memory,omitempty"` // Memory in docker notation, e.g. 512m or 1g
+}
+
+// ResourceUsage describes a project's quota and the resources allocated to its services
+type ResourceUsage struct {
+	CPUQuota        float64 `json:"cpuQuota,omitempty"`
+	CPUAllocated    float64 `json:"cpuAllocated"`
+	MemoryQuota     int64   `json:"memoryQuota,omitempty"` // Bytes
+	MemoryAllocated int64   `json:"memoryAllocated"`       // Bytes
+}
+
+// Suffixes accepted in memory values, matching docker's --memory flag
+var memoryUnits = map[string]int64{
+	"b": 1,
+	"k": 1 << 10,
+	"m": 1 << 20,
+	"g": 1 << 30,
+}
+
+// ParseMemory converts a docker style memory value (e.g. 512m, 1g) to bytes
+func ParseMemory(value string) (int64, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return 0, nil
+	}
+	
+	// Allow an optional trailing "b" after the unit (e.g. 512mb)
+	if len(value) > 2 && strings.HasSuffix(value, "b") {
+		if _, ok := memoryUnits[value[len(value)-2:len(value)-1]]; ok {
+			value = value[:len(value)-1]
+		}
+	}
+	
+	multiplier := int64(1)
+	if unit, ok := memoryUnits[value[len(value)-1:]]; ok {
+		multiplier = unit
+		value = value[:len(value)-1]
+	}
+	
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil || amount < 0 {
+		return 0, fmt.Errorf("invalid memory value: %s", value)
+	}
+	
+	return int64(amount * float64(multiplier)), nil
+}
+
+// FormatMemory converts bytes to a docker --memory value
+func FormatMemory(bytes int64) string {
+	switch {
+	case bytes%(1<<30) == 0:
+		return fmt.Sprintf("%dg", bytes>>30)
+	case bytes%(1<<20) == 0:
+		return fmt.Sprintf("%dm", bytes>>20)
+	case bytes%(1<<10) == 0:
+		return fmt.Sprintf("%dk", bytes>>10)
+	}
+	return fmt.Sprintf("%db", bytes)
+}
@@ -0,0 +1,419 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/secrets"
+)
+
+// ValidationError describes a single problem with a project manifest
+type ValidationError struct {
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Service names are used in container names. They can't contain '.', which separates them
+// from the names of their processes.
+var serviceNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// SupportedServiceTypes are the service types the platform can build and deploy
+var SupportedServiceTypes = map[string]bool{
+	"static": true,
+	"api":    true,
+	"worker": true,
+	"tcp":    true,
+}
+
+// ValidateManifest checks a manifest can be built and deployed and returns warnings and errors.
+// Service directories are only checked when projectDir is set.
+func ValidateManifest(manifest *ProjectManifest, projectDir string) ([]string, []ValidationError) {
+	var warnings []string
+	var errors []ValidationError
+
+	if manifest.Name == "" {
+		warnings = append(warnings, "manifest has no name, the upload name is used")
+	}
+	if len(manifest.Services) == 0 {
+		errors = append(errors, ValidationError{Field: "services", Message: "manifest declares no services"})
+	}
+	errors = append(errors, validateResources("resources", manifest.Resources)...)
+	if manifest.ErrorPages != nil {
+		errors = append(errors, validateErrorPage("error_pages.404", manifest.ErrorPages.NotFound)...)
+		errors = append(errors, validateErrorPage("error_pages.50x", manifest.ErrorPages.ServerError)...)
+	}
+	errors = append(errors, validateHealthCheck("health_check", manifest.HealthCheck)...)
+	errors = append(errors, validateWebhook("webhook", manifest.Webhook)...)
+	errors = append(errors, validateSecretReferences("environment", manifest.Environment)...)
+	if _, err := FlattenConfig(manifest.Config); err != nil {
+		errors = append(errors, ValidationError{Field: "config", Message: err.Error()})
+	}
+	if manifest.Registries != nil {
+		errors = append(errors, validateRegistryURL("registries.npm", manifest.Registries.NPM)...)
+		errors = append(errors, validateRegistryURL("registries.pip", manifest.Registries.Pip)...)
+	}
+
+	for name, service := range manifest.Services {
+		field := fmt.Sprintf("services.%s", name)
+		if !serviceNamePattern.MatchString(name) {
+			errors = append(errors, ValidationError{
+				Field:   field,
+				Message: fmt.Sprintf("invalid service name '%s', use letters, digits, '-' and '_'", name),
+			})
+		}
+		if !SupportedServiceTypes[service.Type] {
+			errors = append(errors, ValidationError{
+				Field:   field + ".type",
+				Message: fmt.Sprintf("unsupported service type '%s'", service.Type),
+			})
+		}
+		if service.Image != "" {
+			errors = append(errors, validateServiceImage(field, service)...)
+		} else if service.Path == "" {
+			errors = append(errors, ValidationError{Field: field + ".path", Message: "service has no path or image"})
+		} else if projectDir != "" {
+			if _, err := os.Stat(filepath.Join(projectDir, service.Path)); err != nil {
+				errors = append(errors, ValidationError{
+					Field:   field + ".path",
+					Message: fmt.Sprintf("service directory %s does not exist", service.Path),
+				})
+			}
+		}
+		if service.Port < 0 || service.Port > 65535 {
+			errors = append(errors, ValidationError{
+				Field:   field + ".port",
+				Message: fmt.Sprintf("port %d is out of range", service.Port),
+			})
+		} else if service.Type == "api" && service.Port == 0 {
+			warnings = append(warnings, fmt.Sprintf("service %s has no port, defaulting to 5000", name))
+		}
+		errors = append(errors, validateResources(field+".resources", service.Resources)...)
+		errors = append(errors, validateDockerfile(field+".dockerfile", projectDir, service)...)
+		errors = append(errors, validateBuildContext(field+".build_context", projectDir, service)...)
+		errors = append(errors, validateServiceProcesses(field+".processes", projectDir, service)...)
+		errors = append(errors, validateSecretReferences(field+".env", service.Env)...)
+		errors = append(errors, validateBuildEnv(field+".build_env", service.BuildEnv)...)
+		if service.Type == "static" && service.Hooks != nil && (service.Hooks.PreDeploy != "" || service.Hooks.PostDeploy != "") {
+			errors = append(errors, ValidationError{Field: field + ".hooks", Message: "static services are served by NGINX and cannot run hooks"})
+		}
+		errors = append(errors, validateInitContainer(field+".init", service)...)
+		errors = append(errors, validateStartupProbe(field+".startup_probe", service)...)
+		if service.HealthPath != "" {
+			if service.Type != "api" {
+				errors = append(errors, ValidationError{Field: field + ".health_path", Message: "only api services can have a health_path"})
+			} else if !probePathPattern.MatchString(service.HealthPath) {
+				errors = append(errors, ValidationError{Field: field + ".health_path", Message: fmt.Sprintf("invalid health path '%s', expected an absolute path like /healthz", service.HealthPath)})
+			}
+		}
+		if service.StopSignal != "" && !ValidStopSignal(service.StopSignal) {
+			errors = append(errors, ValidationError{
+				Field:   field + ".stop_signal",
+				Message: fmt.Sprintf("invalid stop signal '%s', expected one of SIGTERM, SIGINT, SIGQUIT, SIGHUP, SIGUSR1, SIGUSR2, SIGWINCH or SIGKILL", service.StopSignal),
+			})
+		}
+		if service.NginxSnippet != "" {
+			if service.Type == "tcp" {
+				errors = append(errors, ValidationError{Field: field + ".nginx_snippet", Message: "tcp services are proxied by the stream module and cannot have an nginx_snippet"})
+			} else if err := ValidateNginxSnippet(service.NginxSnippet); err != nil {
+				errors = append(errors, ValidationError{Field: field + ".nginx_snippet", Message: err.Error()})
+			}
+		}
+	}
+
+	return warnings, errors
+}
+
+// Signals a service's containers may be stopped with instead of docker's default SIGTERM
+var stopSignals = map[string]bool{
+	"SIGTERM":  true,
+	"SIGINT":   true,
+	"SIGQUIT":  true,
+	"SIGHUP":   true,
+	"SIGUSR1":  true,
+	"SIGUSR2":  true,
+	"SIGWINCH": true,
+	"SIGKILL":  true,
+}
+
+// ValidStopSignal reports whether signal can be used as a stop signal, with or without
+// the SIG prefix and in any case like docker accepts it
+func ValidStopSignal(signal string) bool {
+	signal = strings.ToUpper(signal)
+	if !strings.HasPrefix(signal, "SIG") {
+		signal = "SIG" + signal
+	}
+	return stopSignals[signal]
+}
+
+// validateResources checks a resource block has sensible CPU and memory values
+func validateResources(field string, resources *Resources) []ValidationError {
+	if resources == nil {
+		return nil
+	}
+
+	var errors []ValidationError
+	if resources.CPUs < 0 {
+		errors = append(errors, ValidationError{Field: field + ".cpus", Message: "cpus must not be negative"})
+	}
+	if _, err := ParseMemory(resources.Memory); err != nil {
+		errors = append(errors, ValidationError{Field: field + ".memory", Message: err.Error()})
+	}
+	return errors
+}
+
+// Error page paths are written into the NGINX configuration, so only plain paths are allowed
+var errorPagePathPattern = regexp.MustCompile(`^/[A-Za-z0-9._~/-]+$`)
+
+// ValidErrorPagePath reports whether path can be used as a custom error page
+func ValidErrorPagePath(path string) bool {
+	return errorPagePathPattern.MatchString(path)
+}
+
+// validateErrorPage checks a custom error page path
+func validateErrorPage(field string, path string) []ValidationError {
+	if path == "" || ValidErrorPagePath(path) {
+		return nil
+	}
+	return []ValidationError{{Field: field, Message: fmt.Sprintf("invalid error page path '%s', expected an absolute path like /404.html", path)}}
+}
+
+// validateHealthCheck checks the proxy health check thresholds
+func validateHealthCheck(field string, check *HealthCheck) []ValidationError {
+	if check == nil {
+		return nil
+	}
+
+	var errors []ValidationError
+	if check.MaxFails != nil && *check.MaxFails < 0 {
+		errors = append(errors, ValidationError{Field: field + ".max_fails", Message: "max_fails must not be negative"})
+	}
+	if _, err := check.FailTimeoutSeconds(); err != nil {
+		errors = append(errors, ValidationError{Field: field + ".fail_timeout", Message: err.Error()})
+	}
+	return errors
+}
+
+// validateWebhook checks the webhook URL and the statuses it is notified of
+func validateWebhook(field string, webhook *Webhook) []ValidationError {
+	if webhook == nil {
+		return nil
+	}
+
+	var errors []ValidationError
+	parsed, err := url.Parse(webhook.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		errors = append(errors, ValidationError{Field: field + ".url", Message: fmt.Sprintf("invalid webhook URL '%s'", webhook.URL)})
+	}
+	for _, event := range webhook.Events {
+		if !WebhookEvents[event] {
+			errors = append(errors, ValidationError{Field: field + ".events", Message: fmt.Sprintf("unknown webhook event '%s'", event)})
+		}
+	}
+	return errors
+}
+
+// Startup probe paths are passed to wget, so only plain paths and queries are allowed
+var probePathPattern = regexp.MustCompile(`^/[A-Za-z0-9._~/?=&%+-]*$`)
+
+// validateStartupProbe checks a startup probe can be run against its service
+func validateStartupProbe(field string, service Service) []ValidationError {
+	probe := service.StartupProbe
+	if probe == nil {
+		return nil
+	}
+
+	var errors []ValidationError
+	if service.Type != "api" && service.Type != "tcp" {
+		errors = append(errors, ValidationError{Field: field, Message: "only api and tcp services listen on a port that can be probed"})
+	}
+	if probe.Path != "" {
+		if service.Type == "tcp" {
+			errors = append(errors, ValidationError{Field: field + ".path", Message: "tcp services are probed with a TCP connect and cannot have a path"})
+		} else if !probePathPattern.MatchString(probe.Path) {
+			errors = append(errors, ValidationError{Field: field + ".path", Message: fmt.Sprintf("invalid probe path '%s', expected an absolute path like /health", probe.Path)})
+		}
+	}
+	if _, _, err := probe.Durations(); err != nil {
+		errors = append(errors, ValidationError{Field: field, Message: err.Error()})
+	}
+	if probe.SuccessThreshold < 0 {
+		errors = append(errors, ValidationError{Field: field + ".success_threshold", Message: "success_threshold must not be negative"})
+	}
+	if probe.FailureThreshold < 0 {
+		errors = append(errors, ValidationError{Field: field + ".failure_threshold", Message: "failure_threshold must not be negative"})
+	}
+	return errors
+}
+
+// validateInitContainer checks a service's init container
+func validateInitContainer(field string, service Service) []ValidationError {
+	initContainer := service.Init
+	if initContainer == nil {
+		return nil
+	}
+
+	var errors []ValidationError
+	if service.Type == "static" {
+		errors = append(errors, ValidationError{Field: field, Message: "static services are served by NGINX and cannot run an init container"})
+	}
+	if strings.TrimSpace(initContainer.Command) == "" {
+		errors = append(errors, ValidationError{Field: field + ".command", Message: "init container has no command"})
+	}
+	seen := make(map[string]bool)
+	for i, path := range initContainer.Volumes {
+		volumeField := fmt.Sprintf("%s.volumes[%d]", field, i)
+		cleaned := filepath.Clean(path)
+		switch {
+		case !filepath.IsAbs(path) || cleaned == "/":
+			errors = append(errors, ValidationError{Field: volumeField, Message: fmt.Sprintf("invalid volume path '%s', expected an absolute path like /app/assets", path)})
+		case seen[cleaned]:
+			errors = append(errors, ValidationError{Field: volumeField, Message: fmt.Sprintf("volume path '%s' is listed more than once", path)})
+		}
+		seen[cleaned] = true
+	}
+	return errors
+}
+
+// validateSecretReferences checks the names of the secrets referenced in environment values
+func validateSecretReferences(field string, env map[string]string) []ValidationError {
+	var errors []ValidationError
+	for k, v := range env {
+		for _, name := range secrets.References(v) {
+			if !secrets.ValidName(name) {
+				errors = append(errors, ValidationError{
+					Field:   field + "." + k,
+					Message: fmt.Sprintf("invalid secret name '%s', use letters, digits, '.', '-' and '_'", name),
+				})
+			}
+		}
+	}
+	return errors
+}
+
+// Environment variable names usable at build time, also declared as Dockerfile ARGs
+var buildEnvKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// validateBuildEnv checks build-time variables have valid names and no secret references,
+// which would be baked into the image
+func validateBuildEnv(field string, env map[string]string) []ValidationError {
+	var errors []ValidationError
+	for k, v := range env {
+		if !buildEnvKeyPattern.MatchString(k) {
+			errors = append(errors, ValidationError{Field: field + "." + k, Message: fmt.Sprintf("invalid variable name '%s'", k)})
+		}
+		if len(secrets.References(v)) > 0 {
+			errors = append(errors, ValidationError{Field: field + "." + k, Message: "secrets cannot be used at build time, they would be baked into the image"})
+		}
+	}
+	return errors
+}
+
+// validateRegistryURL checks a package registry URL is an http(s) URL without credentials
+func validateRegistryURL(field string, value string) []ValidationError {
+	if value == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return []ValidationError{{Field: field, Message: fmt.Sprintf("invalid registry URL '%s'", value)}}
+	}
+	if parsed.User != nil {
+		return []ValidationError{{Field: field, Message: "registry credentials must not be stored in the manifest"}}
+	}
+	return nil
+}
+
+// Docker image references: an optional registry host, a lowercase repository path and
+// an optional tag or digest
+var imageReferencePattern = regexp.MustCompile(`^([A-Za-z0-9.-]+(:[0-9]+)?/)?[a-z0-9]+([._-][a-z0-9]+)*(/[a-z0-9]+([._-][a-z0-9]+)*)*(:[A-Za-z0-9_][A-Za-z0-9_.-]{0,127})?(@sha256:[a-f0-9]{64})?$`)
+
+// validateServiceImage checks the image of a service running a pre-built image, which
+// isn't built so can't have build settings
+func validateServiceImage(field string, service Service) []ValidationError {
+	var errors []ValidationError
+	if !imageReferencePattern.MatchString(service.Image) {
+		errors = append(errors, ValidationError{Field: field + ".image", Message: fmt.Sprintf("invalid image reference '%s'", service.Image)})
+	}
+	for setting, value := range map[string]string{
+		"path":          service.Path,
+		"build":         service.Build,
+		"dockerfile":    service.Dockerfile,
+		"build_context": service.BuildContext,
+		"runtime":       service.Runtime,
+		"entrypoint":    service.Entrypoint,
+		"output":        service.Output,
+	} {
+		if value != "" {
+			errors = append(errors, ValidationError{Field: field + "." + setting, Message: fmt.Sprintf("services running a pre-built image cannot set %s", setting)})
+		}
+	}
+	return errors
+}
+
+// validateDockerfile checks a custom Dockerfile stays inside the build context and exists
+func validateDockerfile(field string, projectDir string, service Service) []ValidationError {
+	if service.Dockerfile == "" {
+		return nil
+	}
+
+	if !isRelativeInside(service.Dockerfile) {
+		return []ValidationError{{Field: field, Message: fmt.Sprintf("dockerfile '%s' must be a path inside the build context", service.Dockerfile)}}
+	}
+	if projectDir != "" && (service.Path != "" || service.BuildContext != "") {
+		info, err := os.Stat(filepath.Join(service.BuildContextDir(projectDir), service.Dockerfile))
+		if err != nil || info.IsDir() {
+			return []ValidationError{{Field: field, Message: fmt.Sprintf("dockerfile %s does not exist", service.Dockerfile)}}
+		}
+	}
+	return nil
+}
+
+// validateBuildContext checks a build context stays inside the project directory
+func validateBuildContext(field string, projectDir string, service Service) []ValidationError {
+	if service.BuildContext == "" {
+		return nil
+	}
+
+	if !isRelativeInside(service.BuildContext) {
+		return []ValidationError{{Field: field, Message: fmt.Sprintf("build_context '%s' must be a path inside the project directory", service.BuildContext)}}
+	}
+	if service.Dockerfile == "" {
+		return []ValidationError{{Field: field, Message: "services with a build_context must set a dockerfile relative to it"}}
+	}
+	if projectDir != "" {
+		info, err := os.Stat(filepath.Join(projectDir, service.BuildContext))
+		if err != nil || !info.IsDir() {
+			return []ValidationError{{Field: field, Message: fmt.Sprintf("build_context %s is not a directory", service.BuildContext)}}
+		}
+	}
+	return nil
+}
+
+// isRelativeInside reports whether a path is relative and doesn't climb out of the
+// directory it is relative to
+func isRelativeInside(path string) bool {
+	cleaned := filepath.Clean(path)
+	return !filepath.IsAbs(cleaned) && cleaned != ".." && !strings.HasPrefix(cleaned, ".."+string(filepath.Separator))
+}
+
+// validateServiceProcesses checks the processes declared in the manifest or the service's Procfile
+func validateServiceProcesses(field string, projectDir string, service Service) []ValidationError {
+	processes, err := service.Processes, error(nil)
+	if projectDir != "" && service.Path != "" {
+		processes, err = LoadProcesses(projectDir, service)
+	} else {
+		err = validateProcesses(service.Processes)
+	}
+	if err != nil {
+		return []ValidationError{{Field: field, Message: err.Error()}}
+	}
+	if service.Type == "static" && len(processes) > 0 {
+		return []ValidationError{{Field: field, Message: "static services are served by NGINX and cannot run processes"}}
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// BaseDomain is the domain projects and services get subdomains of, configured with
+// PLATFORM_BASE_DOMAIN
+var BaseDomain = "platform.test"
+
+// A DNS name of at least two labels, each up to 63 letters, digits and inner hyphens
+var baseDomainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+func init() {
+	if value := os.Getenv("PLATFORM_BASE_DOMAIN"); value != "" {
+		BaseDomain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(value), "."))
+	}
+}
+
+// ValidateBaseDomain checks that a base domain is a well-formed DNS name
+func ValidateBaseDomain(domain string) error {
+	if len(domain) > 253 {
+		return fmt.Errorf("domain %q is longer than 253 characters", domain)
+	}
+	if !baseDomainPattern.MatchString(domain) {
+		return fmt.Errorf("domain %q is not a valid DNS name such as apps.example.com", domain)
+	}
+	return nil
+}
@@ -2,44 +2,152 @@ package proxy
 
 import (
 	"fmt"
+	"html"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"text/template"
 )
 
 // NginxConfig represents the configuration for NGINX
 type NginxConfig struct {
 	ConfigDir string
+
+	errorPagesMutex sync.Mutex
+	errorPages      map[string]ErrorPages // Custom error pages by project name
+
+	healthChecksMutex sync.Mutex
+	healthChecks      map[string]HealthCheck // Upstream health checks by project name
+
+	snippetsMutex sync.Mutex
+	snippets      map[string]map[string]string // Custom location directives by project and service name
+
+	portsMutex sync.Mutex
+	ports      map[string]map[string]int // Ports services listen on by project and service name
 }
 
+// SnippetError is returned when the configuration fails nginx -t with a service's custom
+// snippet. The snippet is dropped from the configuration before the error is returned.
+type SnippetError struct {
+	Service string
+	Output  string // Output of nginx -t
+}
+
+func (e *SnippetError) Error() string {
+	return fmt.Sprintf("nginx_snippet of service %s failed the NGINX configuration test: %s", e.Service, strings.TrimSpace(e.Output))
+}
+
+// ErrorPages are the paths of a project's custom error pages, served by its frontend
+type ErrorPages struct {
+	NotFound    string // Page for 404 responses
+	ServerError string // Page for 500, 502, 503 and 504 responses
+}
+
+// HealthCheck configures NGINX's passive health checks of a project's upstreams: a container
+// failing MaxFails times within FailTimeout seconds is taken out of rotation for FailTimeout
+// seconds. Every address a container name resolves to, e.g. each replica sharing a network
+// alias, is checked on its own. A MaxFails of 0 disables the checks.
+type HealthCheck struct {
+	MaxFails    int
+	FailTimeout int
+}
+
+// Ports a project's configuration proxies to when a service doesn't have one of its own
+const (
+	defaultServicePort = 80   // Port of static sites
+	defaultBackendPort = 5000 // Port of API services
+)
+
+// DefaultHealthCheck is used for projects that don't configure their health checks
+var DefaultHealthCheck = HealthCheck{MaxFails: 3, FailTimeout: 10}
+
 // ServerConfig represents a server block configuration for a service
 type ServerConfig struct {
+	HealthCheck
 	ServerName string
+	Upstream   string
 	ProxyPass  string
 	Port       int
+	Snippet    string // Custom directives added to the location block
 }
 
 // ProjectConfig represents a combined configuration for a project with frontend and backend
 type ProjectConfig struct {
+	HealthCheck
 	ProjectDomain     string
+	FrontendUpstream  string
 	FrontendContainer string
+	BackendUpstream   string
 	BackendContainer  string
+	FrontendPort      int
 	BackendPort       int
+	NotFoundPage      string // Custom 404 page, responses are passed through when empty
+	ServerErrorPage   string // Custom 50x page, NGINX's own page is used when empty
+	FrontendSnippet   string // Custom directives of the frontend, added to its location block
+	BackendSnippet    string // Custom directives of the backend, added to its location block
+}
+
+// The template for an upstream with passive health checks. Container names are resolved
+// at runtime, so containers that don't exist yet don't break the configuration. Resolving
+// servers at runtime needs NGINX 1.27.3 or later. Upstream names join the sanitized project
+// and service names with '_', which sanitized names can't contain, so they are unique.
+const upstreamTemplate = `{{ define "upstream" }}upstream {{ .Name }} {
+    zone {{ .Name }} 64k;
+    # Use DNS resolver to handle container name resolution across networks
+    resolver 127.0.0.11 valid=30s;
+    server {{ .Container }}:{{ .Port }} max_fails={{ .MaxFails }} fail_timeout={{ .FailTimeout }}s resolve;
+}{{ end }}`
+
+// upstreamData is the data the upstream template is executed with
+type upstreamData struct {
+	HealthCheck
+	Name      string
+	Container string
+	Port      int
+}
+
+// upstream returns the data of an upstream for a container
+func upstream(check HealthCheck, name, container string, port int) upstreamData {
+	return upstreamData{HealthCheck: check, Name: name, Container: container, Port: port}
+}
+
+// indent indents each line of text by the given number of spaces
+func indent(spaces int, text string) string {
+	prefix := strings.Repeat(" ", spaces)
+	lines := strings.Split(strings.Trim(text, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+		if lines[i] != "" {
+			lines[i] = prefix + lines[i]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// parseTemplate parses a configuration template along with the upstream template
+func parseTemplate(name, text string) (*template.Template, error) {
+	funcs := template.FuncMap{"upstream": upstream, "indent": indent}
+	tmpl, err := template.New(name).Funcs(funcs).Parse(upstreamTemplate)
+	if err != nil {
+		return nil, err
+	}
+	return tmpl.Parse(text)
 }
 
 // The template for an NGINX server block configuration for individual services
-const serverConfigTemplate = `server {
+const serverConfigTemplate = `{{ template "upstream" upstream .HealthCheck .Upstream .ProxyPass .Port }}
+
+server {
     listen 80;
     server_name {{ .ServerName }};
     
     location / {
-        # Use DNS resolver to handle container name resolution across networks
-        resolver 127.0.0.11 valid=30s;
-        set $upstream {{ .ProxyPass }};
-        proxy_pass http://$upstream:{{ .Port }};
+        proxy_pass http://{{ .Upstream }};
+        # Retry failed requests on another replica when there is one
+        proxy_next_upstream error timeout http_502 http_503 http_504;
         proxy_set_header Host $host;
         proxy_set_header X-Real-IP $remote_addr;
         proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
@@ -60,19 +168,31 @@ const serverConfigTemplate = `server {
             add_header 'Content-Length' 0;
             return 204;
         }
+        {{- if .Snippet }}
+        
+        # Custom directives from the project manifest
+{{ indent 8 .Snippet }}
+        {{- end }}
     }
 }`
 
 // The template for the main project configuration file that combines frontend and backend
-const projectConfigTemplate = `server {
+const projectConfigTemplate = `{{ template "upstream" upstream .HealthCheck .FrontendUpstream .FrontendContainer .FrontendPort }}
+
+{{ template "upstream" upstream .HealthCheck .BackendUpstream .BackendContainer .BackendPort }}
+
+server {
     listen 80;
     server_name {{ .ProjectDomain }};
+    {{ if .NotFoundPage }}
+    error_page 404 {{ .NotFoundPage }};
+    {{- end }}
+    error_page 500 502 503 504 {{ if .ServerErrorPage }}{{ .ServerErrorPage }}{{ else }}/50x.html{{ end }};
     
     location / {
-        # Use DNS resolver to handle container name resolution across networks
-        resolver 127.0.0.11 valid=30s;
-        set $frontend {{ .FrontendContainer }};
-        proxy_pass http://$frontend:80;
+        proxy_pass http://{{ .FrontendUpstream }};
+        # Retry failed requests on another replica when there is one
+        proxy_next_upstream error timeout http_502 http_503 http_504;
         proxy_set_header Host $host;
         proxy_set_header X-Real-IP $remote_addr;
         proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
@@ -93,13 +213,38 @@ const projectConfigTemplate = `server {
             add_header 'Content-Length' 0;
             return 204;
         }
+        {{- if or .NotFoundPage .ServerErrorPage }}
+        
+        # Replace the frontend's error responses with the custom error pages
+        proxy_intercept_errors on;
+        {{- end }}
+        {{- if .FrontendSnippet }}
+        
+        # Custom directives from the project manifest
+{{ indent 8 .FrontendSnippet }}
+        {{- end }}
     }
-    
+    {{ if .NotFoundPage }}
+    location = {{ .NotFoundPage }} {
+        internal;
+        proxy_pass http://{{ $.FrontendUpstream }};
+    }
+    {{ end }}
+    {{- if and .ServerErrorPage (ne .ServerErrorPage .NotFoundPage) }}
+    location = {{ .ServerErrorPage }} {
+        internal;
+        proxy_pass http://{{ $.FrontendUpstream }};
+    }
+    {{ else if not .ServerErrorPage }}
+    location = /50x.html {
+        internal;
+        root /usr/share/nginx/html;
+    }
+    {{ end }}
     location /api/ {
-        # Use DNS resolver to handle container name resolution across networks
-        resolver 127.0.0.11 valid=30s;
-        set $backend {{ .BackendContainer }};
-        proxy_pass http://$backend:{{ .BackendPort }};
+        proxy_pass http://{{ .BackendUpstream }};
+        # Retry failed requests on another replica when there is one
+        proxy_next_upstream error timeout http_502 http_503 http_504;
         proxy_set_header Host $host;
         proxy_set_header X-Real-IP $remote_addr;
         proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
@@ -120,13 +265,86 @@ const projectConfigTemplate = `server {
             add_header 'Content-Length' 0;
             return 204;
         }
+        {{- if .BackendSnippet }}
+        
+        # Custom directives from the project manifest
+{{ indent 8 .BackendSnippet }}
+        {{- end }}
+    }
+}`
+
+// Port range NGINX listens on for TCP stream proxies; it must be published by the NGINX container
+const (
+	streamPortStart = 20000
+	streamPortEnd   = 20099
+)
+
+// StreamConfig represents a stream server block configuration for a TCP service
+type StreamConfig struct {
+	HealthCheck
+	ListenPort int
+	Upstream   string
+	ProxyPass  string
+	Port       int
+}
+
+// The template for an NGINX stream server block for TCP services
+const streamConfigTemplate = `{{ template "upstream" upstream .HealthCheck .Upstream .ProxyPass .Port }}
+
+server {
+    listen {{ .ListenPort }};
+
+    proxy_pass {{ .Upstream }};
+    proxy_connect_timeout 10s;
+    # Connect to another replica when there is one
+    proxy_next_upstream on;
+}`
+
+// PausedConfig represents the server block served while a project is paused
+type PausedConfig struct {
+	ServerNames string
+	ProjectName string // Escaped with pausedPageText
+}
+
+// The template for the server block answering with a "paused" page for all of a project's domains
+const pausedConfigTemplate = `server {
+    listen 80;
+    server_name {{ .ServerNames }};
+
+    location / {
+        default_type text/html;
+        add_header 'Retry-After' '3600' always;
+        return 503 '<!DOCTYPE html><html><head><title>Project paused</title></head><body style="font-family: sans-serif; text-align: center; padding-top: 15%;"><h1>{{ .ProjectName }} is paused</h1><p>This project has been paused by its owner. Please check back later.</p></body></html>';
+    }
+}`
+
+// Suffix given to configuration files disabled while a project is paused
+const pausedSuffix = ".paused"
+
+// Config file of the catch-all server for subdomains of the base domain no project serves
+const notFoundConfigFileName = "platform-not-found.conf"
+
+// Template for the catch-all server. NGINX prefers exact server names, which every project
+// and service uses, over a leading wildcard, so this only answers unmapped subdomains.
+const notFoundConfigTemplate = `server {
+    listen 80;
+    server_name *.{{ .BaseDomain }};
+
+    location / {
+        default_type text/html;
+        add_header 'Cache-Control' 'no-store' always;
+        return 404 '<!DOCTYPE html><html><head><title>Project not found</title></head><body style="font-family: sans-serif; text-align: center; padding-top: 15%;"><h1>Project not found</h1><p>No project is deployed at $host. It may have been deleted or not deployed yet.</p></body></html>';
     }
 }`
 
 // NewNginxConfig creates a new NGINX configuration manager
 func NewNginxConfig(configDir string) *NginxConfig {
 	return &NginxConfig{
-		ConfigDir: configDir,
+		ConfigDir:    configDir,
+		errorPages:   make(map[string]ErrorPages),
+		healthChecks: make(map[string]HealthCheck),
+		snippets:     make(map[string]map[string]string),
+		ports:        make(map[string]map[string]int),
 	}
 }
 
@@ -136,7 +354,7 @@ func GenerateSubdomain(projectName, serviceName string) string {
 	projectName = sanitizeName(projectName)
 	serviceName = sanitizeName(serviceName)
 
-	return fmt.Sprintf("%s-%s.platform.test", projectName, serviceName)
+	return fmt.Sprintf("%s-%s.%s", projectName, serviceName, BaseDomain)
 }
 
 // GenerateProjectDomain generates the main domain for a project
@@ -144,7 +362,7 @@ func GenerateProjectDomain(projectName string) string {
 	// Sanitize project name to be DNS-compatible
 	projectName = sanitizeName(projectName)
 
-	return fmt.Sprintf("%s.platform.test", projectName)
+	return fmt.Sprintf("%s.%s", projectName, BaseDomain)
 }
 
 // sanitizeName ensures a name is DNS-compatible
@@ -199,28 +417,81 @@ func (nc *NginxConfig) ConnectNginxToNetwork(networkName string) error {
 
 // CreateMapping creates an NGINX configuration file for a service
 func (nc *NginxConfig) CreateMapping(projectName, serviceName, containerName string, port int) (string, error) {
+	subdomain, err := nc.writeServiceConfig(projectName, serviceName, containerName, port)
+	if err != nil {
+		return "", err
+	}
+
+	// Create or update the main project configuration file
+	if err := nc.createOrUpdateProjectConfig(projectName); err != nil {
+		log.Printf("Warning: failed to create/update project config: %v", err)
+	}
+
+	// Test a custom snippet before it is loaded, and drop it when NGINX rejects it
+	// so the configuration keeps working for the other services
+	var snippetErr error
+	if nc.snippetFor(projectName, serviceName) != "" {
+		if output, err := nc.TestConfig(); err != nil {
+			log.Printf("NGINX rejected the snippet of service %s in project %s: %s", serviceName, projectName, output)
+			snippetErr = &SnippetError{Service: serviceName, Output: output}
+
+			nc.snippetsMutex.Lock()
+			delete(nc.snippets[projectName], serviceName)
+			nc.snippetsMutex.Unlock()
+			if _, err := nc.writeServiceConfig(projectName, serviceName, containerName, port); err != nil {
+				return "", err
+			}
+			if err := nc.createOrUpdateProjectConfig(projectName); err != nil {
+				log.Printf("Warning: failed to create/update project config: %v", err)
+			}
+		}
+	}
+
+	// Connect NGINX to the project network
+	networkName := fmt.Sprintf("project-%s-network", projectName)
+	if err := nc.ConnectNginxToNetwork(networkName); err != nil {
+		log.Printf("Warning: failed to connect NGINX to network: %v", err)
+	}
+
+	// Reload NGINX
+	if err := nc.ReloadNginx(); err != nil {
+		log.Printf("Warning: failed to reload NGINX: %v", err)
+	}
+
+	if snippetErr != nil {
+		return "", snippetErr
+	}
+	return subdomain, nil
+}
+
+// writeServiceConfig writes the server block of a service and returns its subdomain
+func (nc *NginxConfig) writeServiceConfig(projectName, serviceName, containerName string, port int) (string, error) {
 	subdomain := GenerateSubdomain(projectName, serviceName)
 	configFileName := fmt.Sprintf("%s-%s.conf", sanitizeName(projectName), sanitizeName(serviceName))
 	configPath := filepath.Join(nc.ConfigDir, configFileName)
 
-	// For static services, we use port 80 internally
+	// Services without a port of their own, e.g. workers, are proxied on the HTTP port
 	proxyPort := port
-	if strings.Contains(serviceName, "frontend") || strings.Contains(serviceName, "static") {
-		proxyPort = 80
+	if proxyPort <= 0 {
+		proxyPort = defaultServicePort
 	}
+	nc.setServicePort(projectName, serviceName, proxyPort)
 
 	// Create server config
 	serverConfig := ServerConfig{
-		ServerName: subdomain,
-		ProxyPass:  containerName,
-		Port:       proxyPort,
+		HealthCheck: nc.healthCheckFor(projectName),
+		ServerName:  subdomain,
+		Upstream:    fmt.Sprintf("svc_%s_%s", sanitizeName(projectName), sanitizeName(serviceName)),
+		ProxyPass:   containerName,
+		Port:        proxyPort,
+		Snippet:     nc.snippetFor(projectName, serviceName),
 	}
 
 	// Log the domain being used
 	log.Printf("Creating NGINX mapping for domain: %s -> %s:%d", subdomain, containerName, proxyPort)
 
 	// Parse template
-	tmpl, err := template.New("server").Parse(serverConfigTemplate)
+	tmpl, err := parseTemplate("server", serverConfigTemplate)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse template: %v", err)
 	}
@@ -238,10 +509,67 @@ func (nc *NginxConfig) CreateMapping(projectName, serviceName, containerName str
 	}
 
 	log.Printf("Created NGINX mapping for %s at %s", subdomain, configPath)
+	return subdomain, nil
+}
 
-	// Create or update the main project configuration file
-	if err := nc.createOrUpdateProjectConfig(projectName); err != nil {
-		log.Printf("Warning: failed to create/update project config: %v", err)
+// streamConfigDir returns the directory holding stream configurations. It is kept
+// separate from the http server blocks since it is included from the stream context.
+func (nc *NginxConfig) streamConfigDir() string {
+	return filepath.Join(nc.ConfigDir, "stream")
+}
+
+// streamConfigPath returns the stream configuration file of a service
+func (nc *NginxConfig) streamConfigPath(projectName, serviceName string) string {
+	configFileName := fmt.Sprintf("%s-%s.conf", sanitizeName(projectName), sanitizeName(serviceName))
+	return filepath.Join(nc.streamConfigDir(), configFileName)
+}
+
+// allocateStreamPort returns the port already assigned to a service, or the first free port in the range
+func (nc *NginxConfig) allocateStreamPort(configPath string) (int, error) {
+	entries, err := os.ReadDir(nc.streamConfigDir())
+	if err != nil && !os.IsNotExist(err) {
+		return 0, fmt.Errorf("failed to read stream config directory: %v", err)
+	}
+
+	used := make(map[int]bool)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(nc.streamConfigDir(), entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		var port int
+		for _, line := range strings.Split(string(data), "\n") {
+			if _, err := fmt.Sscanf(strings.TrimSpace(line), "listen %d;", &port); err == nil {
+				break
+			}
+		}
+		if port == 0 {
+			continue
+		}
+
+		// Keep the existing port when a service is redeployed
+		if entry.Name() == filepath.Base(configPath) {
+			return port, nil
+		}
+		used[port] = true
+	}
+
+	for port := streamPortStart; port <= streamPortEnd; port++ {
+		if !used[port] {
+			return port, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no free TCP ports left in range %d-%d", streamPortStart, streamPortEnd)
+}
+
+// CreateStreamMapping creates an NGINX stream configuration forwarding a public TCP port to a
+// service container. It returns the allocated public port.
+func (nc *NginxConfig) CreateStreamMapping(projectName, serviceName, containerName string, port int) (int, error) {
+	listenPort, err := nc.writeStreamConfig(projectName, serviceName, containerName, port)
+	if err != nil {
+		return 0, err
 	}
 
 	// Connect NGINX to the project network
@@ -255,7 +583,287 @@ func (nc *NginxConfig) CreateMapping(projectName, serviceName, containerName str
 		log.Printf("Warning: failed to reload NGINX: %v", err)
 	}
 
-	return subdomain, nil
+	return listenPort, nil
+}
+
+// writeStreamConfig writes the stream configuration of a service and returns its public port
+func (nc *NginxConfig) writeStreamConfig(projectName, serviceName, containerName string, port int) (int, error) {
+	if err := os.MkdirAll(nc.streamConfigDir(), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create stream config directory: %v", err)
+	}
+
+	configPath := nc.streamConfigPath(projectName, serviceName)
+	listenPort, err := nc.allocateStreamPort(configPath)
+	if err != nil {
+		return 0, err
+	}
+
+	// Create stream config
+	streamConfig := StreamConfig{
+		HealthCheck: nc.healthCheckFor(projectName),
+		ListenPort:  listenPort,
+		Upstream:    fmt.Sprintf("tcp_%s_%s", sanitizeName(projectName), sanitizeName(serviceName)),
+		ProxyPass:   containerName,
+		Port:        port,
+	}
+
+	log.Printf("Creating NGINX stream mapping for port %d -> %s:%d", listenPort, containerName, port)
+
+	// Parse template
+	tmpl, err := parseTemplate("stream", streamConfigTemplate)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse stream template: %v", err)
+	}
+
+	// Create config file
+	file, err := os.Create(configPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create stream config file: %v", err)
+	}
+	defer file.Close()
+
+	// Execute template
+	if err := tmpl.Execute(file, streamConfig); err != nil {
+		return 0, fmt.Errorf("failed to execute stream template: %v", err)
+	}
+
+	log.Printf("Created NGINX stream mapping for %s-%s at %s", projectName, serviceName, configPath)
+	return listenPort, nil
+}
+
+// MappingExists reports whether an HTTP or stream configuration exists for a service
+func (nc *NginxConfig) MappingExists(projectName, serviceName string) bool {
+	configFileName := fmt.Sprintf("%s-%s.conf", sanitizeName(projectName), sanitizeName(serviceName))
+	if _, err := os.Stat(filepath.Join(nc.ConfigDir, configFileName)); err == nil {
+		return true
+	}
+	_, err := os.Stat(nc.streamConfigPath(projectName, serviceName))
+	return err == nil
+}
+
+// ProjectConfigExists reports whether the main project configuration file exists
+func (nc *NginxConfig) ProjectConfigExists(projectName string) bool {
+	configFileName := fmt.Sprintf("%s.conf", sanitizeName(projectName))
+	_, err := os.Stat(filepath.Join(nc.ConfigDir, configFileName))
+	return err == nil
+}
+
+// pausedConfigPath returns the path of the "paused" server block of a project. Sanitized
+// names never contain '_', so it can't be the config file of one of the project's services.
+func (nc *NginxConfig) pausedConfigPath(projectName string) string {
+	return filepath.Join(nc.ConfigDir, fmt.Sprintf("%s_paused.conf", sanitizeName(projectName)))
+}
+
+// pausedPageText escapes text for the HTML of the paused page, within a single quoted
+// NGINX string: besides HTML markup, quotes, backslashes and variables are escaped
+func pausedPageText(text string) string {
+	return strings.NewReplacer("\\", "&#92;", "$", "&#36;").Replace(html.EscapeString(text))
+}
+
+// PauseProject disables the HTTP mappings of a project's services and serves a
+// "project is paused" page with a 503 status on their domains instead
+func (nc *NginxConfig) PauseProject(projectName string, serviceNames []string) error {
+	var serverNames []string
+
+	// Disable the service mappings, remembering which domains they served
+	for _, serviceName := range serviceNames {
+		configPath := filepath.Join(nc.ConfigDir, fmt.Sprintf("%s-%s.conf", sanitizeName(projectName), sanitizeName(serviceName)))
+		if _, err := os.Stat(configPath); err != nil {
+			continue
+		}
+		if err := os.Rename(configPath, configPath+pausedSuffix); err != nil {
+			return fmt.Errorf("failed to disable mapping for %s: %v", serviceName, err)
+		}
+		serverNames = append(serverNames, GenerateSubdomain(projectName, serviceName))
+	}
+
+	// Disable the main project mapping
+	projectConfigPath := filepath.Join(nc.ConfigDir, fmt.Sprintf("%s.conf", sanitizeName(projectName)))
+	if _, err := os.Stat(projectConfigPath); err == nil {
+		if err := os.Rename(projectConfigPath, projectConfigPath+pausedSuffix); err != nil {
+			return fmt.Errorf("failed to disable project mapping: %v", err)
+		}
+		serverNames = append(serverNames, GenerateProjectDomain(projectName))
+	}
+
+	if len(serverNames) == 0 {
+		log.Printf("Project %s has no NGINX mappings to pause", projectName)
+		return nil
+	}
+
+	// Parse template
+	tmpl, err := template.New("paused").Parse(pausedConfigTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse paused template: %v", err)
+	}
+
+	// Create config file
+	file, err := os.Create(nc.pausedConfigPath(projectName))
+	if err != nil {
+		return fmt.Errorf("failed to create paused config file: %v", err)
+	}
+	defer file.Close()
+
+	// Execute template
+	pausedConfig := PausedConfig{
+		ServerNames: strings.Join(serverNames, " "),
+		ProjectName: pausedPageText(projectName),
+	}
+	if err := tmpl.Execute(file, pausedConfig); err != nil {
+		return fmt.Errorf("failed to execute paused template: %v", err)
+	}
+
+	log.Printf("Serving paused page for project %s on %s", projectName, pausedConfig.ServerNames)
+
+	// Reload NGINX
+	if err := nc.ReloadNginx(); err != nil {
+		log.Printf("Warning: failed to reload NGINX: %v", err)
+	}
+
+	return nil
+}
+
+// ResumeProject removes the "paused" page of a project and restores its mappings
+func (nc *NginxConfig) ResumeProject(projectName string, serviceNames []string) error {
+	if err := os.Remove(nc.pausedConfigPath(projectName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove paused config file: %v", err)
+	}
+
+	// Projects paused before the paused page was renamed have it at <project>-paused.conf,
+	// unless that is the config file of a service named paused
+	legacyPausedPath := filepath.Join(nc.ConfigDir, fmt.Sprintf("%s-paused.conf", sanitizeName(projectName)))
+	legacyIsService := false
+	for _, serviceName := range serviceNames {
+		if sanitizeName(serviceName) == "paused" {
+			legacyIsService = true
+		}
+	}
+	if !legacyIsService {
+		if err := os.Remove(legacyPausedPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove paused config file: %v", err)
+		}
+	}
+
+	// Re-enable every mapping disabled by PauseProject
+	configFileNames := []string{fmt.Sprintf("%s.conf", sanitizeName(projectName))}
+	for _, serviceName := range serviceNames {
+		configFileNames = append(configFileNames, fmt.Sprintf("%s-%s.conf", sanitizeName(projectName), sanitizeName(serviceName)))
+	}
+
+	restored := 0
+	for _, configFileName := range configFileNames {
+		configPath := filepath.Join(nc.ConfigDir, configFileName)
+		if _, err := os.Stat(configPath + pausedSuffix); err != nil {
+			continue
+		}
+		if err := os.Rename(configPath+pausedSuffix, configPath); err != nil {
+			return fmt.Errorf("failed to restore mapping %s: %v", configFileName, err)
+		}
+		restored++
+	}
+
+	log.Printf("Restored %d NGINX mappings for project %s", restored, projectName)
+
+	// Reload NGINX
+	if err := nc.ReloadNginx(); err != nil {
+		log.Printf("Warning: failed to reload NGINX: %v", err)
+	}
+
+	return nil
+}
+
+// SetErrorPages sets the custom error pages used in the project's configuration the next
+// time it is generated. Empty paths fall back to the defaults.
+func (nc *NginxConfig) SetErrorPages(projectName string, pages ErrorPages) {
+	nc.errorPagesMutex.Lock()
+	defer nc.errorPagesMutex.Unlock()
+
+	if pages == (ErrorPages{}) {
+		delete(nc.errorPages, projectName)
+		return
+	}
+	nc.errorPages[projectName] = pages
+}
+
+// SetHealthCheck sets the health checks used in the project's configurations the next time
+// they are generated
+func (nc *NginxConfig) SetHealthCheck(projectName string, check HealthCheck) {
+	nc.healthChecksMutex.Lock()
+	defer nc.healthChecksMutex.Unlock()
+
+	if check == DefaultHealthCheck {
+		delete(nc.healthChecks, projectName)
+		return
+	}
+	nc.healthChecks[projectName] = check
+}
+
+// healthCheckFor returns the health checks of a project's upstreams
+func (nc *NginxConfig) healthCheckFor(projectName string) HealthCheck {
+	nc.healthChecksMutex.Lock()
+	defer nc.healthChecksMutex.Unlock()
+
+	if check, exists := nc.healthChecks[projectName]; exists {
+		return check
+	}
+	return DefaultHealthCheck
+}
+
+// SetSnippets sets the custom location directives of the project's services, keyed by
+// service name, used the next time their configurations are generated. Snippets must be
+// validated before they are set; they are inserted verbatim.
+func (nc *NginxConfig) SetSnippets(projectName string, snippets map[string]string) {
+	nc.snippetsMutex.Lock()
+	defer nc.snippetsMutex.Unlock()
+
+	if len(snippets) == 0 {
+		delete(nc.snippets, projectName)
+		return
+	}
+	nc.snippets[projectName] = snippets
+}
+
+// snippetFor returns the custom location directives of a service
+func (nc *NginxConfig) snippetFor(projectName, serviceName string) string {
+	nc.snippetsMutex.Lock()
+	defer nc.snippetsMutex.Unlock()
+
+	return nc.snippets[projectName][serviceName]
+}
+
+// setServicePort records the port a service's mapping proxies to, so the project's
+// configuration routes to the same port
+func (nc *NginxConfig) setServicePort(projectName, serviceName string, port int) {
+	nc.portsMutex.Lock()
+	defer nc.portsMutex.Unlock()
+
+	if nc.ports[projectName] == nil {
+		nc.ports[projectName] = make(map[string]int)
+	}
+	nc.ports[projectName][serviceName] = port
+}
+
+// servicePort returns the port a service's mapping proxies to, or the fallback when the
+// service isn't mapped
+func (nc *NginxConfig) servicePort(projectName, serviceName string, fallback int) int {
+	nc.portsMutex.Lock()
+	defer nc.portsMutex.Unlock()
+
+	if port, exists := nc.ports[projectName][serviceName]; exists {
+		return port
+	}
+	return fallback
+}
+
+// forgetServicePort drops the recorded port of a service whose mapping was deleted
+func (nc *NginxConfig) forgetServicePort(projectName, serviceName string) {
+	nc.portsMutex.Lock()
+	defer nc.portsMutex.Unlock()
+
+	delete(nc.ports[projectName], serviceName)
+	if len(nc.ports[projectName]) == 0 {
+		delete(nc.ports, projectName)
+	}
 }
 
 // createOrUpdateProjectConfig creates or updates the main project configuration file
@@ -271,14 +879,29 @@ func (nc *NginxConfig) createOrUpdateProjectConfig(projectName string) error {
 
 	// Create project config
 	projectConfig := ProjectConfig{
+		HealthCheck:       nc.healthCheckFor(projectName),
 		ProjectDomain:     projectDomain,
+		FrontendUpstream:  fmt.Sprintf("site-%s-frontend", sanitizeName(projectName)),
 		FrontendContainer: frontendContainer,
+		BackendUpstream:   fmt.Sprintf("site-%s-backend", sanitizeName(projectName)),
 		BackendContainer:  backendContainer,
-		BackendPort:       5000, // Default backend port
+		// Route to the ports the services were mapped with, defaulting to the ports of a
+		// static frontend and an API backend for services that aren't mapped yet
+		FrontendPort: nc.servicePort(projectName, "frontend", defaultServicePort),
+		BackendPort:  nc.servicePort(projectName, "backend", defaultBackendPort),
 	}
 
+	// Point the error pages at the project's frontend
+	nc.errorPagesMutex.Lock()
+	pages := nc.errorPages[projectName]
+	nc.errorPagesMutex.Unlock()
+	projectConfig.NotFoundPage = pages.NotFound
+	projectConfig.ServerErrorPage = pages.ServerError
+	projectConfig.FrontendSnippet = nc.snippetFor(projectName, "frontend")
+	projectConfig.BackendSnippet = nc.snippetFor(projectName, "backend")
+
 	// Parse template
-	tmpl, err := template.New("project").Parse(projectConfigTemplate)
+	tmpl, err := parseTemplate("project", projectConfigTemplate)
 	if err != nil {
 		return fmt.Errorf("failed to parse project template: %v", err)
 	}
@@ -331,6 +954,17 @@ func (nc *NginxConfig) DeleteMapping(projectName, serviceName string) error {
 		}
 	}
 
+	nc.forgetServicePort(projectName, serviceName)
+
+	// Remove the stream config of TCP services
+	streamConfigPath := nc.streamConfigPath(projectName, serviceName)
+	if _, err := os.Stat(streamConfigPath); err == nil {
+		log.Printf("Removing NGINX stream config file: %s", streamConfigPath)
+		if err := os.Remove(streamConfigPath); err != nil {
+			log.Printf("Warning: failed to remove stream config file %s: %v", streamConfigPath, err)
+		}
+	}
+
 	// If this is the last service being deleted, also remove the main project config file
 	if serviceName == "frontend" || serviceName == "backend" {
 		// Check if the other service config file exists
@@ -367,6 +1001,26 @@ func (nc *NginxConfig) DeleteMapping(projectName, serviceName string) error {
 	return nil
 }
 
+// EnsureNotFoundConfig writes the catch-all server answering subdomains of the base domain
+// that no project or service is mapped to, e.g. of a deleted project, with a "not found" page
+func (nc *NginxConfig) EnsureNotFoundConfig() error {
+	tmpl, err := template.New("notFound").Parse(notFoundConfigTemplate)
+	if err != nil {
+		return fmt.Errorf("failed to parse not found template: %v", err)
+	}
+
+	file, err := os.Create(filepath.Join(nc.ConfigDir, notFoundConfigFileName))
+	if err != nil {
+		return fmt.Errorf("failed to create not found config file: %v", err)
+	}
+	defer file.Close()
+
+	if err := tmpl.Execute(file, map[string]string{"BaseDomain": BaseDomain}); err != nil {
+		return fmt.Errorf("failed to execute not found template: %v", err)
+	}
+	return nil
+}
+
 // ReloadNginx reloads the NGINX configuration
 func (nc *NginxConfig) ReloadNginx() error {
 	cmd := exec.Command("docker", "exec", "platform-repository-nginx-1", "nginx", "-s", "reload")
@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Configuration files shipped with NGINX that aren't owned by any project
+var sharedConfigFiles = map[string]bool{
+	"default.conf":        true,
+	"custom-domains.conf": true,
+	"direct.conf":         true,
+}
+
+// ReconcileService is a service whose mapping should exist
+type ReconcileService struct {
+	Name          string
+	ContainerName string
+	Port          int  // Container port
+	TCP           bool // Exposed through a stream proxy instead of an HTTP mapping
+}
+
+// ReconcileProject is a deployed project whose mappings should exist
+type ReconcileProject struct {
+	Name       string
+	Paused     bool // Paused projects keep their disabled mappings and paused page
+	ErrorPages  ErrorPages
+	HealthCheck HealthCheck
+	Snippets    map[string]string // Custom location directives by service name
+	Services    []ReconcileService
+}
+
+// ReconcileReport describes the changes made while reconciling the NGINX configuration
+type ReconcileReport struct {
+	Regenerated []string       `json:"regenerated"`           // Config files written from the project state
+	Removed     []string       `json:"removed"`               // Orphaned config files removed
+	Networks    []string       `json:"networks"`              // Project networks NGINX is connected to
+	StreamPorts map[string]int `json:"streamPorts,omitempty"` // Public ports of TCP services, keyed project/service
+	Errors      []string       `json:"errors"`
+	ConfigTest  string         `json:"configTest"` // Output of nginx -t
+	Reloaded    bool           `json:"reloaded"`
+}
+
+// Reconcile regenerates the configuration of the given projects, removes configuration
+// files that don't belong to any of them, reconnects NGINX to the project networks and
+// reloads NGINX once the configuration passes nginx -t
+func (nc *NginxConfig) Reconcile(projects []ReconcileProject) (*ReconcileReport, error) {
+	report := &ReconcileReport{
+		Regenerated: []string{},
+		Removed:     []string{},
+		Networks:    []string{},
+		StreamPorts: make(map[string]int),
+		Errors:      []string{},
+	}
+
+	// Config files that should exist, relative to the config directory
+	expected := make(map[string]bool)
+	for configFileName := range sharedConfigFiles {
+		expected[configFileName] = true
+	}
+	expected[notFoundConfigFileName] = true
+	if err := nc.EnsureNotFoundConfig(); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", notFoundConfigFileName, err))
+	} else {
+		report.Regenerated = append(report.Regenerated, notFoundConfigFileName)
+	}
+
+	for _, project := range projects {
+		name := sanitizeName(project.Name)
+		hasHTTP := false
+		nc.SetHealthCheck(project.Name, project.HealthCheck)
+		nc.SetSnippets(project.Name, project.Snippets)
+
+		for _, service := range project.Services {
+			serviceFileName := fmt.Sprintf("%s-%s.conf", name, sanitizeName(service.Name))
+
+			if service.TCP {
+				streamFileName := filepath.Join("stream", serviceFileName)
+				expected[streamFileName] = true
+				listenPort, err := nc.writeStreamConfig(project.Name, service.Name, service.ContainerName, service.Port)
+				if err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", streamFileName, err))
+					continue
+				}
+				report.Regenerated = append(report.Regenerated, streamFileName)
+				report.StreamPorts[project.Name+"/"+service.Name] = listenPort
+				continue
+			}
+
+			hasHTTP = true
+			if project.Paused {
+				expected[serviceFileName+pausedSuffix] = true
+				continue
+			}
+			expected[serviceFileName] = true
+			if _, err := nc.writeServiceConfig(project.Name, service.Name, service.ContainerName, service.Port); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", serviceFileName, err))
+				continue
+			}
+			report.Regenerated = append(report.Regenerated, serviceFileName)
+		}
+
+		if hasHTTP {
+			projectFileName := fmt.Sprintf("%s.conf", name)
+			if project.Paused {
+				expected[projectFileName+pausedSuffix] = true
+				expected[filepath.Base(nc.pausedConfigPath(project.Name))] = true
+			} else {
+				expected[projectFileName] = true
+				nc.SetErrorPages(project.Name, project.ErrorPages)
+				if err := nc.createOrUpdateProjectConfig(project.Name); err != nil {
+					report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", projectFileName, err))
+				} else {
+					report.Regenerated = append(report.Regenerated, projectFileName)
+				}
+			}
+		}
+
+		networkName := fmt.Sprintf("project-%s-network", project.Name)
+		if err := nc.ConnectNginxToNetwork(networkName); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("network %s: %v", networkName, err))
+		} else {
+			report.Networks = append(report.Networks, networkName)
+		}
+	}
+
+	// Remove config files no project accounts for
+	for _, dir := range []string{"", "stream"} {
+		entries, err := os.ReadDir(filepath.Join(nc.ConfigDir, dir))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				report.Errors = append(report.Errors, fmt.Sprintf("failed to read config directory: %v", err))
+			}
+			continue
+		}
+		for _, entry := range entries {
+			fileName := entry.Name()
+			if entry.IsDir() || (!strings.HasSuffix(fileName, ".conf") && !strings.HasSuffix(fileName, ".conf"+pausedSuffix)) {
+				continue
+			}
+			relativePath := filepath.Join(dir, fileName)
+			if expected[relativePath] {
+				continue
+			}
+			log.Printf("Removing orphaned NGINX config file: %s", relativePath)
+			if err := os.Remove(filepath.Join(nc.ConfigDir, relativePath)); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("failed to remove %s: %v", relativePath, err))
+				continue
+			}
+			report.Removed = append(report.Removed, relativePath)
+		}
+	}
+
+	// Only reload a configuration NGINX accepts
+	output, err := nc.TestConfig()
+	report.ConfigTest = output
+	if err != nil {
+		return report, err
+	}
+	if err := nc.ReloadNginx(); err != nil {
+		return report, err
+	}
+	report.Reloaded = true
+
+	log.Printf("Reconciled NGINX configuration: %d regenerated, %d removed, %d errors",
+		len(report.Regenerated), len(report.Removed), len(report.Errors))
+	return report, nil
+}
+
+// TestConfig checks the NGINX configuration with nginx -t and returns its output
+func (nc *NginxConfig) TestConfig() (string, error) {
+	cmd := exec.Command("docker", "exec", "platform-repository-nginx-1", "nginx", "-t")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("NGINX configuration test failed: %v", err)
+	}
+	return string(output), nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/auth"
+	"github.com/neeraj-menon/Nabla/project-orchestrator/handlers"
+	"github.com/neeraj-menon/Nabla/project-orchestrator/secrets"
+)
+
+// Largest secret value accepted
+const maxSecretSize = 64 * 1024
+
+// Provider the deploy path resolves secret references through
+var secretProvider secrets.SecretProvider
+
+// initSecretProvider creates the secret provider selected with SECRET_PROVIDER
+func initSecretProvider() {
+	provider, err := secrets.NewProviderFromEnv()
+	if err != nil {
+		log.Printf("Warning: failed to initialize secret provider, secret references can't be resolved: %v", err)
+		return
+	}
+	secretProvider = provider
+	handlers.SetSecretProvider(provider)
+
+	log.Printf("Initialized secret provider")
+}
+
+// SecretListResponse lists the names of a user's secrets, never their values
+type SecretListResponse struct {
+	Secrets []string `json:"secrets"`
+}
+
+// SecretRequest sets the value of a secret
+type SecretRequest struct {
+	Value string `json:"value"`
+}
+
+// secretsHandler manages the requesting user's secrets in the local secret store:
+// GET /secrets lists their names, PUT /secrets/{name} sets one and DELETE /secrets/{name}
+// removes it. Secrets of external providers are managed in the provider itself.
+func secretsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		methodNotAllowed(w, r)
+		return
+	}
+
+	// Extract user ID from request headers
+	userID := auth.GetUserID(r)
+
+	store, ok := secretProvider.(secrets.SecretStore)
+	if !ok {
+		http.Error(w, "Secrets are managed by the configured external secret provider", http.StatusNotImplemented)
+		return
+	}
+
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/secrets"), "/")
+	if name == "" {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, r)
+			return
+		}
+
+		keys, err := store.List(secrets.Key(userID, ""))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list secrets: %v", err), http.StatusInternalServerError)
+			return
+		}
+		response := SecretListResponse{Secrets: []string{}}
+		for _, key := range keys {
+			response.Secrets = append(response.Secrets, strings.TrimPrefix(key, secrets.Key(userID, "")))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if !secrets.ValidName(name) {
+		http.Error(w, fmt.Sprintf("Invalid secret name '%s', use letters, digits, '.', '-' and '_'", name), http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxSecretSize))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Secret must not exceed %d bytes", maxSecretSize), http.StatusRequestEntityTooLarge)
+			return
+		}
+		var request SecretRequest
+		if err := json.Unmarshal(data, &request); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := store.Set(secrets.Key(userID, name), request.Value); err != nil {
+			http.Error(w, fmt.Sprintf("Failed to store secret: %v", err), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Stored secret %s for user %s", name, userID)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if err := store.Delete(secrets.Key(userID, name)); err != nil {
+			if errors.Is(err, secrets.ErrNotFound) {
+				http.Error(w, fmt.Sprintf("Secret %s not found", name), http.StatusNotFound)
+				return
+			}
+			http.Error(w, fmt.Sprintf("Failed to delete secret: %v", err), http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Deleted secret %s for user %s", name, userID)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r)
+	}
+}
@@ -0,0 +1,183 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Directory holding the local secrets and, unless SECRETS_KEY is set, their key
+const defaultSecretsDir = "./secret-store"
+
+// LocalProvider stores secrets in a file, each value encrypted with AES-256-GCM
+type LocalProvider struct {
+	path string
+	aead cipher.AEAD
+
+	mu      sync.Mutex
+	secrets map[string]string // Encrypted values keyed by secret key
+}
+
+// NewLocalProvider opens the secrets stored in dir. The key is a base64-encoded 32 byte
+// key; when empty, a key file is generated in dir, which only protects the secrets if
+// the key file is kept out of backups and copies of the secrets file.
+func NewLocalProvider(dir string, encodedKey string) (*LocalProvider, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create secrets directory: %v", err)
+	}
+
+	key, err := loadKey(dir, encodedKey)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secrets key: %v", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &LocalProvider{
+		path:    filepath.Join(dir, "secrets.json"),
+		aead:    aead,
+		secrets: make(map[string]string),
+	}
+
+	data, err := os.ReadFile(provider.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read secrets: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &provider.secrets); err != nil {
+			return nil, fmt.Errorf("failed to parse secrets: %v", err)
+		}
+	}
+
+	log.Printf("Loaded %d local secrets from %s", len(provider.secrets), provider.path)
+	return provider, nil
+}
+
+// loadKey decodes the configured key or reads, and if needed generates, the key file
+func loadKey(dir string, encodedKey string) ([]byte, error) {
+	if encodedKey != "" {
+		key, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("SECRETS_KEY must be a base64-encoded 32 byte key")
+		}
+		return key, nil
+	}
+
+	keyPath := filepath.Join(dir, "secrets.key")
+	if data, err := os.ReadFile(keyPath); err == nil {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid key in %s", keyPath)
+		}
+		return key, nil
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read secrets key: %v", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate secrets key: %v", err)
+	}
+	if err := os.WriteFile(keyPath, []byte(base64.StdEncoding.EncodeToString(key)), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write secrets key: %v", err)
+	}
+	log.Printf("Generated secrets key at %s, set SECRETS_KEY to keep it elsewhere", keyPath)
+	return key, nil
+}
+
+// Get decrypts a secret
+func (p *LocalProvider) Get(key string) (string, error) {
+	p.mu.Lock()
+	encrypted, exists := p.secrets[key]
+	p.mu.Unlock()
+	if !exists {
+		return "", ErrNotFound
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(data) < p.aead.NonceSize() {
+		return "", fmt.Errorf("secret %s is corrupted", key)
+	}
+	nonce, ciphertext := data[:p.aead.NonceSize()], data[p.aead.NonceSize():]
+	// The key is authenticated so a value can't be moved to another key
+	plaintext, err := p.aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret %s: %v", key, err)
+	}
+	return string(plaintext), nil
+}
+
+// Set encrypts and stores a secret
+func (p *LocalProvider) Set(key, value string) error {
+	nonce := make([]byte, p.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := p.aead.Seal(nonce, nonce, []byte(value), []byte(key))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.secrets[key] = base64.StdEncoding.EncodeToString(sealed)
+	return p.save()
+}
+
+// Delete removes a secret
+func (p *LocalProvider) Delete(key string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, exists := p.secrets[key]; !exists {
+		return ErrNotFound
+	}
+	delete(p.secrets, key)
+	return p.save()
+}
+
+// List returns the keys starting with prefix
+func (p *LocalProvider) List(prefix string) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var keys []string
+	for key := range p.secrets {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// save writes the encrypted secrets. Callers hold p.mu.
+func (p *LocalProvider) save() error {
+	data, err := json.MarshalIndent(p.secrets, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a failed write doesn't lose the secrets
+	tmpPath := p.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write secrets: %v", err)
+	}
+	if err := os.Rename(tmpPath, p.path); err != nil {
+		return fmt.Errorf("failed to write secrets: %v", err)
+	}
+	return nil
+}
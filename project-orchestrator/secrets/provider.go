@@ -0,0 +1,94 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// SecretProvider resolves secrets by key. Keys are scoped to the owning user, see Key.
+type SecretProvider interface {
+	Get(key string) (string, error)
+}
+
+// SecretStore is a provider whose secrets are managed through the orchestrator
+type SecretStore interface {
+	SecretProvider
+	Set(key, value string) error
+	Delete(key string) error
+	List(prefix string) ([]string, error) // Keys starting with prefix
+}
+
+// ErrNotFound is returned for keys a provider has no secret for
+var ErrNotFound = errors.New("secret not found")
+
+// Secret names may be referenced from manifests and are used in provider paths
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// referencePattern matches secret references such as ${secret:db-password} in environment values
+var referencePattern = regexp.MustCompile(`\$\{secret:([^}]*)\}`)
+
+// ValidName reports whether name can be used as a secret name
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Key returns the provider key of a user's secret
+func Key(userID, name string) string {
+	return userID + "/" + name
+}
+
+// References returns the secret names referenced in value, including invalid ones
+func References(value string) []string {
+	var names []string
+	for _, match := range referencePattern.FindAllStringSubmatch(value, -1) {
+		names = append(names, match[1])
+	}
+	return names
+}
+
+// Expand replaces the secret references in value with the secrets returned by lookup
+func Expand(value string, lookup func(name string) (string, error)) (string, error) {
+	var lookupErr error
+	expanded := referencePattern.ReplaceAllStringFunc(value, func(reference string) string {
+		if lookupErr != nil {
+			return reference
+		}
+		name := referencePattern.FindStringSubmatch(reference)[1]
+		if !ValidName(name) {
+			lookupErr = fmt.Errorf("invalid secret name '%s'", name)
+			return reference
+		}
+		secret, err := lookup(name)
+		if err != nil {
+			lookupErr = err
+			return reference
+		}
+		return secret
+	})
+	if lookupErr != nil {
+		return "", lookupErr
+	}
+	return expanded, nil
+}
+
+// NewProviderFromEnv creates the provider selected with SECRET_PROVIDER:
+//
+//   - local (default): secrets encrypted at rest in SECRETS_DIR, managed through the orchestrator API
+//   - vault: a HashiCorp Vault KV v2 engine, configured with VAULT_ADDR, VAULT_TOKEN and VAULT_SECRET_PATH
+func NewProviderFromEnv() (SecretProvider, error) {
+	switch provider := strings.ToLower(os.Getenv("SECRET_PROVIDER")); provider {
+	case "", "local":
+		dir := os.Getenv("SECRETS_DIR")
+		if dir == "" {
+			dir = defaultSecretsDir
+		}
+		return NewLocalProvider(dir, os.Getenv("SECRETS_KEY"))
+	case "vault":
+		return NewVaultProvider(os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TOKEN"), os.Getenv("VAULT_SECRET_PATH"))
+	default:
+		return nil, fmt.Errorf("unknown SECRET_PROVIDER '%s', expected local or vault", provider)
+	}
+}
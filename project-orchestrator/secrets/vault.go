@@ -0,0 +1,87 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Path of the KV v2 data the secrets are read from unless VAULT_SECRET_PATH is set
+const defaultVaultSecretPath = "secret/data/nabla"
+
+// VaultProvider reads secrets from a HashiCorp Vault KV v2 engine. A secret is stored at
+// <path>/<user ID>/<name> with its value in the "value" field.
+type VaultProvider struct {
+	addr      string
+	token     string
+	path      string
+	namespace string // Vault Enterprise namespace, from VAULT_NAMESPACE
+	client    *http.Client
+}
+
+// NewVaultProvider creates a provider reading secrets below path on the Vault server at addr
+func NewVaultProvider(addr, token, path string) (*VaultProvider, error) {
+	if addr == "" || token == "" {
+		return nil, fmt.Errorf("VAULT_ADDR and VAULT_TOKEN are required for the vault secret provider")
+	}
+	if _, err := url.Parse(addr); err != nil {
+		return nil, fmt.Errorf("invalid VAULT_ADDR: %v", err)
+	}
+	if path == "" {
+		path = defaultVaultSecretPath
+	}
+
+	return &VaultProvider{
+		addr:      strings.TrimSuffix(addr, "/"),
+		token:     token,
+		path:      strings.Trim(path, "/"),
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// vaultSecret is the response of a KV v2 read
+type vaultSecret struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+}
+
+// Get reads a secret from Vault
+func (p *VaultProvider) Get(key string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/v1/%s/%s", p.addr, p.path, key), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to reach Vault: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return "", ErrNotFound
+	case resp.StatusCode != http.StatusOK:
+		return "", fmt.Errorf("Vault returned %s reading secret %s", resp.Status, key)
+	}
+
+	var secret vaultSecret
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("failed to parse Vault response: %v", err)
+	}
+	value, ok := secret.Data.Data["value"].(string)
+	if !ok {
+		return "", fmt.Errorf("Vault secret %s has no string 'value' field", key)
+	}
+	return value, nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
+)
+
+// teardownConcurrency bounds how many services of a project are stopped or deleted at once,
+// configured with TEARDOWN_CONCURRENCY
+var teardownConcurrency = 4
+
+func init() {
+	if value := os.Getenv("TEARDOWN_CONCURRENCY"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			teardownConcurrency = parsed
+		} else {
+			log.Printf("Invalid TEARDOWN_CONCURRENCY %q, using default %d", value, teardownConcurrency)
+		}
+	}
+}
+
+// ServiceTeardownResult reports the errors tearing down one service of a project
+type ServiceTeardownResult struct {
+	Service string   `json:"service"`
+	Errors  []string `json:"errors,omitempty"`
+}
+
+// teardownServices runs teardown for each service concurrently, at most teardownConcurrency
+// at a time, and returns the results sorted by service name. The services are a copy, so
+// teardown must not touch the project; callers apply the results under projectsMutex.
+func teardownServices(services map[string]models.ServiceStatus, teardown func(name string, service models.ServiceStatus) []string) []ServiceTeardownResult {
+	results := make([]ServiceTeardownResult, 0, len(services))
+	var resultsMutex sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, teardownConcurrency)
+
+	for name, service := range services {
+		wg.Add(1)
+		go func(name string, service models.ServiceStatus) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			errs := teardown(name, service)
+			resultsMutex.Lock()
+			results = append(results, ServiceTeardownResult{Service: name, Errors: errs})
+			resultsMutex.Unlock()
+		}(name, service)
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Service < results[j].Service })
+	return results
+}
+
+// copyServices copies the services of a project under projectsMutex for a teardown
+func copyServices(project *models.Project) map[string]models.ServiceStatus {
+	projectsMutex.RLock()
+	defer projectsMutex.RUnlock()
+
+	services := make(map[string]models.ServiceStatus, len(project.Services))
+	for name, service := range project.Services {
+		services[name] = service
+	}
+	return services
+}
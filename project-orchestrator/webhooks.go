@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/neeraj-menon/Nabla/project-orchestrator/models"
+)
+
+// Delivery settings of status webhooks: the timeout of each attempt, configured with
+// WEBHOOK_TIMEOUT, and the attempts made before a notification is dropped, configured
+// with WEBHOOK_ATTEMPTS
+var (
+	webhookTimeout  = 5 * time.Second
+	webhookAttempts = 3
+)
+
+// Pending notifications, delivered in order by a single worker so a slow webhook never
+// holds up a deployment. Notifications are dropped when the queue is full.
+var webhookQueue = make(chan webhookDelivery, 256)
+
+// Last status each project's webhook was notified of, keyed by owner and project name
+var (
+	notifiedStatuses      = make(map[string]string)
+	notifiedStatusesMutex sync.Mutex
+)
+
+func init() {
+	if value := os.Getenv("WEBHOOK_TIMEOUT"); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil && parsed > 0 {
+			webhookTimeout = parsed
+		} else {
+			log.Printf("Invalid WEBHOOK_TIMEOUT %q, using default %s", value, webhookTimeout)
+		}
+	}
+	if value := os.Getenv("WEBHOOK_ATTEMPTS"); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil && parsed > 0 {
+			webhookAttempts = parsed
+		} else {
+			log.Printf("Invalid WEBHOOK_ATTEMPTS %q, using default %d", value, webhookAttempts)
+		}
+	}
+
+	go deliverWebhooks()
+}
+
+// WebhookPayload is the JSON body posted to a project's webhook on a status change
+type WebhookPayload struct {
+	Project        string            `json:"project"`
+	Owner          string            `json:"owner"`
+	Version        string            `json:"version,omitempty"`
+	Status         string            `json:"status"`
+	PreviousStatus string            `json:"previousStatus,omitempty"`
+	Error          string            `json:"error,omitempty"`
+	ErrorKind      string            `json:"errorKind,omitempty"`
+	Services       map[string]string `json:"services"` // Service name to status
+	Timestamp      time.Time         `json:"timestamp"`
+}
+
+type webhookDelivery struct {
+	url     string
+	payload WebhookPayload
+}
+
+// notifyStatusChange queues a notification to the project's webhook when its status
+// changed since the last one
+func notifyStatusChange(project *models.Project) {
+	key := project.UserID + ":" + project.Name
+	notifiedStatusesMutex.Lock()
+	previous, known := notifiedStatuses[key]
+	notifiedStatuses[key] = project.Status
+	notifiedStatusesMutex.Unlock()
+	if known && previous == project.Status {
+		return
+	}
+
+	if project.Manifest == nil || project.Manifest.Webhook == nil || !project.Manifest.Webhook.Notifies(project.Status) {
+		return
+	}
+
+	payload := WebhookPayload{
+		Project:        project.Name,
+		Owner:          project.Username,
+		Version:        project.Version,
+		Status:         project.Status,
+		PreviousStatus: previous,
+		Error:          project.Error,
+		ErrorKind:      project.ErrorKind,
+		Services:       make(map[string]string, len(project.Services)),
+		Timestamp:      time.Now().UTC(),
+	}
+	for name, service := range project.Services {
+		payload.Services[name] = service.Status
+	}
+
+	select {
+	case webhookQueue <- webhookDelivery{url: project.Manifest.Webhook.URL, payload: payload}:
+	default:
+		log.Printf("Webhook queue is full, dropping %s notification of project %s", project.Status, project.Name)
+	}
+}
+
+// rememberNotifiedStatus records the status of a project loaded from disk, so only changes
+// after a restart are notified
+func rememberNotifiedStatus(project *models.Project) {
+	notifiedStatusesMutex.Lock()
+	notifiedStatuses[project.UserID+":"+project.Name] = project.Status
+	notifiedStatusesMutex.Unlock()
+}
+
+// deliverWebhooks posts queued notifications, retrying failed deliveries with a backoff
+func deliverWebhooks() {
+	client := &http.Client{Timeout: webhookTimeout}
+	for delivery := range webhookQueue {
+		body, err := json.Marshal(delivery.payload)
+		if err != nil {
+			log.Printf("Error encoding webhook payload of project %s: %v", delivery.payload.Project, err)
+			continue
+		}
+
+		for attempt := 1; attempt <= webhookAttempts; attempt++ {
+			err = postWebhook(client, delivery.url, body)
+			if err == nil {
+				log.Printf("Notified webhook of project %s of status %s", delivery.payload.Project, delivery.payload.Status)
+				break
+			}
+			log.Printf("Webhook of project %s failed (attempt %d/%d): %v", delivery.payload.Project, attempt, webhookAttempts, err)
+			if attempt < webhookAttempts {
+				time.Sleep(time.Duration(attempt) * time.Second)
+			}
+		}
+	}
+}
+
+// postWebhook posts a notification, failing on any status other than 2xx
+func postWebhook(client *http.Client, url string, body []byte) error {
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered with status %d", resp.StatusCode)
+	}
+	return nil
+}
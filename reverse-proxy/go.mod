@@ -5,6 +5,7 @@ go 1.19
 require (
 	github.com/docker/docker v20.10.22+incompatible
 	github.com/gorilla/mux v1.8.0
+	golang.org/x/net v0.29.0
 )
 
 require (
@@ -19,8 +20,8 @@ require (
 	github.com/opencontainers/image-spec v1.0.2 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/sirupsen/logrus v1.9.3 // indirect
-	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // indirect
-	golang.org/x/sys v0.12.0 // indirect
+	golang.org/x/sys v0.25.0 // indirect
+	golang.org/x/text v0.18.0 // indirect
 	golang.org/x/time v0.11.0 // indirect
 	gotest.tools/v3 v3.5.2 // indirect
 )
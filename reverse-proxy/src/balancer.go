@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// How long the replicas found for a function are reused before they are listed again
+const replicaCacheTTL = 5 * time.Second
+
+// cachedReplicas are the replica containers found for a function
+type cachedReplicas struct {
+	containerIDs []string
+	cachedAt     time.Time
+}
+
+// Requests in flight per replica container, used for least-connections routing
+var (
+	replicaRequests = make(map[string]int)
+	replicaMutex    sync.Mutex
+	replicaCursor   int // Rotates the replica preferred on ties so idle replicas share the load
+)
+
+// functionCacheKey scopes cache entries to the owner so identically named functions
+// don't collide
+func functionCacheKey(functionName string, userID string) string {
+	if userID == "" {
+		return functionName
+	}
+	return userID + "/" + functionName
+}
+
+// forgetFunctionContainers drops the cached replicas of a function, e.g. after one failed
+func forgetFunctionContainers(cacheKey string) {
+	cacheMutex.Lock()
+	delete(functionCache, cacheKey)
+	cacheMutex.Unlock()
+}
+
+// acquireReplica picks the replica with the fewest requests in flight and counts a new
+// request against it. releaseReplica must be called once the response completes.
+func acquireReplica(containerIDs []string) string {
+	replicaMutex.Lock()
+	defer replicaMutex.Unlock()
+
+	containerID := pickReplica(containerIDs)
+	replicaRequests[containerID]++
+	return containerID
+}
+
+// releaseReplica counts a request to a replica as completed
+func releaseReplica(containerID string) {
+	replicaMutex.Lock()
+	defer replicaMutex.Unlock()
+
+	replicaRequests[containerID]--
+	if replicaRequests[containerID] <= 0 {
+		delete(replicaRequests, containerID)
+	}
+}
+
+// pickReplica returns the replica with the fewest requests in flight, starting from a
+// rotating position so ties don't always go to the same one. Callers hold replicaMutex.
+func pickReplica(containerIDs []string) string {
+	replicaCursor++
+	best := ""
+	for i := range containerIDs {
+		containerID := containerIDs[(replicaCursor+i)%len(containerIDs)]
+		if best == "" || replicaRequests[containerID] < replicaRequests[best] {
+			best = containerID
+		}
+	}
+	return best
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/client"
+)
+
+// withDockerAPI points the Docker client at a test server standing in for the Docker API
+func withDockerAPI(t *testing.T, handler http.HandlerFunc) {
+	server := httptest.NewServer(handler)
+	docker, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(server.URL, "http://")), client.WithVersion("1.41"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := dockerClient
+	dockerClient = docker
+	t.Cleanup(func() {
+		dockerClient = previous
+		server.Close()
+	})
+}
+
+// A cached replica that was removed since it was listed isn't routed to, the replicas are
+// listed again instead
+func TestAcquireFunctionTargetRemovedReplica(t *testing.T) {
+	previousLabels := labelsList
+	labelsList = []string{"function"}
+	t.Cleanup(func() { labelsList = previousLabels })
+	withDockerAPI(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			json.NewEncoder(w).Encode([]map[string]interface{}{{"Id": "live", "Status": "Up 1 second"}})
+		case strings.HasSuffix(r.URL.Path, "/containers/live/json"):
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"Id":     "live",
+				"State":  map[string]interface{}{"Running": true},
+				"Config": map[string]interface{}{"Labels": map[string]string{}},
+				"NetworkSettings": map[string]interface{}{"Networks": map[string]interface{}{
+					functionNetwork: map[string]interface{}{"IPAddress": "10.0.0.2"},
+				}},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"message": "No such container"})
+		}
+	})
+
+	cacheKey := functionCacheKey("hello", "user1")
+	cacheMutex.Lock()
+	functionCache[cacheKey] = cachedReplicas{containerIDs: []string{"removed"}, cachedAt: time.Now()}
+	cacheMutex.Unlock()
+	t.Cleanup(func() { forgetFunctionContainers(cacheKey) })
+
+	containerID, target, err := acquireFunctionTarget("hello", "user1")
+	if err != nil {
+		t.Fatalf("acquireFunctionTarget() = %v", err)
+	}
+	defer releaseReplica(containerID)
+	if containerID != "live" || target.Address != "10.0.0.2:8080" {
+		t.Errorf("acquireFunctionTarget() = %s at %s, want live at 10.0.0.2:8080", containerID, target.Address)
+	}
+
+	replicaMutex.Lock()
+	inFlight := replicaRequests["removed"]
+	replicaMutex.Unlock()
+	if inFlight != 0 {
+		t.Errorf("%d requests in flight counted against the removed replica, want 0", inFlight)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/tls"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// grpcTransport speaks HTTP/2 cleartext (h2c) to function containers
+var grpcTransport = &http2.Transport{
+	AllowHTTP: true,
+	// Dial plain TCP even though the transport asks for TLS, since the scheme is http
+	DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+		return net.DialTimeout(network, addr, 5*time.Second)
+	},
+}
+
+// isGRPCRequest reports whether a request is a gRPC call, which needs HTTP/2 to the
+// function container. Calls relayed by the function controller arrive over HTTP/1.1, so
+// only the content type is checked: application/grpc, optionally with a +codec suffix
+// or parameters. gRPC-Web (application/grpc-web) works over HTTP/1.1 and isn't one.
+func isGRPCRequest(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	return contentType == "application/grpc" ||
+		strings.HasPrefix(contentType, "application/grpc+") ||
+		strings.HasPrefix(contentType, "application/grpc;")
+}
+
+// proxyGRPC forwards a gRPC request to a function container over h2c.
+// Responses are streamed and trailers (grpc-status, grpc-message) are preserved.
+func proxyGRPC(w http.ResponseWriter, r *http.Request, target *url.URL) {
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = target.Path
+			req.URL.RawQuery = target.RawQuery
+			req.Host = target.Host
+		},
+		Transport: grpcTransport,
+		// Trailers can only follow a chunked body over HTTP/1.1, which a Content-Length
+		// would prevent
+		ModifyResponse: func(res *http.Response) error {
+			if r.ProtoMajor == 1 && len(res.Trailer) > 0 {
+				res.Header.Del("Content-Length")
+				res.ContentLength = -1
+			}
+			return nil
+		},
+		// Flush every write so server and bidirectional streams aren't buffered
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Error forwarding gRPC request to function container: %v", err)
+			// gRPC clients expect errors as a status rather than an HTTP error body
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Grpc-Status", "14") // UNAVAILABLE
+			w.Header().Set("Grpc-Message", "function container unavailable")
+			w.WriteHeader(http.StatusOK)
+		},
+	}
+
+	log.Printf("Sending gRPC request to function container at %s", target)
+	proxy.ServeHTTP(w, r)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestIsGRPCRequest(t *testing.T) {
+	tests := []struct {
+		contentType string
+		protoMajor  int
+		want        bool
+	}{
+		{"application/grpc", 2, true},
+		{"application/grpc", 1, true}, // Relayed by the function controller
+		{"application/grpc+proto", 1, true},
+		{"application/grpc+json", 2, true},
+		{"application/grpc; charset=utf-8", 1, true},
+		{"application/grpc-web", 1, false},
+		{"application/grpc-web+proto", 2, false},
+		{"application/json", 2, false},
+		{"", 1, false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/function/echo/Echo", nil)
+		r.ProtoMajor = test.protoMajor
+		if test.contentType != "" {
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		if got := isGRPCRequest(r); got != test.want {
+			t.Errorf("isGRPCRequest(%q over HTTP/%d) = %v, want %v", test.contentType, test.protoMajor, got, test.want)
+		}
+	}
+}
+
+// A gRPC call arriving over HTTP/1.1 is forwarded to the container over h2c, with the
+// container's trailers passed back
+func TestProxyGRPCFromHTTP1(t *testing.T) {
+	container := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			t.Errorf("container received HTTP/%d.%d, want HTTP/2", r.ProtoMajor, r.ProtoMinor)
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write(body)
+		w.Header().Set("Grpc-Status", "0")
+	}), &http2.Server{}))
+	defer container.Close()
+
+	target, err := url.Parse(container.URL + "/echo.Echo/Say")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isGRPCRequest(r) {
+			t.Errorf("request over HTTP/%d wasn't detected as gRPC", r.ProtoMajor)
+		}
+		proxyGRPC(w, r, target)
+	}))
+	defer proxy.Close()
+
+	request, err := http.NewRequest(http.MethodPost, proxy.URL+"/function/echo/echo.Echo/Say", strings.NewReader("\x00\x00\x00\x00\x02hi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("Content-Type", "application/grpc")
+	request.Header.Set("TE", "trailers")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	if response.ProtoMajor != 1 {
+		t.Fatalf("client used HTTP/%d, want HTTP/1.1", response.ProtoMajor)
+	}
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "\x00\x00\x00\x00\x02hi" {
+		t.Errorf("body = %q, want the echoed message", body)
+	}
+	if status := response.Trailer.Get("Grpc-Status"); status != "0" {
+		t.Errorf("Grpc-Status trailer = %q, want 0", status)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Hop-by-hop headers describe a single connection and must not be forwarded by proxies (RFC 7230, section 6.1)
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"TE",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Header the controller sets to true on traced invocations
+const traceHeader = "X-Trace"
+
+// Header traced invocations are answered with, the milliseconds spent routing the request
+// and waiting for the container's response headers, e.g. route=0.4,container=35.2
+const proxyTimingHeader = "X-Proxy-Timing"
+
+// Largest total size of the response headers a function may send, configured with
+// MAX_RESPONSE_HEADER_BYTES
+var maxResponseHeaderBytes = 64 * 1024
+
+// errResponseHeadersTooLarge refuses a response whose headers exceed maxResponseHeaderBytes
+var errResponseHeadersTooLarge = errors.New("response headers too large")
+
+// Response headers stripped before responses reach clients, e.g. Server and X-Powered-By
+// revealing the function's stack. Configured as a comma separated list with STRIP_RESPONSE_HEADERS.
+var strippedResponseHeaders []string
+
+func init() {
+	if value := os.Getenv("MAX_RESPONSE_HEADER_BYTES"); value != "" {
+		if size, err := strconv.Atoi(value); err == nil && size > 0 {
+			maxResponseHeaderBytes = size
+		} else {
+			log.Printf("Invalid MAX_RESPONSE_HEADER_BYTES %q, using default %d", value, maxResponseHeaderBytes)
+		}
+	}
+
+	for _, name := range strings.Split(os.Getenv("STRIP_RESPONSE_HEADERS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			strippedResponseHeaders = append(strippedResponseHeaders, name)
+		}
+	}
+}
+
+// sanitizeResponseHeaders removes the hop-by-hop headers of a function's response, including
+// the ones its Connection header names, and the headers configured to be stripped
+func sanitizeResponseHeaders(header http.Header) {
+	for _, value := range header.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header.Del(name)
+			}
+		}
+	}
+	for _, name := range hopByHopHeaders {
+		header.Del(name)
+	}
+	for _, name := range strippedResponseHeaders {
+		header.Del(name)
+	}
+}
+
+// responseHeaderSize returns the size of headers as they are written on the wire
+func responseHeaderSize(header http.Header) int {
+	size := 0
+	for key, values := range header {
+		for _, value := range values {
+			size += len(key) + len(value) + len(": \r\n")
+		}
+	}
+	return size
+}
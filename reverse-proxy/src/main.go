@@ -3,12 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -17,20 +20,32 @@ import (
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
 	"github.com/gorilla/mux"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // Configuration variables
 var (
-	functionNetwork = os.Getenv("FUNCTION_NETWORK")
-	proxyPort       = os.Getenv("PROXY_PORT")
-	discoveryLabels = os.Getenv("DISCOVERY_LABELS")
+	functionNetwork    = os.Getenv("FUNCTION_NETWORK")
+	proxyPort          = os.Getenv("PROXY_PORT")
+	discoveryLabels    = os.Getenv("DISCOVERY_LABELS")
 	containerPortLabel = os.Getenv("CONTAINER_PORT_LABEL")
-	dockerClient    *client.Client
-	functionCache   = make(map[string]string) // Maps function name to container ID
-	cacheMutex      = &sync.RWMutex{}
-	labelsList      []string // List of labels to use for discovery
+	ownerLabel         = os.Getenv("OWNER_LABEL")
+	timeoutLabel       = os.Getenv("TIMEOUT_LABEL")
+	dockerClient       *client.Client
+	functionCache      = make(map[string]cachedReplicas) // Maps function name to its replica containers
+	cacheMutex         = &sync.RWMutex{}
+	labelsList         []string            // List of labels to use for discovery
+	maxInvokeTimeout   = 300 * time.Second // Largest timeout a request may ask for
+
+	// Time a request to a function container may take when neither the request
+	// nor the container's timeout label sets one
+	defaultInvokeTimeout = 20 * time.Second
 )
 
+// Prefix of the container labels carrying user metadata, as opposed to the platform's own labels
+const metadataLabelPrefix = "meta."
+
 func init() {
 	// Set default values if environment variables are not set
 	if functionNetwork == "" {
@@ -52,6 +67,34 @@ func init() {
 		containerPortLabel = "platform.port"
 	}
 
+	// Set default label identifying the user that owns a function container
+	if ownerLabel == "" {
+		ownerLabel = "platform.user"
+	}
+
+	// Set default label holding a function's own timeout in seconds
+	if timeoutLabel == "" {
+		timeoutLabel = "platform.timeout"
+	}
+
+	// Set the timeout of functions that don't configure one
+	if value := os.Getenv("DEFAULT_INVOKE_TIMEOUT"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			defaultInvokeTimeout = time.Duration(seconds) * time.Second
+		} else {
+			log.Printf("Invalid DEFAULT_INVOKE_TIMEOUT %q, using default %s", value, defaultInvokeTimeout)
+		}
+	}
+
+	// Set the largest invocation timeout a request may ask for
+	if value := os.Getenv("MAX_INVOKE_TIMEOUT"); value != "" {
+		if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+			maxInvokeTimeout = time.Duration(seconds) * time.Second
+		} else {
+			log.Printf("Invalid MAX_INVOKE_TIMEOUT %q, using default %s", value, maxInvokeTimeout)
+		}
+	}
+
 	// Initialize Docker client
 	var err error
 	dockerClient, err = client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
@@ -65,32 +108,116 @@ func init() {
 // CORS middleware to allow cross-origin requests
 func enableCors(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Invoke-Timeout")
 
 	// Handle preflight requests
 	if r.Method == "OPTIONS" {
+		setAllowHeader(w, r)
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
-// getFunctionContainer finds the container ID for a given function name
-func getFunctionContainer(functionName string) (string, error) {
-	// Check cache first
+// invocationMethods are the HTTP methods functions can be invoked with, used by the
+// function routes and their Allow header. They match the function controller's invoke routes.
+var invocationMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// allowedMethods returns the HTTP methods supported by a proxy route
+func allowedMethods(path string) []string {
+	switch {
+	case path == "/health", path == "/functions", strings.HasPrefix(path, "/discover/"):
+		return []string{http.MethodGet}
+	case strings.HasPrefix(path, "/function/"):
+		return invocationMethods
+	}
+	return nil
+}
+
+// rawSubPath returns the path of a proxied request after the function name, still escaped
+// as received so encoded slashes and other escapes reach the function unchanged
+func rawSubPath(r *http.Request) string {
+	rest := strings.TrimPrefix(r.URL.EscapedPath(), "/function/")
+	if index := strings.IndexByte(rest, '/'); index >= 0 {
+		return rest[index:]
+	}
+	return ""
+}
+
+// withOptions returns methods along with OPTIONS, which every route accepts for CORS
+// preflight requests
+func withOptions(methods []string) []string {
+	return append(append([]string(nil), methods...), http.MethodOptions)
+}
+
+// setAllowHeader advertises the methods supported by the requested route
+func setAllowHeader(w http.ResponseWriter, r *http.Request) {
+	if methods := allowedMethods(r.URL.Path); len(methods) > 0 {
+		w.Header().Set("Allow", strings.Join(withOptions(methods), ", "))
+	}
+}
+
+// methodNotAllowed writes a 405 response including the route's Allow header
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	setAllowHeader(w, r)
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
+
+// invokeTimeout returns the timeout for a request to a function container: the
+// X-Invoke-Timeout header (in seconds) if set, else the function's own timeout, else the default
+func invokeTimeout(r *http.Request, functionTimeout time.Duration) (time.Duration, error) {
+	value := r.Header.Get("X-Invoke-Timeout")
+	if value == "" {
+		if functionTimeout > 0 {
+			return functionTimeout, nil
+		}
+		return defaultInvokeTimeout, nil
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid X-Invoke-Timeout '%s', expected a positive number of seconds", value)
+	}
+
+	timeout := time.Duration(seconds) * time.Second
+	if timeout > maxInvokeTimeout {
+		return 0, fmt.Errorf("X-Invoke-Timeout of %ds exceeds the platform maximum of %ds",
+			seconds, int(maxInvokeTimeout.Seconds()))
+	}
+
+	return timeout, nil
+}
+
+// matchOwner filters containers down to those owned by the given user. Containers
+// started before owner labels existed are only used if no owned container matches.
+func matchOwner(containers []types.Container, userID string) []types.Container {
+	var owned, legacy []types.Container
+	for _, container := range containers {
+		owner, labeled := container.Labels[ownerLabel]
+		if !labeled {
+			legacy = append(legacy, container)
+		} else if owner == userID {
+			owned = append(owned, container)
+		}
+	}
+
+	if len(owned) > 0 {
+		return owned
+	}
+	return legacy
+}
+
+// getFunctionContainers finds the running, healthy replica containers of a function owned
+// by a user. An empty userID keeps the legacy behaviour of matching on the function name only.
+func getFunctionContainers(functionName string, userID string) ([]string, error) {
+	cacheKey := functionCacheKey(functionName, userID)
+
+	// Check cache first, it is refreshed regularly so new replicas are picked up
 	cacheMutex.RLock()
-	containerID, exists := functionCache[functionName]
+	cached, exists := functionCache[cacheKey]
 	cacheMutex.RUnlock()
 
-	if exists {
-		// Verify container still exists and is running
-		container, err := dockerClient.ContainerInspect(context.Background(), containerID)
-		if err == nil && container.State.Running {
-			return containerID, nil
-		}
-		// If not running or error, remove from cache
-		cacheMutex.Lock()
-		delete(functionCache, functionName)
-		cacheMutex.Unlock()
+	if exists && time.Since(cached.cachedAt) < replicaCacheTTL {
+		return cached.containerIDs, nil
 	}
 
 	// Try each discovery label in order
@@ -109,6 +236,11 @@ func getFunctionContainer(functionName string) (string, error) {
 			lastErr = err
 			continue
 		}
+
+		// Only consider containers belonging to the requesting user
+		if userID != "" {
+			containerList = matchOwner(containerList, userID)
+		}
 		
 		if len(containerList) > 0 {
 			containers = containerList
@@ -118,22 +250,64 @@ func getFunctionContainer(functionName string) (string, error) {
 	
 	// If we have an error and no containers, return the error
 	if len(containers) == 0 && lastErr != nil {
-		return "", lastErr
+		return nil, lastErr
 	}
 
 	// No need to check for err here as we've already handled it above
 
-	if len(containers) == 0 {
-		return "", fmt.Errorf("no container found for function: %s", functionName)
+	// Containers failing their image's HEALTHCHECK don't get requests
+	var containerIDs []string
+	for _, container := range containers {
+		if !strings.Contains(container.Status, "(unhealthy)") {
+			containerIDs = append(containerIDs, container.ID)
+		}
+	}
+	if len(containerIDs) == 0 {
+		forgetFunctionContainers(cacheKey)
+		return nil, fmt.Errorf("no healthy container found for function: %s", functionName)
 	}
 
 	// Update cache
-	containerID = containers[0].ID
 	cacheMutex.Lock()
-	functionCache[functionName] = containerID
+	functionCache[cacheKey] = cachedReplicas{containerIDs: containerIDs, cachedAt: time.Now()}
 	cacheMutex.Unlock()
 
-	return containerID, nil
+	return containerIDs, nil
+}
+
+// replicaLookupError is returned when no replica of a function could be found
+type replicaLookupError struct {
+	err error
+}
+
+func (e *replicaLookupError) Error() string {
+	return e.err.Error()
+}
+
+// acquireFunctionTarget picks the replica of a function owned by a user with the fewest
+// requests in flight, counts a new request against it and resolves its address. Cached
+// replicas may have been stopped or removed since they were listed, so when the chosen one
+// can't be resolved the cache entry is dropped and the replicas are listed again once.
+// releaseReplica must be called with the returned container once the response completes.
+func acquireFunctionTarget(functionName string, userID string) (string, *functionTarget, error) {
+	var resolveErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		containerIDs, err := getFunctionContainers(functionName, userID)
+		if err != nil {
+			return "", nil, &replicaLookupError{err: err}
+		}
+
+		containerID := acquireReplica(containerIDs)
+		target, err := resolveFunction(containerID)
+		if err == nil {
+			return containerID, target, nil
+		}
+		releaseReplica(containerID)
+		forgetFunctionContainers(functionCacheKey(functionName, userID))
+		log.Printf("Error resolving address of container %s: %v", containerID, err)
+		resolveErr = err
+	}
+	return "", nil, resolveErr
 }
 
 // proxyRequest forwards the request to the function container
@@ -144,126 +318,217 @@ func proxyRequest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract function name from path
+	startTime := time.Now()
+
+	// Extract function name from path, keeping the rest of the path escaped as received
 	vars := mux.Vars(r)
 	functionName := vars["function"]
-	path := vars["path"]
+	path := rawSubPath(r)
 	if path == "" {
 		path = "/"
-	} else {
-		path = "/" + path
 	}
 
-	log.Printf("Proxying request to function: %s, path: %s", functionName, path)
+	// The controller forwards the function owner so same-named functions of
+	// different users are routed to the right container
+	ownerID := r.Header.Get("X-Function-Owner")
 
-	// Get container ID for the function
-	containerID, err := getFunctionContainer(functionName)
-	if err != nil {
-		log.Printf("Error finding container for function %s: %v", functionName, err)
-		http.Error(w, fmt.Sprintf("Function not found or not running: %v", err), http.StatusNotFound)
-		return
-	}
+	log.Printf("Proxying request to function: %s, path: %s, owner: %s", functionName, path, ownerID)
 
-	// Get container details to find IP address
-	container, err := dockerClient.ContainerInspect(context.Background(), containerID)
+	// Route to the replica with the fewest requests in flight until the response completes,
+	// resolving the address it listens on
+	containerID, target, err := acquireFunctionTarget(functionName, ownerID)
 	if err != nil {
-		log.Printf("Error inspecting container %s: %v", containerID, err)
-		http.Error(w, "Error accessing function container", http.StatusInternalServerError)
-		return
-	}
-
-	// Get container IP address in the function network
-	networkSettings := container.NetworkSettings.Networks[functionNetwork]
-	if networkSettings == nil {
-		log.Printf("Container %s is not connected to network %s", containerID, functionNetwork)
-		http.Error(w, "Function container not properly networked", http.StatusInternalServerError)
-		return
-	}
-
-	containerIP := networkSettings.IPAddress
-	if containerIP == "" {
-		log.Printf("Container %s has no IP address in network %s", containerID, functionNetwork)
-		http.Error(w, "Function container has no IP address", http.StatusInternalServerError)
+		var lookupErr *replicaLookupError
+		if errors.As(err, &lookupErr) {
+			log.Printf("Error finding container for function %s: %v", functionName, err)
+			http.Error(w, fmt.Sprintf("Function not found or not running: %v", err), http.StatusNotFound)
+			return
+		}
+		http.Error(w, fmt.Sprintf("Function container not reachable: %v", err), http.StatusInternalServerError)
 		return
 	}
+	defer releaseReplica(containerID)
 
-	// Determine container port from label or use default
-	containerPort := "8080"
-	// Inspect the container to get all labels
-	containerInfo, err := dockerClient.ContainerInspect(context.Background(), containerID)
-	if err == nil && containerInfo.Config != nil {
-		if portLabel, exists := containerInfo.Config.Labels[containerPortLabel]; exists && portLabel != "0" {
-			containerPort = portLabel
-		}
-	}
-	
 	// Build target URL
-	targetURL := fmt.Sprintf("http://%s:%s%s", containerIP, containerPort, path)
+	targetURL := fmt.Sprintf("http://%s%s", target.Address, path)
 	if r.URL.RawQuery != "" {
 		targetURL += "?" + r.URL.RawQuery
 	}
 
 	log.Printf("Forwarding to: %s", targetURL)
 
-	// Create a new request
-	proxyReq, err := http.NewRequest(r.Method, targetURL, r.Body)
+	containerURL, err := url.Parse(targetURL)
 	if err != nil {
-		log.Printf("Error creating proxy request: %v", err)
+		log.Printf("Error parsing target URL %s: %v", targetURL, err)
 		http.Error(w, "Error creating proxy request", http.StatusInternalServerError)
 		return
 	}
 
-	// Copy headers
-	for key, values := range r.Header {
-		for _, value := range values {
-			proxyReq.Header.Add(key, value)
-		}
+	// gRPC needs HTTP/2 to the container, streaming and trailers
+	if isGRPCRequest(r) {
+		proxyGRPC(w, r, containerURL)
+		return
 	}
 
-	// Send the request to the function container with increased timeout
-	client := &http.Client{
-		Timeout: 20 * time.Second,
-		// Add a transport with more aggressive timeouts
+	// Honor a per-request timeout forwarded by the controller, else the function's own
+	timeout, err := invokeTimeout(r, target.Timeout)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sentTime := time.Now()
+	proxy := &httputil.ReverseProxy{
+		// The body is forwarded with its length rather than chunked, byte for byte
+		Director: func(req *http.Request) {
+			req.URL.Scheme = containerURL.Scheme
+			req.URL.Host = containerURL.Host
+			req.URL.Path = containerURL.Path
+			req.URL.RawPath = containerURL.RawPath
+			req.URL.RawQuery = containerURL.RawQuery
+			req.Host = containerURL.Host
+			// Functions see the client address the controller forwarded, not the controller's
+			if _, ok := req.Header["X-Forwarded-For"]; !ok {
+				req.Header["X-Forwarded-For"] = nil
+			}
+		},
+		// The timeout bounds the wait for the response headers, so streamed responses may
+		// take longer
 		Transport: &http.Transport{
 			DialContext: (&net.Dialer{
 				Timeout:   5 * time.Second,
 				KeepAlive: 30 * time.Second,
 			}).DialContext,
 			TLSHandshakeTimeout:   5 * time.Second,
-			ResponseHeaderTimeout: 10 * time.Second,
+			ResponseHeaderTimeout: timeout,
 			ExpectContinueTimeout: 1 * time.Second,
 			MaxIdleConns:          100,
 			IdleConnTimeout:       90 * time.Second,
+			// Pass the function's encoding through rather than decompressing it here
+			DisableCompression: true,
+		},
+		// Flush every write so streamed responses (chunked, server-sent events, long
+		// polling) aren't held back
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			// Drop headers that must not be forwarded and refuse oversized header sets
+			sanitizeResponseHeaders(resp.Header)
+			if size := responseHeaderSize(resp.Header); size > maxResponseHeaderBytes {
+				log.Printf("Response headers of function %s are %d bytes, more than the limit of %d", functionName, size, maxResponseHeaderBytes)
+				return errResponseHeadersTooLarge
+			}
+
+			// Report the time spent routing and waiting for the container on traced invocations
+			resp.Header.Del(proxyTimingHeader)
+			if strings.EqualFold(r.Header.Get(traceHeader), "true") {
+				resp.Header.Set(proxyTimingHeader, fmt.Sprintf("route=%.3f,container=%.3f",
+					float64(sentTime.Sub(startTime).Microseconds())/1000, float64(time.Since(sentTime).Microseconds())/1000))
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Error forwarding request to function container: %v", err)
+
+			switch {
+			case errors.Is(err, errResponseHeadersTooLarge):
+				http.Error(w, fmt.Sprintf("Function response headers exceed %d bytes", maxResponseHeaderBytes), http.StatusBadGateway)
+			case os.IsTimeout(err) || strings.Contains(err.Error(), "timeout"):
+				http.Error(w, fmt.Sprintf("Function timed out after its configured timeout of %s: %v", timeout, err), http.StatusGatewayTimeout)
+			default:
+				// The replica may be gone, list them again on the next request
+				forgetFunctionContainers(functionCacheKey(functionName, ownerID))
+				http.Error(w, fmt.Sprintf("Error invoking function: %v", err), http.StatusInternalServerError)
+			}
 		},
 	}
 
 	log.Printf("Sending request to function container at %s", targetURL)
-	resp, err := client.Do(proxyReq)
+	proxy.ServeHTTP(w, r)
+}
+
+// functionTarget is where requests to a function container are sent
+type functionTarget struct {
+	Address string        // ip:port the container listens on in the function network
+	Timeout time.Duration // Timeout from the container's label, 0 if it has none
+}
+
+// resolveFunction returns the address a function container listens on in the function
+// network and the timeout it is labelled with
+func resolveFunction(containerID string) (*functionTarget, error) {
+	// Get container details to find IP address
+	container, err := dockerClient.ContainerInspect(context.Background(), containerID)
 	if err != nil {
-		log.Printf("Error forwarding request to function container: %v", err)
-		
-		// Check if it's a timeout error
-		if os.IsTimeout(err) || strings.Contains(err.Error(), "timeout") {
-			http.Error(w, fmt.Sprintf("Function timed out: %v", err), http.StatusGatewayTimeout)
-		} else {
-			http.Error(w, fmt.Sprintf("Error invoking function: %v", err), http.StatusInternalServerError)
+		return nil, fmt.Errorf("error inspecting container: %v", err)
+	}
+	if container.State == nil || !container.State.Running {
+		return nil, fmt.Errorf("container is not running")
+	}
+
+	// Get container IP address in the function network
+	networkSettings := container.NetworkSettings.Networks[functionNetwork]
+	if networkSettings == nil {
+		return nil, fmt.Errorf("container is not connected to network %s", functionNetwork)
+	}
+
+	containerIP := networkSettings.IPAddress
+	if containerIP == "" {
+		return nil, fmt.Errorf("container has no IP address in network %s", functionNetwork)
+	}
+
+	// Determine container port from label or use default
+	containerPort := "8080"
+	target := &functionTarget{}
+	if container.Config != nil {
+		if portLabel, exists := container.Config.Labels[containerPortLabel]; exists && portLabel != "0" {
+			containerPort = portLabel
 		}
+
+		// Ignore invalid timeouts rather than failing the request, capped like request overrides
+		if timeoutValue, exists := container.Config.Labels[timeoutLabel]; exists {
+			if seconds, err := strconv.Atoi(timeoutValue); err == nil && seconds > 0 {
+				target.Timeout = time.Duration(seconds) * time.Second
+				if target.Timeout > maxInvokeTimeout {
+					target.Timeout = maxInvokeTimeout
+				}
+			} else {
+				log.Printf("Ignoring invalid %s label %q on container %s", timeoutLabel, timeoutValue, containerID)
+			}
+		}
+	}
+
+	target.Address = net.JoinHostPort(containerIP, containerPort)
+	return target, nil
+}
+
+// discoverFunction returns the container and address serving a function, so the
+// controller can probe a freshly started function before routing requests to it
+func discoverFunction(w http.ResponseWriter, r *http.Request) {
+	enableCors(w, r)
+	if r.Method == "OPTIONS" {
 		return
 	}
-	defer resp.Body.Close()
 
-	// Copy response headers
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
+	functionName := mux.Vars(r)["function"]
+	ownerID := r.Header.Get("X-Function-Owner")
+
+	containerID, target, err := acquireFunctionTarget(functionName, ownerID)
+	if err != nil {
+		var lookupErr *replicaLookupError
+		if errors.As(err, &lookupErr) {
+			http.Error(w, fmt.Sprintf("Function not found or not running: %v", err), http.StatusNotFound)
+			return
 		}
+		http.Error(w, fmt.Sprintf("Function container not reachable: %v", err), http.StatusServiceUnavailable)
+		return
 	}
+	releaseReplica(containerID)
 
-	// Copy status code
-	w.WriteHeader(resp.StatusCode)
-
-	// Copy response body
-	io.Copy(w, resp.Body)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"function":  functionName,
+		"container": containerID,
+		"address":   target.Address,
+	})
 }
 
 // healthCheck endpoint
@@ -329,6 +594,7 @@ func listFunctions(w http.ResponseWriter, r *http.Request) {
 				"image":     container.Image,
 				"running":   container.State == "running",
 				"created":   container.Created,
+				"metadata":  containerMetadata(container),
 			})
 		}
 	}
@@ -336,22 +602,45 @@ func listFunctions(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(functions)
 }
 
+// containerMetadata returns the user metadata a container is labelled with, e.g. its description
+func containerMetadata(container types.Container) map[string]string {
+	metadata := make(map[string]string)
+	for key, value := range container.Labels {
+		if name := strings.TrimPrefix(key, metadataLabelPrefix); name != key && name != "" {
+			metadata[name] = value
+		}
+	}
+	return metadata
+}
+
 func main() {
 	r := mux.NewRouter()
 
+	// Invocation paths are forwarded to functions as sent, so they must not be cleaned
+	r.SkipClean(true)
+
+	// Advertise the supported methods when a route rejects a method
+	r.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowed)
+
 	// Health check endpoint
 	r.HandleFunc("/health", healthCheck).Methods("GET", "OPTIONS")
 
 	// List functions endpoint
 	r.HandleFunc("/functions", listFunctions).Methods("GET", "OPTIONS")
 
+	// Discovery endpoint used by the controller's readiness probe
+	r.HandleFunc("/discover/{function}", discoverFunction).Methods("GET", "OPTIONS")
+
 	// Proxy endpoint for function invocation
-	r.HandleFunc("/function/{function}", proxyRequest).Methods("GET", "POST", "PUT", "DELETE", "OPTIONS")
-	r.HandleFunc("/function/{function}/{path:.*}", proxyRequest).Methods("GET", "POST", "PUT", "DELETE", "OPTIONS")
+	r.HandleFunc("/function/{function}", proxyRequest).Methods(withOptions(invocationMethods)...)
+	r.HandleFunc("/function/{function}/{path:.*}", proxyRequest).Methods(withOptions(invocationMethods)...)
+
+	// Accept HTTP/2 cleartext (h2c) alongside HTTP/1.1 so gRPC calls can be proxied
+	handler := h2c.NewHandler(r, &http2.Server{})
 
 	// Start server
 	log.Printf("Starting reverse proxy server on port %s", proxyPort)
-	if err := http.ListenAndServe(fmt.Sprintf(":%s", proxyPort), r); err != nil {
+	if err := http.ListenAndServe(fmt.Sprintf(":%s", proxyPort), handler); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
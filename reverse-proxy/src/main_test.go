@@ -0,0 +1,32 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRawSubPath(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{"/function/hello", ""},
+		{"/function/hello/", "/"},
+		{"/function/hello/items", "/items"},
+		{"/function/hello/items/", "/items/"},
+		{"/function/hello/files/a%2Fb", "/files/a%2Fb"},
+		{"/function/hello/hello%20world", "/hello%20world"},
+		{"/function/hello/files/a%252Fb", "/files/a%252Fb"},
+		{"/function/hello/a%2Fb/c%20d/", "/a%2Fb/c%20d/"},
+		{"/function/hello?name=world", ""},
+		{"/function/hello/search?q=a%2Fb", "/search"},
+		{"/function/hello/?q=1", "/"},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", test.target, nil)
+		if got := rawSubPath(r); got != test.want {
+			t.Errorf("rawSubPath(%q) = %q, want %q", test.target, got, test.want)
+		}
+	}
+}